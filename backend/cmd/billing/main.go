@@ -0,0 +1,62 @@
+// Command billing runs one membership billing cycle: it renews subscriptions
+// that are due, retries failed renewals on the dunning schedule and expires
+// memberships that stayed suspended, then pushes the changes to members' wallet
+// passes. Schedule it (e.g. hourly); a run that overlaps another exits
+// without charging anyone.
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"golf-ezz-backend/internal/config"
+	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/features/giftcards"
+	"golf-ezz-backend/internal/features/memberships"
+	"golf-ezz-backend/internal/features/passes"
+	"golf-ezz-backend/internal/features/payments"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	// Load environment variables
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using system environment variables")
+	}
+
+	// Initialize database connection
+	cfg := config.Load()
+	if err := database.Connect(cfg); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+
+	// Register payment providers
+	payments.Register(payments.NewLocalProvider())
+	payments.Register(giftcards.NewGiftCardProvider(database.DB))
+	payments.Register(giftcards.NewWalletProvider(database.DB))
+
+	summary, err := memberships.RunBilling(context.Background(), database.DB, cfg, time.Now())
+	if errors.Is(err, memberships.ErrBillingInProgress) {
+		log.Println("Another billing run is in progress; nothing to do")
+		return
+	}
+	if err != nil {
+		log.Fatalf("Billing run failed: %v", err)
+	}
+
+	log.Printf("Billing run complete: %d renewed, %d failed, %d suspended, %d expired, %d cancelled",
+		summary.Renewed, summary.Failed, summary.Suspended, summary.Expired, summary.Cancelled)
+	for _, message := range summary.Errors {
+		log.Printf("Billing error: %s", message)
+	}
+
+	pushed, err := passes.PushUpdates(context.Background(), database.DB, cfg)
+	if err != nil {
+		log.Fatalf("Membership card updates failed: %v", err)
+	}
+	log.Printf("Membership card updates complete: %d passes updated", pushed)
+}
@@ -0,0 +1,56 @@
+// Command expiry runs the nightly expiry job: it ends subscriptions cancelled
+// at the end of their period, expires memberships that stayed suspended,
+// lapses members past their expiry date, pushes the changes to members' wallet
+// passes and expires old loyalty points. Schedule it nightly from a single host.
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"golf-ezz-backend/internal/config"
+	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/features/loyalty"
+	"golf-ezz-backend/internal/features/memberships"
+	"golf-ezz-backend/internal/features/passes"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	// Load environment variables
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using system environment variables")
+	}
+
+	// Initialize database connection
+	cfg := config.Load()
+	if err := database.Connect(cfg); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+
+	summary, err := memberships.RunExpiry(database.DB, cfg, time.Now())
+	if err != nil {
+		log.Fatalf("Expiry run failed: %v", err)
+	}
+
+	log.Printf("Expiry run complete: %d cancelled, %d expired, %d lapsed",
+		summary.Cancelled, summary.Expired, summary.Lapsed)
+	for _, message := range summary.Errors {
+		log.Printf("Expiry error: %s", message)
+	}
+
+	pushed, err := passes.PushUpdates(context.Background(), database.DB, cfg)
+	if err != nil {
+		log.Fatalf("Membership card updates failed: %v", err)
+	}
+	log.Printf("Membership card updates complete: %d passes updated", pushed)
+
+	points, err := loyalty.ExpirePoints(database.DB, time.Now())
+	if err != nil {
+		log.Fatalf("Points expiry failed: %v", err)
+	}
+	log.Printf("Points expiry complete: %d points expired", points)
+}
@@ -0,0 +1,58 @@
+// Command ledgercheck verifies the revenue ledger: every entry balances, every
+// payment, refund, booking charge and stored-value movement has been posted,
+// and the gift card and wallet liabilities match the balances held. It exits
+// non-zero when it finds a problem, so it can run from a scheduler or CI job.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"golf-ezz-backend/internal/config"
+	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/features/ledger"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	since := flag.String("since", "", "only check records created from this date (YYYY-MM-DD)")
+	flag.Parse()
+
+	var from time.Time
+	if *since != "" {
+		var err error
+		if from, err = time.Parse("2006-01-02", *since); err != nil {
+			log.Fatalf("Invalid -since date: %v", err)
+		}
+	}
+
+	// Load environment variables
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using system environment variables")
+	}
+
+	// Initialize database connection
+	cfg := config.Load()
+	if err := database.Connect(cfg); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+
+	problems, err := ledger.Check(database.DB, from)
+	if err != nil {
+		log.Fatalf("Ledger check failed: %v", err)
+	}
+
+	for _, problem := range problems {
+		log.Printf("%s %s: %s", problem.Kind, problem.Reference, problem.Detail)
+	}
+	if len(problems) > 0 {
+		log.Printf("Ledger check found %d problems", len(problems))
+		database.Close()
+		os.Exit(1)
+	}
+	log.Println("Ledger check passed")
+}
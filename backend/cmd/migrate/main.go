@@ -30,21 +30,57 @@ func main() {
 
 	err = db.AutoMigrate(
 		&models.User{},
+		&models.Session{},
+		&models.RecoveryCode{},
 		&models.Course{},
 		&models.CourseCondition{},
+		&models.CourseClosure{},
+		&models.TaxProfile{},
+		&models.TaxRate{},
 		&models.TeeTimeBooking{},
 		&models.RangeBooking{},
 		&models.Payment{},
+		&models.Refund{},
+		&models.PaymentWebhookEvent{},
+		&models.Invoice{},
+		&models.InvoiceSequence{},
+		&models.GiftCard{},
+		&models.Wallet{},
+		&models.StoredValueTransaction{},
+		&models.Coupon{},
+		&models.CouponRedemption{},
+		&models.LoyaltyRule{},
+		&models.LoyaltyTier{},
+		&models.LoyaltyReward{},
+		&models.PointsAccount{},
+		&models.PointsTransaction{},
+		&models.JournalEntry{},
+		&models.JournalLine{},
+		&models.DayClose{},
+		&models.Household{},
+		&models.HouseholdMember{},
+		&models.MembershipPlan{},
+		&models.MembershipSubscription{},
+		&models.MembershipSequence{},
+		&models.MembershipPass{},
+		&models.PassRegistration{},
 		&models.Review{},
 		&models.Notification{},
 		&models.InventoryItem{},
+		&models.Sale{},
+		&models.SaleItem{},
 		&models.Analytics{},
+		&models.SystemSettings{},
 	)
 
 	if err != nil {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
 
+	if err := database.MigrateData(db); err != nil {
+		log.Fatalf("Failed to migrate data: %v", err)
+	}
+
 	log.Println("Database migrations completed successfully!")
 
 	// Create initial admin user if not exists
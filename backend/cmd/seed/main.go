@@ -7,6 +7,7 @@ import (
 	"golf-ezz-backend/internal/config"
 	"golf-ezz-backend/internal/database"
 	"golf-ezz-backend/internal/models"
+	"golf-ezz-backend/internal/money"
 
 	"github.com/joho/godotenv"
 	"gorm.io/gorm"
@@ -54,12 +55,12 @@ func seedCourses(db *gorm.DB) {
 		Par             int
 		Length          int
 		Difficulty      string
-		GreenFeeWeekday float64
-		GreenFeeWeekend float64
-		GreenFeeHoliday float64
-		CartFee         float64
-		ClubRentalFee   float64
-		RangeBallPrice  float64
+		GreenFeeWeekday money.Amount
+		GreenFeeWeekend money.Amount
+		GreenFeeHoliday money.Amount
+		CartFee         money.Amount
+		ClubRentalFee   money.Amount
+		RangeBallPrice  money.Amount
 		IsActive        bool
 	}{
 		{
@@ -73,12 +74,12 @@ func seedCourses(db *gorm.DB) {
 			Par:             72,
 			Length:          6800,
 			Difficulty:      "Championship",
-			GreenFeeWeekday: 120.00,
-			GreenFeeWeekend: 150.00,
-			GreenFeeHoliday: 175.00,
-			CartFee:         25.00,
-			ClubRentalFee:   35.00,
-			RangeBallPrice:  8.00,
+			GreenFeeWeekday: money.Cents(12000),
+			GreenFeeWeekend: money.Cents(15000),
+			GreenFeeHoliday: money.Cents(17500),
+			CartFee:         money.Cents(2500),
+			ClubRentalFee:   money.Cents(3500),
+			RangeBallPrice:  money.Cents(800),
 			IsActive:        true,
 		},
 		{
@@ -92,12 +93,12 @@ func seedCourses(db *gorm.DB) {
 			Par:             71,
 			Length:          6400,
 			Difficulty:      "Resort",
-			GreenFeeWeekday: 75.00,
-			GreenFeeWeekend: 95.00,
-			GreenFeeHoliday: 110.00,
-			CartFee:         20.00,
-			ClubRentalFee:   30.00,
-			RangeBallPrice:  6.00,
+			GreenFeeWeekday: money.Cents(7500),
+			GreenFeeWeekend: money.Cents(9500),
+			GreenFeeHoliday: money.Cents(11000),
+			CartFee:         money.Cents(2000),
+			ClubRentalFee:   money.Cents(3000),
+			RangeBallPrice:  money.Cents(600),
 			IsActive:        true,
 		},
 		{
@@ -111,12 +112,12 @@ func seedCourses(db *gorm.DB) {
 			Par:             70,
 			Length:          6200,
 			Difficulty:      "Advanced",
-			GreenFeeWeekday: 100.00,
-			GreenFeeWeekend: 120.00,
-			GreenFeeHoliday: 140.00,
-			CartFee:         22.00,
-			ClubRentalFee:   32.00,
-			RangeBallPrice:  7.00,
+			GreenFeeWeekday: money.Cents(10000),
+			GreenFeeWeekend: money.Cents(12000),
+			GreenFeeHoliday: money.Cents(14000),
+			CartFee:         money.Cents(2200),
+			ClubRentalFee:   money.Cents(3200),
+			RangeBallPrice:  money.Cents(700),
 			IsActive:        true,
 		},
 	}
@@ -172,36 +173,32 @@ func seedCourses(db *gorm.DB) {
 
 func seedUsers(db *gorm.DB) {
 	users := []struct {
-		Email          string
-		Name           string
-		Role           string
-		MembershipType *string
-		Phone          *string
-		Handicap       *float64
+		Email    string
+		Name     string
+		Role     string
+		Phone    *string
+		Handicap *float64
 	}{
 		{
-			Email:          "john.smith@example.com",
-			Name:           "John Smith",
-			Role:           "member",
-			MembershipType: stringPtr("Premium"),
-			Phone:          stringPtr("(555) 111-2222"),
-			Handicap:       float64Ptr(12.5),
+			Email:    "john.smith@example.com",
+			Name:     "John Smith",
+			Role:     "member",
+			Phone:    stringPtr("(555) 111-2222"),
+			Handicap: float64Ptr(12.5),
 		},
 		{
-			Email:          "sarah.johnson@example.com",
-			Name:           "Sarah Johnson",
-			Role:           "member",
-			MembershipType: stringPtr("Standard"),
-			Phone:          stringPtr("(555) 333-4444"),
-			Handicap:       float64Ptr(18.2),
+			Email:    "sarah.johnson@example.com",
+			Name:     "Sarah Johnson",
+			Role:     "member",
+			Phone:    stringPtr("(555) 333-4444"),
+			Handicap: float64Ptr(18.2),
 		},
 		{
-			Email:          "mike.wilson@example.com",
-			Name:           "Mike Wilson",
-			Role:           "member",
-			MembershipType: stringPtr("Premium"),
-			Phone:          stringPtr("(555) 555-6666"),
-			Handicap:       float64Ptr(8.3),
+			Email:    "mike.wilson@example.com",
+			Name:     "Mike Wilson",
+			Role:     "member",
+			Phone:    stringPtr("(555) 555-6666"),
+			Handicap: float64Ptr(8.3),
 		},
 	}
 
@@ -211,12 +208,11 @@ func seedUsers(db *gorm.DB) {
 		if result.Error != nil {
 			// Create user without complex JSONB preferences
 			user := models.User{
-				Email:          userData.Email,
-				Name:           userData.Name,
-				Role:           userData.Role,
-				MembershipType: userData.MembershipType,
-				Phone:          userData.Phone,
-				Handicap:       userData.Handicap,
+				Email:    userData.Email,
+				Name:     userData.Name,
+				Role:     userData.Role,
+				Phone:    userData.Phone,
+				Handicap: userData.Handicap,
 			}
 
 			if err := db.Create(&user).Error; err != nil {
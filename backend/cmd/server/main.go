@@ -11,7 +11,19 @@ import (
 	"golf-ezz-backend/internal/features/auth"
 	"golf-ezz-backend/internal/features/bookings"
 	"golf-ezz-backend/internal/features/courses"
+	"golf-ezz-backend/internal/features/giftcards"
+	"golf-ezz-backend/internal/features/households"
+	"golf-ezz-backend/internal/features/ledger"
+	"golf-ezz-backend/internal/features/loyalty"
+	"golf-ezz-backend/internal/features/memberships"
+	"golf-ezz-backend/internal/features/passes"
+	"golf-ezz-backend/internal/features/payments"
+	"golf-ezz-backend/internal/features/promotions"
+	"golf-ezz-backend/internal/features/proshop"
+	"golf-ezz-backend/internal/features/reconciliation"
+	"golf-ezz-backend/internal/features/taxes"
 	"golf-ezz-backend/internal/middleware"
+	"golf-ezz-backend/internal/money"
 
 	"github.com/gin-gonic/gin"
 )
@@ -38,6 +50,9 @@ import (
 func main() {
 	// Load configuration
 	cfg := config.Load()
+	if !money.ValidCurrency(cfg.Payment.Currency) {
+		log.Fatalf("Unsupported PAYMENT_CURRENCY %q", cfg.Payment.Currency)
+	}
 
 	// Connect to database
 	if err := database.Connect(cfg); err != nil {
@@ -50,6 +65,13 @@ func main() {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
+	// Register payment providers
+	payments.Register(payments.NewLocalProvider())
+	payments.Register(payments.NewCashProvider())
+	payments.Register(giftcards.NewGiftCardProvider(database.DB))
+	payments.Register(giftcards.NewWalletProvider(database.DB))
+	payments.Register(loyalty.NewPointsProvider(database.DB, cfg))
+
 	// Set Gin mode
 	if !cfg.App.Debug {
 		gin.SetMode(gin.ReleaseMode)
@@ -106,12 +128,39 @@ func setupPublicRoutes(router *gin.RouterGroup, cfg *config.Config) {
 	authHandler := auth.NewAuthHandler(cfg)
 	router.POST("/auth/register", authHandler.Register)
 	router.POST("/auth/login", authHandler.Login)
+	router.POST("/auth/login/2fa", authHandler.LoginTwoFactor)
+	router.POST("/auth/login/2fa/setup", authHandler.LoginTwoFactorSetup)
+	router.POST("/auth/login/2fa/confirm", authHandler.LoginTwoFactorConfirm)
+	router.POST("/auth/google", authHandler.GoogleLogin)
+	router.POST("/auth/refresh", authHandler.Refresh)
+	router.POST("/auth/forgot-password", authHandler.ForgotPassword)
+	router.POST("/auth/reset-password", authHandler.ResetPassword)
+	router.POST("/auth/verify-email", authHandler.VerifyEmail)
 
 	// Course routes (public)
 	courseHandler := courses.NewCourseHandler()
 	router.GET("/courses", courseHandler.GetCourses)
 	router.GET("/courses/:id", courseHandler.GetCourse)
-	router.GET("/courses/:id/availability", bookings.NewBookingHandler().GetAvailableTimeSlots)
+	router.GET("/courses/:id/closures", courseHandler.GetCourseClosures)
+	bookingHandler := bookings.NewBookingHandler(cfg)
+	router.GET("/courses/:id/availability", bookingHandler.GetAvailableTimeSlots)
+	router.GET("/courses/:id/quote", bookingHandler.GetQuote)
+	router.GET("/availability/search", bookingHandler.SearchAvailability)
+
+	// Membership plans (public)
+	membershipHandler := memberships.NewMembershipHandler(cfg)
+	router.GET("/membership-plans", membershipHandler.GetPlans)
+
+	// Payment provider webhooks (authenticated by signature)
+	router.POST("/webhooks/payments/:provider", payments.NewPaymentHandler(cfg).HandleWebhook)
+
+	// Apple Wallet web service (authenticated by pass token)
+	passHandler := passes.NewPassHandler(cfg)
+	router.POST("/passes/v1/devices/:device_id/registrations/:pass_type_id/:serial", passHandler.RegisterDevice)
+	router.DELETE("/passes/v1/devices/:device_id/registrations/:pass_type_id/:serial", passHandler.UnregisterDevice)
+	router.GET("/passes/v1/devices/:device_id/registrations/:pass_type_id", passHandler.GetUpdatedPasses)
+	router.GET("/passes/v1/passes/:pass_type_id/:serial", passHandler.GetLatestPass)
+	router.POST("/passes/v1/log", passHandler.LogMessages)
 
 	// Health check
 	router.GET("/health", func(c *gin.Context) {
@@ -127,17 +176,61 @@ func setupProtectedRoutes(router *gin.RouterGroup, cfg *config.Config) {
 	authHandler := auth.NewAuthHandler(cfg)
 	router.GET("/auth/profile", authHandler.GetProfile)
 	router.PUT("/auth/profile", authHandler.UpdateProfile)
+	router.POST("/auth/logout", authHandler.Logout)
+	router.POST("/auth/logout-all", authHandler.LogoutAll)
+	router.POST("/auth/resend-verification", authHandler.ResendVerification)
+	router.POST("/auth/2fa/setup", authHandler.SetupTwoFactor)
+	router.POST("/auth/2fa/confirm", authHandler.ConfirmTwoFactor)
+	router.POST("/auth/2fa/disable", authHandler.DisableTwoFactor)
+	router.POST("/auth/2fa/recovery-codes", authHandler.RegenerateRecoveryCodes)
 
 	// User booking routes
-	bookingHandler := bookings.NewBookingHandler()
+	bookingHandler := bookings.NewBookingHandler(cfg)
 	router.GET("/my/bookings", bookingHandler.GetMyBookings)
-	router.POST("/bookings/tee-time", bookingHandler.CreateTeeTimeBooking)
+	router.POST("/bookings/tee-time", middleware.VerifiedEmailMiddleware(), bookingHandler.CreateTeeTimeBooking)
 	router.DELETE("/bookings/:id", bookingHandler.CancelBooking)
 
 	// Range booking routes
 	router.GET("/my/range-bookings", bookingHandler.GetMyRangeBookings)
-	router.POST("/bookings/range", bookingHandler.CreateRangeBooking)
+	router.POST("/bookings/range", middleware.VerifiedEmailMiddleware(), bookingHandler.CreateRangeBooking)
 	router.PUT("/range-bookings/:id/usage", bookingHandler.UpdateBucketUsage)
+
+	// Payment routes
+	paymentHandler := payments.NewPaymentHandler(cfg)
+	router.GET("/my/payments", paymentHandler.GetMyPayments)
+	router.POST("/payments", middleware.VerifiedEmailMiddleware(), paymentHandler.PayBooking)
+	router.GET("/payments/:id", paymentHandler.GetPayment)
+	router.GET("/payments/:id/receipt.pdf", paymentHandler.GetReceiptPDF)
+
+	// Gift card and wallet routes
+	giftCardHandler := giftcards.NewGiftCardHandler(cfg)
+	router.GET("/gift-cards/balance", giftCardHandler.CheckBalance)
+	router.GET("/my/wallet", giftCardHandler.GetMyWallet)
+	router.POST("/my/wallet/load", giftCardHandler.LoadGiftCard)
+
+	// Membership subscription routes
+	membershipHandler := memberships.NewMembershipHandler(cfg)
+	router.GET("/my/subscription", membershipHandler.GetMySubscription)
+	router.POST("/my/subscription", membershipHandler.Subscribe)
+	router.PUT("/my/subscription/plan", membershipHandler.ChangeMyPlan)
+	router.PUT("/my/subscription/payment-method", membershipHandler.UpdateMyPaymentMethod)
+	router.DELETE("/my/subscription", membershipHandler.CancelMySubscription)
+	router.GET("/my/membership-card", passes.NewPassHandler(cfg).GetMyMembershipCard)
+
+	// Household routes
+	householdHandler := households.NewHouseholdHandler()
+	router.GET("/my/household", householdHandler.GetMyHousehold)
+	router.POST("/my/household", householdHandler.CreateHousehold)
+	router.POST("/my/household/members", householdHandler.AddMember)
+	router.PUT("/my/household/members/:user_id", householdHandler.UpdateMember)
+	router.DELETE("/my/household/members/:user_id", householdHandler.RemoveMember)
+	router.GET("/my/household/bookings", householdHandler.GetHouseholdBookings)
+
+	// Loyalty points routes
+	loyaltyHandler := loyalty.NewLoyaltyHandler(cfg)
+	router.GET("/my/points", loyaltyHandler.GetMyPoints)
+	router.GET("/loyalty/rewards", loyaltyHandler.GetRewards)
+	router.POST("/my/points/rewards/:id", loyaltyHandler.RedeemReward)
 }
 
 // setupAdminRoutes sets up admin API routes
@@ -148,21 +241,110 @@ func setupAdminRoutes(router *gin.RouterGroup, cfg *config.Config) {
 	router.PUT("/courses/:id", courseHandler.UpdateCourse)
 	router.DELETE("/courses/:id", courseHandler.DeleteCourse)
 	router.PUT("/courses/:id/conditions", courseHandler.UpdateCourseConditions)
+	router.POST("/courses/:id/closures", courseHandler.CreateCourseClosure)
+	router.DELETE("/courses/:id/closures/:closure_id", courseHandler.DeleteCourseClosure)
 
 	// User management (admin only)
-	adminHandler := admin.NewAdminHandler()
+	adminHandler := admin.NewAdminHandler(cfg)
 	router.GET("/users", adminHandler.GetAllUsers)
 	router.GET("/users/:id", adminHandler.GetUserByID)
 	router.PUT("/users/:id/role", adminHandler.UpdateUserRole)
+	router.PUT("/users/:id/status", adminHandler.UpdateUserStatus)
+	router.PUT("/users/:id/two-factor", adminHandler.UpdateUserTwoFactor)
 
 	// Booking management (admin only)
 	router.GET("/bookings", adminHandler.GetAllBookings)
 	router.GET("/bookings/by-date", adminHandler.GetBookingsByDate)
 	router.PUT("/bookings/:id/status", adminHandler.UpdateBookingStatus)
 
+	// Payments and refunds (admin only)
+	paymentHandler := payments.NewPaymentHandler(cfg)
+	router.GET("/payments/:id/refunds", paymentHandler.GetPaymentRefunds)
+	router.POST("/payments/:id/refunds", paymentHandler.RefundPayment)
+	router.GET("/invoices", paymentHandler.GetInvoices)
+	router.GET("/invoices/:id/pdf", paymentHandler.GetInvoicePDF)
+	router.POST("/invoices/:id/regenerate", paymentHandler.RegenerateInvoice)
+	router.POST("/invoices/:id/void", paymentHandler.VoidInvoice)
+	router.GET("/webhooks/payments", paymentHandler.GetWebhookEvents)
+	router.POST("/webhooks/payments/replay", paymentHandler.ReplayWebhookEvents)
+
+	// Gift cards and wallets (admin only)
+	giftCardHandler := giftcards.NewGiftCardHandler(cfg)
+	router.GET("/gift-cards", giftCardHandler.GetGiftCards)
+	router.POST("/gift-cards", giftCardHandler.IssueGiftCard)
+	router.GET("/gift-cards/:id", giftCardHandler.GetGiftCard)
+	router.POST("/gift-cards/:id/adjust", giftCardHandler.AdjustGiftCard)
+	router.POST("/gift-cards/:id/void", giftCardHandler.VoidGiftCard)
+	router.GET("/users/:id/wallet", giftCardHandler.GetUserWallet)
+	router.POST("/users/:id/wallet/adjust", giftCardHandler.AdjustWallet)
+
+	// Membership plans, billing and households (admin only)
+	membershipHandler := memberships.NewMembershipHandler(cfg)
+	router.POST("/membership-plans", membershipHandler.CreatePlan)
+	router.PUT("/membership-plans/:id", membershipHandler.UpdatePlan)
+	router.POST("/membership-plans/:id/archive", membershipHandler.ArchivePlan)
+	router.GET("/subscriptions", membershipHandler.GetSubscriptions)
+	router.POST("/billing/run", membershipHandler.RunBillingNow)
+	router.POST("/memberships/expiry/run", membershipHandler.RunExpiryNow)
+	router.GET("/households", households.NewHouseholdHandler().GetHouseholds)
+	router.POST("/check-in", passes.NewPassHandler(cfg).CheckIn)
+
+	// Loyalty programme (admin only)
+	loyaltyHandler := loyalty.NewLoyaltyHandler(cfg)
+	router.GET("/loyalty/rules", loyaltyHandler.GetRules)
+	router.PUT("/loyalty/rules/:activity", loyaltyHandler.SetRule)
+	router.GET("/loyalty/tiers", loyaltyHandler.GetTiers)
+	router.POST("/loyalty/tiers", loyaltyHandler.CreateTier)
+	router.PUT("/loyalty/tiers/:id", loyaltyHandler.UpdateTier)
+	router.GET("/loyalty/rewards", loyaltyHandler.GetAllRewards)
+	router.POST("/loyalty/rewards", loyaltyHandler.CreateReward)
+	router.PUT("/loyalty/rewards/:id", loyaltyHandler.UpdateReward)
+	router.POST("/users/:id/points/adjust", loyaltyHandler.AdjustPoints)
+
+	// Promo codes (admin only)
+	couponHandler := promotions.NewCouponHandler()
+	router.GET("/coupons", couponHandler.GetCoupons)
+	router.POST("/coupons", couponHandler.CreateCoupon)
+	router.PUT("/coupons/:id", couponHandler.UpdateCoupon)
+
+	// Sales tax (admin only)
+	taxHandler := taxes.NewTaxHandler()
+	router.GET("/tax-profiles", taxHandler.GetTaxProfiles)
+	router.POST("/tax-profiles", taxHandler.CreateTaxProfile)
+	router.PUT("/tax-profiles/:id", taxHandler.UpdateTaxProfile)
+	router.PUT("/courses/:id/tax-profile", taxHandler.SetCourseTaxProfile)
+
+	// Pro shop point of sale (admin only)
+	proShopHandler := proshop.NewProShopHandler(cfg)
+	router.GET("/pos/items", proShopHandler.GetInventory)
+	router.POST("/pos/items", proShopHandler.CreateInventoryItem)
+	router.PUT("/pos/items/:id", proShopHandler.UpdateInventoryItem)
+	router.GET("/pos/sales", proShopHandler.GetSales)
+	router.POST("/pos/sales", proShopHandler.CreateSale)
+	router.GET("/pos/sales/:id", proShopHandler.GetSale)
+	router.POST("/pos/sales/:id/payments", proShopHandler.PaySale)
+	router.POST("/pos/sales/:id/void", proShopHandler.VoidSale)
+	router.POST("/pos/sales/:id/returns", proShopHandler.ReturnItems)
+
+	// End-of-day reconciliation (admin only)
+	reconciliationHandler := reconciliation.NewReconciliationHandler()
+	router.GET("/courses/:id/day-close", reconciliationHandler.GetDayClose)
+	router.PUT("/courses/:id/day-close", reconciliationHandler.RecordCounts)
+	router.POST("/courses/:id/day-close/lock", reconciliationHandler.LockDay)
+	router.POST("/courses/:id/day-close/adjustments", reconciliationHandler.PostAdjustment)
+
+	// Revenue ledger (admin only)
+	ledgerHandler := ledger.NewLedgerHandler()
+	router.GET("/ledger/entries", ledgerHandler.GetEntries)
+	router.POST("/ledger/entries/:id/reverse", ledgerHandler.ReverseEntry)
+	router.GET("/ledger/balances", ledgerHandler.GetBalances)
+	router.GET("/ledger/check", ledgerHandler.RunCheck)
+
 	// Analytics and reporting (admin only)
 	router.GET("/dashboard/stats", adminHandler.GetDashboardStats)
 	router.GET("/reports/revenue", adminHandler.GetRevenueReport)
+	router.GET("/reports/coupons", couponHandler.GetCouponReport)
+	router.GET("/reports/tax", taxHandler.GetTaxReport)
 	router.GET("/system/logs", adminHandler.GetSystemLogs)
 	router.GET("/export", adminHandler.ExportData)
 }
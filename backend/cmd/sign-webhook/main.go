@@ -0,0 +1,54 @@
+// Command sign-webhook signs a payment webhook fixture so it can be posted to
+// a local server without a live provider.
+//
+// Usage:
+//
+//	go run ./cmd/sign-webhook -payment <payment-id> testdata/webhooks/payment_captured.json
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"golf-ezz-backend/internal/config"
+	"golf-ezz-backend/internal/features/payments"
+)
+
+const placeholderPaymentID = "00000000-0000-0000-0000-000000000000"
+
+func main() {
+	provider := flag.String("provider", "local", "payment provider name")
+	paymentID := flag.String("payment", "", "payment ID substituted into the fixture")
+	url := flag.String("url", "http://localhost:8080/api/v1/webhooks/payments/", "webhook endpoint base URL")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		log.Fatal("Usage: sign-webhook [-provider name] [-payment id] <fixture.json>")
+	}
+
+	cfg := config.Load()
+	if cfg.Payment.WebhookSecret == "" {
+		log.Fatal("PAYMENT_WEBHOOK_SECRET is not set")
+	}
+
+	body, err := os.ReadFile(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("Failed to read fixture: %v", err)
+	}
+
+	payload := string(body)
+	if *paymentID != "" {
+		payload = strings.ReplaceAll(payload, placeholderPaymentID, *paymentID)
+	}
+
+	signature := payments.SignPayload(cfg.Payment.WebhookSecret, time.Now().Unix(), []byte(payload))
+
+	fmt.Printf("curl -X POST '%s%s' \\\n", *url, *provider)
+	fmt.Printf("  -H 'Content-Type: application/json' \\\n")
+	fmt.Printf("  -H '%s: %s' \\\n", payments.SignatureHeader, signature)
+	fmt.Printf("  --data-raw '%s'\n", strings.TrimSpace(payload))
+}
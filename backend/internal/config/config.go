@@ -6,18 +6,24 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
 
 // Config holds all configuration for our application
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Redis    RedisConfig
-	JWT      JWTConfig
-	Google   GoogleConfig
-	App      AppConfig
+	Server     ServerConfig
+	Database   DatabaseConfig
+	Redis      RedisConfig
+	JWT        JWTConfig
+	Google     GoogleConfig
+	Payment    PaymentConfig
+	Membership MembershipConfig
+	Loyalty    LoyaltyConfig
+	Passes     PassConfig
+	Mail       MailConfig
+	App        AppConfig
 }
 
 // ServerConfig holds server configuration
@@ -47,13 +53,70 @@ type RedisConfig struct {
 
 // JWTConfig holds JWT configuration
 type JWTConfig struct {
-	Secret string
+	Secret        string
+	AccessMinutes int    // lifetime of an access token
+	RefreshDays   int    // a session not refreshed for this long signs out
+	TOTPIssuer    string // account issuer shown in authenticator apps
 }
 
 // GoogleConfig holds Google OAuth configuration
 type GoogleConfig struct {
-	ClientID     string
+	ClientID     string // audience of the ID tokens Google sign-in accepts
 	ClientSecret string
+	JWKSURL      string // Google's signing keys; point at a local key server in tests
+}
+
+// PaymentConfig holds payment processing configuration
+type PaymentConfig struct {
+	Provider         string
+	Currency         string
+	WebhookSecret    string
+	WebhookTolerance int // seconds
+	GiftCardValidity int // months a new gift card stays redeemable
+}
+
+// MembershipConfig holds membership billing configuration
+type MembershipConfig struct {
+	DunningSchedule []int // days after a failed renewal on which the charge is retried
+	SuspensionDays  int   // days a suspended membership is kept before it expires
+}
+
+// LoyaltyConfig holds loyalty points configuration
+type LoyaltyConfig struct {
+	PointValue   int // cents a point is worth when paying with points
+	ExpiryMonths int // months earned points stay redeemable
+	TierMonths   int // months of earning that count towards a tier
+}
+
+// PassConfig holds digital membership card configuration. Apple and Google
+// Wallet passes are each offered only when their credentials are set.
+type PassConfig struct {
+	OrganizationName string
+	BarcodeSecret    string // signs the member barcode scanned at check-in; cards are off without it
+
+	AppleTeamID        string
+	ApplePassTypeID    string
+	AppleCertFile      string // PEM pass type ID certificate, also used for push updates
+	AppleKeyFile       string // PEM private key of the certificate
+	AppleWWDRFile      string // PEM Apple WWDR intermediate certificate
+	AppleWebServiceURL string // public base URL of the pass web service, e.g. https://example.com/api/v1/passes
+	AppleImagesDir     string // optional directory of pass images such as icon.png and logo.png
+	ApplePushURL       string // APNs endpoint
+
+	GoogleIssuerID string
+	GoogleClassID  string // suffix of the pass class, created on first save
+	GoogleKeyFile  string // service account JSON key
+}
+
+// MailConfig holds outgoing email configuration
+type MailConfig struct {
+	Driver       string // smtp, or file for local development
+	From         string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	Dir          string // where the file driver writes messages; empty logs them instead
 }
 
 // AppConfig holds general application configuration
@@ -61,6 +124,7 @@ type AppConfig struct {
 	Environment string
 	Debug       bool
 	LogLevel    string
+	FrontendURL string // base URL of the web app, used in emailed links
 }
 
 // Load loads configuration from environment variables
@@ -90,16 +154,61 @@ func Load() *Config {
 			DB:       getEnvAsInt("REDIS_DB", 0),
 		},
 		JWT: JWTConfig{
-			Secret: getEnv("JWT_SECRET", "your-secret-key"),
+			Secret:        getEnv("JWT_SECRET", "your-secret-key"),
+			AccessMinutes: getEnvAsInt("JWT_ACCESS_MINUTES", 15),
+			RefreshDays:   getEnvAsInt("JWT_REFRESH_DAYS", 30),
+			TOTPIssuer:    getEnv("TOTP_ISSUER", "Golf Ezz"),
 		},
 		Google: GoogleConfig{
 			ClientID:     getEnv("GOOGLE_CLIENT_ID", ""),
 			ClientSecret: getEnv("GOOGLE_CLIENT_SECRET", ""),
+			JWKSURL:      getEnv("GOOGLE_JWKS_URL", "https://www.googleapis.com/oauth2/v3/certs"),
+		},
+		Payment: PaymentConfig{
+			Provider:         getEnv("PAYMENT_PROVIDER", "local"),
+			Currency:         getEnv("PAYMENT_CURRENCY", "USD"),
+			WebhookSecret:    getEnv("PAYMENT_WEBHOOK_SECRET", ""),
+			WebhookTolerance: getEnvAsInt("PAYMENT_WEBHOOK_TOLERANCE", 300),
+			GiftCardValidity: getEnvAsInt("GIFT_CARD_VALIDITY_MONTHS", 60),
+		},
+		Membership: MembershipConfig{
+			DunningSchedule: getEnvAsIntSlice("MEMBERSHIP_DUNNING_DAYS", []int{1, 3, 7}),
+			SuspensionDays:  getEnvAsInt("MEMBERSHIP_SUSPENSION_DAYS", 30),
+		},
+		Loyalty: LoyaltyConfig{
+			PointValue:   getEnvAsInt("LOYALTY_POINT_VALUE_CENTS", 1),
+			ExpiryMonths: getEnvAsInt("LOYALTY_POINTS_EXPIRY_MONTHS", 12),
+			TierMonths:   getEnvAsInt("LOYALTY_TIER_MONTHS", 12),
+		},
+		Passes: PassConfig{
+			OrganizationName:   getEnv("PASS_ORGANIZATION_NAME", "Golf Ezz"),
+			BarcodeSecret:      getEnv("PASS_BARCODE_SECRET", ""),
+			AppleTeamID:        getEnv("APPLE_PASS_TEAM_ID", ""),
+			ApplePassTypeID:    getEnv("APPLE_PASS_TYPE_ID", ""),
+			AppleCertFile:      getEnv("APPLE_PASS_CERT_FILE", ""),
+			AppleKeyFile:       getEnv("APPLE_PASS_KEY_FILE", ""),
+			AppleWWDRFile:      getEnv("APPLE_WWDR_CERT_FILE", ""),
+			AppleWebServiceURL: getEnv("APPLE_PASS_WEB_SERVICE_URL", ""),
+			AppleImagesDir:     getEnv("APPLE_PASS_IMAGES_DIR", ""),
+			ApplePushURL:       getEnv("APPLE_PASS_PUSH_URL", "https://api.push.apple.com"),
+			GoogleIssuerID:     getEnv("GOOGLE_WALLET_ISSUER_ID", ""),
+			GoogleClassID:      getEnv("GOOGLE_WALLET_CLASS_ID", "membership"),
+			GoogleKeyFile:      getEnv("GOOGLE_WALLET_KEY_FILE", ""),
+		},
+		Mail: MailConfig{
+			Driver:       getEnv("MAIL_DRIVER", "file"),
+			From:         getEnv("MAIL_FROM", "Golf Ezz <no-reply@golfezz.local>"),
+			SMTPHost:     getEnv("SMTP_HOST", ""),
+			SMTPPort:     getEnv("SMTP_PORT", "587"),
+			SMTPUsername: getEnv("SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+			Dir:          getEnv("MAIL_DIR", ""),
 		},
 		App: AppConfig{
 			Environment: getEnv("APP_ENV", "development"),
 			Debug:       getEnvAsBool("APP_DEBUG", true),
 			LogLevel:    getEnv("LOG_LEVEL", "info"),
+			FrontendURL: getEnv("FRONTEND_URL", "http://localhost:3000"),
 		},
 	}
 
@@ -140,3 +249,20 @@ func getEnvAsBool(name string, defaultVal bool) bool {
 	}
 	return defaultVal
 }
+
+func getEnvAsIntSlice(name string, defaultVal []int) []int {
+	valueStr := getEnv(name, "")
+	if valueStr == "" {
+		return defaultVal
+	}
+
+	var values []int
+	for _, part := range strings.Split(valueStr, ",") {
+		value, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return defaultVal
+		}
+		values = append(values, value)
+	}
+	return values
+}
@@ -47,25 +47,96 @@ func Migrate() error {
 
 	err := DB.AutoMigrate(
 		&models.User{},
+		&models.Session{},
+		&models.RecoveryCode{},
 		&models.Course{},
 		&models.CourseCondition{},
+		&models.CourseClosure{},
+		&models.TaxProfile{},
+		&models.TaxRate{},
 		&models.TeeTimeBooking{},
 		&models.RangeBooking{},
 		&models.Payment{},
+		&models.Refund{},
+		&models.PaymentWebhookEvent{},
+		&models.Invoice{},
+		&models.InvoiceSequence{},
+		&models.GiftCard{},
+		&models.Wallet{},
+		&models.StoredValueTransaction{},
+		&models.Coupon{},
+		&models.CouponRedemption{},
+		&models.LoyaltyRule{},
+		&models.LoyaltyTier{},
+		&models.LoyaltyReward{},
+		&models.PointsAccount{},
+		&models.PointsTransaction{},
+		&models.JournalEntry{},
+		&models.JournalLine{},
+		&models.DayClose{},
+		&models.Household{},
+		&models.HouseholdMember{},
+		&models.MembershipPlan{},
+		&models.MembershipSubscription{},
+		&models.MembershipSequence{},
+		&models.MembershipPass{},
+		&models.PassRegistration{},
 		&models.Review{},
 		&models.Notification{},
 		&models.InventoryItem{},
+		&models.Sale{},
+		&models.SaleItem{},
 		&models.Analytics{},
+		&models.SystemSettings{},
 	)
 
 	if err != nil {
 		return fmt.Errorf("failed to migrate database: %w", err)
 	}
 
+	if err := MigrateData(DB); err != nil {
+		return fmt.Errorf("failed to migrate data: %w", err)
+	}
+
 	log.Println("Database migrations completed successfully")
 	return nil
 }
 
+// MigrateData moves existing rows onto columns that replaced old ones and
+// adds the constraints AutoMigrate cannot express. Run it after AutoMigrate,
+// which adds columns but never drops them.
+func MigrateData(db *gorm.DB) error {
+	// Coupons kept percentages and fixed amounts in one float column
+	if db.Migrator().HasColumn(&models.Coupon{}, "discount_value") {
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(`UPDATE coupons SET
+				discount_percent = CASE WHEN discount_type = 'percentage' THEN discount_value ELSE 0 END,
+				discount_amount = CASE WHEN discount_type = 'fixed' THEN ROUND(discount_value::numeric, 2) ELSE 0 END`).Error; err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&models.Coupon{}, "discount_value")
+		}); err != nil {
+			return err
+		}
+	}
+
+	// A payment has at most one live invoice. Duplicates issued before this
+	// was enforced are voided, keeping the first.
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`UPDATE invoices SET status = 'void', voided_at = NOW(), void_reason = 'Duplicate invoice for the payment'
+			WHERE id IN (
+				SELECT id FROM (
+					SELECT id, ROW_NUMBER() OVER (PARTITION BY payment_id ORDER BY issued_at, number) AS position
+					FROM invoices WHERE status = 'issued' AND deleted_at IS NULL
+				) live WHERE position > 1
+			)`).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_invoices_issued_payment
+			ON invoices (payment_id) WHERE status = 'issued' AND deleted_at IS NULL`).Error
+	})
+}
+
 // GetDB returns the database instance
 func GetDB() *gorm.DB {
 	return DB
@@ -2,22 +2,35 @@
 package admin
 
 import (
+	"fmt"
+	"log"
 	"net/http"
 	"time"
 
+	"golf-ezz-backend/internal/config"
 	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/features/auth"
+	"golf-ezz-backend/internal/features/ledger"
+	"golf-ezz-backend/internal/features/loyalty"
+	"golf-ezz-backend/internal/features/payments"
+	"golf-ezz-backend/internal/features/promotions"
+	"golf-ezz-backend/internal/features/taxes"
 	"golf-ezz-backend/internal/models"
+	"golf-ezz-backend/internal/money"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 // AdminHandler handles admin-specific requests
-type AdminHandler struct{}
+type AdminHandler struct {
+	config *config.Config
+}
 
 // NewAdminHandler creates a new admin handler
-func NewAdminHandler() *AdminHandler {
-	return &AdminHandler{}
+func NewAdminHandler(cfg *config.Config) *AdminHandler {
+	return &AdminHandler{config: cfg}
 }
 
 // GetAllUsers returns all users (admin only)
@@ -96,6 +109,94 @@ func (h *AdminHandler) UpdateUserRole(c *gin.Context) {
 	c.JSON(http.StatusOK, user)
 }
 
+// UpdateUserStatus activates, deactivates or suspends a user (admin only). A
+// user who is no longer active is signed out everywhere.
+func (h *AdminHandler) UpdateUserStatus(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req struct {
+		Status string `json:"status" binding:"required,oneof=active inactive suspended"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("status", req.Status).Error; err != nil {
+			return err
+		}
+		if req.Status == "active" {
+			return nil
+		}
+		_, err := auth.RevokeSessions(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user status"})
+		return
+	}
+
+	user.Password = "" // Remove password from response
+	c.JSON(http.StatusOK, user)
+}
+
+// UpdateUserTwoFactor requires or stops requiring a user to sign in with
+// two-factor authentication (admin only). A user made to use it who has not
+// set it up is signed out, and enrolls at their next login.
+func (h *AdminHandler) UpdateUserTwoFactor(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req struct {
+		Required *bool `json:"required" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("two_factor_required", *req.Required).Error; err != nil {
+			return err
+		}
+		if !*req.Required || user.TwoFactorEnabled {
+			return nil
+		}
+		_, err := auth.RevokeSessions(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update two-factor requirement"})
+		return
+	}
+
+	user.TwoFactorRequired = *req.Required
+	user.Password = "" // Remove password from response
+	c.JSON(http.StatusOK, user)
+}
+
 // GetAllBookings returns all tee time bookings (admin only)
 func (h *AdminHandler) GetAllBookings(c *gin.Context) {
 	var bookings []models.TeeTimeBooking
@@ -157,11 +258,11 @@ func (h *AdminHandler) GetDashboardStats(c *gin.Context) {
 	todayDate, _ := time.Parse("2006-01-02", today)
 	database.DB.Model(&models.TeeTimeBooking{}).Where("date = ?", todayDate).Count(&todayBookingCount)
 
-	// Revenue calculation (example)
-	var totalRevenue float64
-	database.DB.Model(&models.TeeTimeBooking{}).
-		Where("payment_status = ?", "completed").
-		Select("SUM(total_amount)").Scan(&totalRevenue)
+	// Revenue from the ledger, net of discounts, refunds and cancellations
+	totalRevenue := money.Zero
+	if revenue, err := ledger.RevenueBetween(database.DB, time.Time{}, time.Time{}); err == nil {
+		totalRevenue = revenue.Total.Net
+	}
 
 	// Recent bookings
 	var recentBookings []models.TeeTimeBooking
@@ -204,31 +305,42 @@ func (h *AdminHandler) GetRevenueReport(c *gin.Context) {
 		return
 	}
 
-	// Get bookings in date range
-	var bookings []models.TeeTimeBooking
-	if err := database.DB.Where("date BETWEEN ? AND ? AND payment_status = ?",
-		startDate, endDate, "completed").
-		Preload("Course").Find(&bookings).Error; err != nil {
+	// Revenue posted to the ledger in the period
+	revenue, err := ledger.RevenueBetween(database.DB, startDate, endDate)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve revenue data"})
 		return
 	}
 
-	// Calculate revenue by course
-	courseRevenue := make(map[string]float64)
-	totalRevenue := 0.0
+	// Tax collected on receipts issued in the period
+	taxSummary, taxTotal, err := taxes.Summarize(database.DB, startDate, endDate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tax data"})
+		return
+	}
 
-	for _, booking := range bookings {
-		courseRevenue[booking.Course.Name] += booking.TotalAmount
-		totalRevenue += booking.TotalAmount
+	courseRevenue := make(map[string]money.Amount)
+	for _, row := range revenue.Courses {
+		courseRevenue[row.CourseName] += row.Net
 	}
 
 	report := gin.H{
-		"start_date":        startDateStr,
-		"end_date":          endDateStr,
-		"total_revenue":     totalRevenue,
-		"booking_count":     len(bookings),
-		"revenue_by_course": courseRevenue,
-		"generated_at":      time.Now(),
+		"start_date":          startDateStr,
+		"end_date":            endDateStr,
+		"gross_revenue":       revenue.Total.Gross,
+		"discounts":           -revenue.Total.Discounts,
+		"refunds":             -revenue.Total.Refunds,
+		"cancellations":       -revenue.Total.Cancellations,
+		"total_revenue":       revenue.Total.Net,
+		"tax_collected":       revenue.Total.Tax,
+		"revenue_by_course":   courseRevenue,
+		"revenue_by_category": revenue.Categories,
+		"courses":             revenue.Courses,
+		"tax_summary": gin.H{
+			"taxes":     taxSummary,
+			"total_tax": taxTotal,
+		},
+		"generated_at": time.Now(),
 	}
 
 	c.JSON(http.StatusOK, report)
@@ -261,17 +373,69 @@ func (h *AdminHandler) UpdateBookingStatus(c *gin.Context) {
 		return
 	}
 
-	// Update status
+	// Update status. Refunds move money through the payment provider, so a
+	// "refunded" payment status is applied by the refund itself.
+	wasCancelled := booking.Status == "cancelled"
+	wasCompleted := booking.Status == "completed"
 	booking.Status = req.Status
-	if req.PaymentStatus != "" {
+	if req.PaymentStatus != "" && req.PaymentStatus != "refunded" {
 		booking.PaymentStatus = req.PaymentStatus
 	}
 
-	if err := database.DB.Save(&booking).Error; err != nil {
+	var adminID *uuid.UUID
+	if userID, ok := c.Get("user_id"); ok {
+		if parsed, err := uuid.Parse(fmt.Sprint(userID)); err == nil {
+			adminID = &parsed
+		}
+	}
+
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&booking).Error; err != nil {
+			return err
+		}
+		if req.Status == "completed" && !wasCompleted {
+			return loyalty.EarnForBooking(tx, h.config, &booking)
+		}
+		if req.Status != "cancelled" || wasCancelled {
+			return nil
+		}
+		return ledger.PostCancellation(tx, &models.JournalEntry{
+			Description: "Booking cancelled by the course",
+			CourseID:    &booking.CourseID,
+			UserID:      &booking.UserID,
+			BookingID:   &booking.ID,
+			PostedBy:    adminID,
+		})
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update booking"})
 		return
 	}
 
+	// Course-initiated cancellations and explicit refunds return the full balance
+	reasonCode := ""
+	if req.PaymentStatus == "refunded" {
+		reasonCode = payments.ReasonCustomerRequest
+	}
+	if req.Status == "cancelled" && !wasCancelled {
+		reasonCode = payments.ReasonCourseCancelled
+		if err := promotions.ReleaseRedemptions(database.DB, booking.ID); err != nil {
+			log.Printf("Failed to release promo code for booking %s: %v", booking.ID, err)
+		}
+	}
+	if reasonCode != "" {
+		refunds, err := payments.RefundBookingPayments(c.Request.Context(), database.DB, booking.ID, 100, reasonCode, adminID)
+		if err != nil {
+			log.Printf("Refund failed for booking %s: %v", booking.ID, err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Booking updated, but the refund could not be processed"})
+			return
+		}
+
+		// Bookings paid outside the system have nothing to refund through a provider
+		if len(refunds) == 0 && req.PaymentStatus == "refunded" {
+			database.DB.Model(&booking).Update("payment_status", "refunded")
+		}
+	}
+
 	// Load updated booking with relations
 	if err := database.DB.Preload("User").Preload("Course").First(&booking, id).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load updated booking"})
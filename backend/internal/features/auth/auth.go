@@ -2,15 +2,18 @@
 package auth
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
 	"golf-ezz-backend/internal/config"
 	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/mail"
 	"golf-ezz-backend/internal/models"
 
 	"errors"
@@ -18,6 +21,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
@@ -25,11 +29,12 @@ import (
 // AuthHandler handles authentication requests
 type AuthHandler struct {
 	config *config.Config
+	mailer mail.Mailer
 }
 
 // NewAuthHandler creates a new auth handler
 func NewAuthHandler(cfg *config.Config) *AuthHandler {
-	return &AuthHandler{config: cfg}
+	return &AuthHandler{config: cfg, mailer: mail.New(cfg)}
 }
 
 // LoginRequest represents login request payload
@@ -41,21 +46,26 @@ type LoginRequest struct {
 
 // RegisterRequest represents registration request payload
 type RegisterRequest struct {
-	Email          string `json:"email" binding:"required,email"`
-	Name           string `json:"name" binding:"required"`
-	Password       string `json:"password" binding:"required,min=6"`
-	Phone          string `json:"phone"`
-	Role           string `json:"role"`
-	Address        string `json:"address"`
-	DateOfBirth    string `json:"date_of_birth"`
+	Email       string `json:"email" binding:"required,email"`
+	Name        string `json:"name" binding:"required"`
+	Password    string `json:"password" binding:"required,min=6"`
+	Phone       string `json:"phone"`
+	Role        string `json:"role"`
+	Address     string `json:"address"`
+	DateOfBirth string `json:"date_of_birth"`
+
+	// MembershipType is no longer accepted: members enroll in a plan after
+	// registering, so it is rejected rather than silently dropped
 	MembershipType string `json:"membership_type"`
 }
 
 // LoginResponse represents login response
 type LoginResponse struct {
-	Token     string      `json:"token"`
-	User      models.User `json:"user"`
-	ExpiresAt time.Time   `json:"expires_at"`
+	Token            string      `json:"token"`
+	User             models.User `json:"user"`
+	ExpiresAt        time.Time   `json:"expires_at"`
+	RefreshToken     string      `json:"refresh_token"`
+	RefreshExpiresAt time.Time   `json:"refresh_expires_at"`
 }
 
 // Register handles user registration
@@ -65,6 +75,10 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if req.MembershipType != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "membership_type is not accepted; enroll in a membership plan after registering"})
+		return
+	}
 
 	// Check if user already exists
 	var existingUser models.User
@@ -94,12 +108,6 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		}
 	}
 
-	// Set membership type if provided
-	var membershipType *string
-	if req.MembershipType != "" {
-		membershipType = &req.MembershipType
-	}
-
 	// Set address if provided
 	var address *string
 	if req.Address != "" {
@@ -114,24 +122,14 @@ func (h *AuthHandler) Register(c *gin.Context) {
 
 	// Create user
 	user := models.User{
-		Email:          req.Email,
-		Name:           req.Name,
-		Role:           role,
-		Phone:          phone,
-		Address:        address,
-		DateOfBirth:    dateOfBirth,
-		MembershipType: membershipType,
-		Password:       string(hashedPassword),
-		Preferences: models.UserPreferences{
-			PreferredTeeTime: "morning",
-			PreferredCourses: []string{},
-			Notifications: models.NotificationSettings{
-				Email: true,
-				SMS:   false,
-				Push:  true,
-			},
-			PlayingStyle: "casual",
-		},
+		Email:       req.Email,
+		Name:        req.Name,
+		Role:        role,
+		Phone:       phone,
+		Address:     address,
+		DateOfBirth: dateOfBirth,
+		Password:    string(hashedPassword),
+		Preferences: defaultPreferences(),
 	}
 
 	if err := database.DB.Create(&user).Error; err != nil {
@@ -147,8 +145,13 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	// Generate JWT token
-	token, expiresAt, err := h.generateJWT(user)
+	// Ask the new user to confirm their address
+	if _, err := h.sendVerification(user); err != nil {
+		log.Printf("Failed to send verification email to %s: %v", user.Email, err)
+	}
+
+	// Sign the new user in
+	tokens, err := h.startSession(c, user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
@@ -159,9 +162,11 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	responseUser.Password = ""
 
 	c.JSON(http.StatusCreated, LoginResponse{
-		Token:     token,
-		User:      responseUser,
-		ExpiresAt: expiresAt,
+		Token:            tokens.Token,
+		User:             responseUser,
+		ExpiresAt:        tokens.ExpiresAt,
+		RefreshToken:     tokens.RefreshToken,
+		RefreshExpiresAt: tokens.RefreshExpiresAt,
 	})
 }
 
@@ -173,9 +178,6 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// Debug logging
-	log.Printf("Login attempt: email=%s, expected_role=%s", req.Email, req.ExpectedRole)
-
 	// Validate input
 	if req.Email == "" || req.Password == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Email and password are required"})
@@ -193,58 +195,71 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// Debug logging
-	log.Printf("User found: email=%s, user_role=%s", user.Email, user.Role)
-
 	// Verify password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
+	if user.Status != "active" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is not active"})
+		return
+	}
+
 	// Role validation: Check if expected role matches user's actual role
 	if req.ExpectedRole != "" {
 		expectedRole := strings.ToLower(strings.TrimSpace(req.ExpectedRole))
 		userRole := strings.ToLower(strings.TrimSpace(user.Role))
 
-		log.Printf("Role validation: expected=%s, actual=%s", expectedRole, userRole)
-
 		if expectedRole != userRole {
-			log.Printf("Role mismatch: user with role '%s' tried to login as '%s'", userRole, expectedRole)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("Access denied: User role '%s' cannot access %s portal", userRole, expectedRole)})
 			return
 		}
 	}
 
-	// Generate JWT token
-	token, expiresAt, err := h.generateJWT(user)
+	// Accounts with two-factor authentication finish signing in with a code
+	if user.TwoFactorEnabled || user.TwoFactorRequired {
+		h.respondTwoFactorChallenge(c, user)
+		return
+	}
+
+	h.completeLogin(c, user, nil)
+}
+
+// completeLogin starts a session for a user who has proved who they are.
+// Extra fields are added to the response.
+func (h *AuthHandler) completeLogin(c *gin.Context, user models.User, extra gin.H) {
+	tokens, err := h.startSession(c, user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
 	// Update last login time
-	user.LastLoginAt = &time.Time{}
-	*user.LastLoginAt = time.Now()
-	database.DB.Save(&user)
-
-	log.Printf("Login successful: email=%s, role=%s", user.Email, user.Role)
+	database.DB.Model(&user).Update("last_login_at", time.Now())
 
 	// Return success response
-	c.JSON(http.StatusOK, gin.H{
-		"message":    "Login successful",
-		"token":      token,
-		"expires_at": expiresAt,
+	response := gin.H{
+		"message":            "Login successful",
+		"token":              tokens.Token,
+		"expires_at":         tokens.ExpiresAt,
+		"refresh_token":      tokens.RefreshToken,
+		"refresh_expires_at": tokens.RefreshExpiresAt,
 		"user": gin.H{
 			"id":              user.ID,
 			"email":           user.Email,
+			"email_verified":  user.EmailVerified,
 			"name":            user.Name,
 			"role":            user.Role,
 			"membership_type": user.MembershipType,
 			"admin_level":     user.AdminLevel,
 			"image":           user.Image,
 		},
-	})
+	}
+	for key, value := range extra {
+		response[key] = value
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 // GetProfile returns the current user's profile
@@ -301,21 +316,28 @@ func (h *AuthHandler) UpdateProfile(c *gin.Context) {
 		return
 	}
 
-	// Update user fields
+	// Only the profile columns are written, so a stale copy of the user
+	// cannot undo changes made to it since it was loaded
+	updates := map[string]interface{}{}
 	if updateReq.Name != "" {
-		userModel.Name = updateReq.Name
+		updates["name"] = updateReq.Name
 	}
 	if updateReq.Phone != nil {
-		userModel.Phone = updateReq.Phone
+		updates["phone"] = updateReq.Phone
 	}
 	if updateReq.Handicap != nil {
-		userModel.Handicap = updateReq.Handicap
+		updates["handicap"] = updateReq.Handicap
 	}
 
-	// Save to database
-	if err := database.DB.Save(&userModel).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
-		return
+	if len(updates) > 0 {
+		if err := database.DB.Model(&userModel).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+			return
+		}
+		if err := database.DB.First(&userModel, userModel.ID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+			return
+		}
 	}
 
 	responseUser := userModel
@@ -323,12 +345,27 @@ func (h *AuthHandler) UpdateProfile(c *gin.Context) {
 	c.JSON(http.StatusOK, responseUser)
 }
 
-// generateJWT generates a JWT token for the user
-func (h *AuthHandler) generateJWT(user models.User) (string, time.Time, error) {
-	expiresAt := time.Now().Add(24 * time.Hour) // Token expires in 24 hours
+// defaultPreferences are a new user's preferences
+func defaultPreferences() models.UserPreferences {
+	return models.UserPreferences{
+		PreferredTeeTime: "morning",
+		PreferredCourses: []string{},
+		Notifications: models.NotificationSettings{
+			Email: true,
+			SMS:   false,
+			Push:  true,
+		},
+		PlayingStyle: "casual",
+	}
+}
+
+// generateJWT generates a short-lived access token for a user's session
+func (h *AuthHandler) generateJWT(user models.User, sessionID uuid.UUID) (string, time.Time, error) {
+	expiresAt := time.Now().Add(time.Duration(h.config.JWT.AccessMinutes) * time.Minute)
 
 	claims := jwt.MapClaims{
 		"user_id": user.ID,
+		"sid":     sessionID,
 		"email":   user.Email,
 		"role":    user.Role,
 		"exp":     expiresAt.Unix(),
@@ -344,6 +381,55 @@ func (h *AuthHandler) generateJWT(user models.User) (string, time.Time, error) {
 	return tokenString, expiresAt, nil
 }
 
+// purposeToken signs a token that proves one thing about a user, such as
+// owning their email address. The purpose claim keeps it from being accepted
+// for anything else signed with the same secret, including as an access token.
+func (h *AuthHandler) purposeToken(user models.User, purpose string, expiresAt time.Time) (string, error) {
+	claims := jwt.MapClaims{
+		"sub":     user.ID.String(),
+		"email":   user.Email,
+		"purpose": purpose,
+		"iat":     time.Now().Unix(),
+		"exp":     expiresAt.Unix(),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(h.config.JWT.Secret))
+}
+
+// parsePurposeToken checks the signature, expiry and purpose of a token made
+// by purposeToken
+func (h *AuthHandler) parsePurposeToken(tokenString, purpose string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return []byte(h.config.JWT.Secret), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != purpose {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	return claims, nil
+}
+
+// sendMail sends an email in the background, logging a failure
+func (h *AuthHandler) sendMail(msg mail.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := h.mailer.Send(ctx, msg); err != nil {
+			log.Printf("Failed to send %q email to %s: %v", msg.Subject, msg.To, err)
+		}
+	}()
+}
+
+// frontendLink returns a link to a web app page carrying a token
+func (h *AuthHandler) frontendLink(path, token string) string {
+	return strings.TrimRight(h.config.App.FrontendURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
 // generateRandomString generates a random string for various purposes
 func generateRandomString(length int) (string, error) {
 	bytes := make([]byte, length)
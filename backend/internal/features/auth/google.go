@@ -0,0 +1,384 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golf-ezz-backend/internal/config"
+	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/sync/singleflight"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// jwksDefaultMaxAge is how long keys are cached when Google sends no max-age
+	jwksDefaultMaxAge = time.Hour
+	// jwksMinRefresh limits refetching the keys for a key ID we have not seen
+	jwksMinRefresh = time.Minute
+)
+
+// googleIssuers are the issuers Google signs ID tokens as
+var googleIssuers = []string{"accounts.google.com", "https://accounts.google.com"}
+
+var (
+	errGoogleToken  = errors.New("invalid Google ID token")
+	errUnknownKey   = errors.New("unknown signing key")
+	errGoogleLinked = errors.New("account is linked to another Google account")
+	maxAgePattern   = regexp.MustCompile(`max-age=(\d+)`)
+)
+
+// GoogleLoginRequest carries the ID token from Google sign-in
+type GoogleLoginRequest struct {
+	IDToken string `json:"id_token" binding:"required"`
+}
+
+// googleIdentity is who a verified Google ID token says the user is
+type googleIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+}
+
+// GoogleLogin signs a user in with a Google ID token. The user is matched
+// by Google account, then by verified email address, and otherwise a new
+// member is created. Two-factor authentication still applies.
+func (h *AuthHandler) GoogleLogin(c *gin.Context) {
+	if h.config.Google.ClientID == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Google sign-in is not available"})
+		return
+	}
+
+	var req GoogleLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	identity, err := verifyGoogleIDToken(c.Request.Context(), h.config, req.IDToken)
+	if err != nil {
+		log.Printf("Google sign-in rejected: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Google credentials"})
+		return
+	}
+	if !identity.EmailVerified {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Google account email is not verified"})
+		return
+	}
+
+	user, created, err := userForGoogle(database.DB, identity)
+	if errors.Is(err, errGoogleLinked) {
+		c.JSON(http.StatusConflict, gin.H{"error": "This email is linked to a different Google account"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign in with Google"})
+		return
+	}
+	if created {
+		log.Printf("Created user from Google sign-in: email=%s", user.Email)
+	}
+
+	if user.Status != "active" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is not active"})
+		return
+	}
+	if user.TwoFactorEnabled || user.TwoFactorRequired {
+		h.respondTwoFactorChallenge(c, user)
+		return
+	}
+
+	h.completeLogin(c, user, gin.H{"created": created})
+}
+
+// userForGoogle finds or creates the user for a Google identity, linking an
+// existing account with the same email address. Google has verified the
+// address, so the user's email counts as verified too; see linkGoogle for
+// accounts that had not verified it themselves.
+func userForGoogle(db *gorm.DB, identity googleIdentity) (models.User, bool, error) {
+	var user models.User
+	err := db.Where("google_id = ?", identity.Subject).First(&user).Error
+	if err == nil {
+		return user, false, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, false, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("LOWER(email) = LOWER(?)", identity.Email).First(&user).Error; err != nil {
+			return err
+		}
+		if user.GoogleID != nil && *user.GoogleID != identity.Subject {
+			return errGoogleLinked
+		}
+		return linkGoogle(tx, &user, identity)
+	})
+	if err == nil || !errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, false, err
+	}
+
+	// The account has no usable password until the user sets one through
+	// a password reset
+	password, err := generateRandomString(32)
+	if err != nil {
+		return user, false, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return user, false, err
+	}
+
+	now := time.Now()
+	name := identity.Name
+	if name == "" {
+		name = strings.Split(identity.Email, "@")[0]
+	}
+	user = models.User{
+		Email:           identity.Email,
+		Name:            name,
+		Role:            "member",
+		Password:        string(hashedPassword),
+		GoogleID:        &identity.Subject,
+		EmailVerified:   true,
+		EmailVerifiedAt: &now,
+		Preferences:     defaultPreferences(),
+	}
+	if identity.Picture != "" {
+		user.Image = &identity.Picture
+	}
+	if err := db.Create(&user).Error; err != nil {
+		return user, false, err
+	}
+	return user, true, nil
+}
+
+// linkGoogle links a Google identity to an existing account. Anyone can
+// register an address they do not own, so when the account never proved it
+// owns the email, whoever registered it loses access: the password, any
+// two-factor enrollment they set up and their sessions are all dropped, and
+// the owner can choose a password through a reset.
+func linkGoogle(tx *gorm.DB, user *models.User, identity googleIdentity) error {
+	updates := map[string]interface{}{"google_id": identity.Subject}
+	if user.Image == nil && identity.Picture != "" {
+		updates["image"] = identity.Picture
+	}
+
+	if !user.EmailVerified {
+		password, err := generateRandomString(32)
+		if err != nil {
+			return err
+		}
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		updates["email_verified"] = true
+		updates["email_verified_at"] = time.Now()
+		updates["password"] = string(hashedPassword)
+		updates["password_reset_token"] = nil
+		updates["password_reset_expiry"] = nil
+		updates["two_factor_enabled"] = false
+		updates["two_factor_secret"] = nil
+		updates["two_factor_last_step"] = 0
+		updates["two_factor_failures"] = 0
+		updates["two_factor_locked_at"] = nil
+
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if _, err := RevokeSessions(tx, user.ID); err != nil {
+			return err
+		}
+		log.Printf("Linked Google sign-in to unverified account; previous credentials cleared: user_id=%s", user.ID)
+	}
+
+	if err := tx.Model(user).Updates(updates).Error; err != nil {
+		return err
+	}
+	return tx.First(user, "id = ?", user.ID).Error
+}
+
+// verifyGoogleIDToken checks an ID token's signature against Google's keys,
+// and its audience, issuer and expiry
+func verifyGoogleIDToken(ctx context.Context, cfg *config.Config, idToken string) (googleIdentity, error) {
+	token, err := jwt.Parse(idToken, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return googleKeys.key(ctx, cfg.Google.JWKSURL, kid)
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithAudience(cfg.Google.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(30*time.Second),
+	)
+	if err != nil {
+		return googleIdentity{}, fmt.Errorf("%w: %v", errGoogleToken, err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return googleIdentity{}, errGoogleToken
+	}
+	issuer, _ := claims.GetIssuer()
+	if !containsString(googleIssuers, issuer) {
+		return googleIdentity{}, fmt.Errorf("%w: unexpected issuer %q", errGoogleToken, issuer)
+	}
+
+	identity := googleIdentity{}
+	identity.Subject, _ = claims.GetSubject()
+	identity.Email, _ = claims["email"].(string)
+	identity.Name, _ = claims["name"].(string)
+	identity.Picture, _ = claims["picture"].(string)
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		identity.EmailVerified, _ = strconv.ParseBool(verified)
+	}
+	if identity.Subject == "" || identity.Email == "" {
+		return googleIdentity{}, fmt.Errorf("%w: missing subject or email", errGoogleToken)
+	}
+	return identity, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// googleKeys caches Google's token signing keys
+var googleKeys = &jwksCache{}
+
+// jwksCache holds the RSA keys of a JSON Web Key Set for as long as its
+// server allows, refetching early when a token names a key it lacks. Keys are
+// fetched outside the lock, and concurrent fetches of one URL share a
+// request, so a slow key server does not hold up tokens whose keys are cached.
+type jwksCache struct {
+	mu        sync.Mutex
+	url       string
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+	expiresAt time.Time
+	fetches   singleflight.Group
+}
+
+// key returns the public key with the given ID
+func (k *jwksCache) key(ctx context.Context, url, kid string) (*rsa.PublicKey, error) {
+	k.mu.Lock()
+	now := time.Now()
+	if k.url == url && now.Before(k.expiresAt) {
+		if key, ok := k.keys[kid]; ok {
+			k.mu.Unlock()
+			return key, nil
+		}
+		// Keys can rotate before the cache expires, but a made-up key ID
+		// must not make us fetch on every request
+		if now.Sub(k.fetchedAt) < jwksMinRefresh {
+			k.mu.Unlock()
+			return nil, errUnknownKey
+		}
+	}
+	k.mu.Unlock()
+
+	if _, err, _ := k.fetches.Do(url, func() (interface{}, error) {
+		return nil, k.refresh(ctx, url)
+	}); err != nil {
+		return nil, err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	key, ok := k.keys[kid]
+	if !ok || k.url != url {
+		return nil, errUnknownKey
+	}
+	return key, nil
+}
+
+// refresh fetches the key set and replaces the cached keys with it
+func (k *jwksCache) refresh(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := (&http.Client{Timeout: 10 * time.Second}).Do(req)
+	if err != nil {
+		return fmt.Errorf("fetch signing keys: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch signing keys: %s", resp.Status)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("parse signing keys: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+		keys[jwk.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	maxAge := jwksDefaultMaxAge
+	if match := maxAgePattern.FindStringSubmatch(resp.Header.Get("Cache-Control")); match != nil {
+		if seconds, err := strconv.Atoi(match[1]); err == nil {
+			maxAge = time.Duration(seconds) * time.Second
+		}
+	}
+
+	now := time.Now()
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.url = url
+	k.keys = keys
+	k.fetchedAt = now
+	k.expiresAt = now.Add(maxAge)
+	return nil
+}
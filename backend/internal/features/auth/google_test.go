@@ -0,0 +1,413 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golf-ezz-backend/internal/config"
+	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const testClientID = "test-client.apps.googleusercontent.com"
+
+var (
+	signingKeysOnce sync.Once
+	signingKey      *rsa.PrivateKey
+	otherKey        *rsa.PrivateKey
+)
+
+// testKeys returns the key the test key server publishes and one it does not
+func testKeys(t *testing.T) (*rsa.PrivateKey, *rsa.PrivateKey) {
+	t.Helper()
+	signingKeysOnce.Do(func() {
+		var err error
+		if signingKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			panic(err)
+		}
+		if otherKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			panic(err)
+		}
+	})
+	return signingKey, otherKey
+}
+
+// keyServer serves a JSON Web Key Set in place of Google's
+type keyServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	keys     map[string]*rsa.PublicKey
+	requests atomic.Int32
+	delay    atomic.Int64 // nanoseconds
+}
+
+func newKeyServer(t *testing.T, keys map[string]*rsa.PublicKey) *keyServer {
+	t.Helper()
+	ks := &keyServer{keys: keys}
+	ks.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ks.requests.Add(1)
+		time.Sleep(time.Duration(ks.delay.Load()))
+
+		ks.mu.Lock()
+		defer ks.mu.Unlock()
+		var set struct {
+			Keys []map[string]string `json:"keys"`
+		}
+		for kid, key := range ks.keys {
+			set.Keys = append(set.Keys, map[string]string{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": kid,
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(ks.Close)
+	return ks
+}
+
+func (ks *keyServer) setKeys(keys map[string]*rsa.PublicKey) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.keys = keys
+}
+
+// googleTestConfig points Google sign-in at the key server with an empty key cache
+func googleTestConfig(t *testing.T, ks *keyServer) *config.Config {
+	t.Helper()
+	previous := googleKeys
+	googleKeys = &jwksCache{}
+	t.Cleanup(func() { googleKeys = previous })
+	return &config.Config{Google: config.GoogleConfig{ClientID: testClientID, JWKSURL: ks.URL}}
+}
+
+// idToken signs claims as an ID token, filling in valid defaults
+func idToken(t *testing.T, key *rsa.PrivateKey, kid string, overrides jwt.MapClaims) string {
+	t.Helper()
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            "https://accounts.google.com",
+		"aud":            testClientID,
+		"sub":            "1100000000000001",
+		"email":          "golfer@example.com",
+		"email_verified": true,
+		"name":           "Test Golfer",
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	}
+	for name, value := range overrides {
+		if value == nil {
+			delete(claims, name)
+			continue
+		}
+		claims[name] = value
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return signed
+}
+
+func TestVerifyGoogleIDToken(t *testing.T) {
+	key, other := testKeys(t)
+	ks := newKeyServer(t, map[string]*rsa.PublicKey{"key-1": &key.PublicKey})
+	hourAgo := time.Now().Add(-time.Hour).Unix()
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"valid", idToken(t, key, "key-1", nil), true},
+		{"issuer without scheme", idToken(t, key, "key-1", jwt.MapClaims{"iss": "accounts.google.com"}), true},
+		{"email_verified as a string", idToken(t, key, "key-1", jwt.MapClaims{"email_verified": "true"}), true},
+		{"bad signature", idToken(t, other, "key-1", nil), false},
+		{"wrong audience", idToken(t, key, "key-1", jwt.MapClaims{"aud": "someone-else.apps.googleusercontent.com"}), false},
+		{"wrong issuer", idToken(t, key, "key-1", jwt.MapClaims{"iss": "https://accounts.example.com"}), false},
+		{"expired", idToken(t, key, "key-1", jwt.MapClaims{"iat": hourAgo - 3600, "exp": hourAgo}), false},
+		{"no expiry", idToken(t, key, "key-1", jwt.MapClaims{"exp": nil}), false},
+		{"issued in the future", idToken(t, key, "key-1", jwt.MapClaims{"iat": time.Now().Add(time.Hour).Unix()}), false},
+		{"no email", idToken(t, key, "key-1", jwt.MapClaims{"email": nil}), false},
+		{"unknown key", idToken(t, key, "key-2", nil), false},
+		{"not RS256", func() string {
+			signed, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+				"iss": "https://accounts.google.com", "aud": testClientID, "sub": "1", "email": "a@example.com",
+				"iat": time.Now().Unix(), "exp": time.Now().Add(time.Hour).Unix(),
+			}).SignedString([]byte("secret"))
+			return signed
+		}(), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := googleTestConfig(t, ks)
+			identity, err := verifyGoogleIDToken(context.Background(), cfg, tt.token)
+			if (err == nil) != tt.ok {
+				t.Fatalf("verifyGoogleIDToken() error = %v, want ok = %v", err, tt.ok)
+			}
+			if tt.ok && (identity.Email != "golfer@example.com" || !identity.EmailVerified) {
+				t.Errorf("identity = %+v", identity)
+			}
+		})
+	}
+}
+
+func TestGoogleKeysRefetchThrottle(t *testing.T) {
+	key, other := testKeys(t)
+	ks := newKeyServer(t, map[string]*rsa.PublicKey{"key-1": &key.PublicKey})
+	cfg := googleTestConfig(t, ks)
+	ctx := context.Background()
+
+	if _, err := verifyGoogleIDToken(ctx, cfg, idToken(t, key, "key-1", nil)); err != nil {
+		t.Fatalf("first token: %v", err)
+	}
+	if got := ks.requests.Load(); got != 1 {
+		t.Fatalf("key server hit %d times, want 1", got)
+	}
+
+	// A key ID missing from a fresh cache does not refetch
+	if _, err := verifyGoogleIDToken(ctx, cfg, idToken(t, other, "made-up", nil)); !errors.Is(err, errGoogleToken) {
+		t.Fatalf("unknown key error = %v", err)
+	}
+	if got := ks.requests.Load(); got != 1 {
+		t.Fatalf("key server hit %d times after an unknown key, want 1", got)
+	}
+
+	// Later, made-up key IDs are refetched at most once a minute
+	googleKeys.mu.Lock()
+	googleKeys.fetchedAt = time.Now().Add(-2 * jwksMinRefresh)
+	googleKeys.mu.Unlock()
+	for i := 0; i < 3; i++ {
+		if _, err := verifyGoogleIDToken(ctx, cfg, idToken(t, other, "made-up", nil)); !errors.Is(err, errGoogleToken) {
+			t.Fatalf("unknown key error = %v", err)
+		}
+	}
+	if got := ks.requests.Load(); got != 2 {
+		t.Errorf("key server hit %d times after unknown keys, want 2", got)
+	}
+
+	// Once the throttle has passed, a rotated key is picked up
+	ks.setKeys(map[string]*rsa.PublicKey{"key-1": &key.PublicKey, "key-2": &other.PublicKey})
+	googleKeys.mu.Lock()
+	googleKeys.fetchedAt = time.Now().Add(-2 * jwksMinRefresh)
+	googleKeys.mu.Unlock()
+	if _, err := verifyGoogleIDToken(ctx, cfg, idToken(t, other, "key-2", nil)); err != nil {
+		t.Errorf("rotated key: %v", err)
+	}
+	if got := ks.requests.Load(); got != 3 {
+		t.Errorf("key server hit %d times after rotation, want 3", got)
+	}
+}
+
+func TestGoogleKeysFetchOutsideLock(t *testing.T) {
+	key, _ := testKeys(t)
+	ks := newKeyServer(t, map[string]*rsa.PublicKey{"key-1": &key.PublicKey})
+	cfg := googleTestConfig(t, ks)
+	ctx := context.Background()
+
+	// Cache the key, then make the server slow
+	if _, err := verifyGoogleIDToken(ctx, cfg, idToken(t, key, "key-1", nil)); err != nil {
+		t.Fatalf("first token: %v", err)
+	}
+	googleKeys.mu.Lock()
+	googleKeys.fetchedAt = time.Now().Add(-2 * jwksMinRefresh)
+	googleKeys.mu.Unlock()
+	ks.delay.Store(int64(500 * time.Millisecond))
+
+	// Several lookups of a new key share one slow fetch...
+	newKeyToken := idToken(t, key, "key-new", nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			verifyGoogleIDToken(ctx, cfg, newKeyToken)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// ...while tokens signed with a cached key are not held up by it
+	started := time.Now()
+	if _, err := verifyGoogleIDToken(ctx, cfg, idToken(t, key, "key-1", nil)); err != nil {
+		t.Fatalf("cached key: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 250*time.Millisecond {
+		t.Errorf("cached key took %s while keys were being fetched", elapsed)
+	}
+
+	wg.Wait()
+	if got := ks.requests.Load(); got != 2 {
+		t.Errorf("key server hit %d times, want 2", got)
+	}
+}
+
+func TestGoogleLoginRejectsUnverifiedEmail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	key, _ := testKeys(t)
+	ks := newKeyServer(t, map[string]*rsa.PublicKey{"key-1": &key.PublicKey})
+	cfg := googleTestConfig(t, ks)
+
+	router := gin.New()
+	router.POST("/auth/google", NewAuthHandler(cfg).GoogleLogin)
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"unverified email", idToken(t, key, "key-1", jwt.MapClaims{"email_verified": false}), http.StatusUnauthorized},
+		{"email_verified missing", idToken(t, key, "key-1", jwt.MapClaims{"email_verified": nil}), http.StatusUnauthorized},
+		{"bad token", "not-a-token", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(GoogleLoginRequest{IDToken: tt.token})
+			req := httptest.NewRequest(http.MethodPost, "/auth/google", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
+
+// useTestDB points database.DB at a transaction on TEST_DATABASE_DSN that is
+// rolled back when the test ends, skipping the test when none is configured
+func useTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	previous := database.DB
+	database.DB = db
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	tx := db.Begin()
+	database.DB = tx
+	t.Cleanup(func() {
+		tx.Rollback()
+		database.DB = previous
+	})
+	return tx
+}
+
+func testUser(t *testing.T, db *gorm.DB, verified bool) models.User {
+	t.Helper()
+	secret := "JBSWY3DPEHPK3PXP"
+	user := models.User{
+		Email:            uuid.NewString() + "@example.com",
+		Name:             "Existing Golfer",
+		Password:         "original-hash",
+		Role:             "member",
+		EmailVerified:    verified,
+		TwoFactorEnabled: true,
+		TwoFactorSecret:  &secret,
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	session := models.Session{
+		UserID:           user.ID,
+		RefreshTokenHash: uuid.NewString(),
+		ExpiresAt:        time.Now().Add(time.Hour),
+	}
+	if err := db.Create(&session).Error; err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	return user
+}
+
+func TestUserForGoogleLinksVerifiedAccount(t *testing.T) {
+	db := useTestDB(t)
+	existing := testUser(t, db, true)
+
+	user, created, err := userForGoogle(db, googleIdentity{Subject: uuid.NewString(), Email: existing.Email, EmailVerified: true})
+	if err != nil || created {
+		t.Fatalf("userForGoogle() = created %v, %v; want the existing account", created, err)
+	}
+	if user.ID != existing.ID || user.GoogleID == nil {
+		t.Fatalf("linked user = %s (google %v), want %s", user.ID, user.GoogleID, existing.ID)
+	}
+	if user.Password != existing.Password || !user.TwoFactorEnabled {
+		t.Error("a verified account lost its credentials when Google was linked")
+	}
+
+	var active int64
+	db.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).Count(&active)
+	if active != 1 {
+		t.Errorf("%d active sessions, want 1", active)
+	}
+}
+
+func TestUserForGoogleClearsUnverifiedAccount(t *testing.T) {
+	db := useTestDB(t)
+	squatter := testUser(t, db, false)
+
+	user, created, err := userForGoogle(db, googleIdentity{Subject: uuid.NewString(), Email: squatter.Email, EmailVerified: true})
+	if err != nil || created {
+		t.Fatalf("userForGoogle() = created %v, %v; want the existing account", created, err)
+	}
+	if !user.EmailVerified || user.GoogleID == nil {
+		t.Errorf("user verified = %v, google = %v; want linked and verified", user.EmailVerified, user.GoogleID)
+	}
+	if user.Password == squatter.Password || user.TwoFactorEnabled || user.TwoFactorSecret != nil {
+		t.Error("the unverified account kept the credentials it was registered with")
+	}
+
+	var active int64
+	db.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).Count(&active)
+	if active != 0 {
+		t.Errorf("%d active sessions, want 0", active)
+	}
+}
+
+func TestUserForGoogleRefusesOtherGoogleAccount(t *testing.T) {
+	db := useTestDB(t)
+	existing := testUser(t, db, true)
+	if _, _, err := userForGoogle(db, googleIdentity{Subject: "first", Email: existing.Email, EmailVerified: true}); err != nil {
+		t.Fatalf("link: %v", err)
+	}
+
+	if _, _, err := userForGoogle(db, googleIdentity{Subject: "second", Email: existing.Email, EmailVerified: true}); !errors.Is(err, errGoogleLinked) {
+		t.Errorf("userForGoogle() error = %v, want errGoogleLinked", err)
+	}
+}
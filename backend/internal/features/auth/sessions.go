@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrSessionInvalid is returned for a refresh token of a revoked or expired session
+var ErrSessionInvalid = errors.New("session is no longer valid")
+
+// RefreshRequest represents a request for a new access token
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// tokenPair is what a client holds for a session
+type tokenPair struct {
+	Token            string    `json:"token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// Refresh swaps a refresh token for a new access token and refresh token.
+// Each refresh token works once; presenting one that was already swapped
+// means it was copied, so the whole session is signed out.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	refreshToken, newHash, err := newRefreshToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	hash := hashToken(req.RefreshToken)
+	now := time.Now()
+	var session models.Session
+	var user models.User
+	var reused bool
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("refresh_token_hash = ? OR previous_token_hash = ?", hash, hash).
+			First(&session).Error; err != nil {
+			return err
+		}
+		if session.RevokedAt != nil || !now.Before(session.ExpiresAt) {
+			return ErrSessionInvalid
+		}
+		if session.RefreshTokenHash != hash {
+			reused = true
+			return tx.Model(&session).Update("revoked_at", now).Error
+		}
+
+		if err := tx.First(&user, session.UserID).Error; err != nil {
+			return err
+		}
+		if user.Status != "active" {
+			return ErrSessionInvalid
+		}
+
+		session.ExpiresAt = now.AddDate(0, 0, h.config.JWT.RefreshDays)
+		return tx.Model(&session).Updates(map[string]interface{}{
+			"refresh_token_hash":  newHash,
+			"previous_token_hash": hash,
+			"expires_at":          session.ExpiresAt,
+			"last_used_at":        now,
+			"ip_address":          c.ClientIP(),
+			"user_agent":          c.Request.UserAgent(),
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, ErrSessionInvalid) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+	if reused {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token already used; the session has been signed out"})
+		return
+	}
+
+	tokens, err := h.tokensFor(user, session, refreshToken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Logout signs out the session the request was made with
+func (h *AuthHandler) Logout(c *gin.Context) {
+	sessionID, exists := c.Get("session_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session not found"})
+		return
+	}
+
+	if err := database.DB.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// LogoutAll signs the authenticated user out on every device
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	userModel := user.(models.User)
+
+	revoked, err := RevokeSessions(database.DB, userModel.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Logged out on all devices",
+		"sessions": revoked,
+	})
+}
+
+// RevokeSessions signs a user out everywhere, returning how many sessions
+// were ended. Their access tokens stop working at once.
+func RevokeSessions(db *gorm.DB, userID uuid.UUID) (int64, error) {
+	result := db.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// startSession signs a user in on a new device
+func (h *AuthHandler) startSession(c *gin.Context, user models.User) (tokenPair, error) {
+	refreshToken, hash, err := newRefreshToken()
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		UserID:           user.ID,
+		RefreshTokenHash: hash,
+		ExpiresAt:        now.AddDate(0, 0, h.config.JWT.RefreshDays),
+		LastUsedAt:       now,
+		IPAddress:        c.ClientIP(),
+		UserAgent:        c.Request.UserAgent(),
+	}
+	if err := database.DB.Create(&session).Error; err != nil {
+		return tokenPair{}, err
+	}
+
+	return h.tokensFor(user, session, refreshToken)
+}
+
+// tokensFor issues an access token for a session alongside its refresh token
+func (h *AuthHandler) tokensFor(user models.User, session models.Session, refreshToken string) (tokenPair, error) {
+	token, expiresAt, err := h.generateJWT(user, session.ID)
+	if err != nil {
+		return tokenPair{}, err
+	}
+	return tokenPair{
+		Token:            token,
+		ExpiresAt:        expiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: session.ExpiresAt,
+	}, nil
+}
+
+// newRefreshToken returns a random refresh token and the hash stored for it
+func newRefreshToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
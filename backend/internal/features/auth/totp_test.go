@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the RFC 6238 SHA-1 test key "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to six digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got, err := totpCode(rfcSecret, totpStep(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("totpCode(%d) error = %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("totpCode(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+
+	if _, err := totpCode("not base32!", 1); err == nil {
+		t.Error("totpCode() accepted an invalid secret")
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := totpStep(now)
+	code := func(step int64) string {
+		c, err := totpCode(rfcSecret, step)
+		if err != nil {
+			t.Fatalf("totpCode() error = %v", err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		lastStep int64
+		wantStep int64
+		ok       bool
+	}{
+		{"current step", rfcSecret, code(current), 0, current, true},
+		{"surrounding spaces", rfcSecret, " " + code(current) + " ", 0, current, true},
+		{"lower case secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", code(current), 0, current, true},
+		{"previous step within skew", rfcSecret, code(current - 1), 0, current - 1, true},
+		{"next step within skew", rfcSecret, code(current + 1), 0, current + 1, true},
+		{"outside skew", rfcSecret, code(current - 2), 0, 0, false},
+		{"replayed", rfcSecret, code(current), current, 0, false},
+		{"earlier step after a later one", rfcSecret, code(current - 1), current, 0, false},
+		{"later step after an earlier one", rfcSecret, code(current + 1), current, current + 1, true},
+		{"wrong code", rfcSecret, "000000", 0, 0, false},
+		{"too short", rfcSecret, code(current)[:5], 0, 0, false},
+		{"too long", rfcSecret, code(current) + "0", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := matchTOTP(tt.secret, tt.code, now, tt.lastStep)
+			if ok != tt.ok || step != tt.wantStep {
+				t.Errorf("matchTOTP() = %d, %v; want %d, %v", step, ok, tt.wantStep, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,455 @@
+package auth
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// challengeTTL is how long a user has to enter their code after the password
+	challengeTTL = 5 * time.Minute
+	// twoFactorMaxFailures wrong codes in a row lock codes out for twoFactorLockout
+	twoFactorMaxFailures = 5
+	twoFactorLockout     = 15 * time.Minute
+	// recoveryCodeCount codes are issued at a time
+	recoveryCodeCount = 10
+
+	twoFactorLoginPurpose = "2fa_login" // the password was right; a code finishes signing in
+	twoFactorSetupPurpose = "2fa_setup" // the password was right; the account must enroll first
+)
+
+var (
+	errInvalidCode      = errors.New("invalid authentication code")
+	errTwoFactorLocked  = errors.New("too many incorrect authentication codes")
+	errAlreadyEnrolled  = errors.New("two-factor authentication is already enabled")
+	errTwoFactorMissing = errors.New("two-factor authentication is not set up")
+)
+
+// TwoFactorCodeRequest carries a TOTP code, or a recovery code where accepted
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// TwoFactorChallengeRequest continues a login that needs two-factor authentication
+type TwoFactorChallengeRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code"`
+}
+
+// LoginTwoFactor finishes a login with a TOTP or recovery code
+func (h *AuthHandler) LoginTwoFactor(c *gin.Context) {
+	var req TwoFactorChallengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "challenge_token and code are required"})
+		return
+	}
+
+	userID, err := h.parseChallenge(req.ChallengeToken, twoFactorLoginPurpose)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login has expired; please sign in again"})
+		return
+	}
+
+	user, err := checkCode(database.DB, userID, req.Code, true)
+	if err != nil {
+		respondCodeError(c, err)
+		return
+	}
+	if user.Status != "active" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is not active"})
+		return
+	}
+
+	h.completeLogin(c, user, nil)
+}
+
+// LoginTwoFactorSetup starts enrollment for an account an admin requires to
+// use two-factor authentication, part way through its login
+func (h *AuthHandler) LoginTwoFactorSetup(c *gin.Context) {
+	var req TwoFactorChallengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := h.parseChallenge(req.ChallengeToken, twoFactorSetupPurpose)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login has expired; please sign in again"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	h.respondEnrollment(c, user)
+}
+
+// LoginTwoFactorConfirm completes enrollment during login and signs the user
+// in, returning their recovery codes with the session
+func (h *AuthHandler) LoginTwoFactorConfirm(c *gin.Context) {
+	var req TwoFactorChallengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "challenge_token and code are required"})
+		return
+	}
+
+	userID, err := h.parseChallenge(req.ChallengeToken, twoFactorSetupPurpose)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login has expired; please sign in again"})
+		return
+	}
+
+	user, codes, err := confirmEnrollment(database.DB, userID, req.Code)
+	if err != nil {
+		respondCodeError(c, err)
+		return
+	}
+	if user.Status != "active" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is not active"})
+		return
+	}
+
+	h.completeLogin(c, user, gin.H{"recovery_codes": codes})
+}
+
+// SetupTwoFactor starts enrollment for the authenticated user, returning the
+// secret and the URI an authenticator app scans. Nothing changes at login
+// until the enrollment is confirmed with a code.
+func (h *AuthHandler) SetupTwoFactor(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	h.respondEnrollment(c, user.(models.User))
+}
+
+// ConfirmTwoFactor turns on two-factor authentication once the user proves
+// their authenticator works, returning one-time recovery codes
+func (h *AuthHandler) ConfirmTwoFactor(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	userModel := user.(models.User)
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, codes, err := confirmEnrollment(database.DB, userModel.ID, req.Code)
+	if err != nil {
+		respondCodeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor turns off two-factor authentication after checking a code.
+// Accounts an admin requires to use it cannot turn it off.
+func (h *AuthHandler) DisableTwoFactor(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	userModel := user.(models.User)
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if userModel.TwoFactorRequired {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for this account"})
+		return
+	}
+	if !userModel.TwoFactorEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	if _, err := checkCode(database.DB, userModel.ID, req.Code, true); err != nil {
+		respondCodeError(c, err)
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userModel.ID).Updates(map[string]interface{}{
+			"two_factor_enabled":   false,
+			"two_factor_secret":    nil,
+			"two_factor_last_step": 0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("user_id = ?", userModel.ID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after checking
+// a code from their authenticator
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	userModel := user.(models.User)
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !userModel.TwoFactorEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if _, err := checkCode(database.DB, userModel.ID, req.Code, false); err != nil {
+		respondCodeError(c, err)
+		return
+	}
+
+	var codes []string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = issueRecoveryCodes(tx, userModel.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// respondTwoFactorChallenge answers a correct password for an account that
+// needs a second factor. The challenge token continues the login with a code,
+// or with enrollment when the account must use two-factor but has not set it up.
+func (h *AuthHandler) respondTwoFactorChallenge(c *gin.Context, user models.User) {
+	purpose, step := twoFactorLoginPurpose, "code"
+	if !user.TwoFactorEnabled {
+		purpose, step = twoFactorSetupPurpose, "setup"
+	}
+
+	expiresAt := time.Now().Add(challengeTTL)
+	token, err := h.purposeToken(user, purpose, expiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":              "Two-factor authentication required",
+		"two_factor":           step,
+		"challenge_token":      token,
+		"challenge_expires_at": expiresAt,
+	})
+}
+
+// respondEnrollment gives the user a new TOTP secret to add to their authenticator
+func (h *AuthHandler) respondEnrollment(c *gin.Context, user models.User) {
+	if user.TwoFactorEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+	if err := database.DB.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"two_factor_secret":    secret,
+		"two_factor_last_step": 0,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor setup"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":           secret,
+		"provisioning_uri": provisioningURI(h.config.JWT.TOTPIssuer, user.Email, secret),
+	})
+}
+
+// confirmEnrollment turns on two-factor authentication when the code matches
+// the pending secret, returning the user and their recovery codes
+func confirmEnrollment(db *gorm.DB, userID uuid.UUID, code string) (models.User, []string, error) {
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return user, nil, err
+	}
+	if user.TwoFactorEnabled {
+		return user, nil, errAlreadyEnrolled
+	}
+
+	user, err := checkCode(db, userID, code, false)
+	if err != nil {
+		return user, nil, err
+	}
+
+	var codes []string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("two_factor_enabled", true).Error; err != nil {
+			return err
+		}
+		codes, err = issueRecoveryCodes(tx, user.ID)
+		return err
+	})
+	user.TwoFactorEnabled = true
+	return user, codes, err
+}
+
+// checkCode checks a TOTP code, or a recovery code when allowed, against the
+// user's secret. Each code works once, and too many wrong codes in a row
+// lock the user out of two-factor checks for a while.
+func checkCode(db *gorm.DB, userID uuid.UUID, code string, allowRecovery bool) (models.User, error) {
+	var user models.User
+	var result error
+	now := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+			return err
+		}
+		if user.TwoFactorSecret == nil {
+			result = errTwoFactorMissing
+			return nil
+		}
+		if user.TwoFactorLockedAt != nil && now.Before(user.TwoFactorLockedAt.Add(twoFactorLockout)) {
+			result = errTwoFactorLocked
+			return nil
+		}
+
+		passed := false
+		if step, ok := matchTOTP(*user.TwoFactorSecret, code, now, user.TwoFactorLastStep); ok {
+			user.TwoFactorLastStep = step
+			passed = true
+		} else if allowRecovery && user.TwoFactorEnabled {
+			used, err := useRecoveryCode(tx, user.ID, code, now)
+			if err != nil {
+				return err
+			}
+			passed = used
+		}
+
+		if passed {
+			user.TwoFactorFailures = 0
+			user.TwoFactorLockedAt = nil
+			return tx.Model(&user).Updates(map[string]interface{}{
+				"two_factor_last_step": user.TwoFactorLastStep,
+				"two_factor_failures":  0,
+				"two_factor_locked_at": nil,
+			}).Error
+		}
+
+		result = errInvalidCode
+		updates := map[string]interface{}{"two_factor_failures": user.TwoFactorFailures + 1}
+		if user.TwoFactorFailures+1 >= twoFactorMaxFailures {
+			updates["two_factor_failures"] = 0
+			updates["two_factor_locked_at"] = now
+		}
+		return tx.Model(&user).Updates(updates).Error
+	})
+	if err != nil {
+		return user, err
+	}
+	return user, result
+}
+
+// issueRecoveryCodes replaces a user's recovery codes, returning the new ones
+func issueRecoveryCodes(tx *gorm.DB, userID uuid.UUID) ([]string, error) {
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	records := make([]models.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(totpEncoding.EncodeToString(b))[:10]
+		codes[i] = raw[:5] + "-" + raw[5:]
+		records[i] = models.RecoveryCode{UserID: userID, CodeHash: hashToken(raw)}
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// useRecoveryCode spends an unused recovery code, reporting whether it matched
+func useRecoveryCode(tx *gorm.DB, userID uuid.UUID, code string, now time.Time) (bool, error) {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	if normalized == "" {
+		return false, nil
+	}
+	result := tx.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashToken(normalized)).
+		Update("used_at", now)
+	return result.RowsAffected > 0, result.Error
+}
+
+// parseChallenge checks a login challenge token, returning whose login it is
+func (h *AuthHandler) parseChallenge(tokenString, purpose string) (uuid.UUID, error) {
+	claims, err := h.parsePurposeToken(tokenString, purpose)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return uuid.Parse(fmt.Sprint(claims["sub"]))
+}
+
+// respondCodeError writes the response for a failed two-factor check
+func respondCodeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errInvalidCode):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication code"})
+	case errors.Is(err, errTwoFactorLocked):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many incorrect codes; try again later"})
+	case errors.Is(err, errAlreadyEnrolled):
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+	case errors.Is(err, errTwoFactorMissing):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start two-factor setup first"})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check authentication code"})
+	}
+}
@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/mail"
+	"golf-ezz-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// verificationTTL is how long an emailed verification link works
+	verificationTTL = 48 * time.Hour
+	// verificationResendInterval is the least time between verification emails
+	verificationResendInterval = 2 * time.Minute
+	// verifyEmailPurpose marks a signed token as a verification link
+	verifyEmailPurpose = "verify_email"
+)
+
+var errInvalidVerification = errors.New("invalid verification token")
+
+// VerifyEmailRequest represents a verification link being followed
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// VerifyEmail marks the user's email address as verified
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, email, err := h.parseVerificationToken(req.Token)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification link"})
+		return
+	}
+
+	// The link is for the address it was sent to; changing it needs a new link
+	var user models.User
+	if err := database.DB.Where("id = ? AND email = ?", userID, email).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification link"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if !user.EmailVerified {
+		if err := database.DB.Model(&user).Updates(map[string]interface{}{
+			"email_verified":    true,
+			"email_verified_at": time.Now(),
+		}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+}
+
+// ResendVerification emails the authenticated user a new verification link,
+// at most once every few minutes
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	userModel := user.(models.User)
+
+	if userModel.EmailVerified {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email is already verified"})
+		return
+	}
+
+	sent, err := h.sendVerification(userModel)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		return
+	}
+	if !sent {
+		retryAfter := verificationResendInterval
+		if userModel.VerificationSentAt != nil {
+			retryAfter = time.Until(userModel.VerificationSentAt.Add(verificationResendInterval))
+		}
+		seconds := int(math.Ceil(retryAfter.Seconds()))
+		c.Header("Retry-After", fmt.Sprint(seconds))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "A verification email was sent recently; please wait before asking again",
+			"retry_after": seconds,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
+
+// sendVerification emails a verification link unless one was sent within the
+// resend interval, reporting whether it sent one
+func (h *AuthHandler) sendVerification(user models.User) (bool, error) {
+	now := time.Now()
+	result := database.DB.Model(&models.User{}).
+		Where("id = ? AND (verification_sent_at IS NULL OR verification_sent_at <= ?)", user.ID, now.Add(-verificationResendInterval)).
+		Update("verification_sent_at", now)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	token, err := h.purposeToken(user, verifyEmailPurpose, now.Add(verificationTTL))
+	if err != nil {
+		return false, err
+	}
+
+	h.sendMail(mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by following the link below:\n\n%s\n\n"+
+			"The link expires in %d hours. If you did not create an account, you can ignore this email.\n",
+			user.Name, h.frontendLink("/auth/verify-email", token), int(verificationTTL.Hours())),
+	})
+	return true, nil
+}
+
+// parseVerificationToken checks a verification link, returning who it is for
+func (h *AuthHandler) parseVerificationToken(tokenString string) (uuid.UUID, string, error) {
+	claims, err := h.parsePurposeToken(tokenString, verifyEmailPurpose)
+	if err != nil {
+		return uuid.Nil, "", errInvalidVerification
+	}
+	email, _ := claims["email"].(string)
+	userID, err := uuid.Parse(fmt.Sprint(claims["sub"]))
+	if err != nil || email == "" {
+		return uuid.Nil, "", errInvalidVerification
+	}
+	return userID, email, nil
+}
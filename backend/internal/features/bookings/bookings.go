@@ -2,22 +2,47 @@
 package bookings
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
 	"time"
 
+	"golf-ezz-backend/internal/config"
 	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/features/courses"
+	"golf-ezz-backend/internal/features/households"
+	"golf-ezz-backend/internal/features/ledger"
+	"golf-ezz-backend/internal/features/loyalty"
+	"golf-ezz-backend/internal/features/memberships"
+	"golf-ezz-backend/internal/features/payments"
+	"golf-ezz-backend/internal/features/promotions"
 	"golf-ezz-backend/internal/models"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // BookingHandler handles booking-related requests
-type BookingHandler struct{}
+type BookingHandler struct {
+	config *config.Config
+}
+
+// Errors returned while cancelling a booking
+var (
+	errBookingNotFound  = errors.New("booking not found")
+	errAlreadyCancelled = errors.New("booking is already cancelled")
+	errTooLateToCancel  = errors.New("too late to cancel booking")
+)
+
+// errSlotTaken is returned when a tee time fills up while it is being booked
+var errSlotTaken = errors.New("time slot already booked")
 
 // NewBookingHandler creates a new booking handler
-func NewBookingHandler() *BookingHandler {
-	return &BookingHandler{}
+func NewBookingHandler(cfg *config.Config) *BookingHandler {
+	return &BookingHandler{config: cfg}
 }
 
 // TeeTimeBookingRequest represents a tee time booking request
@@ -26,7 +51,10 @@ type TeeTimeBookingRequest struct {
 	Date            time.Time `json:"date" binding:"required"`
 	Time            string    `json:"time" binding:"required"`
 	Players         int       `json:"players" binding:"required,min=1,max=4"`
+	Holes           int       `json:"holes" binding:"omitempty,oneof=9 18"`        // defaults to 18
+	StartingTee     int       `json:"starting_tee" binding:"omitempty,oneof=1 10"` // defaults to 1
 	SpecialRequests string    `json:"special_requests"`
+	PromoCode       string    `json:"promo_code"`
 }
 
 // RangeBookingRequest represents a range booking request
@@ -37,6 +65,7 @@ type RangeBookingRequest struct {
 	Duration    int       `json:"duration" binding:"required"` // in minutes
 	BucketSize  string    `json:"bucket_size" binding:"required"`
 	BucketCount int       `json:"bucket_count" binding:"required,min=1"`
+	PromoCode   string    `json:"promo_code"`
 }
 
 // GetMyBookings returns all bookings for the authenticated user
@@ -94,24 +123,82 @@ func (h *BookingHandler) CreateTeeTimeBooking(c *gin.Context) {
 		return
 	}
 
-	// Check for booking conflicts
-	var existingBooking models.TeeTimeBooking
-	if err := database.DB.Where("course_id = ? AND date = ? AND time = ?",
-		courseID, req.Date, req.Time).First(&existingBooking).Error; err == nil {
+	holes := req.Holes
+	if holes == 0 {
+		holes = 18
+	}
+	startingTee := req.StartingTee
+	if startingTee == 0 {
+		startingTee = 1
+	}
+
+	// Check tee capacity, including the crossover at the turn
+	sheet, err := loadTeeSheet(database.DB, course, req.Date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check availability"})
+		return
+	}
+	if !sheet.validTee(startingTee) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Starting tee not available on this course"})
+		return
+	}
+	start, err := courses.ParseClock(req.Time)
+	if err != nil || !sheet.onGrid(start) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Time is not a tee time on this course"})
+		return
+	}
+
+	// Reject rounds that would play into a scheduled closure
+	closures, err := courses.ClosuresForDate(database.DB, courseID, req.Date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check course closures"})
+		return
+	}
+	nines := sheet.nines(startingTee, start, holes)
+	if closure := courses.BlockingClosure(closures, course, nines); closure != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "Course is closed at the requested time",
+			"reason": closure.Reason,
+		})
+		return
+	}
+
+	if sheet.remaining(startingTee, start, holes) < req.Players {
 		c.JSON(http.StatusConflict, gin.H{"error": "Time slot already booked"})
 		return
 	}
 
-	// Calculate total amount based on day of week
-	var greenFee float64
-	weekday := req.Date.Weekday()
-	if weekday == time.Saturday || weekday == time.Sunday {
-		greenFee = course.GreenFeeWeekend
-	} else {
-		greenFee = course.GreenFeeWeekday
+	if !checkBookingPermission(c, userModel.ID, households.KindTeeTime) {
+		return
+	}
+
+	// Members' benefits come from the plan version they hold
+	benefits, err := memberships.BenefitsFor(database.DB, userModel.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check membership"})
+		return
+	}
+
+	advanceDays := course.BookingAdvanceDays
+	if benefits != nil && advanceDays > 0 {
+		advanceDays += benefits.BookingAdvantage
+	}
+	if advanceDays > 0 && req.Date.After(courses.DateOnly(time.Now()).AddDate(0, 0, advanceDays)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tee times can be booked at most " + strconv.Itoa(advanceDays) + " days in advance"})
+		return
 	}
 
-	totalAmount := greenFee * float64(req.Players)
+	price := teeTimeQuote(course, req.Date, holes, req.Players, closures, nines)
+	if benefits != nil {
+		allowed, err := memberRateAvailable(database.DB, userModel.ID, benefits, req.Date)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check membership"})
+			return
+		}
+		if allowed {
+			price.applyMemberDiscount(benefits)
+		}
+	}
 
 	// Create booking
 	specialRequests := req.SpecialRequests
@@ -121,13 +208,68 @@ func (h *BookingHandler) CreateTeeTimeBooking(c *gin.Context) {
 		Date:            req.Date,
 		Time:            req.Time,
 		Players:         req.Players,
+		Holes:           holes,
+		StartingTee:     startingTee,
 		Status:          "confirmed",
-		TotalAmount:     totalAmount,
 		PaymentStatus:   "pending",
 		SpecialRequests: &specialRequests,
 	}
 
-	if err := database.DB.Create(&booking).Error; err != nil {
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// Check capacity again under the tee sheet lock, so concurrent
+		// bookings cannot both take the last places in a slot or its crossover
+		if err := lockTeeSheet(tx, courseID, req.Date); err != nil {
+			return err
+		}
+		sheet, err := loadTeeSheet(tx, course, req.Date)
+		if err != nil {
+			return err
+		}
+		if sheet.remaining(startingTee, start, holes) < req.Players {
+			return errSlotTaken
+		}
+
+		if req.PromoCode != "" {
+			if err := price.applyPromoCode(tx, req.PromoCode, promotions.Usage{
+				Kind:     promotions.KindTeeTime,
+				UserID:   userModel.ID,
+				CourseID: courseID,
+				Date:     req.Date,
+				Time:     req.Time,
+				Players:  req.Players,
+			}); err != nil {
+				return err
+			}
+		}
+
+		if err := price.applyTax(tx, courseID); err != nil {
+			return err
+		}
+
+		booking.TotalAmount = price.due()
+		booking.PriceLines = price.lines
+		booking.PromoCode = price.promoCode()
+		booking.DiscountAmount = price.discountTotal()
+		booking.TaxLines = price.tax.Lines
+		booking.TaxAmount = price.tax.Tax
+		booking.TaxInclusive = price.tax.Inclusive
+		if err := tx.Create(&booking).Error; err != nil {
+			return err
+		}
+		if err := ledger.PostTeeTimeCharge(tx, &booking); err != nil {
+			return err
+		}
+		return price.redeem(tx, userModel.ID, &booking.ID, nil)
+	})
+	if errors.Is(err, errSlotTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Time slot already booked"})
+		return
+	}
+	if errors.Is(err, promotions.ErrNotApplicable) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create booking"})
 		return
 	}
@@ -196,21 +338,42 @@ func (h *BookingHandler) CreateRangeBooking(c *gin.Context) {
 		return
 	}
 
-	// Calculate total amount based on bucket size and count
-	bucketPrices := map[string]float64{
-		"small":  10.0,
-		"medium": 15.0,
-		"large":  20.0,
-		"jumbo":  25.0,
+	// The range shuts when the whole course is closed
+	from, err := courses.ParseClock(req.StartTime)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start time. Use HH:MM"})
+		return
+	}
+	closures, err := courses.ClosuresForDate(database.DB, courseID, req.Date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check course closures"})
+		return
+	}
+	if closure := courses.FacilityClosure(closures, course, from, from+max(req.Duration, 1)); closure != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "Course is closed at the requested time",
+			"reason": closure.Reason,
+		})
+		return
 	}
 
-	bucketPrice, exists := bucketPrices[req.BucketSize]
-	if !exists {
+	// Calculate total amount based on bucket size and count
+	price, err := rangeQuote(req.BucketSize, req.BucketCount)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bucket size"})
 		return
 	}
 
-	totalAmount := bucketPrice * float64(req.BucketCount)
+	if !checkBookingPermission(c, userModel.ID, households.KindRange) {
+		return
+	}
+
+	benefits, err := memberships.BenefitsFor(database.DB, userModel.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check membership"})
+		return
+	}
+	price.applyRangeBenefit(benefits)
 
 	// Create range booking
 	booking := models.RangeBooking{
@@ -221,12 +384,48 @@ func (h *BookingHandler) CreateRangeBooking(c *gin.Context) {
 		Duration:    req.Duration,
 		BucketSize:  req.BucketSize,
 		BucketCount: req.BucketCount,
-		TotalAmount: totalAmount,
 		Status:      "active",
 		UsedBuckets: 0,
 	}
 
-	if err := database.DB.Create(&booking).Error; err != nil {
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if req.PromoCode != "" {
+			if err := price.applyPromoCode(tx, req.PromoCode, promotions.Usage{
+				Kind:     promotions.KindRange,
+				UserID:   userModel.ID,
+				CourseID: courseID,
+				Date:     req.Date,
+				Time:     req.StartTime,
+				Players:  1,
+			}); err != nil {
+				return err
+			}
+		}
+
+		if err := price.applyTax(tx, courseID); err != nil {
+			return err
+		}
+
+		booking.TotalAmount = price.due()
+		booking.PriceLines = price.lines
+		booking.PromoCode = price.promoCode()
+		booking.DiscountAmount = price.discountTotal()
+		booking.TaxLines = price.tax.Lines
+		booking.TaxAmount = price.tax.Tax
+		booking.TaxInclusive = price.tax.Inclusive
+		if err := tx.Create(&booking).Error; err != nil {
+			return err
+		}
+		if err := ledger.PostRangeCharge(tx, &booking); err != nil {
+			return err
+		}
+		return price.redeem(tx, userModel.ID, nil, &booking.ID)
+	})
+	if errors.Is(err, promotions.ErrNotApplicable) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create range booking"})
 		return
 	}
@@ -240,6 +439,48 @@ func (h *BookingHandler) CreateRangeBooking(c *gin.Context) {
 	c.JSON(http.StatusCreated, booking)
 }
 
+// memberRateAvailable reports whether a member has tee times left at the
+// member rate in the month of date under their plan's monthly allowance,
+// which a household plan may share between everyone in the household
+func memberRateAvailable(db *gorm.DB, userID uuid.UUID, benefits *memberships.Benefits, date time.Time) (bool, error) {
+	if benefits.MaxBookingsMonth == 0 {
+		return true, nil
+	}
+
+	userIDs := []uuid.UUID{userID}
+	if benefits.HouseholdID != nil {
+		var err error
+		if userIDs, err = households.MemberIDs(db, *benefits.HouseholdID); err != nil {
+			return false, err
+		}
+	}
+
+	monthStart := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, date.Location())
+	var count int64
+	if err := db.Model(&models.TeeTimeBooking{}).
+		Where("user_id IN ? AND status <> ? AND date >= ? AND date < ?", userIDs, "cancelled", monthStart, monthStart.AddDate(0, 1, 0)).
+		Where("price_lines @> ?", `[{"category": "member_discount"}]`).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count < int64(benefits.MaxBookingsMonth), nil
+}
+
+// checkBookingPermission refuses bookings a household dependent has not been
+// allowed to make, writing the error response
+func checkBookingPermission(c *gin.Context, userID uuid.UUID, kind string) bool {
+	allowed, err := households.CanBook(database.DB, userID, kind)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check booking permissions"})
+		return false
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Your household's primary member has not allowed you to make this booking"})
+		return false
+	}
+	return true
+}
+
 // CancelBooking cancels a tee time booking
 func (h *BookingHandler) CancelBooking(c *gin.Context) {
 	user, exists := c.Get("user")
@@ -258,30 +499,93 @@ func (h *BookingHandler) CancelBooking(c *gin.Context) {
 		return
 	}
 
-	// Find booking
+	// The booking is locked while it is cancelled, so a second cancellation
+	// sees the first and cannot refund it again
 	var booking models.TeeTimeBooking
-	if err := database.DB.Where("id = ? AND user_id = ?", id, userModel.ID).First(&booking).Error; err != nil {
+	var percent float64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ?", id, userModel.ID).First(&booking).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errBookingNotFound
+			}
+			return err
+		}
+		if booking.Status == "cancelled" {
+			return errAlreadyCancelled
+		}
+
+		// Check if booking can be cancelled (e.g., not within 24 hours)
+		notice := time.Until(booking.Date)
+		if notice < 24*time.Hour {
+			return errTooLateToCancel
+		}
+		percent = cancellationRefundPercent(notice)
+
+		// Update booking status and write off what is still owed
+		booking.Status = "cancelled"
+		if err := tx.Save(&booking).Error; err != nil {
+			return err
+		}
+		return ledger.PostCancellation(tx, &models.JournalEntry{
+			Description: "Booking cancelled",
+			CourseID:    &booking.CourseID,
+			UserID:      &booking.UserID,
+			BookingID:   &booking.ID,
+		})
+	})
+	switch {
+	case errors.Is(err, errBookingNotFound):
 		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
 		return
-	}
-
-	// Check if booking can be cancelled (e.g., not within 24 hours)
-	if time.Until(booking.Date) < 24*time.Hour {
+	case errors.Is(err, errAlreadyCancelled):
+		c.JSON(http.StatusConflict, gin.H{"error": "Booking is already cancelled"})
+		return
+	case errors.Is(err, errTooLateToCancel):
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot cancel booking within 24 hours of tee time"})
 		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel booking"})
+		return
 	}
 
-	// Update booking status
-	booking.Status = "cancelled"
-	if err := database.DB.Save(&booking).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel booking"})
+	// A cancelled booking no longer uses up its promo code
+	if err := promotions.ReleaseRedemptions(database.DB, booking.ID); err != nil {
+		log.Printf("Failed to release promo code for booking %s: %v", booking.ID, err)
+	}
+
+	// Refund whatever the cancellation policy allows
+	refunds, err := payments.RefundBookingPayments(c.Request.Context(), database.DB, booking.ID,
+		percent, payments.ReasonCancellationPolicy, nil)
+	if err != nil {
+		log.Printf("Cancellation refund failed for booking %s: %v", booking.ID, err)
+		c.JSON(http.StatusOK, gin.H{
+			"message":      "Booking cancelled, but the refund could not be processed",
+			"refunds":      refunds,
+			"refund_error": err.Error(),
+		})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Booking cancelled successfully"})
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Booking cancelled successfully",
+		"refund_percent": percent,
+		"refunds":        refunds,
+	})
+}
+
+// cancellationRefundPercent returns the share of the amount paid that is
+// refunded when a member cancels with the given notice. Cancellations with
+// less than 24 hours' notice are not allowed.
+func cancellationRefundPercent(notice time.Duration) float64 {
+	if notice >= 48*time.Hour {
+		return 100
+	}
+	return 50
 }
 
-// GetAvailableTimeSlots returns available time slots for a given date and course
+// GetAvailableTimeSlots returns available time slots for a given date and course.
+// Optional query parameters: holes (9 or 18), tee (1 or 10) and players.
 func (h *BookingHandler) GetAvailableTimeSlots(c *gin.Context) {
 	courseID := c.Param("id")
 	dateStr := c.Query("date")
@@ -300,39 +604,68 @@ func (h *BookingHandler) GetAvailableTimeSlots(c *gin.Context) {
 		return
 	}
 
-	// Get existing bookings for the date
-	var bookedSlots []models.TeeTimeBooking
-	if err := database.DB.Where("course_id = ? AND date = ?", id, date).Find(&bookedSlots).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check availability"})
+	holes, err := strconv.Atoi(c.DefaultQuery("holes", "18"))
+	if err != nil || (holes != 9 && holes != 18) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "holes must be 9 or 18"})
 		return
 	}
 
-	// Generate available time slots (example: 7 AM to 7 PM, every 15 minutes)
-	availableSlots := []string{}
-	bookedTimes := make(map[string]bool)
+	players, err := strconv.Atoi(c.DefaultQuery("players", "1"))
+	if err != nil || players < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "players must be a positive number"})
+		return
+	}
 
-	for _, booking := range bookedSlots {
-		bookedTimes[booking.Time] = true
+	var course models.Course
+	if err := database.DB.First(&course, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Course not found"})
+		return
 	}
 
-	// Generate time slots from 7:00 AM to 7:00 PM
-	startHour := 7
-	endHour := 19
+	closures, err := courses.ClosuresForDate(database.DB, id, date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check course closures"})
+		return
+	}
 
-	for hour := startHour; hour <= endHour; hour++ {
-		for minute := 0; minute < 60; minute += 15 {
-			timeSlot := time.Date(2000, 1, 1, hour, minute, 0, 0, time.UTC).Format("15:04")
-			if !bookedTimes[timeSlot] {
-				availableSlots = append(availableSlots, timeSlot)
-			}
+	sheet, err := loadTeeSheet(database.DB, course, date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check availability"})
+		return
+	}
+
+	tees := sheet.tees()
+	if teeStr := c.Query("tee"); teeStr != "" {
+		tee, err := strconv.Atoi(teeStr)
+		if err != nil || !sheet.validTee(tee) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Starting tee not available on this course"})
+			return
+		}
+		tees = []int{tee}
+	}
+
+	slots := sheet.availability(tees, holes, players, closures)
+
+	// Distinct start times, kept for clients that only need the times
+	availableSlots := []string{}
+	seen := make(map[string]bool)
+	for _, slot := range slots {
+		if !seen[slot.Time] {
+			seen[slot.Time] = true
+			availableSlots = append(availableSlots, slot.Time)
 		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"course_id":       courseID,
 		"date":            dateStr,
+		"holes":           holes,
+		"players":         players,
+		"price":           greenFee(course, date, holes),
 		"available_slots": availableSlots,
 		"total_available": len(availableSlots),
+		"slots":           slots,
+		"closures":        closures,
 	})
 }
 
@@ -377,12 +710,21 @@ func (h *BookingHandler) UpdateBucketUsage(c *gin.Context) {
 	}
 
 	// Update used buckets
+	completing := booking.Status != "completed" && req.UsedBuckets >= booking.BucketCount
 	booking.UsedBuckets = req.UsedBuckets
 	if req.UsedBuckets >= booking.BucketCount {
 		booking.Status = "completed"
 	}
 
-	if err := database.DB.Save(&booking).Error; err != nil {
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&booking).Error; err != nil {
+			return err
+		}
+		if !completing {
+			return nil
+		}
+		return loyalty.EarnForRangeBooking(tx, h.config, &booking)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update bucket usage"})
 		return
 	}
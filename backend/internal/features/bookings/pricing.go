@@ -0,0 +1,204 @@
+package bookings
+
+import (
+	"fmt"
+	"time"
+
+	"golf-ezz-backend/internal/features/courses"
+	"golf-ezz-backend/internal/features/memberships"
+	"golf-ezz-backend/internal/features/promotions"
+	"golf-ezz-backend/internal/features/taxes"
+	"golf-ezz-backend/internal/models"
+	"golf-ezz-backend/internal/money"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// bucketPrices are the range prices per bucket by size
+var bucketPrices = map[string]money.Amount{
+	"small":  money.Cents(1000),
+	"medium": money.Cents(1500),
+	"large":  money.Cents(2000),
+	"jumbo":  money.Cents(2500),
+}
+
+// greenFee returns the per-player green fee for a round on the given date.
+// Nine-hole rounds use the course's nine-hole rates, falling back to half the
+// 18-hole fee when no nine-hole rate is configured.
+func greenFee(course models.Course, date time.Time, holes int) money.Amount {
+	weekend := date.Weekday() == time.Saturday || date.Weekday() == time.Sunday
+
+	fee := course.GreenFeeWeekday
+	nineHoleFee := course.NineHoleWeekday
+	if weekend {
+		fee = course.GreenFeeWeekend
+		nineHoleFee = course.NineHoleWeekend
+	}
+
+	if holes == 9 {
+		if nineHoleFee > 0 {
+			return nineHoleFee
+		}
+		return fee.Div(2)
+	}
+	return fee
+}
+
+// quote is the priced breakdown of a booking. Discounts are negative lines,
+// so the total is always the sum of the lines; tax is worked out separately
+// once the lines are final.
+type quote struct {
+	lines      models.InvoiceLines
+	coupon     *models.Coupon
+	couponLine money.Amount
+	tax        taxes.Breakdown
+}
+
+// teeTimeQuote prices a tee time, including any partial-closure discount
+func teeTimeQuote(course models.Course, date time.Time, holes, players int, closures []models.CourseClosure, nines []courses.Nine) *quote {
+	fee := greenFee(course, date, holes)
+	q := &quote{}
+	q.add(models.InvoiceLine{
+		Description: fmt.Sprintf("Green fee, %d holes", holes),
+		Category:    "green_fee",
+		Quantity:    players,
+		UnitPrice:   fee,
+		Amount:      fee.Mul(players),
+	})
+
+	// Partial closures (e.g. a nine under repair) may reduce the price
+	if percent := courses.PartialClosureDiscount(closures, course, nines); percent > 0 {
+		q.discount(fmt.Sprintf("Partial course closure (%g%% off)", percent), "closure_discount", q.total().Percent(percent))
+	}
+	return q
+}
+
+// rangeQuote prices a range booking
+func rangeQuote(bucketSize string, bucketCount int) (*quote, error) {
+	price, ok := bucketPrices[bucketSize]
+	if !ok {
+		return nil, fmt.Errorf("invalid bucket size")
+	}
+
+	q := &quote{}
+	q.add(models.InvoiceLine{
+		Description: fmt.Sprintf("Range, %s bucket", bucketSize),
+		Category:    "range",
+		Quantity:    bucketCount,
+		UnitPrice:   price,
+		Amount:      price.Mul(bucketCount),
+	})
+	return q, nil
+}
+
+// applyMemberDiscount takes the member's plan discount off a tee time
+func (q *quote) applyMemberDiscount(benefits *memberships.Benefits) {
+	if benefits == nil || benefits.DiscountPercent <= 0 {
+		return
+	}
+	q.discount(fmt.Sprintf("%s discount (%g%% off)", benefits.PlanName, benefits.DiscountPercent),
+		"member_discount", q.total().Percent(benefits.DiscountPercent))
+}
+
+// applyRangeBenefit zeroes a range booking for members whose plan includes the range
+func (q *quote) applyRangeBenefit(benefits *memberships.Benefits) {
+	if benefits == nil || !benefits.IncludesRange {
+		return
+	}
+	q.discount("Range included with "+benefits.PlanName, "member_discount", q.total())
+}
+
+// applyPromoCode checks a promo code against the booking and adds its
+// discount as its own line. tx must be the transaction that creates the
+// booking so the coupon stays locked until the redemption is recorded.
+func (q *quote) applyPromoCode(tx *gorm.DB, code string, usage promotions.Usage) error {
+	coupon, amount, err := promotions.Apply(tx, code, usage, q.total())
+	if err != nil {
+		return err
+	}
+	q.coupon = coupon
+	q.couponLine = q.discount("Promo code "+coupon.Code, "discount", amount)
+	return nil
+}
+
+// redeem records the promo code applied to the quote, if any, against the booking
+func (q *quote) redeem(tx *gorm.DB, userID uuid.UUID, bookingID, rangeBookingID *uuid.UUID) error {
+	if q.coupon == nil {
+		return nil
+	}
+	return promotions.Redeem(tx, q.coupon, &models.CouponRedemption{
+		UserID:         userID,
+		BookingID:      bookingID,
+		RangeBookingID: rangeBookingID,
+		GrossAmount:    q.total() + q.couponLine,
+		DiscountAmount: q.couponLine,
+	})
+}
+
+// applyTax works out the sales tax on the quote under the course's tax
+// profile. It must run after all discounts have been added.
+func (q *quote) applyTax(db *gorm.DB, courseID uuid.UUID) error {
+	profile, err := taxes.ForCourse(db, courseID)
+	if err != nil {
+		return err
+	}
+	q.tax = taxes.Calculate(profile, q.lines)
+	return nil
+}
+
+// due returns what the customer pays, including any tax added on top
+func (q *quote) due() money.Amount {
+	if q.tax.Inclusive {
+		return q.total()
+	}
+	return q.total() + q.tax.Tax
+}
+
+// promoCode returns the applied promo code, for storing on the booking
+func (q *quote) promoCode() *string {
+	if q.coupon == nil {
+		return nil
+	}
+	return &q.coupon.Code
+}
+
+// discountTotal returns the sum of all discount lines as a positive amount
+func (q *quote) discountTotal() money.Amount {
+	var total money.Amount
+	for _, line := range q.lines {
+		if line.Amount < 0 {
+			total -= line.Amount
+		}
+	}
+	return total
+}
+
+func (q *quote) add(line models.InvoiceLine) {
+	q.lines = append(q.lines, line)
+}
+
+// discount adds a discount line of amount (positive), capped at the running
+// total, and returns the amount applied
+func (q *quote) discount(description, category string, amount money.Amount) money.Amount {
+	amount = money.Min(amount, q.total())
+	if amount <= 0 {
+		return money.Zero
+	}
+	q.add(models.InvoiceLine{
+		Description: description,
+		Category:    category,
+		Quantity:    1,
+		UnitPrice:   -amount,
+		Amount:      -amount,
+	})
+	return amount
+}
+
+func (q *quote) total() money.Amount {
+	var total money.Amount
+	for _, line := range q.lines {
+		total += line.Amount
+	}
+	return total
+}
@@ -0,0 +1,116 @@
+package bookings
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/features/courses"
+	"golf-ezz-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// GetQuote prices a tee time or range booking without making it, showing the
+// line items, tax and total the customer would pay. Promo codes and member
+// benefits are applied when the booking is made.
+func (h *BookingHandler) GetQuote(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
+		return
+	}
+
+	date, err := time.Parse("2006-01-02", c.Query("date"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD"})
+		return
+	}
+
+	var course models.Course
+	if err := database.DB.First(&course, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Course not found"})
+		return
+	}
+
+	var price *quote
+	switch c.DefaultQuery("type", "tee_time") {
+	case "tee_time":
+		start, err := courses.ParseClock(c.Query("time"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		holes, err := strconv.Atoi(c.DefaultQuery("holes", "18"))
+		if err != nil || (holes != 9 && holes != 18) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "holes must be 9 or 18"})
+			return
+		}
+
+		players, err := strconv.Atoi(c.DefaultQuery("players", "1"))
+		if err != nil || players < 1 || players > 4 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "players must be between 1 and 4"})
+			return
+		}
+
+		sheet, err := newTeeSheet(course)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to price tee time"})
+			return
+		}
+		startingTee, err := strconv.Atoi(c.DefaultQuery("starting_tee", "1"))
+		if err != nil || !sheet.validTee(startingTee) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Starting tee not available on this course"})
+			return
+		}
+
+		closures, err := courses.ClosuresForDate(database.DB, id, date)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check course closures"})
+			return
+		}
+		nines := sheet.nines(startingTee, start, holes)
+		if closure := courses.BlockingClosure(closures, course, nines); closure != nil {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":  "Course is closed at the requested time",
+				"reason": closure.Reason,
+			})
+			return
+		}
+
+		price = teeTimeQuote(course, date, holes, players, closures, nines)
+
+	case "range":
+		count, err := strconv.Atoi(c.DefaultQuery("bucket_count", "1"))
+		if err != nil || count < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bucket_count must be a positive number"})
+			return
+		}
+		if price, err = rangeQuote(c.Query("bucket_size"), count); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bucket size"})
+			return
+		}
+
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be tee_time or range"})
+		return
+	}
+
+	if err := price.applyTax(database.DB, course.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate tax"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"course_id":     course.ID,
+		"lines":         price.lines,
+		"subtotal":      price.total(),
+		"tax_lines":     price.tax.Lines,
+		"tax":           price.tax.Tax,
+		"tax_inclusive": price.tax.Inclusive,
+		"total":         price.due(),
+	})
+}
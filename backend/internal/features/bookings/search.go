@@ -0,0 +1,260 @@
+package bookings
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/features/courses"
+	"golf-ezz-backend/internal/models"
+	"golf-ezz-backend/internal/money"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxSearchDays caps the date range of a single availability search
+const maxSearchDays = 14
+
+// AvailabilityResult is one bookable tee time returned by a cross-course search
+type AvailabilityResult struct {
+	CourseID       uuid.UUID    `json:"course_id"`
+	CourseName     string       `json:"course_name"`
+	Difficulty     string       `json:"difficulty"`
+	Date           string       `json:"date"`
+	Time           string       `json:"time"`
+	StartingTee    int          `json:"starting_tee"`
+	Holes          int          `json:"holes"`
+	Available      int          `json:"available"`
+	PricePerPlayer money.Amount `json:"price_per_player"`
+	TotalPrice     money.Amount `json:"total_price"`
+}
+
+// SearchAvailability searches tee times across all active courses.
+//
+// Query parameters: from and to (YYYY-MM-DD, to defaults to from), start_time
+// and end_time (HH:MM), players, holes, max_price (per player), difficulty,
+// amenities (comma separated, all must match), sort (time or price), page
+// and limit. max_price applies to the price after any partial-closure
+// discount, and tee times that have passed today are left out. Courses,
+// bookings and closures are each loaded in one query.
+func (h *BookingHandler) SearchAvailability(c *gin.Context) {
+	from, err := time.Parse("2006-01-02", c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date format. Use YYYY-MM-DD"})
+		return
+	}
+
+	to := from
+	if toStr := c.Query("to"); toStr != "" {
+		if to, err = time.Parse("2006-01-02", toStr); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date format. Use YYYY-MM-DD"})
+			return
+		}
+	}
+	if to.Before(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must not be before from"})
+		return
+	}
+	if to.Sub(from) > (maxSearchDays-1)*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Date range cannot exceed 14 days"})
+		return
+	}
+
+	windowStart, windowEnd := 0, 24*60
+	if v := c.Query("start_time"); v != "" {
+		if windowStart, err = courses.ParseClock(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if v := c.Query("end_time"); v != "" {
+		if windowEnd, err = courses.ParseClock(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	players, err := strconv.Atoi(c.DefaultQuery("players", "1"))
+	if err != nil || players < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "players must be a positive number"})
+		return
+	}
+
+	holes, err := strconv.Atoi(c.DefaultQuery("holes", "18"))
+	if err != nil || (holes != 9 && holes != 18) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "holes must be 9 or 18"})
+		return
+	}
+
+	maxPrice := money.Zero
+	if v := c.Query("max_price"); v != "" {
+		if maxPrice, err = money.Parse(v); err != nil || maxPrice < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid max_price"})
+			return
+		}
+	}
+
+	sortBy := c.DefaultQuery("sort", "time")
+	if sortBy != "time" && sortBy != "price" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be time or price"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	// Load matching courses
+	query := database.DB.Where("is_active = ?", true)
+	if difficulty := c.Query("difficulty"); difficulty != "" {
+		query = query.Where("LOWER(difficulty) = LOWER(?)", difficulty)
+	}
+	if amenities := c.Query("amenities"); amenities != "" {
+		var wanted models.StringArray
+		for _, amenity := range strings.Split(amenities, ",") {
+			if amenity = strings.TrimSpace(amenity); amenity != "" {
+				wanted = append(wanted, amenity)
+			}
+		}
+		query = query.Where("amenities @> ?", wanted)
+	}
+
+	var courseList []models.Course
+	if err := query.Find(&courseList).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search availability"})
+		return
+	}
+
+	courseIDs := make([]uuid.UUID, len(courseList))
+	for i, course := range courseList {
+		courseIDs[i] = course.ID
+	}
+
+	// Load all bookings and closures for the range up front
+	bookingsByDay := make(map[uuid.UUID]map[string][]models.TeeTimeBooking)
+	if len(courseIDs) > 0 {
+		var bookings []models.TeeTimeBooking
+		if err := database.DB.Where("course_id IN ? AND date BETWEEN ? AND ? AND status <> ?",
+			courseIDs, from, to, "cancelled").Find(&bookings).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search availability"})
+			return
+		}
+		for _, booking := range bookings {
+			if bookingsByDay[booking.CourseID] == nil {
+				bookingsByDay[booking.CourseID] = make(map[string][]models.TeeTimeBooking)
+			}
+			day := booking.Date.Format("2006-01-02")
+			bookingsByDay[booking.CourseID][day] = append(bookingsByDay[booking.CourseID][day], booking)
+		}
+	}
+
+	closures, err := courses.ClosuresForRange(database.DB, courseIDs, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search availability"})
+		return
+	}
+
+	now := time.Now()
+	today := courses.DateOnly(now)
+	nowMinute := now.Hour()*60 + now.Minute()
+	results := []AvailabilityResult{}
+
+	for _, course := range courseList {
+		for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+			if day.Before(today) {
+				continue
+			}
+			if course.BookingAdvanceDays > 0 && day.After(today.AddDate(0, 0, course.BookingAdvanceDays)) {
+				continue
+			}
+
+			price := greenFee(course, day, holes)
+
+			sheet, err := newTeeSheet(course)
+			if err != nil {
+				continue
+			}
+			dayKey := day.Format("2006-01-02")
+			for _, booking := range bookingsByDay[course.ID][dayKey] {
+				sheet.add(booking)
+			}
+
+			dayClosures := courses.ClosuresOnDate(closures[course.ID], day)
+			for _, slot := range sheet.availability(sheet.tees(), holes, players, dayClosures) {
+				minute, _ := courses.ParseClock(slot.Time)
+				if minute < windowStart || minute > windowEnd {
+					continue
+				}
+				// Tee times earlier today have already gone
+				if day.Equal(today) && minute < nowMinute {
+					continue
+				}
+
+				slotPrice := price
+				if discount := courses.PartialClosureDiscount(dayClosures, course, sheet.nines(slot.StartingTee, minute, holes)); discount > 0 {
+					slotPrice = price - price.Percent(discount)
+				}
+				if maxPrice > 0 && slotPrice > maxPrice {
+					continue
+				}
+
+				results = append(results, AvailabilityResult{
+					CourseID:       course.ID,
+					CourseName:     course.Name,
+					Difficulty:     course.Difficulty,
+					Date:           dayKey,
+					Time:           slot.Time,
+					StartingTee:    slot.StartingTee,
+					Holes:          holes,
+					Available:      slot.Available,
+					PricePerPlayer: slotPrice,
+					TotalPrice:     slotPrice.Mul(players),
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if sortBy == "price" && a.PricePerPlayer != b.PricePerPlayer {
+			return a.PricePerPlayer < b.PricePerPlayer
+		}
+		if a.Date != b.Date {
+			return a.Date < b.Date
+		}
+		if a.Time != b.Time {
+			return a.Time < b.Time
+		}
+		return a.CourseName < b.CourseName
+	})
+
+	total := len(results)
+	start := (page - 1) * limit
+	if start > total {
+		start = total
+	}
+	end := start + limit
+	if end > total {
+		end = total
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    results[start:end],
+		"pagination": gin.H{
+			"page":       page,
+			"limit":      limit,
+			"total":      total,
+			"totalPages": (total + limit - 1) / limit,
+		},
+	})
+}
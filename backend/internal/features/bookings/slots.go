@@ -0,0 +1,258 @@
+package bookings
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"golf-ezz-backend/internal/features/courses"
+	"golf-ezz-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Defaults used when a course has no slot settings of its own
+const (
+	defaultOpenTime         = "06:00"
+	defaultCloseTime        = "19:00"
+	defaultSlotDuration     = 15
+	defaultNineHoleDuration = 135
+	defaultMaxPlayers       = 4
+)
+
+// teeKey identifies one tee at one time of day (minutes after midnight)
+type teeKey struct {
+	Tee    int
+	Minute int
+}
+
+// teeSheet models tee capacity for one course on one day.
+//
+// Every booking occupies its starting tee at its tee time. An 18-hole round
+// also occupies the other tee when the group makes the turn, NineHoleDuration
+// minutes later rounded up to the slot grid: an 18-hole group off #1 at 08:00
+// takes capacity on #10 at 10:15, and a group off #10 at 08:00 takes capacity
+// on #1 at 10:15. On a nine-hole course both nines are played off #1.
+type teeSheet struct {
+	course   models.Course
+	open     int
+	close    int
+	step     int
+	nine     int
+	capacity int
+	occupied map[teeKey]int
+}
+
+// newTeeSheet creates an empty tee sheet using the course's slot settings
+func newTeeSheet(course models.Course) (*teeSheet, error) {
+	openTime, closeTime := course.OpenTime, course.CloseTime
+	if openTime == "" {
+		openTime = defaultOpenTime
+	}
+	if closeTime == "" {
+		closeTime = defaultCloseTime
+	}
+
+	open, err := courses.ParseClock(openTime)
+	if err != nil {
+		return nil, err
+	}
+	closing, err := courses.ParseClock(closeTime)
+	if err != nil {
+		return nil, err
+	}
+
+	sheet := &teeSheet{
+		course:   course,
+		open:     open,
+		close:    closing,
+		step:     course.SlotDuration,
+		nine:     course.NineHoleDuration,
+		capacity: course.MaxPlayersPerSlot,
+		occupied: make(map[teeKey]int),
+	}
+	if sheet.step <= 0 {
+		sheet.step = defaultSlotDuration
+	}
+	if sheet.nine <= 0 {
+		sheet.nine = defaultNineHoleDuration
+	}
+	if sheet.capacity <= 0 {
+		sheet.capacity = defaultMaxPlayers
+	}
+
+	return sheet, nil
+}
+
+// loadTeeSheet builds the tee sheet for a course and date from its active bookings
+func loadTeeSheet(db *gorm.DB, course models.Course, date time.Time) (*teeSheet, error) {
+	sheet, err := newTeeSheet(course)
+	if err != nil {
+		return nil, err
+	}
+
+	var bookings []models.TeeTimeBooking
+	if err := db.Where("course_id = ? AND date = ? AND status <> ?", course.ID, date, "cancelled").
+		Find(&bookings).Error; err != nil {
+		return nil, err
+	}
+
+	for _, booking := range bookings {
+		sheet.add(booking)
+	}
+
+	return sheet, nil
+}
+
+// lockTeeSheet holds a transaction-scoped advisory lock on a course's tee
+// sheet for a day, so bookings for it are checked and created one at a time
+func lockTeeSheet(tx *gorm.DB, courseID uuid.UUID, date time.Time) error {
+	key := "tee_sheet:" + courseID.String() + ":" + date.Format("2006-01-02")
+	return tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", key).Error
+}
+
+// add records the tee capacity taken by a booking
+func (s *teeSheet) add(booking models.TeeTimeBooking) {
+	start, err := courses.ParseClock(booking.Time)
+	if err != nil {
+		return
+	}
+	for _, key := range s.segments(booking.StartingTee, start, booking.Holes) {
+		s.occupied[key] += booking.Players
+	}
+}
+
+// tees returns the starting tees available on the course
+func (s *teeSheet) tees() []int {
+	if s.course.Holes > 0 && s.course.Holes < 18 {
+		return []int{1}
+	}
+	return []int{1, 10}
+}
+
+// validTee reports whether a round may start from the given tee
+func (s *teeSheet) validTee(tee int) bool {
+	for _, t := range s.tees() {
+		if t == tee {
+			return true
+		}
+	}
+	return false
+}
+
+// turnTee returns the tee a group plays from after the given tee's nine
+func (s *teeSheet) turnTee(tee int) int {
+	if len(s.tees()) == 1 || tee == 10 {
+		return 1
+	}
+	return 10
+}
+
+// crossover returns the slot at which a group starting at start reaches the turn
+func (s *teeSheet) crossover(start int) int {
+	turn := start + s.nine
+	if offset := (turn - s.open) % s.step; offset != 0 {
+		turn += s.step - offset
+	}
+	return turn
+}
+
+// segments returns the tee slots a round occupies
+func (s *teeSheet) segments(tee, start, holes int) []teeKey {
+	if tee == 0 {
+		tee = 1
+	}
+	keys := []teeKey{{Tee: tee, Minute: start}}
+	if holes != 9 {
+		keys = append(keys, teeKey{Tee: s.turnTee(tee), Minute: s.crossover(start)})
+	}
+	return keys
+}
+
+// nines returns the nines a round plays and when, for checking closures.
+// They follow the round's tee slots, so an 18-hole round is checked on the
+// other nine from its crossover time.
+func (s *teeSheet) nines(tee, start, holes int) []courses.Nine {
+	segments := s.segments(tee, start, holes)
+	nines := make([]courses.Nine, len(segments))
+	for i, key := range segments {
+		nines[i] = courses.Nine{Tee: key.Tee, From: key.Minute, To: key.Minute + s.nine}
+	}
+	return nines
+}
+
+// onGrid reports whether a start time is a bookable slot within opening hours
+func (s *teeSheet) onGrid(start int) bool {
+	return start >= s.open && start <= s.close && (start-s.open)%s.step == 0
+}
+
+// remaining returns how many more players a round starting at start can take
+func (s *teeSheet) remaining(tee, start, holes int) int {
+	remaining := s.capacity
+	for _, key := range s.segments(tee, start, holes) {
+		if free := s.capacity - s.occupied[key]; free < remaining {
+			remaining = free
+		}
+	}
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// starts returns every slot start time on the grid, in order
+func (s *teeSheet) starts() []int {
+	var starts []int
+	for minute := s.open; minute <= s.close; minute += s.step {
+		starts = append(starts, minute)
+	}
+	return starts
+}
+
+// SlotAvailability describes one bookable start on the tee sheet
+type SlotAvailability struct {
+	Time          string  `json:"time"`
+	StartingTee   int     `json:"starting_tee"`
+	Holes         int     `json:"holes"`
+	Available     int     `json:"available"`
+	CrossoverTime *string `json:"crossover_time,omitempty"`
+}
+
+// availability lists the starts that can take the given number of players
+func (s *teeSheet) availability(tees []int, holes, players int, closures []models.CourseClosure) []SlotAvailability {
+	var slots []SlotAvailability
+	for _, start := range s.starts() {
+		clock := formatClock(start)
+		for _, tee := range tees {
+			if courses.BlockingClosure(closures, s.course, s.nines(tee, start, holes)) != nil {
+				continue
+			}
+			available := s.remaining(tee, start, holes)
+			if available < players {
+				continue
+			}
+			slot := SlotAvailability{
+				Time:        clock,
+				StartingTee: tee,
+				Holes:       holes,
+				Available:   available,
+			}
+			if holes != 9 {
+				crossover := formatClock(s.crossover(start))
+				slot.CrossoverTime = &crossover
+			}
+			slots = append(slots, slot)
+		}
+	}
+
+	sort.SliceStable(slots, func(i, j int) bool {
+		return slots[i].Time < slots[j].Time
+	})
+	return slots
+}
+
+// formatClock formats minutes after midnight as HH:MM
+func formatClock(minute int) string {
+	return fmt.Sprintf("%02d:%02d", minute/60, minute%60)
+}
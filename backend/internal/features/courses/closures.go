@@ -0,0 +1,433 @@
+package courses
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CourseClosureRequest represents a request to schedule a course closure
+type CourseClosureRequest struct {
+	StartDate       string  `json:"start_date" binding:"required"` // YYYY-MM-DD
+	EndDate         string  `json:"end_date"`                      // YYYY-MM-DD, defaults to start_date
+	StartTime       *string `json:"start_time"`                    // HH:MM, omit for full day
+	EndTime         *string `json:"end_time"`                      // HH:MM, omit for full day
+	Holes           []int   `json:"holes"`                         // omit for the whole course
+	ClosureType     string  `json:"closure_type" binding:"omitempty,oneof=maintenance aeration event weather repair"`
+	Reason          string  `json:"reason" binding:"required"`
+	PriceAdjustment float64 `json:"price_adjustment" binding:"min=0,max=100"`
+}
+
+// ParseClock parses an HH:MM time of day into minutes after midnight
+func ParseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, use HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// DateOnly truncates a timestamp to midnight UTC of the same calendar day
+func DateOnly(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// ClosuresForDate returns the closures in effect for a course on the given date
+func ClosuresForDate(db *gorm.DB, courseID uuid.UUID, date time.Time) ([]models.CourseClosure, error) {
+	day := DateOnly(date)
+
+	var closures []models.CourseClosure
+	err := db.Where("course_id = ? AND start_date <= ? AND end_date >= ?", courseID, day, day).
+		Order("start_time ASC").
+		Find(&closures).Error
+	return closures, err
+}
+
+// ClosuresForRange returns the closures overlapping a date range for several
+// courses at once, grouped by course ID
+func ClosuresForRange(db *gorm.DB, courseIDs []uuid.UUID, from, to time.Time) (map[uuid.UUID][]models.CourseClosure, error) {
+	grouped := make(map[uuid.UUID][]models.CourseClosure)
+	if len(courseIDs) == 0 {
+		return grouped, nil
+	}
+
+	var closures []models.CourseClosure
+	if err := db.Where("course_id IN ? AND start_date <= ? AND end_date >= ?", courseIDs, DateOnly(to), DateOnly(from)).
+		Order("start_time ASC").
+		Find(&closures).Error; err != nil {
+		return nil, err
+	}
+
+	for _, closure := range closures {
+		grouped[closure.CourseID] = append(grouped[closure.CourseID], closure)
+	}
+	return grouped, nil
+}
+
+// ClosuresOnDate filters closures down to those in effect on the given date
+func ClosuresOnDate(closures []models.CourseClosure, date time.Time) []models.CourseClosure {
+	day := DateOnly(date)
+
+	var active []models.CourseClosure
+	for _, closure := range closures {
+		if !DateOnly(closure.StartDate).After(day) && !DateOnly(closure.EndDate).Before(day) {
+			active = append(active, closure)
+		}
+	}
+	return active
+}
+
+// Nine is one nine of a round: the tee it is played from and the minutes
+// after midnight the group is on it
+type Nine struct {
+	Tee  int
+	From int
+	To   int
+}
+
+// NineHoles returns the holes of the nine played from a tee. On a nine-hole
+// course every nine is holes 1-9.
+func NineHoles(course models.Course, tee int) []int {
+	first := 1
+	if tee == 10 && course.Holes >= 18 {
+		first = 10
+	}
+	last := first + 8
+	if course.Holes > 0 && course.Holes < last {
+		last = course.Holes
+	}
+
+	holes := make([]int, 0, last-first+1)
+	for hole := first; hole <= last; hole++ {
+		holes = append(holes, hole)
+	}
+	return holes
+}
+
+// closedHoles returns the distinct holes a closure covers
+func closedHoles(closure models.CourseClosure) map[int]bool {
+	closed := make(map[int]bool, len(closure.Holes))
+	for _, hole := range closure.Holes {
+		closed[hole] = true
+	}
+	return closed
+}
+
+// IsPartialClosure reports whether a closure only affects some of the course's holes
+func IsPartialClosure(closure models.CourseClosure, course models.Course) bool {
+	closed := len(closedHoles(closure))
+	return closed > 0 && closed < course.Holes
+}
+
+// ClosureOverlaps reports whether a closure is in force at any point between
+// from and to (minutes after midnight)
+func ClosureOverlaps(closure models.CourseClosure, from, to int) bool {
+	if closure.StartTime == nil || closure.EndTime == nil {
+		return true
+	}
+
+	start, err := ParseClock(*closure.StartTime)
+	if err != nil {
+		return false
+	}
+	end, err := ParseClock(*closure.EndTime)
+	if err != nil {
+		return false
+	}
+
+	return from < end && start < to
+}
+
+// closedOnNine counts how many of a nine's holes a closure shuts while the
+// group is playing it, out of the holes on that nine
+func closedOnNine(closure models.CourseClosure, course models.Course, nine Nine) (int, int) {
+	holes := NineHoles(course, nine.Tee)
+	if !ClosureOverlaps(closure, nine.From, nine.To) {
+		return 0, len(holes)
+	}
+	if !IsPartialClosure(closure, course) {
+		return len(holes), len(holes)
+	}
+
+	closed := closedHoles(closure)
+	count := 0
+	for _, hole := range holes {
+		if closed[hole] {
+			count++
+		}
+	}
+	return count, len(holes)
+}
+
+// BlockingClosure returns the closure that makes a round unbookable, if any:
+// one that shuts the whole course, or every hole of a nine, while the group
+// would be playing it
+func BlockingClosure(closures []models.CourseClosure, course models.Course, nines []Nine) *models.CourseClosure {
+	for i := range closures {
+		for _, nine := range nines {
+			if closed, holes := closedOnNine(closures[i], course, nine); closed == holes {
+				return &closures[i]
+			}
+		}
+	}
+	return nil
+}
+
+// FacilityClosure returns the closure that shuts the whole course at some
+// point between from and to (minutes after midnight), if any. Closures of
+// some holes only leave the course's other facilities, such as the range, open.
+func FacilityClosure(closures []models.CourseClosure, course models.Course, from, to int) *models.CourseClosure {
+	for i := range closures {
+		if !IsPartialClosure(closures[i], course) && ClosureOverlaps(closures[i], from, to) {
+			return &closures[i]
+		}
+	}
+	return nil
+}
+
+// PartialClosureDiscount returns the largest price adjustment (percentage)
+// of the partial closures that shut some of the holes a round plays
+func PartialClosureDiscount(closures []models.CourseClosure, course models.Course, nines []Nine) float64 {
+	discount := 0.0
+	for _, closure := range closures {
+		if closure.PriceAdjustment <= discount {
+			continue
+		}
+		for _, nine := range nines {
+			if closed, _ := closedOnNine(closure, course, nine); closed > 0 {
+				discount = closure.PriceAdjustment
+				break
+			}
+		}
+	}
+	return discount
+}
+
+// GetCourseClosures lists upcoming closures for a course
+func (h *CourseHandler) GetCourseClosures(c *gin.Context) {
+	parsedID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid course ID",
+		})
+		return
+	}
+
+	from := DateOnly(time.Now())
+	if fromStr := c.Query("from"); fromStr != "" {
+		if from, err = time.Parse("2006-01-02", fromStr); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid from date format. Use YYYY-MM-DD",
+			})
+			return
+		}
+	}
+
+	db := database.GetDB()
+	query := db.Where("course_id = ? AND end_date >= ?", parsedID, from)
+
+	if toStr := c.Query("to"); toStr != "" {
+		to, err := time.Parse("2006-01-02", toStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid to date format. Use YYYY-MM-DD",
+			})
+			return
+		}
+		query = query.Where("start_date <= ?", to)
+	}
+
+	var closures []models.CourseClosure
+	if err := query.Order("start_date ASC, start_time ASC").Find(&closures).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve course closures",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    closures,
+	})
+}
+
+// CreateCourseClosure schedules a closure for a course (admin only)
+func (h *CourseHandler) CreateCourseClosure(c *gin.Context) {
+	parsedID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid course ID",
+		})
+		return
+	}
+
+	var req CourseClosureRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	db := database.GetDB()
+
+	var course models.Course
+	if err := db.First(&course, parsedID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Course not found",
+		})
+		return
+	}
+
+	startDate, err := time.Parse("2006-01-02", req.StartDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid start_date format. Use YYYY-MM-DD",
+		})
+		return
+	}
+
+	endDate := startDate
+	if req.EndDate != "" {
+		if endDate, err = time.Parse("2006-01-02", req.EndDate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid end_date format. Use YYYY-MM-DD",
+			})
+			return
+		}
+	}
+	if endDate.Before(startDate) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "end_date must not be before start_date",
+		})
+		return
+	}
+
+	// A time range needs both ends, and must not be empty
+	if (req.StartTime == nil) != (req.EndTime == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "start_time and end_time must be provided together",
+		})
+		return
+	}
+	if req.StartTime != nil {
+		start, err := ParseClock(*req.StartTime)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		end, err := ParseClock(*req.EndTime)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if end <= start {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "end_time must be after start_time",
+			})
+			return
+		}
+	}
+
+	// Holes are stored once each and in order, so the count says whether
+	// the closure covers the whole course
+	seen := make(map[int]bool, len(req.Holes))
+	holes := []int{}
+	for _, hole := range req.Holes {
+		if hole < 1 || hole > course.Holes {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Hole %d does not exist on this course", hole),
+			})
+			return
+		}
+		if !seen[hole] {
+			seen[hole] = true
+			holes = append(holes, hole)
+		}
+	}
+	sort.Ints(holes)
+
+	closureType := req.ClosureType
+	if closureType == "" {
+		closureType = "maintenance"
+	}
+
+	closure := models.CourseClosure{
+		CourseID:        parsedID,
+		StartDate:       startDate,
+		EndDate:         endDate,
+		StartTime:       req.StartTime,
+		EndTime:         req.EndTime,
+		Holes:           models.IntArray(holes),
+		ClosureType:     closureType,
+		Reason:          req.Reason,
+		PriceAdjustment: req.PriceAdjustment,
+	}
+
+	if userID, ok := c.Get("user_id"); ok {
+		if adminID, err := uuid.Parse(fmt.Sprint(userID)); err == nil {
+			closure.CreatedBy = &adminID
+		}
+	}
+
+	if err := db.Create(&closure).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create course closure",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    closure,
+	})
+}
+
+// DeleteCourseClosure removes a scheduled closure (admin only)
+func (h *CourseHandler) DeleteCourseClosure(c *gin.Context) {
+	courseID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid course ID",
+		})
+		return
+	}
+
+	closureID, err := uuid.Parse(c.Param("closure_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid closure ID",
+		})
+		return
+	}
+
+	db := database.GetDB()
+	result := db.Where("id = ? AND course_id = ?", closureID, courseID).Delete(&models.CourseClosure{})
+
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to delete course closure",
+		})
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Course closure not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Course closure deleted successfully",
+	})
+}
@@ -0,0 +1,116 @@
+package courses
+
+import (
+	"testing"
+
+	"golf-ezz-backend/internal/models"
+)
+
+func clock(value string) *string {
+	return &value
+}
+
+func holeRange(first, last int) models.IntArray {
+	var holes models.IntArray
+	for hole := first; hole <= last; hole++ {
+		holes = append(holes, hole)
+	}
+	return holes
+}
+
+func TestBlockingClosure(t *testing.T) {
+	course := models.Course{Holes: 18}
+	backNine := models.CourseClosure{Holes: holeRange(10, 18), PriceAdjustment: 20}
+	morning := models.CourseClosure{StartTime: clock("09:00"), EndTime: clock("11:00")}
+	repeated := models.CourseClosure{Holes: models.IntArray{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1}}
+
+	eight := 8 * 60
+	tests := []struct {
+		name     string
+		closures []models.CourseClosure
+		nines    []Nine
+		blocked  bool
+	}{
+		{"front nine with back nine closed", []models.CourseClosure{backNine}, []Nine{{Tee: 1, From: eight, To: eight + 135}}, false},
+		{"off #10 with back nine closed", []models.CourseClosure{backNine}, []Nine{{Tee: 10, From: eight, To: eight + 135}}, true},
+		{"crossing to a closed back nine", []models.CourseClosure{backNine}, []Nine{{Tee: 1, From: eight, To: eight + 135}, {Tee: 10, From: eight + 135, To: eight + 270}}, true},
+		{"playing into a closure", []models.CourseClosure{morning}, []Nine{{Tee: 1, From: eight, To: eight + 135}}, true},
+		{"finishing as a closure starts", []models.CourseClosure{morning}, []Nine{{Tee: 1, From: 6*60 + 45, To: 9 * 60}}, false},
+		{"starting as a closure ends", []models.CourseClosure{morning}, []Nine{{Tee: 1, From: 11 * 60, To: 11*60 + 135}}, false},
+		{"one hole listed many times", []models.CourseClosure{repeated}, []Nine{{Tee: 1, From: eight, To: eight + 135}}, false},
+		{"whole course", []models.CourseClosure{{}}, []Nine{{Tee: 10, From: eight, To: eight + 135}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BlockingClosure(tt.closures, course, tt.nines) != nil; got != tt.blocked {
+				t.Errorf("BlockingClosure() blocked = %v, want %v", got, tt.blocked)
+			}
+		})
+	}
+}
+
+func TestPartialClosureDiscount(t *testing.T) {
+	course := models.Course{Holes: 18}
+	greens := models.CourseClosure{Holes: models.IntArray{3, 4}, PriceAdjustment: 15}
+	backNine := models.CourseClosure{Holes: holeRange(10, 18), PriceAdjustment: 20}
+
+	front := Nine{Tee: 1, From: 480, To: 615}
+	tests := []struct {
+		name     string
+		closures []models.CourseClosure
+		nines    []Nine
+		want     float64
+	}{
+		{"plays closed greens", []models.CourseClosure{greens}, []Nine{front}, 15},
+		{"misses closed greens", []models.CourseClosure{greens}, []Nine{{Tee: 10, From: 480, To: 615}}, 0},
+		{"other nine closed", []models.CourseClosure{backNine}, []Nine{front}, 0},
+		{"largest applies", []models.CourseClosure{greens, {Holes: models.IntArray{5}, PriceAdjustment: 25}}, []Nine{front}, 25},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PartialClosureDiscount(tt.closures, course, tt.nines); got != tt.want {
+				t.Errorf("PartialClosureDiscount() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFacilityClosure(t *testing.T) {
+	course := models.Course{Holes: 18}
+	morning := models.CourseClosure{StartTime: clock("09:00"), EndTime: clock("11:00")}
+	greens := models.CourseClosure{Holes: models.IntArray{3, 4}}
+	everyHole := models.CourseClosure{Holes: holeRange(1, 18)}
+
+	tests := []struct {
+		name     string
+		closures []models.CourseClosure
+		from, to int
+		closed   bool
+	}{
+		{"during a closure", []models.CourseClosure{morning}, 10 * 60, 11 * 60, true},
+		{"running into a closure", []models.CourseClosure{morning}, 8*60 + 30, 9*60 + 30, true},
+		{"ending as a closure starts", []models.CourseClosure{morning}, 8 * 60, 9 * 60, false},
+		{"some holes closed", []models.CourseClosure{greens}, 10 * 60, 11 * 60, false},
+		{"every hole listed", []models.CourseClosure{everyHole}, 10 * 60, 11 * 60, true},
+		{"whole day", []models.CourseClosure{{}}, 10 * 60, 11 * 60, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FacilityClosure(tt.closures, course, tt.from, tt.to) != nil; got != tt.closed {
+				t.Errorf("FacilityClosure() closed = %v, want %v", got, tt.closed)
+			}
+		})
+	}
+}
+
+func TestNineHoles(t *testing.T) {
+	if got := NineHoles(models.Course{Holes: 18}, 10); len(got) != 9 || got[0] != 10 || got[8] != 18 {
+		t.Errorf("NineHoles(18, #10) = %v", got)
+	}
+	if got := NineHoles(models.Course{Holes: 9}, 10); len(got) != 9 || got[0] != 1 {
+		t.Errorf("NineHoles(9, #10) = %v", got)
+	}
+}
@@ -0,0 +1,517 @@
+package giftcards
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golf-ezz-backend/internal/config"
+	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/middleware"
+	"golf-ezz-backend/internal/models"
+	"golf-ezz-backend/internal/money"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// GiftCardHandler handles gift card and wallet requests
+type GiftCardHandler struct {
+	config *config.Config
+}
+
+// NewGiftCardHandler creates a new gift card handler
+func NewGiftCardHandler(cfg *config.Config) *GiftCardHandler {
+	return &GiftCardHandler{config: cfg}
+}
+
+// IssueGiftCardRequest represents a request to issue a gift card
+type IssueGiftCardRequest struct {
+	Amount        money.Amount `json:"amount" binding:"required,gt=0"`
+	ExpiresAt     *time.Time   `json:"expires_at"` // defaults to the configured validity
+	PurchaserID   string       `json:"purchaser_id"`
+	RecipientName string       `json:"recipient_name"`
+	Notes         string       `json:"notes"`
+}
+
+// AdjustmentRequest represents an admin correction to a gift card or wallet
+// balance. Amount is signed; a reason is required for the audit trail.
+type AdjustmentRequest struct {
+	Amount    money.Amount `json:"amount"`
+	Reason    string       `json:"reason" binding:"required"`
+	ExpiresAt *time.Time   `json:"expires_at"` // gift cards only: extends or reinstates the card
+}
+
+// VoidGiftCardRequest represents a request to void a gift card
+type VoidGiftCardRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// LoadGiftCardRequest represents a request to move a gift card balance into the member's wallet
+type LoadGiftCardRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// IssueGiftCard creates a gift card with a unique code (admin only)
+func (h *GiftCardHandler) IssueGiftCard(c *gin.Context) {
+	var req IssueGiftCardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	card := models.GiftCard{
+		InitialBalance: req.Amount,
+		Currency:       h.config.Payment.Currency,
+		Status:         "active",
+		IssuedBy:       adminID(c),
+	}
+
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+			return
+		}
+		card.ExpiresAt = req.ExpiresAt
+	} else if h.config.Payment.GiftCardValidity > 0 {
+		expiresAt := time.Now().AddDate(0, h.config.Payment.GiftCardValidity, 0)
+		card.ExpiresAt = &expiresAt
+	}
+
+	if req.PurchaserID != "" {
+		id, err := uuid.Parse(req.PurchaserID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchaser ID"})
+			return
+		}
+		card.PurchaserID = &id
+	}
+	if req.RecipientName != "" {
+		card.RecipientName = &req.RecipientName
+	}
+	if req.Notes != "" {
+		card.Notes = &req.Notes
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Codes are random, so a collision is rare; retry a few times if it happens
+		for attempt := 0; ; attempt++ {
+			code, err := generateCode()
+			if err != nil {
+				return err
+			}
+			var taken int64
+			if err := tx.Model(&models.GiftCard{}).Where("code = ?", code).Count(&taken).Error; err != nil {
+				return err
+			}
+			if taken == 0 {
+				card.Code = code
+				break
+			}
+			if attempt == 4 {
+				return fmt.Errorf("could not generate a unique gift card code")
+			}
+		}
+
+		if err := tx.Create(&card).Error; err != nil {
+			return err
+		}
+		return postCardEntry(tx, &card, &models.StoredValueTransaction{
+			Type:        EntryIssue,
+			Amount:      card.InitialBalance,
+			PerformedBy: card.IssuedBy,
+		})
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue gift card"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, card)
+}
+
+// GetGiftCards lists gift cards, optionally filtered by status or code (admin only)
+func (h *GiftCardHandler) GetGiftCards(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	query := database.DB.Model(&models.GiftCard{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if code := c.Query("code"); code != "" {
+		query = query.Where("code = ?", NormalizeCode(code))
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var cards []models.GiftCard
+	if err := query.Order("created_at DESC").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&cards).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve gift cards"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"gift_cards": cards,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// GetGiftCard returns a gift card with its full ledger (admin only)
+func (h *GiftCardHandler) GetGiftCard(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid gift card ID"})
+		return
+	}
+
+	var card models.GiftCard
+	if err := database.DB.First(&card, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gift card not found"})
+		return
+	}
+
+	var entries []models.StoredValueTransaction
+	if err := database.DB.Where("gift_card_id = ?", card.ID).
+		Order("created_at ASC").
+		Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve gift card ledger"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"gift_card":    card,
+		"transactions": entries,
+	})
+}
+
+// AdjustGiftCard corrects a gift card balance or expiry date (admin only)
+func (h *GiftCardHandler) AdjustGiftCard(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid gift card ID"})
+		return
+	}
+
+	var req AdjustmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Amount == 0 && req.ExpiresAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide an amount or a new expires_at"})
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	var card *models.GiftCard
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if card, err = lockCardByID(tx, id); err != nil {
+			return err
+		}
+		if card.Status == "void" {
+			return fmt.Errorf("%w: card is void", ErrCardNotRedeemable)
+		}
+
+		reason := req.Reason
+		if req.ExpiresAt != nil {
+			// A new expiry date reinstates an expired card; its forfeited
+			// balance is only restored by an explicit amount
+			previous := "none"
+			if card.ExpiresAt != nil {
+				previous = card.ExpiresAt.Format("2006-01-02")
+			}
+			reason = fmt.Sprintf("%s (expiry %s -> %s)", req.Reason, previous, req.ExpiresAt.Format("2006-01-02"))
+			card.ExpiresAt = req.ExpiresAt
+			if card.Status == "expired" {
+				card.Status = "depleted"
+				if card.Balance > 0 {
+					card.Status = "active"
+				}
+			}
+			if err := tx.Model(card).Updates(map[string]interface{}{
+				"expires_at": card.ExpiresAt,
+				"status":     card.Status,
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		return postCardEntry(tx, card, &models.StoredValueTransaction{
+			Type:        EntryAdjustment,
+			Amount:      req.Amount,
+			Reason:      &reason,
+			PerformedBy: adminID(c),
+		})
+	})
+	if err != nil {
+		respondLedgerError(c, err, "Gift card not found", "Failed to adjust gift card")
+		return
+	}
+
+	c.JSON(http.StatusOK, card)
+}
+
+// VoidGiftCard cancels a gift card and forfeits its remaining balance (admin only)
+func (h *GiftCardHandler) VoidGiftCard(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid gift card ID"})
+		return
+	}
+
+	var req VoidGiftCardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var card *models.GiftCard
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if card, err = lockCardByID(tx, id); err != nil {
+			return err
+		}
+		if card.Status == "void" {
+			return fmt.Errorf("%w: card is already void", ErrCardNotRedeemable)
+		}
+
+		if err := postCardEntry(tx, card, &models.StoredValueTransaction{
+			Type:        EntryAdjustment,
+			Amount:      -card.Balance,
+			Reason:      &req.Reason,
+			PerformedBy: adminID(c),
+		}); err != nil {
+			return err
+		}
+		card.Status = "void"
+		return tx.Model(card).Update("status", card.Status).Error
+	})
+	if err != nil {
+		respondLedgerError(c, err, "Gift card not found", "Failed to void gift card")
+		return
+	}
+
+	c.JSON(http.StatusOK, card)
+}
+
+// CheckBalance returns the balance of a gift card by its code
+func (h *GiftCardHandler) CheckBalance(c *gin.Context) {
+	code := c.Query("code")
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+
+	var card *models.GiftCard
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		card, err = lockCard(tx, code)
+		return err
+	})
+	if err != nil {
+		respondLedgerError(c, err, "Gift card not found", "Failed to check gift card")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":       card.Code,
+		"balance":    card.Balance,
+		"currency":   card.Currency,
+		"status":     card.Status,
+		"expires_at": card.ExpiresAt,
+	})
+}
+
+// GetMyWallet returns the authenticated user's wallet and recent transactions
+func (h *GiftCardHandler) GetMyWallet(c *gin.Context) {
+	userModel, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	h.respondWallet(c, userModel.ID, 50)
+}
+
+// LoadGiftCard moves the whole balance of a gift card into the authenticated user's wallet
+func (h *GiftCardHandler) LoadGiftCard(c *gin.Context) {
+	userModel, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	var req LoadGiftCardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var wallet *models.Wallet
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		card, err := lockCard(tx, req.Code)
+		if err != nil {
+			return err
+		}
+		if err := redeemable(card); err != nil {
+			return err
+		}
+		if wallet, err = lockWallet(tx, userModel.ID, h.config.Payment.Currency); err != nil {
+			return err
+		}
+		if wallet.Currency != card.Currency {
+			return fmt.Errorf("%w: card is in %s", ErrCardNotRedeemable, card.Currency)
+		}
+
+		debit := &models.StoredValueTransaction{Type: EntryTransfer, Amount: -card.Balance}
+		if err := postCardEntry(tx, card, debit); err != nil {
+			return err
+		}
+		return postWalletEntry(tx, wallet, &models.StoredValueTransaction{
+			Type:      EntryTransfer,
+			Amount:    -debit.Amount,
+			RelatedID: &debit.ID,
+		})
+	})
+	if err != nil {
+		respondLedgerError(c, err, "Gift card not found", "Failed to load gift card")
+		return
+	}
+
+	c.JSON(http.StatusOK, wallet)
+}
+
+// GetUserWallet returns a user's wallet with its full ledger (admin only)
+func (h *GiftCardHandler) GetUserWallet(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	h.respondWallet(c, userID, 0)
+}
+
+// AdjustWallet credits or debits a user's wallet (admin only)
+func (h *GiftCardHandler) AdjustWallet(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req AdjustmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Amount == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount must not be zero"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var wallet *models.Wallet
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if wallet, err = lockWallet(tx, user.ID, h.config.Payment.Currency); err != nil {
+			return err
+		}
+		return postWalletEntry(tx, wallet, &models.StoredValueTransaction{
+			Type:        EntryAdjustment,
+			Amount:      req.Amount,
+			Reason:      &req.Reason,
+			PerformedBy: adminID(c),
+		})
+	})
+	if err != nil {
+		respondLedgerError(c, err, "Wallet not found", "Failed to adjust wallet")
+		return
+	}
+
+	c.JSON(http.StatusOK, wallet)
+}
+
+// respondWallet writes a user's wallet and its most recent ledger entries
+// (all of them when limit is 0)
+func (h *GiftCardHandler) respondWallet(c *gin.Context, userID uuid.UUID, limit int) {
+	var wallet models.Wallet
+	err := database.DB.Where("user_id = ?", userID).First(&wallet).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Wallets are created on first use; report an empty one until then
+		c.JSON(http.StatusOK, gin.H{
+			"wallet":       models.Wallet{UserID: userID, Currency: h.config.Payment.Currency},
+			"transactions": []models.StoredValueTransaction{},
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve wallet"})
+		return
+	}
+
+	query := database.DB.Where("wallet_id = ?", wallet.ID).Order("created_at DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	var entries []models.StoredValueTransaction
+	if err := query.Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve wallet ledger"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"wallet":       wallet,
+		"transactions": entries,
+	})
+}
+
+// respondLedgerError maps ledger errors onto HTTP responses
+func respondLedgerError(c *gin.Context, err error, notFound, failed string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+	case errors.Is(err, ErrInsufficientBalance), errors.Is(err, ErrCardNotRedeemable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": failed})
+	}
+}
+
+// adminID returns the ID of the authenticated admin, for the audit trail
+func adminID(c *gin.Context) *uuid.UUID {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		return nil
+	}
+	id, err := uuid.Parse(fmt.Sprint(userID))
+	if err != nil {
+		return nil
+	}
+	return &id
+}
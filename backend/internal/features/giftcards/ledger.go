@@ -0,0 +1,196 @@
+// Package giftcards provides gift cards and member wallets: stored-value
+// balances that can pay for bookings and are tracked in a transaction ledger
+package giftcards
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"golf-ezz-backend/internal/features/ledger"
+	"golf-ezz-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Ledger entry types
+const (
+	EntryIssue      = "issue"
+	EntryRedeem     = "redeem"
+	EntryVoid       = "void"
+	EntryRefund     = "refund"
+	EntryTransfer   = "transfer"
+	EntryAdjustment = "adjustment"
+	EntryExpire     = "expire"
+)
+
+// ErrInsufficientBalance is returned when a debit exceeds the available balance
+var ErrInsufficientBalance = errors.New("insufficient balance")
+
+// ErrCardNotRedeemable is returned for gift cards that are expired, void or depleted
+var ErrCardNotRedeemable = errors.New("gift card cannot be redeemed")
+
+// codeAlphabet leaves out characters that are easily confused when read aloud
+const codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// generateCode returns a random gift card code in the form XXXX-XXXX-XXXX-XXXX
+func generateCode() (string, error) {
+	var code strings.Builder
+	max := big.NewInt(int64(len(codeAlphabet)))
+	for i := 0; i < 16; i++ {
+		if i > 0 && i%4 == 0 {
+			code.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code.WriteByte(codeAlphabet[n.Int64()])
+	}
+	return code.String(), nil
+}
+
+// NormalizeCode formats user-entered codes the way they are stored, so
+// "abcd efgh-jkmn pqrs" finds ABCD-EFGH-JKMN-PQRS
+func NormalizeCode(input string) string {
+	var raw strings.Builder
+	for _, r := range strings.ToUpper(input) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			raw.WriteRune(r)
+		}
+	}
+
+	code := raw.String()
+	if len(code) != 16 {
+		return code
+	}
+	return code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16]
+}
+
+// lockCard loads a gift card by code for update, expiring it first if due
+func lockCard(tx *gorm.DB, code string) (*models.GiftCard, error) {
+	var card models.GiftCard
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("code = ?", NormalizeCode(code)).
+		First(&card).Error; err != nil {
+		return nil, err
+	}
+	if err := expireIfDue(tx, &card, time.Now()); err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
+
+// lockCardByID loads a gift card by ID for update, expiring it first if due
+func lockCardByID(tx *gorm.DB, id uuid.UUID) (*models.GiftCard, error) {
+	var card models.GiftCard
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&card, id).Error; err != nil {
+		return nil, err
+	}
+	if err := expireIfDue(tx, &card, time.Now()); err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
+
+// lockWallet loads a user's wallet for update, creating an empty one on first use
+func lockWallet(tx *gorm.DB, userID uuid.UUID, currency string) (*models.Wallet, error) {
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.Wallet{UserID: userID, Currency: currency}).Error; err != nil {
+		return nil, err
+	}
+
+	var wallet models.Wallet
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ?", userID).
+		First(&wallet).Error; err != nil {
+		return nil, err
+	}
+	return &wallet, nil
+}
+
+// expireIfDue closes out the balance of a gift card past its expiry date. The
+// forfeited amount is recorded in the ledger so it can be reported.
+func expireIfDue(tx *gorm.DB, card *models.GiftCard, now time.Time) error {
+	if card.ExpiresAt == nil || now.Before(*card.ExpiresAt) {
+		return nil
+	}
+	if card.Status != "active" && card.Status != "depleted" {
+		return nil
+	}
+
+	reason := "Expired " + card.ExpiresAt.Format("2006-01-02")
+	if err := postCardEntry(tx, card, &models.StoredValueTransaction{
+		Type:   EntryExpire,
+		Amount: -card.Balance,
+		Reason: &reason,
+	}); err != nil {
+		return err
+	}
+	card.Status = "expired"
+	return tx.Model(card).Update("status", card.Status).Error
+}
+
+// postCardEntry moves a locked gift card's balance by entry.Amount and appends
+// the entry to its ledger and, where no payment covers it, the revenue ledger
+func postCardEntry(tx *gorm.DB, card *models.GiftCard, entry *models.StoredValueTransaction) error {
+	balance := card.Balance + entry.Amount
+	if balance < 0 {
+		return ErrInsufficientBalance
+	}
+
+	entry.GiftCardID = &card.ID
+	entry.BalanceAfter = balance
+	if err := tx.Create(entry).Error; err != nil {
+		return err
+	}
+	if err := ledger.PostStoredValue(tx, entry); err != nil {
+		return err
+	}
+
+	card.Balance = balance
+	switch {
+	case card.Status == "active" && balance == 0:
+		card.Status = "depleted"
+	case card.Status == "depleted" && balance > 0:
+		card.Status = "active"
+	}
+	return tx.Model(card).Updates(map[string]interface{}{
+		"balance": card.Balance,
+		"status":  card.Status,
+	}).Error
+}
+
+// postWalletEntry moves a locked wallet's balance by entry.Amount and appends
+// the entry to its ledger and, where no payment covers it, the revenue ledger
+func postWalletEntry(tx *gorm.DB, wallet *models.Wallet, entry *models.StoredValueTransaction) error {
+	balance := wallet.Balance + entry.Amount
+	if balance < 0 {
+		return ErrInsufficientBalance
+	}
+
+	entry.WalletID = &wallet.ID
+	entry.BalanceAfter = balance
+	if err := tx.Create(entry).Error; err != nil {
+		return err
+	}
+	if err := ledger.PostStoredValue(tx, entry); err != nil {
+		return err
+	}
+
+	wallet.Balance = balance
+	return tx.Model(wallet).Update("balance", wallet.Balance).Error
+}
+
+// redeemable reports why a card cannot currently be spent, if it cannot
+func redeemable(card *models.GiftCard) error {
+	if card.Status != "active" {
+		return fmt.Errorf("%w: card is %s", ErrCardNotRedeemable, card.Status)
+	}
+	return nil
+}
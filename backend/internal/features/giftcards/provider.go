@@ -0,0 +1,217 @@
+package giftcards
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"golf-ezz-backend/internal/features/payments"
+	"golf-ezz-backend/internal/models"
+	"golf-ezz-backend/internal/money"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// StoredValueProvider is a payment provider that spends gift card or wallet
+// balances. Authorization debits the balance straight away so two payments
+// cannot spend the same money; capture confirms the debit and void returns it.
+// Transaction IDs are the IDs of the redeem ledger entries.
+type StoredValueProvider struct {
+	db   *gorm.DB
+	name string
+}
+
+// NewGiftCardProvider creates the provider for payment_method "gift_card".
+// The charge source is the gift card code.
+func NewGiftCardProvider(db *gorm.DB) *StoredValueProvider {
+	return &StoredValueProvider{db: db, name: "gift_card"}
+}
+
+// NewWalletProvider creates the provider for payment_method "wallet". The
+// customer's own wallet is charged.
+func NewWalletProvider(db *gorm.DB) *StoredValueProvider {
+	return &StoredValueProvider{db: db, name: "wallet"}
+}
+
+// Name returns the provider's registry name
+func (p *StoredValueProvider) Name() string {
+	return p.name
+}
+
+// Authorize debits the requested amount from the card or wallet
+func (p *StoredValueProvider) Authorize(ctx context.Context, req payments.ChargeRequest) (payments.Result, error) {
+	if req.Amount <= 0 {
+		return payments.Result{}, fmt.Errorf("amount must be positive")
+	}
+
+	var paymentID *uuid.UUID
+	if id, err := uuid.Parse(req.Reference); err == nil {
+		paymentID = &id
+	}
+
+	entry := &models.StoredValueTransaction{
+		Type:      EntryRedeem,
+		Amount:    -req.Amount,
+		PaymentID: paymentID,
+	}
+
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if p.name == "wallet" {
+			userID, err := uuid.Parse(req.Customer)
+			if err != nil {
+				return fmt.Errorf("invalid customer %q", req.Customer)
+			}
+			wallet, err := lockWallet(tx, userID, req.Currency)
+			if err != nil {
+				return err
+			}
+			if wallet.Currency != req.Currency {
+				return fmt.Errorf("%w: wallet is in %s", payments.ErrDeclined, wallet.Currency)
+			}
+			return postWalletEntry(tx, wallet, entry)
+		}
+
+		card, err := lockCard(tx, req.Source)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: unknown gift card", payments.ErrDeclined)
+		}
+		if err != nil {
+			return err
+		}
+		if err := redeemable(card); err != nil {
+			return fmt.Errorf("%w: %v", payments.ErrDeclined, err)
+		}
+		if card.Currency != req.Currency {
+			return fmt.Errorf("%w: gift card is in %s", payments.ErrDeclined, card.Currency)
+		}
+		return postCardEntry(tx, card, entry)
+	})
+	if errors.Is(err, ErrInsufficientBalance) {
+		return payments.Result{}, fmt.Errorf("%w: %v", payments.ErrDeclined, err)
+	}
+	if err != nil {
+		return payments.Result{}, err
+	}
+	return payments.Result{TransactionID: entry.ID.String(), Status: "authorized"}, nil
+}
+
+// Capture confirms a debit made at authorization
+func (p *StoredValueProvider) Capture(ctx context.Context, transactionID string, amount money.Amount) (payments.Result, error) {
+	redemption, err := p.redemption(p.db.WithContext(ctx), transactionID)
+	if err != nil {
+		return payments.Result{}, err
+	}
+
+	var voided int64
+	p.db.WithContext(ctx).Model(&models.StoredValueTransaction{}).
+		Where("related_id = ? AND type = ?", redemption.ID, EntryVoid).
+		Count(&voided)
+	if voided > 0 {
+		return payments.Result{}, fmt.Errorf("transaction %s was voided", transactionID)
+	}
+	if amount > -redemption.Amount {
+		return payments.Result{}, fmt.Errorf("capture exceeds authorized amount")
+	}
+	return payments.Result{TransactionID: transactionID, Status: "captured"}, nil
+}
+
+// Refund credits all or part of a redemption back to the card or wallet it
+// came from. Refunds to an expired or void card are still recorded, but the
+// card stays unusable until an admin reinstates it.
+func (p *StoredValueProvider) Refund(ctx context.Context, transactionID string, amount money.Amount) (payments.Result, error) {
+	entry, err := p.reverse(ctx, transactionID, EntryRefund, amount)
+	if err != nil {
+		return payments.Result{}, err
+	}
+	return payments.Result{TransactionID: entry.ID.String(), Status: "refunded"}, nil
+}
+
+// Void returns the full amount of a redemption
+func (p *StoredValueProvider) Void(ctx context.Context, transactionID string) (payments.Result, error) {
+	if _, err := p.reverse(ctx, transactionID, EntryVoid, 0); err != nil {
+		return payments.Result{}, err
+	}
+	return payments.Result{TransactionID: transactionID, Status: "voided"}, nil
+}
+
+// reverse credits back amount of a redemption (all of what remains when
+// amount is 0) as an entry of the given type
+func (p *StoredValueProvider) reverse(ctx context.Context, transactionID, entryType string, amount money.Amount) (*models.StoredValueTransaction, error) {
+	var entry *models.StoredValueTransaction
+
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		redemption, err := p.redemption(tx, transactionID)
+		if err != nil {
+			return err
+		}
+
+		// Lock the account first so concurrent refunds see each other
+		var card *models.GiftCard
+		var wallet *models.Wallet
+		if redemption.GiftCardID != nil {
+			if card, err = lockCardByID(tx, *redemption.GiftCardID); err != nil {
+				return err
+			}
+		} else {
+			var w models.Wallet
+			if err := tx.First(&w, *redemption.WalletID).Error; err != nil {
+				return err
+			}
+			if wallet, err = lockWallet(tx, w.UserID, w.Currency); err != nil {
+				return err
+			}
+		}
+
+		var returned money.Amount
+		if err := tx.Model(&models.StoredValueTransaction{}).
+			Where("related_id = ? AND type IN ?", redemption.ID, []string{EntryVoid, EntryRefund}).
+			Select("COALESCE(SUM(amount), 0)").
+			Scan(&returned).Error; err != nil {
+			return err
+		}
+
+		remaining := -redemption.Amount - returned
+		if amount <= 0 {
+			amount = remaining
+		}
+		if amount > remaining || remaining <= 0 {
+			return fmt.Errorf("%s exceeds the unreturned amount %s", entryType, money.Max(remaining, money.Zero))
+		}
+
+		entry = &models.StoredValueTransaction{
+			Type:      entryType,
+			Amount:    amount,
+			PaymentID: redemption.PaymentID,
+			RelatedID: &redemption.ID,
+		}
+		if card != nil {
+			return postCardEntry(tx, card, entry)
+		}
+		return postWalletEntry(tx, wallet, entry)
+	})
+	return entry, err
+}
+
+// redemption loads the redeem entry a transaction ID refers to
+func (p *StoredValueProvider) redemption(db *gorm.DB, transactionID string) (*models.StoredValueTransaction, error) {
+	id, err := uuid.Parse(transactionID)
+	if err != nil {
+		return nil, payments.ErrUnknownTransaction
+	}
+
+	var entry models.StoredValueTransaction
+	err = db.Where("id = ? AND type = ?", id, EntryRedeem).First(&entry).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, payments.ErrUnknownTransaction
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Guard against spending from one kind of account through the other's provider
+	if (entry.GiftCardID != nil) != (p.name == "gift_card") {
+		return nil, payments.ErrUnknownTransaction
+	}
+	return &entry, nil
+}
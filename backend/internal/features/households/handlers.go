@@ -0,0 +1,373 @@
+package households
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/middleware"
+	"golf-ezz-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// HouseholdHandler handles household accounts
+type HouseholdHandler struct{}
+
+// NewHouseholdHandler creates a new household handler
+func NewHouseholdHandler() *HouseholdHandler {
+	return &HouseholdHandler{}
+}
+
+// CreateHouseholdRequest represents a request to start a household
+type CreateHouseholdRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// AddMemberRequest represents a request to add a dependent with their own login
+type AddMemberRequest struct {
+	Email           string   `json:"email" binding:"required,email"`
+	Name            string   `json:"name" binding:"required"`
+	Password        string   `json:"password" binding:"required,min=6"`
+	Relationship    string   `json:"relationship" binding:"required,oneof=partner dependent junior"`
+	DateOfBirth     string   `json:"date_of_birth"` // YYYY-MM-DD; required for juniors
+	Handicap        *float64 `json:"handicap"`
+	CanBookTeeTimes *bool    `json:"can_book_tee_times"` // defaults to true
+	CanBookRange    *bool    `json:"can_book_range"`     // defaults to true
+}
+
+// UpdateMemberRequest represents a change to a dependent's relationship or permissions
+type UpdateMemberRequest struct {
+	Relationship    string `json:"relationship" binding:"omitempty,oneof=partner dependent junior"`
+	CanBookTeeTimes *bool  `json:"can_book_tee_times"`
+	CanBookRange    *bool  `json:"can_book_range"`
+}
+
+// GetMyHousehold returns the authenticated user's household and its members
+func (h *HouseholdHandler) GetMyHousehold(c *gin.Context) {
+	userModel, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	member, household, err := MemberOf(database.DB, userModel.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve household"})
+		return
+	}
+	if member == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not in a household"})
+		return
+	}
+
+	if err := database.DB.Preload("Members.User").First(household, household.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve household"})
+		return
+	}
+
+	c.JSON(http.StatusOK, household)
+}
+
+// CreateHousehold starts a household with the authenticated user as its primary member
+func (h *HouseholdHandler) CreateHousehold(c *gin.Context) {
+	userModel, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	var req CreateHouseholdRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if member, _, err := MemberOf(database.DB, userModel.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check household"})
+		return
+	} else if member != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Already in a household"})
+		return
+	}
+
+	household := models.Household{Name: req.Name, PrimaryUserID: userModel.ID}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&household).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.HouseholdMember{
+			HouseholdID:     household.ID,
+			UserID:          userModel.ID,
+			Relationship:    RelationshipPrimary,
+			CanBookTeeTimes: true,
+			CanBookRange:    true,
+		}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create household"})
+		return
+	}
+
+	database.DB.Preload("Members.User").First(&household, household.ID)
+	c.JSON(http.StatusCreated, household)
+}
+
+// AddMember creates a login for a dependent and adds them to the primary
+// member's household
+func (h *HouseholdHandler) AddMember(c *gin.Context) {
+	household, ok := primaryHousehold(c)
+	if !ok {
+		return
+	}
+
+	var req AddMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var dateOfBirth *time.Time
+	if req.DateOfBirth != "" {
+		parsed, err := time.Parse("2006-01-02", req.DateOfBirth)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date_of_birth format. Use YYYY-MM-DD"})
+			return
+		}
+		dateOfBirth = &parsed
+	}
+	if req.Relationship == RelationshipJunior && dateOfBirth == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date_of_birth is required for juniors"})
+		return
+	}
+
+	var existing int64
+	database.DB.Model(&models.User{}).Where("email = ?", req.Email).Count(&existing)
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "User already exists"})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	dependent := models.User{
+		Email:       req.Email,
+		Name:        req.Name,
+		Password:    string(hashedPassword),
+		Role:        "member",
+		DateOfBirth: dateOfBirth,
+		Handicap:    req.Handicap,
+		Preferences: models.UserPreferences{
+			PreferredTeeTime: "morning",
+			PreferredCourses: []string{},
+			Notifications: models.NotificationSettings{
+				Email: true,
+				Push:  true,
+			},
+			PlayingStyle: "casual",
+		},
+	}
+	member := models.HouseholdMember{
+		HouseholdID:     household.ID,
+		Relationship:    req.Relationship,
+		CanBookTeeTimes: true,
+		CanBookRange:    true,
+	}
+	if req.CanBookTeeTimes != nil {
+		member.CanBookTeeTimes = *req.CanBookTeeTimes
+	}
+	if req.CanBookRange != nil {
+		member.CanBookRange = *req.CanBookRange
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&dependent).Error; err != nil {
+			return err
+		}
+		member.UserID = dependent.ID
+		if err := tx.Create(&member).Error; err != nil {
+			return err
+		}
+		// The column defaults would turn refused permissions back on
+		return tx.Model(&member).Updates(map[string]interface{}{
+			"can_book_tee_times": member.CanBookTeeTimes,
+			"can_book_range":     member.CanBookRange,
+		}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add household member"})
+		return
+	}
+
+	member.User = &dependent
+	c.JSON(http.StatusCreated, member)
+}
+
+// UpdateMember changes a dependent's relationship or booking permissions
+func (h *HouseholdHandler) UpdateMember(c *gin.Context) {
+	household, ok := primaryHousehold(c)
+	if !ok {
+		return
+	}
+
+	member, ok := dependentParam(c, household)
+	if !ok {
+		return
+	}
+
+	var req UpdateMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Relationship != "" {
+		member.Relationship = req.Relationship
+	}
+	if req.CanBookTeeTimes != nil {
+		member.CanBookTeeTimes = *req.CanBookTeeTimes
+	}
+	if req.CanBookRange != nil {
+		member.CanBookRange = *req.CanBookRange
+	}
+
+	if err := database.DB.Model(member).Updates(map[string]interface{}{
+		"relationship":       member.Relationship,
+		"can_book_tee_times": member.CanBookTeeTimes,
+		"can_book_range":     member.CanBookRange,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update household member"})
+		return
+	}
+
+	c.JSON(http.StatusOK, member)
+}
+
+// RemoveMember takes a dependent out of the household. Their login, bookings
+// and history stay with them.
+func (h *HouseholdHandler) RemoveMember(c *gin.Context) {
+	household, ok := primaryHousehold(c)
+	if !ok {
+		return
+	}
+
+	member, ok := dependentParam(c, household)
+	if !ok {
+		return
+	}
+
+	// Removed outright so the user can join a household again
+	if err := database.DB.Unscoped().Delete(member).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove household member"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Household member removed"})
+}
+
+// GetHouseholdBookings returns the tee time and range bookings of everyone in
+// the primary member's household
+func (h *HouseholdHandler) GetHouseholdBookings(c *gin.Context) {
+	household, ok := primaryHousehold(c)
+	if !ok {
+		return
+	}
+
+	userIDs, err := MemberIDs(database.DB, household.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve bookings"})
+		return
+	}
+
+	var bookings []models.TeeTimeBooking
+	if err := database.DB.Where("user_id IN ?", userIDs).
+		Preload("Course").Preload("User").
+		Order("date ASC, time ASC").
+		Find(&bookings).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve bookings"})
+		return
+	}
+
+	var rangeBookings []models.RangeBooking
+	if err := database.DB.Where("user_id IN ?", userIDs).
+		Preload("Course").Preload("User").
+		Order("date ASC, start_time ASC").
+		Find(&rangeBookings).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve bookings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"bookings":       bookings,
+		"range_bookings": rangeBookings,
+		"count":          len(bookings) + len(rangeBookings),
+	})
+}
+
+// GetHouseholds lists households with their members (admin only)
+func (h *HouseholdHandler) GetHouseholds(c *gin.Context) {
+	var households []models.Household
+	if err := database.DB.Preload("Members.User").
+		Order("name ASC").
+		Find(&households).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve households"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"households": households,
+		"count":      len(households),
+	})
+}
+
+// primaryHousehold loads the household the authenticated user is the primary
+// member of, writing the error response if there is none
+func primaryHousehold(c *gin.Context) (*models.Household, bool) {
+	userModel, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return nil, false
+	}
+
+	var household models.Household
+	err := database.DB.Where("primary_user_id = ?", userModel.ID).First(&household).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only a household's primary member can do this"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve household"})
+		return nil, false
+	}
+	return &household, true
+}
+
+// dependentParam loads the household member named in the URL, refusing the
+// primary member, writing the error response if it cannot
+func dependentParam(c *gin.Context, household *models.Household) (*models.HouseholdMember, bool) {
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+	if userID == household.PrimaryUserID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The primary member cannot be changed"})
+		return nil, false
+	}
+
+	var member models.HouseholdMember
+	if err := database.DB.Where("household_id = ? AND user_id = ?", household.ID, userID).
+		First(&member).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Household member not found"})
+		return nil, false
+	}
+	return &member, true
+}
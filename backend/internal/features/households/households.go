@@ -0,0 +1,85 @@
+// Package households provides family accounts: a primary member who holds
+// the membership and pays, and dependents with their own logins
+package households
+
+import (
+	"errors"
+
+	"golf-ezz-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Booking kinds a dependent can be allowed to make
+const (
+	KindTeeTime = "tee_time"
+	KindRange   = "range"
+)
+
+// Relationships a household member can have to the primary member
+const (
+	RelationshipPrimary   = "primary"
+	RelationshipPartner   = "partner"
+	RelationshipDependent = "dependent"
+	RelationshipJunior    = "junior"
+)
+
+// MemberOf returns the user's place in a household with the household
+// loaded, or nil when they are not in one
+func MemberOf(db *gorm.DB, userID uuid.UUID) (*models.HouseholdMember, *models.Household, error) {
+	var member models.HouseholdMember
+	err := db.Where("user_id = ?", userID).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var household models.Household
+	if err := db.First(&household, member.HouseholdID).Error; err != nil {
+		return nil, nil, err
+	}
+	return &member, &household, nil
+}
+
+// MemberIDs returns the users in a household, the primary included
+func MemberIDs(db *gorm.DB, householdID uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := db.Model(&models.HouseholdMember{}).
+		Where("household_id = ?", householdID).
+		Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+// AccountsPaidBy returns the users whose bookings userID pays for: themselves
+// and, for a household's primary member, everyone in the household
+func AccountsPaidBy(db *gorm.DB, userID uuid.UUID) ([]uuid.UUID, error) {
+	var household models.Household
+	err := db.Where("primary_user_id = ?", userID).First(&household).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return []uuid.UUID{userID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return MemberIDs(db, household.ID)
+}
+
+// CanBook reports whether the user may make a booking of the given kind.
+// Users outside a household, and primary members, always can.
+func CanBook(db *gorm.DB, userID uuid.UUID, kind string) (bool, error) {
+	member, household, err := MemberOf(db, userID)
+	if err != nil {
+		return false, err
+	}
+	if member == nil || household.PrimaryUserID == userID {
+		return true, nil
+	}
+
+	if kind == KindRange {
+		return member.CanBookRange, nil
+	}
+	return member.CanBookTeeTimes, nil
+}
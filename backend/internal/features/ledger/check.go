@@ -0,0 +1,120 @@
+package ledger
+
+import (
+	"fmt"
+	"time"
+
+	"golf-ezz-backend/internal/models"
+	"golf-ezz-backend/internal/money"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Problem is an inconsistency found by Check
+type Problem struct {
+	Kind      string `json:"kind"`
+	Reference string `json:"reference"`
+	Detail    string `json:"detail"`
+}
+
+// postedStoredValue are the stored-value transaction types that post entries
+var postedStoredValue = []string{"issue", "transfer", "adjustment", "expire"}
+
+// Check looks for ledger entries that do not balance, charges and money
+// movements that were never posted, and stored-value liabilities that disagree
+// with the gift card and wallet balances. Records created before since are
+// skipped; a zero since checks everything, including the liability totals,
+// which can only be compared over all time.
+func Check(db *gorm.DB, since time.Time) ([]Problem, error) {
+	problems := []Problem{}
+
+	var unbalanced []struct {
+		EntryID uuid.UUID
+		Debit   money.Amount
+		Credit  money.Amount
+	}
+	if err := db.Model(&models.JournalLine{}).
+		Select("entry_id, SUM(debit) AS debit, SUM(credit) AS credit").
+		Where("posted_at >= ?", since).
+		Group("entry_id").
+		Having("SUM(debit) <> SUM(credit)").
+		Scan(&unbalanced).Error; err != nil {
+		return nil, err
+	}
+	for _, entry := range unbalanced {
+		problems = append(problems, Problem{
+			Kind:      "unbalanced_entry",
+			Reference: entry.EntryID.String(),
+			Detail:    fmt.Sprintf("%s debits, %s credits", entry.Debit, entry.Credit),
+		})
+	}
+
+	unposted := []struct {
+		kind, table, where, detail string
+		args                       []interface{}
+	}{
+		{"unposted_payment", "payments",
+			"status IN ? AND NOT EXISTS (SELECT 1 FROM journal_entries WHERE journal_entries.payment_id = payments.id AND journal_entries.type = ?)",
+			"payment has no ledger entry", []interface{}{[]string{"completed", "partially_refunded", "refunded", "disputed"}, EntryPayment}},
+		{"unposted_refund", "refunds",
+			"status = ? AND NOT EXISTS (SELECT 1 FROM journal_entries WHERE journal_entries.refund_id = refunds.id)",
+			"refund has no ledger entry", []interface{}{"completed"}},
+		{"unposted_booking", "tee_time_bookings",
+			"total_amount > 0 AND NOT EXISTS (SELECT 1 FROM journal_entries WHERE journal_entries.booking_id = tee_time_bookings.id AND journal_entries.type = ?)",
+			"booking has no charge entry", []interface{}{EntryCharge}},
+		{"unposted_booking", "range_bookings",
+			"total_amount > 0 AND NOT EXISTS (SELECT 1 FROM journal_entries WHERE journal_entries.range_booking_id = range_bookings.id AND journal_entries.type = ?)",
+			"range booking has no charge entry", []interface{}{EntryCharge}},
+		{"unposted_sale", "sales",
+			"total_amount > 0 AND NOT EXISTS (SELECT 1 FROM journal_entries WHERE journal_entries.sale_id = sales.id AND journal_entries.type = ?)",
+			"sale has no charge entry", []interface{}{EntryCharge}},
+		{"unposted_stored_value", "stored_value_transactions",
+			"type IN ? AND amount <> 0 AND NOT EXISTS (SELECT 1 FROM journal_entries WHERE journal_entries.stored_value_transaction_id = stored_value_transactions.id)",
+			"stored value transaction has no ledger entry", []interface{}{postedStoredValue}},
+	}
+	for _, check := range unposted {
+		var ids []uuid.UUID
+		if err := db.Table(check.table).
+			Where(check.where, check.args...).
+			Where(check.table+".created_at >= ?", since).
+			Pluck(check.table+".id", &ids).Error; err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			problems = append(problems, Problem{Kind: check.kind, Reference: id.String(), Detail: check.detail})
+		}
+	}
+
+	if !since.IsZero() {
+		return problems, nil
+	}
+
+	liabilities := []struct {
+		account string
+		model   interface{}
+	}{
+		{AccountGiftCardLiability, &models.GiftCard{}},
+		{AccountWalletLiability, &models.Wallet{}},
+	}
+	for _, liability := range liabilities {
+		var held, posted money.Amount
+		if err := db.Model(liability.model).Select("COALESCE(SUM(balance), 0)").Scan(&held).Error; err != nil {
+			return nil, err
+		}
+		if err := db.Model(&models.JournalLine{}).
+			Where("account = ?", liability.account).
+			Select("COALESCE(SUM(credit - debit), 0)").
+			Scan(&posted).Error; err != nil {
+			return nil, err
+		}
+		if held != posted {
+			problems = append(problems, Problem{
+				Kind:      "liability_mismatch",
+				Reference: liability.account,
+				Detail:    fmt.Sprintf("balances hold %s, ledger shows %s", held, posted),
+			})
+		}
+	}
+	return problems, nil
+}
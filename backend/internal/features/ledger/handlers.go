@@ -0,0 +1,200 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/models"
+	"golf-ezz-backend/internal/money"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// LedgerHandler handles ledger inspection and corrections
+type LedgerHandler struct{}
+
+// NewLedgerHandler creates a new ledger handler
+func NewLedgerHandler() *LedgerHandler {
+	return &LedgerHandler{}
+}
+
+// errAlreadyReversed is returned when reversing an entry a second time
+var errAlreadyReversed = errors.New("entry has already been reversed")
+
+// ReverseRequest represents a request to reverse a ledger entry
+type ReverseRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// GetEntries lists ledger entries with their lines, newest first (admin only).
+// Filters: type, course_id, booking_id, payment_id, start_date and end_date.
+func (h *LedgerHandler) GetEntries(c *gin.Context) {
+	query := database.DB.Preload("Lines").Order("posted_at DESC").Limit(200)
+
+	if entryType := c.Query("type"); entryType != "" {
+		query = query.Where("type = ?", entryType)
+	}
+	for _, column := range []string{"course_id", "booking_id", "payment_id"} {
+		value := c.Query(column)
+		if value == "" {
+			continue
+		}
+		id, err := uuid.Parse(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + column})
+			return
+		}
+		query = query.Where(column+" = ?", id)
+	}
+	if startDateStr := c.Query("start_date"); startDateStr != "" {
+		startDate, err := time.Parse("2006-01-02", startDateStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_date format. Use YYYY-MM-DD"})
+			return
+		}
+		query = query.Where("posted_at >= ?", startDate)
+	}
+	if endDateStr := c.Query("end_date"); endDateStr != "" {
+		endDate, err := time.Parse("2006-01-02", endDateStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date format. Use YYYY-MM-DD"})
+			return
+		}
+		query = query.Where("posted_at < ?", endDate.AddDate(0, 0, 1))
+	}
+
+	var entries []models.JournalEntry
+	if err := query.Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve ledger entries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries": entries,
+		"count":   len(entries),
+	})
+}
+
+// GetBalances returns a trial balance of every account (admin only). as_of
+// includes lines posted on that date; course_id narrows it to one course.
+func (h *LedgerHandler) GetBalances(c *gin.Context) {
+	asOf := time.Now()
+	if asOfStr := c.Query("as_of"); asOfStr != "" {
+		date, err := time.Parse("2006-01-02", asOfStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid as_of format. Use YYYY-MM-DD"})
+			return
+		}
+		asOf = date.AddDate(0, 0, 1)
+	}
+
+	var courseID *uuid.UUID
+	if value := c.Query("course_id"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course_id"})
+			return
+		}
+		courseID = &id
+	}
+
+	balances, err := Balances(database.DB, courseID, asOf)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve balances"})
+		return
+	}
+
+	var debits, credits money.Amount
+	for _, balance := range balances {
+		debits += balance.Debit
+		credits += balance.Credit
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"accounts": balances,
+		"balanced": debits == credits,
+		"as_of":    asOf,
+	})
+}
+
+// ReverseEntry posts an entry that undoes another (admin only). Entries are
+// never edited; a mistake is corrected by reversing it and posting again.
+func (h *LedgerHandler) ReverseEntry(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid entry ID"})
+		return
+	}
+
+	var req ReverseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var postedBy *uuid.UUID
+	if userID, ok := c.Get("user_id"); ok {
+		if adminID, err := uuid.Parse(fmt.Sprint(userID)); err == nil {
+			postedBy = &adminID
+		}
+	}
+
+	var reversal *models.JournalEntry
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var reversed int64
+		if err := tx.Model(&models.JournalEntry{}).Where("reversal_of_id = ?", id).Count(&reversed).Error; err != nil {
+			return err
+		}
+		if reversed > 0 {
+			return errAlreadyReversed
+		}
+
+		var err error
+		reversal, err = Reverse(tx, models.JournalEntry{Base: models.Base{ID: id}}, req.Reason, postedBy)
+		return err
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ledger entry not found"})
+		return
+	case errors.Is(err, errAlreadyReversed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reverse ledger entry"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, reversal)
+}
+
+// RunCheck runs the ledger consistency checks (admin only). since limits the
+// checks to records created from that date.
+func (h *LedgerHandler) RunCheck(c *gin.Context) {
+	var since time.Time
+	if sinceStr := c.Query("since"); sinceStr != "" {
+		date, err := time.Parse("2006-01-02", sinceStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid since format. Use YYYY-MM-DD"})
+			return
+		}
+		since = date
+	}
+
+	problems, err := Check(database.DB, since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check ledger"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"problems":   problems,
+		"count":      len(problems),
+		"checked_at": time.Now(),
+	})
+}
@@ -0,0 +1,463 @@
+// Package ledger keeps the append-only double-entry ledger that revenue
+// reports are derived from. Every charge, payment, refund, discount, fee and
+// stored-value movement posts one balanced entry.
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golf-ezz-backend/internal/models"
+	"golf-ezz-backend/internal/money"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Accounts. Revenue is credited to one account per item category, see
+// RevenueAccount; discounts, refunds and cancellations are contra-revenue
+// accounts that carry debit balances.
+const (
+	AccountReceivable          = "accounts_receivable"
+	AccountCardClearing        = "card_clearing"
+	AccountCash                = "cash"
+	AccountGiftCardLiability   = "gift_card_liability"
+	AccountWalletLiability     = "wallet_liability"
+	AccountTaxPayable          = "sales_tax_payable"
+	AccountDiscounts           = "discounts"
+	AccountRefunds             = "refunds"
+	AccountCancellations       = "cancellations"
+	AccountProcessingFees      = "processing_fees"
+	AccountStoredValueAdjust   = "stored_value_adjustments"
+	AccountStoredValueTransfer = "stored_value_transfers"
+	AccountBreakage            = "breakage"
+	AccountOverShort           = "cash_over_short"
+	AccountLoyaltyRewards      = "loyalty_rewards"
+)
+
+// revenuePrefix starts the name of every revenue account
+const revenuePrefix = "revenue:"
+
+// contraRevenue are the accounts that reduce revenue
+var contraRevenue = []string{AccountDiscounts, AccountRefunds, AccountCancellations}
+
+// Entry types
+const (
+	EntryCharge       = "charge"
+	EntryCancellation = "cancellation"
+	EntryPayment      = "payment"
+	EntryRefund       = "refund"
+	EntryStoredValue  = "stored_value"
+	EntryAdjustment   = "adjustment"
+	EntryReversal     = "reversal"
+)
+
+// ErrUnbalanced is returned when an entry's debits and credits differ
+var ErrUnbalanced = errors.New("ledger entry does not balance")
+
+// RevenueAccount returns the income account for an item category
+func RevenueAccount(category string) string {
+	if category == "" {
+		category = "other"
+	}
+	return revenuePrefix + category
+}
+
+// FundsAccount returns the account money received by a payment method lands in
+func FundsAccount(method string) string {
+	switch method {
+	case "gift_card":
+		return AccountGiftCardLiability
+	case "wallet":
+		return AccountWalletLiability
+	case "cash":
+		return AccountCash
+	case "points":
+		return AccountLoyaltyRewards
+	}
+	return AccountCardClearing
+}
+
+// Debit returns a line debiting amount to account
+func Debit(account string, amount money.Amount) models.JournalLine {
+	return models.JournalLine{Account: account, Debit: amount}
+}
+
+// Credit returns a line crediting amount to account
+func Credit(account string, amount money.Amount) models.JournalLine {
+	return models.JournalLine{Account: account, Credit: amount}
+}
+
+// Post validates and appends an entry. Each line is netted to one side, zero
+// lines are dropped, and an entry left empty is not posted.
+func Post(tx *gorm.DB, entry *models.JournalEntry) error {
+	var lines []models.JournalLine
+	var debits, credits money.Amount
+	for _, line := range entry.Lines {
+		net := line.Debit - line.Credit
+		if net == 0 {
+			continue
+		}
+		line.Debit, line.Credit = money.Max(net, money.Zero), money.Max(-net, money.Zero)
+		debits += line.Debit
+		credits += line.Credit
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	if debits != credits {
+		return fmt.Errorf("%w: %s debits, %s credits", ErrUnbalanced, debits, credits)
+	}
+
+	now := time.Now()
+	if entry.PostedAt.IsZero() {
+		entry.PostedAt = now
+	}
+
+	// A locked day's books are closed: anything dated into one lands today
+	// instead, and only adjustments may correct it
+	if entry.CourseID != nil && entry.Type != EntryAdjustment && Day(entry.PostedAt).Before(Day(now)) {
+		var locked int64
+		if err := tx.Model(&models.DayClose{}).
+			Where("course_id = ? AND date = ? AND status = ?", *entry.CourseID, Day(entry.PostedAt), "locked").
+			Count(&locked).Error; err != nil {
+			return err
+		}
+		if locked > 0 {
+			entry.PostedAt = now
+		}
+	}
+	for i := range lines {
+		lines[i].CourseID = entry.CourseID
+		lines[i].PostedAt = entry.PostedAt
+	}
+	entry.Lines = lines
+	return tx.Create(entry).Error
+}
+
+// Day returns the start of the UTC day t falls on, the date day closes are kept by
+func Day(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// PostAdjustment corrects the takings of a locked day. amount is added to the
+// funds account, e.g. cash or card_clearing, against cash over/short.
+func PostAdjustment(tx *gorm.DB, entry *models.JournalEntry, account string, amount money.Amount) error {
+	entry.Type = EntryAdjustment
+	entry.Lines = []models.JournalLine{
+		Debit(account, amount),
+		Credit(AccountOverShort, amount),
+	}
+	return Post(tx, entry)
+}
+
+// Reverse posts an entry that undoes another
+func Reverse(tx *gorm.DB, original models.JournalEntry, reason string, postedBy *uuid.UUID) (*models.JournalEntry, error) {
+	if err := tx.Preload("Lines").First(&original, original.ID).Error; err != nil {
+		return nil, err
+	}
+
+	reversal := &models.JournalEntry{
+		Type:           EntryReversal,
+		Description:    "Reversal: " + reason,
+		CourseID:       original.CourseID,
+		UserID:         original.UserID,
+		BookingID:      original.BookingID,
+		RangeBookingID: original.RangeBookingID,
+		SaleID:         original.SaleID,
+		PaymentID:      original.PaymentID,
+		RefundID:       original.RefundID,
+		ReversalOfID:   &original.ID,
+		PostedBy:       postedBy,
+	}
+	for _, line := range original.Lines {
+		reversal.Lines = append(reversal.Lines, models.JournalLine{
+			Account: line.Account,
+			Debit:   line.Credit,
+			Credit:  line.Debit,
+		})
+	}
+	return reversal, Post(tx, reversal)
+}
+
+// PostTeeTimeCharge records what a tee time booking is owed
+func PostTeeTimeCharge(tx *gorm.DB, booking *models.TeeTimeBooking) error {
+	entry := &models.JournalEntry{
+		Type:        EntryCharge,
+		Description: fmt.Sprintf("Tee time %s %s", booking.Date.Format("2006-01-02"), booking.Time),
+		CourseID:    &booking.CourseID,
+		UserID:      &booking.UserID,
+		BookingID:   &booking.ID,
+	}
+	return postCharge(tx, entry, booking.PriceLines, booking.TaxAmount, booking.TaxInclusive, booking.TotalAmount)
+}
+
+// PostRangeCharge records what a range booking is owed
+func PostRangeCharge(tx *gorm.DB, booking *models.RangeBooking) error {
+	entry := &models.JournalEntry{
+		Type:           EntryCharge,
+		Description:    fmt.Sprintf("Range %s %s", booking.Date.Format("2006-01-02"), booking.StartTime),
+		CourseID:       &booking.CourseID,
+		UserID:         &booking.UserID,
+		RangeBookingID: &booking.ID,
+	}
+	return postCharge(tx, entry, booking.PriceLines, booking.TaxAmount, booking.TaxInclusive, booking.TotalAmount)
+}
+
+// PostSale records what a pro shop sale is owed
+func PostSale(tx *gorm.DB, sale *models.Sale) error {
+	entry := &models.JournalEntry{
+		Type:        EntryCharge,
+		Description: "Pro shop sale",
+		CourseID:    &sale.CourseID,
+		UserID:      sale.UserID,
+		BookingID:   sale.BookingID,
+		SaleID:      &sale.ID,
+	}
+	lines := make(models.InvoiceLines, 0, len(sale.Items))
+	for _, item := range sale.Items {
+		lines = append(lines, models.InvoiceLine{Category: "merchandise", Amount: item.Amount})
+	}
+	return postCharge(tx, entry, lines, sale.TaxAmount, sale.TaxInclusive, sale.TotalAmount)
+}
+
+// postCharge debits the receivable with the total due and credits revenue per
+// category, gross of discounts, which are debited to their own account. Tax
+// included in the prices is taken out of revenue in proportion.
+func postCharge(tx *gorm.DB, entry *models.JournalEntry, priceLines models.InvoiceLines, tax money.Amount, inclusive bool, total money.Amount) error {
+	if total <= 0 && len(priceLines) == 0 {
+		return nil
+	}
+	if len(priceLines) == 0 {
+		priceLines = models.InvoiceLines{{Category: "other", Amount: total - untaxed(tax, inclusive)}}
+	}
+
+	type revenue struct {
+		account string
+		amount  money.Amount
+	}
+	var revenues []revenue
+	var gross, discounts money.Amount
+	for _, line := range priceLines {
+		if line.Amount < 0 {
+			discounts -= line.Amount
+			continue
+		}
+		gross += line.Amount
+		account := RevenueAccount(line.Category)
+		found := false
+		for i := range revenues {
+			if revenues[i].account == account {
+				revenues[i].amount += line.Amount
+				found = true
+			}
+		}
+		if !found {
+			revenues = append(revenues, revenue{account, line.Amount})
+		}
+	}
+
+	// Tax inside the prices is not revenue
+	if inclusive && tax > 0 && gross > 0 {
+		remaining := tax
+		for i := range revenues {
+			share := remaining
+			if i < len(revenues)-1 {
+				share = tax.Scale(float64(revenues[i].amount) / float64(gross))
+			}
+			revenues[i].amount -= share
+			remaining -= share
+		}
+	}
+
+	entry.Lines = append(entry.Lines, Debit(AccountReceivable, total), Debit(AccountDiscounts, discounts))
+	for _, r := range revenues {
+		entry.Lines = append(entry.Lines, Credit(r.account, r.amount))
+	}
+	entry.Lines = append(entry.Lines, Credit(AccountTaxPayable, tax))
+	return Post(tx, entry)
+}
+
+// untaxed returns the tax that sits on top of the priced lines
+func untaxed(tax money.Amount, inclusive bool) money.Amount {
+	if inclusive {
+		return money.Zero
+	}
+	return tax
+}
+
+// PostCancellation writes off what is still owed on a cancelled booking or
+// voided sale. The entry names what was cancelled: a sale, a range booking or
+// a tee time booking. Money already paid stays in revenue until it is refunded.
+func PostCancellation(tx *gorm.DB, entry *models.JournalEntry) error {
+	var column string
+	var id *uuid.UUID
+	switch {
+	case entry.SaleID != nil:
+		column, id = "sale_id", entry.SaleID
+	case entry.RangeBookingID != nil:
+		column, id = "range_booking_id", entry.RangeBookingID
+	case entry.BookingID != nil:
+		column, id = "booking_id", entry.BookingID
+	default:
+		return fmt.Errorf("cancellation does not name a booking or sale")
+	}
+
+	var owed money.Amount
+	if err := tx.Model(&models.JournalLine{}).
+		Joins("JOIN journal_entries ON journal_entries.id = journal_lines.entry_id").
+		Where("journal_entries."+column+" = ? AND journal_lines.account = ?", *id, AccountReceivable).
+		Select("COALESCE(SUM(journal_lines.debit - journal_lines.credit), 0)").
+		Scan(&owed).Error; err != nil {
+		return err
+	}
+	if owed <= 0 {
+		return nil
+	}
+
+	entry.Type = EntryCancellation
+	entry.Lines = []models.JournalLine{
+		Debit(AccountCancellations, owed),
+		Credit(AccountReceivable, owed),
+	}
+	return Post(tx, entry)
+}
+
+// PostPayment records money received. Booking payments settle the receivable;
+// payments for anything else, e.g. membership dues, are revenue as they are
+// received. A fee kept by the provider is expensed out of the funds received.
+// A payment is posted once, however many times this is called.
+func PostPayment(tx *gorm.DB, payment *models.Payment) error {
+	var posted int64
+	if err := tx.Model(&models.JournalEntry{}).
+		Where("payment_id = ? AND type = ?", payment.ID, EntryPayment).
+		Count(&posted).Error; err != nil {
+		return err
+	}
+	if posted > 0 {
+		return nil
+	}
+
+	entry := &models.JournalEntry{
+		Type:           EntryPayment,
+		Description:    "Payment by " + strings.ReplaceAll(payment.PaymentMethod, "_", " "),
+		UserID:         &payment.UserID,
+		BookingID:      payment.BookingID,
+		RangeBookingID: payment.RangeBookingID,
+		PaymentID:      &payment.ID,
+	}
+	if payment.ProcessedAt != nil {
+		entry.PostedAt = *payment.ProcessedAt
+	}
+
+	funds := FundsAccount(payment.PaymentMethod)
+	entry.Lines = append(entry.Lines, Debit(funds, payment.Amount))
+
+	switch {
+	case payment.BookingID != nil:
+		var booking models.TeeTimeBooking
+		if err := tx.Select("id", "course_id").First(&booking, *payment.BookingID).Error; err != nil {
+			return err
+		}
+		entry.CourseID = &booking.CourseID
+		entry.Lines = append(entry.Lines, Credit(AccountReceivable, payment.Amount))
+	case payment.RangeBookingID != nil:
+		var booking models.RangeBooking
+		if err := tx.Select("id", "course_id").First(&booking, *payment.RangeBookingID).Error; err != nil {
+			return err
+		}
+		entry.CourseID = &booking.CourseID
+		entry.Lines = append(entry.Lines, Credit(AccountReceivable, payment.Amount))
+	case payment.SaleID != nil:
+		var sale models.Sale
+		if err := tx.Select("id", "course_id").First(&sale, *payment.SaleID).Error; err != nil {
+			return err
+		}
+		entry.CourseID = &sale.CourseID
+		entry.SaleID = &sale.ID
+		entry.Lines = append(entry.Lines, Credit(AccountReceivable, payment.Amount))
+	case payment.SubscriptionID != nil:
+		entry.Lines = append(entry.Lines, Credit(RevenueAccount("membership"), payment.Amount))
+	default:
+		entry.Lines = append(entry.Lines, Credit(AccountReceivable, payment.Amount))
+	}
+
+	if payment.Fee > 0 {
+		entry.Lines = append(entry.Lines, Debit(AccountProcessingFees, payment.Fee), Credit(funds, payment.Fee))
+	}
+	return Post(tx, entry)
+}
+
+// PostRefund records money returned against a payment
+func PostRefund(tx *gorm.DB, payment *models.Payment, refund *models.Refund) error {
+	var original models.JournalEntry
+	err := tx.Where("payment_id = ? AND type = ?", payment.ID, EntryPayment).First(&original).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	entry := &models.JournalEntry{
+		Type:           EntryRefund,
+		Description:    "Refund: " + strings.ReplaceAll(refund.ReasonCode, "_", " "),
+		CourseID:       original.CourseID,
+		UserID:         &payment.UserID,
+		BookingID:      payment.BookingID,
+		RangeBookingID: payment.RangeBookingID,
+		SaleID:         payment.SaleID,
+		PaymentID:      &payment.ID,
+		RefundID:       &refund.ID,
+		PostedBy:       refund.IssuedBy,
+		Lines: []models.JournalLine{
+			Debit(AccountRefunds, refund.Amount),
+			Credit(FundsAccount(payment.PaymentMethod), refund.Amount),
+		},
+	}
+	if refund.ProcessedAt != nil {
+		entry.PostedAt = *refund.ProcessedAt
+	}
+	return Post(tx, entry)
+}
+
+// PostStoredValue records a gift card or wallet movement that no payment or
+// refund accounts for: issuing a card, moving value between a card and a
+// wallet, admin adjustments and expiry. Redemptions, and the refunds and voids
+// that return them, are posted with the payment they belong to.
+func PostStoredValue(tx *gorm.DB, txn *models.StoredValueTransaction) error {
+	liability := AccountWalletLiability
+	if txn.GiftCardID != nil {
+		liability = AccountGiftCardLiability
+	}
+
+	var counter, description string
+	switch txn.Type {
+	case "issue":
+		counter, description = AccountCash, "Gift card sold"
+	case "transfer":
+		counter, description = AccountStoredValueTransfer, "Stored value transfer"
+	case "adjustment":
+		counter, description = AccountStoredValueAdjust, "Stored value adjustment"
+	case "expire":
+		counter, description = AccountBreakage, "Gift card expired"
+	default:
+		return nil
+	}
+	if txn.Reason != nil && *txn.Reason != "" {
+		description += ": " + *txn.Reason
+	}
+
+	// Value added to the card or wallet is owed to the holder
+	return Post(tx, &models.JournalEntry{
+		Type:                     EntryStoredValue,
+		Description:              description,
+		StoredValueTransactionID: &txn.ID,
+		PostedBy:                 txn.PerformedBy,
+		Lines: []models.JournalLine{
+			Debit(counter, txn.Amount),
+			Credit(liability, txn.Amount),
+		},
+	})
+}
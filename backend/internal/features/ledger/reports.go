@@ -0,0 +1,141 @@
+package ledger
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"golf-ezz-backend/internal/models"
+	"golf-ezz-backend/internal/money"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AccountBalance is the sum of the lines posted to one account
+type AccountBalance struct {
+	Account string       `json:"account"`
+	Debit   money.Amount `json:"debit"`
+	Credit  money.Amount `json:"credit"`
+	Balance money.Amount `json:"balance"` // debit minus credit
+}
+
+// RevenueRow is the revenue earned at one course over a period. Gross is
+// credited revenue before discounts; Net is what remains after discounts,
+// refunds and cancellations. Tax is collected for the jurisdiction and is not
+// part of either.
+type RevenueRow struct {
+	CourseID      *uuid.UUID   `json:"course_id"`
+	CourseName    string       `json:"course_name"`
+	Gross         money.Amount `json:"gross"`
+	Discounts     money.Amount `json:"discounts"`
+	Refunds       money.Amount `json:"refunds"`
+	Cancellations money.Amount `json:"cancellations"`
+	Net           money.Amount `json:"net"`
+	Tax           money.Amount `json:"tax"`
+}
+
+// Revenue is the revenue report over a period
+type Revenue struct {
+	Courses    []RevenueRow            `json:"courses"`
+	Categories map[string]money.Amount `json:"categories"` // gross revenue per item category
+	Total      RevenueRow              `json:"total"`
+}
+
+// Balances returns the balance of every account from lines posted before
+// asOf, optionally for one course only
+func Balances(db *gorm.DB, courseID *uuid.UUID, asOf time.Time) ([]AccountBalance, error) {
+	query := db.Model(&models.JournalLine{}).
+		Select("account, COALESCE(SUM(debit), 0) AS debit, COALESCE(SUM(credit), 0) AS credit").
+		Where("posted_at < ?", asOf)
+	if courseID != nil {
+		query = query.Where("course_id = ?", *courseID)
+	}
+
+	var balances []AccountBalance
+	if err := query.Group("account").Order("account").Scan(&balances).Error; err != nil {
+		return nil, err
+	}
+	for i := range balances {
+		balances[i].Balance = balances[i].Debit - balances[i].Credit
+	}
+	return balances, nil
+}
+
+// RevenueBetween reports revenue posted between two dates, inclusive, by course
+// and category. Zero dates leave that end of the period open.
+func RevenueBetween(db *gorm.DB, from, to time.Time) (*Revenue, error) {
+	accounts := append([]string{AccountTaxPayable}, contraRevenue...)
+	query := db.Model(&models.JournalLine{}).
+		Select("journal_lines.course_id, courses.name AS course_name, journal_lines.account, "+
+			"COALESCE(SUM(journal_lines.credit - journal_lines.debit), 0) AS amount").
+		Joins("LEFT JOIN courses ON courses.id = journal_lines.course_id").
+		Where("journal_lines.account LIKE ? OR journal_lines.account IN ?", revenuePrefix+"%", accounts)
+	if !from.IsZero() {
+		query = query.Where("journal_lines.posted_at >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("journal_lines.posted_at < ?", to.AddDate(0, 0, 1))
+	}
+
+	var sums []struct {
+		CourseID   *uuid.UUID
+		CourseName *string
+		Account    string
+		Amount     money.Amount
+	}
+	if err := query.Group("journal_lines.course_id, courses.name, journal_lines.account").
+		Scan(&sums).Error; err != nil {
+		return nil, err
+	}
+
+	report := &Revenue{Categories: make(map[string]money.Amount)}
+	rows := make(map[uuid.UUID]*RevenueRow)
+	for _, sum := range sums {
+		var key uuid.UUID
+		if sum.CourseID != nil {
+			key = *sum.CourseID
+		}
+		row, ok := rows[key]
+		if !ok {
+			row = &RevenueRow{CourseID: sum.CourseID, CourseName: "Club-wide"}
+			if sum.CourseName != nil {
+				row.CourseName = *sum.CourseName
+			}
+			rows[key] = row
+		}
+
+		// Contra-revenue accounts carry debit balances, reported as positive
+		switch {
+		case strings.HasPrefix(sum.Account, revenuePrefix):
+			row.Gross += sum.Amount
+			report.Categories[strings.TrimPrefix(sum.Account, revenuePrefix)] += sum.Amount
+		case sum.Account == AccountDiscounts:
+			row.Discounts -= sum.Amount
+		case sum.Account == AccountRefunds:
+			row.Refunds -= sum.Amount
+		case sum.Account == AccountCancellations:
+			row.Cancellations -= sum.Amount
+		case sum.Account == AccountTaxPayable:
+			row.Tax += sum.Amount
+		}
+	}
+
+	report.Courses = make([]RevenueRow, 0, len(rows))
+	for _, row := range rows {
+		row.Net = row.Gross - row.Discounts - row.Refunds - row.Cancellations
+		report.Courses = append(report.Courses, *row)
+
+		report.Total.Gross += row.Gross
+		report.Total.Discounts += row.Discounts
+		report.Total.Refunds += row.Refunds
+		report.Total.Cancellations += row.Cancellations
+		report.Total.Net += row.Net
+		report.Total.Tax += row.Tax
+	}
+	report.Total.CourseName = "Total"
+	sort.Slice(report.Courses, func(i, j int) bool {
+		return report.Courses[i].CourseName < report.Courses[j].CourseName
+	})
+	return report, nil
+}
@@ -0,0 +1,430 @@
+package loyalty
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golf-ezz-backend/internal/config"
+	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/middleware"
+	"golf-ezz-backend/internal/models"
+	"golf-ezz-backend/internal/money"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LoyaltyHandler handles loyalty points requests
+type LoyaltyHandler struct {
+	config *config.Config
+}
+
+// NewLoyaltyHandler creates a new loyalty handler
+func NewLoyaltyHandler(cfg *config.Config) *LoyaltyHandler {
+	return &LoyaltyHandler{config: cfg}
+}
+
+// RuleRequest represents how many points an activity earns
+type RuleRequest struct {
+	PointsPerUnit float64 `json:"points_per_unit" binding:"gte=0"`
+	BonusPoints   int     `json:"bonus_points" binding:"gte=0"`
+	IsActive      *bool   `json:"is_active"`
+}
+
+// TierRequest represents a loyalty tier
+type TierRequest struct {
+	Name       string  `json:"name" binding:"required"`
+	MinPoints  int     `json:"min_points" binding:"gte=0"`
+	Multiplier float64 `json:"multiplier" binding:"required,gt=0"`
+}
+
+// RewardRequest represents a reward points can be exchanged for
+type RewardRequest struct {
+	Name        string       `json:"name" binding:"required"`
+	Description string       `json:"description"`
+	Points      int          `json:"points" binding:"required,gt=0"`
+	Value       money.Amount `json:"value" binding:"required,gt=0"`
+	AppliesTo   string       `json:"applies_to" binding:"omitempty,oneof=any tee_time range"`
+	ValidDays   int          `json:"valid_days" binding:"gte=0"`
+	IsActive    *bool        `json:"is_active"`
+}
+
+// PointsAdjustmentRequest represents an admin correction to a points balance
+type PointsAdjustmentRequest struct {
+	Points int    `json:"points" binding:"required"`
+	Reason string `json:"reason" binding:"required"`
+}
+
+// GetMyPoints returns the authenticated user's points balance, tier, points
+// expiring soon and history
+func (h *LoyaltyHandler) GetMyPoints(c *gin.Context) {
+	userModel, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	var account models.PointsAccount
+	err := database.DB.Where("user_id = ?", userModel.ID).First(&account).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Accounts are opened on first use; report an empty one until then
+		c.JSON(http.StatusOK, gin.H{
+			"account":      models.PointsAccount{UserID: userModel.ID},
+			"point_value":  money.Cents(int64(h.config.Loyalty.PointValue)),
+			"transactions": []models.PointsTransaction{},
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve points"})
+		return
+	}
+
+	now := time.Now()
+	tier, earned, err := CurrentTier(database.DB, h.config, account.ID, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tier"})
+		return
+	}
+
+	var next *models.LoyaltyTier
+	var upcoming models.LoyaltyTier
+	if err := database.DB.Where("min_points > ?", earned).Order("min_points ASC").First(&upcoming).Error; err == nil {
+		next = &upcoming
+	}
+
+	var expiring int
+	database.DB.Model(&models.PointsTransaction{}).
+		Where("account_id = ? AND remaining > 0 AND expires_at > ? AND expires_at <= ?", account.ID, now, now.AddDate(0, 0, 30)).
+		Select("COALESCE(SUM(remaining), 0)").
+		Scan(&expiring)
+
+	var entries []models.PointsTransaction
+	if err := database.DB.Where("account_id = ?", account.ID).
+		Order("created_at DESC").
+		Limit(100).
+		Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve points history"})
+		return
+	}
+
+	response := gin.H{
+		"account":             account,
+		"point_value":         money.Cents(int64(h.config.Loyalty.PointValue)),
+		"tier":                tier,
+		"tier_points":         earned,
+		"next_tier":           next,
+		"expiring_within_30d": expiring,
+		"transactions":        entries,
+	}
+	if next != nil {
+		response["points_to_next_tier"] = next.MinPoints - earned
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetRewards returns the rewards open for redemption
+func (h *LoyaltyHandler) GetRewards(c *gin.Context) {
+	var rewards []models.LoyaltyReward
+	if err := database.DB.Where("is_active = ?", true).Order("points ASC").Find(&rewards).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve rewards"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rewards": rewards,
+		"count":   len(rewards),
+	})
+}
+
+// RedeemReward exchanges the authenticated user's points for a reward and
+// returns the promo code it is taken as
+func (h *LoyaltyHandler) RedeemReward(c *gin.Context) {
+	userModel, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reward ID"})
+		return
+	}
+
+	var reward models.LoyaltyReward
+	if err := database.DB.Where("id = ? AND is_active = ?", id, true).First(&reward).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reward not found"})
+		return
+	}
+
+	var coupon *models.Coupon
+	var entry *models.PointsTransaction
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		coupon, entry, err = RedeemReward(tx, userModel.ID, &reward)
+		return err
+	})
+	if errors.Is(err, ErrInsufficientPoints) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Not enough points for this reward"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to redeem reward"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"reward":      reward,
+		"promo_code":  coupon.Code,
+		"valid_until": coupon.ValidUntil,
+		"transaction": entry,
+	})
+}
+
+// GetRules returns the earning rules (admin only)
+func (h *LoyaltyHandler) GetRules(c *gin.Context) {
+	var rules []models.LoyaltyRule
+	if err := database.DB.Order("activity ASC").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rules": rules,
+		"count": len(rules),
+	})
+}
+
+// SetRule creates or replaces the earning rule for an activity (admin only)
+func (h *LoyaltyHandler) SetRule(c *gin.Context) {
+	activity := c.Param("activity")
+	if activity != ActivityTeeTime && activity != ActivityRange && activity != ActivityPurchase {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "activity must be tee_time, range or purchase"})
+		return
+	}
+
+	var req RuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule := models.LoyaltyRule{
+		Activity:      activity,
+		PointsPerUnit: req.PointsPerUnit,
+		BonusPoints:   req.BonusPoints,
+		IsActive:      req.IsActive == nil || *req.IsActive,
+	}
+	if err := database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "activity"}},
+		DoUpdates: clause.AssignmentColumns([]string{"points_per_unit", "bonus_points", "updated_at"}),
+	}).Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save rule"})
+		return
+	}
+	// is_active is written separately as a false value is skipped on insert
+	if err := database.DB.Model(&models.LoyaltyRule{}).
+		Where("activity = ?", activity).
+		Update("is_active", rule.IsActive).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save rule"})
+		return
+	}
+
+	database.DB.Where("activity = ?", activity).First(&rule)
+	c.JSON(http.StatusOK, rule)
+}
+
+// GetTiers returns the loyalty tiers, lowest first (admin only)
+func (h *LoyaltyHandler) GetTiers(c *gin.Context) {
+	var tiers []models.LoyaltyTier
+	if err := database.DB.Order("min_points ASC").Find(&tiers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tiers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tiers": tiers,
+		"count": len(tiers),
+	})
+}
+
+// CreateTier adds a loyalty tier (admin only)
+func (h *LoyaltyHandler) CreateTier(c *gin.Context) {
+	var req TierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tier := models.LoyaltyTier{Name: req.Name, MinPoints: req.MinPoints, Multiplier: req.Multiplier}
+	if err := database.DB.Create(&tier).Error; err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "A tier with this name already exists"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, tier)
+}
+
+// UpdateTier changes a loyalty tier (admin only)
+func (h *LoyaltyHandler) UpdateTier(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tier ID"})
+		return
+	}
+
+	var req TierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var tier models.LoyaltyTier
+	if err := database.DB.First(&tier, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tier not found"})
+		return
+	}
+
+	if err := database.DB.Model(&tier).Updates(map[string]interface{}{
+		"name":       req.Name,
+		"min_points": req.MinPoints,
+		"multiplier": req.Multiplier,
+	}).Error; err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "A tier with this name already exists"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tier)
+}
+
+// GetAllRewards returns every reward, retired ones included (admin only)
+func (h *LoyaltyHandler) GetAllRewards(c *gin.Context) {
+	var rewards []models.LoyaltyReward
+	if err := database.DB.Order("points ASC").Find(&rewards).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve rewards"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rewards": rewards,
+		"count":   len(rewards),
+	})
+}
+
+// CreateReward adds a reward to the catalogue (admin only)
+func (h *LoyaltyHandler) CreateReward(c *gin.Context) {
+	var req RewardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var reward models.LoyaltyReward
+	req.apply(&reward)
+	if err := database.DB.Create(&reward).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reward"})
+		return
+	}
+	if !reward.IsActive {
+		database.DB.Model(&reward).Update("is_active", false)
+	}
+
+	c.JSON(http.StatusCreated, reward)
+}
+
+// UpdateReward changes or retires a reward. Promo codes already issued for it
+// are unaffected. (admin only)
+func (h *LoyaltyHandler) UpdateReward(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reward ID"})
+		return
+	}
+
+	var req RewardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var reward models.LoyaltyReward
+	if err := database.DB.First(&reward, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reward not found"})
+		return
+	}
+
+	req.apply(&reward)
+	if err := database.DB.Save(&reward).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update reward"})
+		return
+	}
+
+	c.JSON(http.StatusOK, reward)
+}
+
+// AdjustPoints credits or debits a user's points (admin only)
+func (h *LoyaltyHandler) AdjustPoints(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req PointsAdjustmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var performedBy *uuid.UUID
+	if userID, ok := c.Get("user_id"); ok {
+		if adminID, err := uuid.Parse(fmt.Sprint(userID)); err == nil {
+			performedBy = &adminID
+		}
+	}
+
+	var entry *models.PointsTransaction
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		entry, err = Adjust(tx, h.config, user.ID, req.Points, req.Reason, performedBy)
+		return err
+	})
+	if errors.Is(err, ErrInsufficientPoints) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Adjustment would make the balance negative"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to adjust points"})
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
+
+// apply copies the request onto a reward
+func (req RewardRequest) apply(reward *models.LoyaltyReward) {
+	reward.Name = req.Name
+	reward.Description = req.Description
+	reward.Points = req.Points
+	reward.Value = req.Value
+	reward.AppliesTo = req.AppliesTo
+	if reward.AppliesTo == "" {
+		reward.AppliesTo = "any"
+	}
+	reward.ValidDays = req.ValidDays
+	if reward.ValidDays == 0 {
+		reward.ValidDays = 90
+	}
+	reward.IsActive = req.IsActive == nil || *req.IsActive
+}
@@ -0,0 +1,476 @@
+// Package loyalty provides the member points programme: points earned on
+// completed play and pro shop purchases, spent as a payment method or on
+// rewards, with tiers and expiry
+package loyalty
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+
+	"golf-ezz-backend/internal/config"
+	"golf-ezz-backend/internal/models"
+	"golf-ezz-backend/internal/money"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Points ledger entry types
+const (
+	EntryEarn       = "earn"
+	EntryRedeem     = "redeem"
+	EntryRefund     = "refund"
+	EntryReward     = "reward"
+	EntryReverse    = "reverse"
+	EntryAdjustment = "adjustment"
+	EntryExpire     = "expire"
+)
+
+// Activities that earn points
+const (
+	ActivityTeeTime  = "tee_time"
+	ActivityRange    = "range"
+	ActivityPurchase = "purchase"
+)
+
+// MethodPoints is the payment method and provider name for paying in points
+const MethodPoints = "points"
+
+// ErrInsufficientPoints is returned when spending more points than a member has
+var ErrInsufficientPoints = errors.New("insufficient points")
+
+// codeAlphabet leaves out characters that are easily confused when read aloud
+const codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// EarnForBooking credits the points for a completed tee time
+func EarnForBooking(tx *gorm.DB, cfg *config.Config, booking *models.TeeTimeBooking) error {
+	paid, err := paidAmount(tx, "booking_id", booking.ID)
+	if err != nil {
+		return err
+	}
+	return earn(tx, cfg, booking.UserID, ActivityTeeTime, paid, &models.PointsTransaction{
+		BookingID:   &booking.ID,
+		Description: fmt.Sprintf("Tee time on %s", booking.Date.Format("2006-01-02")),
+	})
+}
+
+// EarnForRangeBooking credits the points for a completed range session
+func EarnForRangeBooking(tx *gorm.DB, cfg *config.Config, booking *models.RangeBooking) error {
+	paid, err := paidAmount(tx, "range_booking_id", booking.ID)
+	if err != nil {
+		return err
+	}
+	return earn(tx, cfg, booking.UserID, ActivityRange, paid, &models.PointsTransaction{
+		RangeBookingID: &booking.ID,
+		Description:    fmt.Sprintf("Range session on %s", booking.Date.Format("2006-01-02")),
+	})
+}
+
+// EarnForSale credits the points for a paid pro shop sale to a member
+func EarnForSale(tx *gorm.DB, cfg *config.Config, sale *models.Sale) error {
+	if sale.UserID == nil {
+		return nil
+	}
+	paid, err := paidAmount(tx, "sale_id", sale.ID)
+	if err != nil {
+		return err
+	}
+	return earn(tx, cfg, *sale.UserID, ActivityPurchase, paid, &models.PointsTransaction{
+		SaleID:      &sale.ID,
+		Description: "Pro shop purchase",
+	})
+}
+
+// ReverseSale takes back fraction of the points a sale earned, e.g. all of
+// them when it is voided. Points the member has already spent are not
+// clawed back beyond their balance.
+func ReverseSale(tx *gorm.DB, saleID uuid.UUID, fraction float64, reason string) error {
+	var earned models.PointsTransaction
+	err := tx.Where("sale_id = ? AND type = ?", saleID, EntryEarn).First(&earned).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	account, err := lockAccountByID(tx, earned.AccountID)
+	if err != nil {
+		return err
+	}
+
+	var reversed int
+	if err := tx.Model(&models.PointsTransaction{}).
+		Where("sale_id = ? AND type = ?", saleID, EntryReverse).
+		Select("COALESCE(SUM(-points), 0)").
+		Scan(&reversed).Error; err != nil {
+		return err
+	}
+
+	points := int(math.Round(float64(earned.Points) * math.Min(fraction, 1)))
+	points = minInt(points, earned.Points-reversed)
+	if err := expireLots(tx, account, time.Now()); err != nil {
+		return err
+	}
+	points = minInt(points, account.Balance)
+	if points <= 0 {
+		return nil
+	}
+
+	return post(tx, account, &models.PointsTransaction{
+		Type:        EntryReverse,
+		Points:      -points,
+		SaleID:      &saleID,
+		RelatedID:   &earned.ID,
+		Description: reason,
+	}, nil)
+}
+
+// RedeemReward spends a member's points on a reward, issuing the single-use
+// promo code the reward is taken as
+func RedeemReward(tx *gorm.DB, userID uuid.UUID, reward *models.LoyaltyReward) (*models.Coupon, *models.PointsTransaction, error) {
+	account, err := lockAccount(tx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	code, err := generateCode()
+	if err != nil {
+		return nil, nil, err
+	}
+	validUntil := time.Now().AddDate(0, 0, reward.ValidDays)
+	coupon := &models.Coupon{
+		Code:           code,
+		Description:    "Loyalty reward: " + reward.Name,
+		DiscountType:   "fixed",
+		DiscountAmount: reward.Value,
+		AppliesTo:      reward.AppliesTo,
+		ValidUntil:     &validUntil,
+		MaxRedemptions: 1,
+		MaxPerUser:     1,
+		UserID:         &userID,
+		IsActive:       true,
+	}
+	if err := tx.Create(coupon).Error; err != nil {
+		return nil, nil, err
+	}
+
+	entry := &models.PointsTransaction{
+		Type:        EntryReward,
+		Points:      -reward.Points,
+		RewardID:    &reward.ID,
+		CouponID:    &coupon.ID,
+		Description: reward.Name,
+	}
+	if err := post(tx, account, entry, nil); err != nil {
+		return nil, nil, err
+	}
+	return coupon, entry, nil
+}
+
+// Adjust corrects a member's balance by points, positive or negative
+func Adjust(tx *gorm.DB, cfg *config.Config, userID uuid.UUID, points int, reason string, adminID *uuid.UUID) (*models.PointsTransaction, error) {
+	account, err := lockAccount(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &models.PointsTransaction{
+		Type:        EntryAdjustment,
+		Points:      points,
+		Description: reason,
+		PerformedBy: adminID,
+	}
+	if err := post(tx, account, entry, expiryFrom(cfg, time.Now())); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// ExpirePoints expires points that have passed their expiry date, returning
+// the number of points expired. It is meant to run nightly.
+func ExpirePoints(db *gorm.DB, now time.Time) (int, error) {
+	var accountIDs []uuid.UUID
+	if err := db.Model(&models.PointsTransaction{}).
+		Distinct("account_id").
+		Where("remaining > 0 AND expires_at <= ?", now).
+		Pluck("account_id", &accountIDs).Error; err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, accountID := range accountIDs {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			account, err := lockAccountByID(tx, accountID)
+			if err != nil {
+				return err
+			}
+			before := account.Balance
+			if err := expireLots(tx, account, now); err != nil {
+				return err
+			}
+			expired += before - account.Balance
+			return nil
+		})
+		if err != nil {
+			return expired, err
+		}
+	}
+	return expired, nil
+}
+
+// CurrentTier returns the tier a member has reached by the points they earned
+// over the configured period, or nil below the lowest tier
+func CurrentTier(db *gorm.DB, cfg *config.Config, accountID uuid.UUID, now time.Time) (*models.LoyaltyTier, int, error) {
+	var earned int
+	if err := db.Model(&models.PointsTransaction{}).
+		Where("account_id = ? AND type = ? AND created_at >= ?", accountID, EntryEarn, now.AddDate(0, -cfg.Loyalty.TierMonths, 0)).
+		Select("COALESCE(SUM(points), 0)").
+		Scan(&earned).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var tier models.LoyaltyTier
+	err := db.Where("min_points <= ?", earned).Order("min_points DESC").First(&tier).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, earned, nil
+	}
+	if err != nil {
+		return nil, earned, err
+	}
+	return &tier, earned, nil
+}
+
+// earn credits the points an activity earns under its rule, multiplied by the
+// member's tier, once per booking or sale
+func earn(tx *gorm.DB, cfg *config.Config, userID uuid.UUID, activity string, paid money.Amount, entry *models.PointsTransaction) error {
+	var rule models.LoyaltyRule
+	err := tx.Where("activity = ? AND is_active = ?", activity, true).First(&rule).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	column, id := entryReference(entry)
+	var count int64
+	if err := tx.Model(&models.PointsTransaction{}).
+		Where(column+" = ? AND type = ?", id, EntryEarn).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	account, err := lockAccount(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	tier, _, err := CurrentTier(tx, cfg, account.ID, now)
+	if err != nil {
+		return err
+	}
+	multiplier := 1.0
+	if tier != nil && tier.Multiplier > 0 {
+		multiplier = tier.Multiplier
+	}
+
+	base := math.Max(paid.Float64(), 0)*rule.PointsPerUnit + float64(rule.BonusPoints)
+	points := int(math.Floor(base * multiplier))
+	if points <= 0 {
+		return nil
+	}
+
+	entry.Type = EntryEarn
+	entry.Points = points
+	if err := post(tx, account, entry, expiryFrom(cfg, now)); err != nil {
+		return err
+	}
+
+	// The tier is refreshed with the points just earned
+	if tier, _, err = CurrentTier(tx, cfg, account.ID, now); err != nil {
+		return err
+	}
+	var name *string
+	if tier != nil {
+		name = &tier.Name
+	}
+	return tx.Model(account).Update("tier", name).Error
+}
+
+// post records an entry against a locked account. Entries that add points
+// start a lot expiring at expiresAt; entries that take points spend the
+// oldest lots first.
+func post(tx *gorm.DB, account *models.PointsAccount, entry *models.PointsTransaction, expiresAt *time.Time) error {
+	if entry.Points < 0 {
+		if err := expireLots(tx, account, time.Now()); err != nil {
+			return err
+		}
+		if account.Balance+entry.Points < 0 {
+			return ErrInsufficientPoints
+		}
+		if err := spend(tx, account.ID, -entry.Points); err != nil {
+			return err
+		}
+	} else {
+		entry.Remaining = entry.Points
+		entry.ExpiresAt = expiresAt
+	}
+
+	account.Balance += entry.Points
+	entry.AccountID = account.ID
+	entry.BalanceAfter = account.Balance
+	if err := tx.Create(entry).Error; err != nil {
+		return err
+	}
+	return tx.Model(account).Update("balance", account.Balance).Error
+}
+
+// spend takes points from an account's lots, soonest to expire first
+func spend(tx *gorm.DB, accountID uuid.UUID, points int) error {
+	var lots []models.PointsTransaction
+	if err := tx.Where("account_id = ? AND remaining > 0", accountID).
+		Order("expires_at ASC NULLS LAST, created_at ASC").
+		Find(&lots).Error; err != nil {
+		return err
+	}
+
+	for _, lot := range lots {
+		if points == 0 {
+			break
+		}
+		used := minInt(points, lot.Remaining)
+		if err := tx.Model(&lot).Update("remaining", lot.Remaining-used).Error; err != nil {
+			return err
+		}
+		points -= used
+	}
+	if points > 0 {
+		return ErrInsufficientPoints
+	}
+	return nil
+}
+
+// expireLots writes off what is left of an account's lots past their expiry
+func expireLots(tx *gorm.DB, account *models.PointsAccount, now time.Time) error {
+	var lots []models.PointsTransaction
+	if err := tx.Where("account_id = ? AND remaining > 0 AND expires_at <= ?", account.ID, now).
+		Find(&lots).Error; err != nil {
+		return err
+	}
+	if len(lots) == 0 {
+		return nil
+	}
+
+	expired := 0
+	for _, lot := range lots {
+		expired += lot.Remaining
+	}
+	if err := tx.Model(&models.PointsTransaction{}).
+		Where("account_id = ? AND remaining > 0 AND expires_at <= ?", account.ID, now).
+		Update("remaining", 0).Error; err != nil {
+		return err
+	}
+
+	account.Balance -= expired
+	if err := tx.Create(&models.PointsTransaction{
+		AccountID:    account.ID,
+		Type:         EntryExpire,
+		Points:       -expired,
+		BalanceAfter: account.Balance,
+		Description:  "Points expired",
+	}).Error; err != nil {
+		return err
+	}
+	return tx.Model(account).Update("balance", account.Balance).Error
+}
+
+// lockAccount loads a member's points account for update, opening it on first use
+func lockAccount(tx *gorm.DB, userID uuid.UUID) (*models.PointsAccount, error) {
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.PointsAccount{UserID: userID}).Error; err != nil {
+		return nil, err
+	}
+
+	var account models.PointsAccount
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ?", userID).
+		First(&account).Error; err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// lockAccountByID loads a points account by ID for update
+func lockAccountByID(tx *gorm.DB, id uuid.UUID) (*models.PointsAccount, error) {
+	var account models.PointsAccount
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&account, id).Error; err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// paidAmount returns what was paid for a booking or sale, net of refunds,
+// other than in points
+func paidAmount(tx *gorm.DB, column string, id uuid.UUID) (money.Amount, error) {
+	var paid money.Amount
+	err := tx.Model(&models.Payment{}).
+		Where(column+" = ? AND payment_method <> ? AND status IN ?", id, MethodPoints,
+			[]string{"completed", "partially_refunded"}).
+		Select("COALESCE(SUM(amount - refunded_amount), 0)").
+		Scan(&paid).Error
+	return paid, err
+}
+
+// entryReference returns the column and ID of what an earn entry is for
+func entryReference(entry *models.PointsTransaction) (string, uuid.UUID) {
+	switch {
+	case entry.BookingID != nil:
+		return "booking_id", *entry.BookingID
+	case entry.RangeBookingID != nil:
+		return "range_booking_id", *entry.RangeBookingID
+	default:
+		return "sale_id", *entry.SaleID
+	}
+}
+
+// expiryFrom returns when points earned at now expire, or nil if they never do
+func expiryFrom(cfg *config.Config, now time.Time) *time.Time {
+	if cfg.Loyalty.ExpiryMonths <= 0 {
+		return nil
+	}
+	expiresAt := now.AddDate(0, cfg.Loyalty.ExpiryMonths, 0)
+	return &expiresAt
+}
+
+// generateCode returns a random reward promo code in the form RWD-XXXXXXXX
+func generateCode() (string, error) {
+	var code strings.Builder
+	code.WriteString("RWD-")
+	max := big.NewInt(int64(len(codeAlphabet)))
+	for i := 0; i < 8; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code.WriteByte(codeAlphabet[n.Int64()])
+	}
+	return code.String(), nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
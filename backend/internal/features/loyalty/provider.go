@@ -0,0 +1,169 @@
+package loyalty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"golf-ezz-backend/internal/config"
+	"golf-ezz-backend/internal/features/payments"
+	"golf-ezz-backend/internal/models"
+	"golf-ezz-backend/internal/money"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PointsProvider is a payment provider that spends a member's loyalty points
+// at the configured value per point. Like stored value, authorization debits
+// the points straight away and void returns them. Transaction IDs are the IDs
+// of the redeem ledger entries.
+type PointsProvider struct {
+	db     *gorm.DB
+	config *config.Config
+}
+
+// NewPointsProvider creates the provider for payment_method "points". The
+// customer's own points are spent.
+func NewPointsProvider(db *gorm.DB, cfg *config.Config) *PointsProvider {
+	return &PointsProvider{db: db, config: cfg}
+}
+
+// Name returns the provider's registry name
+func (p *PointsProvider) Name() string {
+	return MethodPoints
+}
+
+// Authorize debits the points needed to cover the requested amount
+func (p *PointsProvider) Authorize(ctx context.Context, req payments.ChargeRequest) (payments.Result, error) {
+	if req.Amount <= 0 {
+		return payments.Result{}, fmt.Errorf("amount must be positive")
+	}
+	userID, err := uuid.Parse(req.Customer)
+	if err != nil {
+		return payments.Result{}, fmt.Errorf("invalid customer %q", req.Customer)
+	}
+
+	entry := &models.PointsTransaction{
+		Type:        EntryRedeem,
+		Points:      -p.pointsFor(req.Amount),
+		Description: fmt.Sprintf("Paid %s", req.Amount),
+	}
+	if id, err := uuid.Parse(req.Reference); err == nil {
+		entry.PaymentID = &id
+	}
+
+	err = p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		account, err := lockAccount(tx, userID)
+		if err != nil {
+			return err
+		}
+		return post(tx, account, entry, nil)
+	})
+	if errors.Is(err, ErrInsufficientPoints) {
+		return payments.Result{}, fmt.Errorf("%w: %v", payments.ErrDeclined, err)
+	}
+	if err != nil {
+		return payments.Result{}, err
+	}
+	return payments.Result{TransactionID: entry.ID.String(), Status: "authorized"}, nil
+}
+
+// Capture confirms a debit made at authorization
+func (p *PointsProvider) Capture(ctx context.Context, transactionID string, amount money.Amount) (payments.Result, error) {
+	redemption, err := p.redemption(p.db.WithContext(ctx), transactionID)
+	if err != nil {
+		return payments.Result{}, err
+	}
+	if p.pointsFor(amount) > -redemption.Points {
+		return payments.Result{}, fmt.Errorf("capture exceeds authorized amount")
+	}
+	return payments.Result{TransactionID: transactionID, Status: "captured"}, nil
+}
+
+// Refund credits the points for all or part of a payment back to the member.
+// Refunded points start a new lot with the usual expiry.
+func (p *PointsProvider) Refund(ctx context.Context, transactionID string, amount money.Amount) (payments.Result, error) {
+	entry, err := p.reverse(ctx, transactionID, p.pointsFor(amount))
+	if err != nil {
+		return payments.Result{}, err
+	}
+	return payments.Result{TransactionID: entry.ID.String(), Status: "refunded"}, nil
+}
+
+// Void returns all the points of a redemption not yet refunded
+func (p *PointsProvider) Void(ctx context.Context, transactionID string) (payments.Result, error) {
+	if _, err := p.reverse(ctx, transactionID, 0); err != nil {
+		return payments.Result{}, err
+	}
+	return payments.Result{TransactionID: transactionID, Status: "voided"}, nil
+}
+
+// reverse credits back points of a redemption, all of what remains when
+// points is 0
+func (p *PointsProvider) reverse(ctx context.Context, transactionID string, points int) (*models.PointsTransaction, error) {
+	var entry *models.PointsTransaction
+
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		redemption, err := p.redemption(tx, transactionID)
+		if err != nil {
+			return err
+		}
+
+		account, err := lockAccountByID(tx, redemption.AccountID)
+		if err != nil {
+			return err
+		}
+
+		var returned int
+		if err := tx.Model(&models.PointsTransaction{}).
+			Where("related_id = ? AND type = ?", redemption.ID, EntryRefund).
+			Select("COALESCE(SUM(points), 0)").
+			Scan(&returned).Error; err != nil {
+			return err
+		}
+
+		remaining := -redemption.Points - returned
+		if points <= 0 || points > remaining {
+			points = remaining
+		}
+		if points <= 0 {
+			return fmt.Errorf("all points of transaction %s have been returned", transactionID)
+		}
+
+		entry = &models.PointsTransaction{
+			Type:        EntryRefund,
+			Points:      points,
+			PaymentID:   redemption.PaymentID,
+			RelatedID:   &redemption.ID,
+			Description: "Points returned",
+		}
+		return post(tx, account, entry, expiryFrom(p.config, time.Now()))
+	})
+	return entry, err
+}
+
+// redemption loads the redeem entry a transaction ID refers to
+func (p *PointsProvider) redemption(db *gorm.DB, transactionID string) (*models.PointsTransaction, error) {
+	id, err := uuid.Parse(transactionID)
+	if err != nil {
+		return nil, payments.ErrUnknownTransaction
+	}
+	var entry models.PointsTransaction
+	err = db.Where("id = ? AND type = ?", id, EntryRedeem).First(&entry).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, payments.ErrUnknownTransaction
+	}
+	return &entry, err
+}
+
+// pointsFor returns the points it takes to pay amount, rounding up so a
+// payment is never worth more than the points spent
+func (p *PointsProvider) pointsFor(amount money.Amount) int {
+	value := int64(p.config.Loyalty.PointValue)
+	if value <= 0 {
+		value = 1
+	}
+	return int((int64(amount) + value - 1) / value)
+}
@@ -0,0 +1,371 @@
+// Package memberships provides membership subscriptions and their recurring billing
+package memberships
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"golf-ezz-backend/internal/config"
+	"golf-ezz-backend/internal/features/passes"
+	"golf-ezz-backend/internal/features/payments"
+	"golf-ezz-backend/internal/models"
+	"golf-ezz-backend/internal/money"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// liveStatuses are the subscription statuses that still hold a membership
+var liveStatuses = []string{"active", "past_due", "suspended"}
+
+// BillingSummary reports what a billing run did
+type BillingSummary struct {
+	Renewed   int      `json:"renewed"`
+	Failed    int      `json:"failed"`
+	Suspended int      `json:"suspended"`
+	Expired   int      `json:"expired"`
+	Cancelled int      `json:"cancelled"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// billingLockKey is the Postgres advisory lock held while subscriptions are charged
+const billingLockKey = 0x62696c6c // "bill"
+
+// ErrBillingInProgress is returned when another process is charging subscriptions
+var ErrBillingInProgress = errors.New("membership billing is already running")
+
+// WithBillingLock runs fn while holding the billing advisory lock, so the
+// billing command, an admin-triggered run and a member settling arrears never
+// charge the same subscription at once. It returns ErrBillingInProgress
+// without waiting when the lock is taken.
+func WithBillingLock(db *gorm.DB, fn func() error) error {
+	return db.Connection(func(conn *gorm.DB) error {
+		var locked bool
+		if err := conn.Raw("SELECT pg_try_advisory_lock(?)", billingLockKey).Scan(&locked).Error; err != nil {
+			return err
+		}
+		if !locked {
+			return ErrBillingInProgress
+		}
+		defer func() {
+			if err := conn.Exec("SELECT pg_advisory_unlock(?)", billingLockKey).Error; err != nil {
+				log.Printf("Failed to release billing lock: %v", err)
+			}
+		}()
+		return fn()
+	})
+}
+
+// RunBilling renews subscriptions that are due, retries failed renewals on the
+// dunning schedule and expires memberships that stayed suspended too long.
+// Runs hold the billing lock, so one that overlaps another returns
+// ErrBillingInProgress instead of charging members twice.
+func RunBilling(ctx context.Context, db *gorm.DB, cfg *config.Config, now time.Time) (BillingSummary, error) {
+	var summary BillingSummary
+	err := WithBillingLock(db, func() error {
+		var err error
+		summary, err = runBilling(ctx, db, cfg, now)
+		return err
+	})
+	return summary, err
+}
+
+func runBilling(ctx context.Context, db *gorm.DB, cfg *config.Config, now time.Time) (BillingSummary, error) {
+	var summary BillingSummary
+
+	var due []models.MembershipSubscription
+	if err := db.Where("(status = ? AND next_billing_at <= ?) OR (status = ? AND next_retry_at <= ?)",
+		"active", now, "past_due", now).
+		Order("next_billing_at ASC").
+		Find(&due).Error; err != nil {
+		return summary, err
+	}
+
+	for i := range due {
+		sub := &due[i]
+
+		if sub.Status == "active" && sub.CancelAtPeriodEnd {
+			if err := endSubscription(db, sub, "cancelled", now); err != nil {
+				summary.Errors = append(summary.Errors, fmt.Sprintf("%s: %v", sub.ID, err))
+				continue
+			}
+			summary.Cancelled++
+			continue
+		}
+
+		err := Renew(ctx, db, cfg, sub, now)
+		switch {
+		case err == nil:
+			summary.Renewed++
+		case sub.Status == "suspended":
+			summary.Suspended++
+		case sub.Status == "past_due":
+			summary.Failed++
+		default:
+			summary.Errors = append(summary.Errors, fmt.Sprintf("%s: %v", sub.ID, err))
+		}
+	}
+
+	expired, errs, err := expireSuspended(db, cfg, now)
+	if err != nil {
+		return summary, err
+	}
+	summary.Expired = expired
+	summary.Errors = append(summary.Errors, errs...)
+
+	return summary, nil
+}
+
+// Renew charges the next billing period of a subscription, using up any
+// proration credit first. A plan change scheduled for renewal takes effect,
+// and a plan edited since the last renewal moves the subscription onto its
+// latest version. On success the period advances and the member's expiry is
+// extended; on failure the subscription enters dunning.
+func Renew(ctx context.Context, db *gorm.DB, cfg *config.Config, sub *models.MembershipSubscription, now time.Time) error {
+	plan, err := renewalPlan(db, sub)
+	if err != nil {
+		return err
+	}
+	if plan.ID != sub.PlanID {
+		sub.PlanID = plan.ID
+		sub.Price = plan.Price
+		sub.BillingCycle = billingCycle(plan)
+	}
+	sub.ScheduledPlanID = nil
+
+	credit := money.Min(sub.CreditBalance, sub.Price)
+	amount := sub.Price - credit
+
+	var paymentID *uuid.UUID
+	if amount > 0 {
+		payment, err := charge(ctx, db, cfg, sub, amount)
+		if errors.Is(err, payments.ErrUnrecorded) {
+			// The money was taken, so the period is paid; retrying would
+			// charge again. The payment is left pending for staff to check.
+			log.Printf("Renewal of subscription %s was charged but not recorded (payment %s)", sub.ID, payment.ID)
+			err = nil
+		}
+		if err != nil {
+			if failErr := recordFailure(db, cfg, sub, err, now); failErr != nil {
+				return failErr
+			}
+			return err
+		}
+		paymentID = &payment.ID
+	}
+
+	sub.CreditBalance -= credit
+	sub.CurrentPeriodStart = sub.CurrentPeriodEnd
+	sub.CurrentPeriodEnd = addCycle(sub.CurrentPeriodStart, sub.BillingCycle)
+
+	// A member coming back from a long suspension starts a fresh period
+	if sub.CurrentPeriodEnd.Before(now) {
+		sub.CurrentPeriodStart = now
+		sub.CurrentPeriodEnd = addCycle(now, sub.BillingCycle)
+	}
+
+	return activate(db, sub, paymentID)
+}
+
+// activate records a paid period on the subscription and enrolls the member
+func activate(db *gorm.DB, sub *models.MembershipSubscription, paymentID *uuid.UUID) error {
+	sub.Status = "active"
+	sub.NextBillingAt = sub.CurrentPeriodEnd
+	sub.FailedAttempts = 0
+	sub.NextRetryAt = nil
+	sub.LastFailure = nil
+	sub.SuspendedAt = nil
+	if paymentID != nil {
+		sub.LastPaymentID = paymentID
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(sub).Error; err != nil {
+			return err
+		}
+		return enroll(tx, sub)
+	})
+}
+
+// recordFailure moves a subscription along the dunning schedule. Retries are
+// timed from the original due date; once they are used up the membership is
+// suspended.
+func recordFailure(db *gorm.DB, cfg *config.Config, sub *models.MembershipSubscription, cause error, now time.Time) error {
+	reason := cause.Error()
+	sub.LastFailure = &reason
+	sub.FailedAttempts++
+
+	schedule := cfg.Membership.DunningSchedule
+	if sub.FailedAttempts > len(schedule) {
+		sub.Status = "suspended"
+		sub.NextRetryAt = nil
+		sub.SuspendedAt = &now
+		log.Printf("Membership subscription %s suspended after %d failed charges", sub.ID, sub.FailedAttempts)
+
+		return db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(sub).Error; err != nil {
+				return err
+			}
+			return setMemberStatus(tx, sub.UserID, "suspended")
+		})
+	}
+
+	retryAt := sub.NextBillingAt.AddDate(0, 0, schedule[sub.FailedAttempts-1])
+	if retryAt.Before(now) {
+		retryAt = now
+	}
+	sub.Status = "past_due"
+	sub.NextRetryAt = &retryAt
+	return db.Save(sub).Error
+}
+
+// endSubscription closes a subscription and lapses the membership
+func endSubscription(db *gorm.DB, sub *models.MembershipSubscription, status string, now time.Time) error {
+	sub.Status = status
+	sub.NextRetryAt = nil
+	if status == "cancelled" {
+		sub.CancelledAt = &now
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(sub).Error; err != nil {
+			return err
+		}
+		return setMemberStatus(tx, sub.UserID, "expired")
+	})
+}
+
+// charge takes amount from the subscription's payment method
+func charge(ctx context.Context, db *gorm.DB, cfg *config.Config, sub *models.MembershipSubscription, amount money.Amount) (*models.Payment, error) {
+	provider, err := payments.ProviderFor(cfg, sub.PaymentMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	payment := models.Payment{
+		UserID:         sub.UserID,
+		SubscriptionID: &sub.ID,
+		Amount:         amount,
+		Currency:       sub.Currency,
+		Status:         "pending",
+		PaymentMethod:  sub.PaymentMethod,
+		Provider:       provider.Name(),
+	}
+	if err := db.Create(&payment).Error; err != nil {
+		return nil, err
+	}
+
+	if err := payments.Charge(ctx, db, provider, &payment, sub.Source); err != nil {
+		return &payment, err
+	}
+	return &payment, nil
+}
+
+// setMemberStatus mirrors a subscription that is no longer in good standing
+// onto the member's profile, leaving the expiry date in place
+func setMemberStatus(tx *gorm.DB, userID uuid.UUID, status string) error {
+	if err := tx.Model(&models.User{}).Where("id = ?", userID).Update("membership_status", status).Error; err != nil {
+		return err
+	}
+	return passes.Touch(tx, userID)
+}
+
+// proration is the money owed either way when a member changes plan mid-cycle
+type proration struct {
+	Charge  money.Amount `json:"charge"`  // collected now
+	Credit  money.Amount `json:"credit"`  // taken off future renewals
+	Restart bool         `json:"restart"` // the billing period restarts today
+}
+
+// prorate prices a plan change at now. Between plans on the same cycle the
+// price difference is charged or credited for the rest of the period. A
+// change of billing cycle restarts the period today, crediting the unused
+// part of the old one against the first charge.
+func prorate(sub models.MembershipSubscription, plan models.MembershipPlan, now time.Time) proration {
+	period := sub.CurrentPeriodEnd.Sub(sub.CurrentPeriodStart)
+	remaining := sub.CurrentPeriodEnd.Sub(now)
+	fraction := 0.0
+	if period > 0 && remaining > 0 {
+		fraction = math.Min(float64(remaining)/float64(period), 1)
+	}
+
+	var difference money.Amount
+	restart := billingCycle(plan) != sub.BillingCycle
+	if restart {
+		difference = plan.Price - sub.Price.Scale(fraction)
+	} else {
+		difference = (plan.Price - sub.Price).Scale(fraction)
+	}
+
+	if difference >= 0 {
+		return proration{Charge: difference, Restart: restart}
+	}
+	return proration{Credit: -difference, Restart: restart}
+}
+
+// ChangePlan moves a subscription to another plan, prorating the current
+// period. Any amount owed is charged before the change takes effect; a charge
+// that was taken but not recorded still counts as paid.
+func ChangePlan(ctx context.Context, db *gorm.DB, cfg *config.Config, sub *models.MembershipSubscription, plan models.MembershipPlan, now time.Time) (proration, *models.Payment, error) {
+	prorated := prorate(*sub, plan, now)
+
+	// Existing credit counts towards what is owed now
+	chargeNow := prorated.Charge
+	credit := sub.CreditBalance + prorated.Credit
+	if chargeNow > 0 && credit > 0 {
+		used := money.Min(credit, chargeNow)
+		chargeNow -= used
+		credit -= used
+	}
+
+	var payment *models.Payment
+	if chargeNow > 0 {
+		var err error
+		payment, err = charge(ctx, db, cfg, sub, chargeNow)
+		if errors.Is(err, payments.ErrUnrecorded) {
+			// The money was taken, so the change goes ahead as paid, as a
+			// renewal would. The payment is left pending for staff to check.
+			log.Printf("Plan change of subscription %s was charged but not recorded (payment %s)", sub.ID, payment.ID)
+			err = nil
+		}
+		if err != nil {
+			return prorated, payment, err
+		}
+	}
+
+	sub.PlanID = plan.ID
+	sub.Price = plan.Price
+	sub.BillingCycle = billingCycle(plan)
+	sub.CreditBalance = credit
+	sub.ScheduledPlanID = nil
+	if prorated.Restart {
+		sub.CurrentPeriodStart = now
+		sub.CurrentPeriodEnd = addCycle(now, sub.BillingCycle)
+	}
+
+	var paymentID *uuid.UUID
+	if payment != nil {
+		paymentID = &payment.ID
+	}
+	return prorated, payment, activate(db, sub, paymentID)
+}
+
+// billingCycle returns a plan's billing cycle, defaulting to monthly
+func billingCycle(plan models.MembershipPlan) string {
+	if plan.BillingCycle == "yearly" {
+		return "yearly"
+	}
+	return "monthly"
+}
+
+// addCycle returns the end of a billing period starting at start
+func addCycle(start time.Time, cycle string) time.Time {
+	if cycle == "yearly" {
+		return start.AddDate(1, 0, 0)
+	}
+	return start.AddDate(0, 1, 0)
+}
@@ -0,0 +1,53 @@
+package memberships
+
+import (
+	"testing"
+	"time"
+
+	"golf-ezz-backend/internal/models"
+	"golf-ezz-backend/internal/money"
+)
+
+func TestProrate(t *testing.T) {
+	start := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 30)
+	halfway := start.AddDate(0, 0, 15)
+
+	monthly := func(price int64) models.MembershipSubscription {
+		return models.MembershipSubscription{
+			Price:              money.Cents(price),
+			BillingCycle:       "monthly",
+			CurrentPeriodStart: start,
+			CurrentPeriodEnd:   end,
+		}
+	}
+	plan := func(price int64, cycle string) models.MembershipPlan {
+		return models.MembershipPlan{Price: money.Cents(price), BillingCycle: cycle}
+	}
+
+	tests := []struct {
+		name string
+		sub  models.MembershipSubscription
+		plan models.MembershipPlan
+		now  time.Time
+		want proration
+	}{
+		{"upgrade halfway", monthly(10000), plan(16000, "monthly"), halfway, proration{Charge: money.Cents(3000)}},
+		{"downgrade halfway", monthly(10000), plan(4000, "monthly"), halfway, proration{Credit: money.Cents(3000)}},
+		{"upgrade at the start", monthly(10000), plan(16000, "monthly"), start, proration{Charge: money.Cents(6000)}},
+		{"upgrade after the period", monthly(10000), plan(16000, "monthly"), end.Add(time.Hour), proration{}},
+		{"same price", monthly(10000), plan(10000, "monthly"), halfway, proration{}},
+		{"rounds to the cent", monthly(1000), plan(2000, "monthly"), start.AddDate(0, 0, 10), proration{Charge: money.Cents(667)}},
+		{"to yearly halfway", monthly(10000), plan(100000, "yearly"), halfway, proration{Charge: money.Cents(95000), Restart: true}},
+		{"to a cheaper yearly", monthly(10000), plan(3000, "yearly"), halfway, proration{Credit: money.Cents(2000), Restart: true}},
+		{"plan without a cycle is monthly", monthly(10000), plan(16000, ""), halfway, proration{Charge: money.Cents(3000)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := prorate(tt.sub, tt.plan, tt.now); got != tt.want {
+				t.Errorf("prorate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package memberships
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golf-ezz-backend/internal/config"
+	"golf-ezz-backend/internal/features/households"
+	"golf-ezz-backend/internal/features/passes"
+	"golf-ezz-backend/internal/models"
+	"golf-ezz-backend/internal/money"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Benefits are what a member's plan entitles them to
+type Benefits struct {
+	PlanID           uuid.UUID `json:"plan_id"`
+	PlanName         string    `json:"plan_name"`
+	DiscountPercent  float64   `json:"discount_percent"`
+	BookingAdvantage int       `json:"booking_advantage"`  // extra days ahead tee times can be booked
+	MaxBookingsMonth int       `json:"max_bookings_month"` // bookings a month at the member rate; 0 = unlimited
+	IncludesRange    bool      `json:"includes_range"`
+	IncludesCart     bool      `json:"includes_cart"`
+
+	// HouseholdID is set when the allowance is shared by the household
+	HouseholdID *uuid.UUID `json:"household_id,omitempty"`
+}
+
+// BenefitsFor resolves a member's benefits from the plan version they hold,
+// or else from the household primary's plan when it extends to the
+// household. It returns nil when no membership covers the user.
+func BenefitsFor(db *gorm.DB, userID uuid.UUID) (*Benefits, error) {
+	member, household, err := households.MemberOf(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := heldPlan(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if plan == nil && member != nil && household.PrimaryUserID != userID {
+		if plan, err = heldPlan(db, household.PrimaryUserID); err != nil {
+			return nil, err
+		}
+		if plan != nil && !plan.HouseholdBenefits {
+			plan = nil
+		}
+	}
+	if plan == nil {
+		return nil, nil
+	}
+
+	benefits := &Benefits{
+		PlanID:           plan.ID,
+		PlanName:         plan.Name,
+		DiscountPercent:  plan.DiscountPercent,
+		BookingAdvantage: plan.BookingAdvantage,
+		MaxBookingsMonth: plan.MaxBookingsMonth,
+		IncludesRange:    plan.IncludesRange,
+		IncludesCart:     plan.IncludesCart,
+	}
+	if member != nil && plan.QuotaScope == "household" {
+		benefits.HouseholdID = &member.HouseholdID
+	}
+	return benefits, nil
+}
+
+// heldPlan returns the plan version of the user's membership in force, or nil
+func heldPlan(db *gorm.DB, userID uuid.UUID) (*models.MembershipPlan, error) {
+	var user models.User
+	if err := db.Select("id", "membership_status", "membership_plan_id").First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if user.MembershipPlanID == nil || user.MembershipStatus == nil || *user.MembershipStatus != "active" {
+		return nil, nil
+	}
+
+	var plan models.MembershipPlan
+	err := db.First(&plan, *user.MembershipPlanID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// ExpirySummary reports what an expiry run did
+type ExpirySummary struct {
+	Cancelled int      `json:"cancelled"` // subscriptions cancelled at the end of their period
+	Expired   int      `json:"expired"`   // subscriptions suspended for too long
+	Lapsed    int      `json:"lapsed"`    // memberships past their expiry with nothing to renew them
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// RunExpiry ends memberships that have run out: subscriptions cancelled at
+// the end of a period that is over, subscriptions that stayed suspended too
+// long, and members past their expiry date without a live subscription. It is
+// meant to run nightly, e.g. from the expiry command.
+func RunExpiry(db *gorm.DB, cfg *config.Config, now time.Time) (ExpirySummary, error) {
+	var summary ExpirySummary
+
+	var ended []models.MembershipSubscription
+	if err := db.Where("status = ? AND cancel_at_period_end = ? AND current_period_end <= ?", "active", true, now).
+		Find(&ended).Error; err != nil {
+		return summary, err
+	}
+	for i := range ended {
+		if err := endSubscription(db, &ended[i], "cancelled", now); err != nil {
+			summary.Errors = append(summary.Errors, fmt.Sprintf("%s: %v", ended[i].ID, err))
+			continue
+		}
+		summary.Cancelled++
+	}
+
+	expired, errs, err := expireSuspended(db, cfg, now)
+	if err != nil {
+		return summary, err
+	}
+	summary.Expired = expired
+	summary.Errors = append(summary.Errors, errs...)
+
+	var lapsed []uuid.UUID
+	if err := db.Model(&models.User{}).
+		Where("membership_status = ? AND membership_expiry <= ?", "active", now).
+		Where("NOT EXISTS (SELECT 1 FROM membership_subscriptions WHERE membership_subscriptions.user_id = users.id AND membership_subscriptions.status IN ? AND membership_subscriptions.deleted_at IS NULL)", liveStatuses).
+		Pluck("id", &lapsed).Error; err != nil {
+		return summary, err
+	}
+	if len(lapsed) > 0 {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.User{}).Where("id IN ?", lapsed).
+				Update("membership_status", "expired").Error; err != nil {
+				return err
+			}
+			return passes.Touch(tx, lapsed...)
+		})
+		if err != nil {
+			return summary, err
+		}
+	}
+	summary.Lapsed = len(lapsed)
+
+	return summary, nil
+}
+
+// expireSuspended ends subscriptions that stayed suspended longer than the
+// configured grace period, returning how many it ended
+func expireSuspended(db *gorm.DB, cfg *config.Config, now time.Time) (int, []string, error) {
+	var lapsed []models.MembershipSubscription
+	if err := db.Where("status = ? AND suspended_at <= ?", "suspended",
+		now.AddDate(0, 0, -cfg.Membership.SuspensionDays)).
+		Find(&lapsed).Error; err != nil {
+		return 0, nil, err
+	}
+
+	expired := 0
+	var errs []string
+	for i := range lapsed {
+		if err := endSubscription(db, &lapsed[i], "expired", now); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", lapsed[i].ID, err))
+			continue
+		}
+		expired++
+	}
+	return expired, errs, nil
+}
+
+// enroll records an active membership on the member's profile: the plan
+// version held, when it runs to and, on first enrollment, a membership number
+func enroll(tx *gorm.DB, sub *models.MembershipSubscription) error {
+	var plan models.MembershipPlan
+	if err := tx.First(&plan, sub.PlanID).Error; err != nil {
+		return err
+	}
+
+	var user models.User
+	if err := tx.Select("id", "membership_id").First(&user, sub.UserID).Error; err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{
+		"membership_status":  "active",
+		"membership_expiry":  sub.CurrentPeriodEnd,
+		"membership_plan_id": plan.ID,
+		"membership_type":    plan.Name,
+	}
+	if user.MembershipID == nil {
+		number, err := nextMembershipNumber(tx, time.Now())
+		if err != nil {
+			return err
+		}
+		updates["membership_id"] = number
+	}
+	if err := tx.Model(&models.User{}).Where("id = ?", sub.UserID).Updates(updates).Error; err != nil {
+		return err
+	}
+	return passes.Touch(tx, sub.UserID)
+}
+
+// nextMembershipNumber takes the next number in the year's sequence, e.g.
+// M2026-00042. The sequence row stays locked until the surrounding
+// transaction ends, so a rollback also returns the number.
+func nextMembershipNumber(tx *gorm.DB, now time.Time) (string, error) {
+	year := now.Year()
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.MembershipSequence{Year: year}).Error; err != nil {
+		return "", err
+	}
+
+	var sequence models.MembershipSequence
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("year = ?", year).
+		First(&sequence).Error; err != nil {
+		return "", err
+	}
+
+	sequence.LastNumber++
+	if err := tx.Model(&models.MembershipSequence{}).
+		Where("year = ?", year).
+		Update("last_number", sequence.LastNumber).Error; err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("M%d-%05d", year, sequence.LastNumber), nil
+}
+
+// renewalPlan returns the plan a subscription renews on: the plan change
+// scheduled for renewal if there is one still open, otherwise the latest
+// version of the plan it is on
+func renewalPlan(db *gorm.DB, sub *models.MembershipSubscription) (models.MembershipPlan, error) {
+	if sub.ScheduledPlanID != nil {
+		plan, err := LatestVersion(db, *sub.ScheduledPlanID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return plan, err
+		}
+		if err == nil && plan.ArchivedAt == nil {
+			return plan, nil
+		}
+	}
+	return LatestVersion(db, sub.PlanID)
+}
+
+// monthlyPrice puts prices on different billing cycles on the same footing
+func monthlyPrice(price money.Amount, cycle string) money.Amount {
+	if cycle == "yearly" {
+		return price.Div(12)
+	}
+	return price
+}
@@ -0,0 +1,217 @@
+package memberships
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/models"
+	"golf-ezz-backend/internal/money"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// errPlanSuperseded is returned when changing a version that is not the latest
+	errPlanSuperseded = errors.New("only the latest version of a plan can be changed")
+
+	// errPlanArchived is returned when changing an archived plan
+	errPlanArchived = errors.New("plan is archived")
+)
+
+// PlanRequest represents a request to create or edit a membership plan
+type PlanRequest struct {
+	Name              string       `json:"name" binding:"required"`
+	Description       string       `json:"description"`
+	Price             money.Amount `json:"price" binding:"min=0"`
+	BillingCycle      string       `json:"billing_cycle" binding:"required,oneof=monthly yearly"`
+	Features          []string     `json:"features"`
+	BookingAdvantage  int          `json:"booking_advantage" binding:"min=0"`
+	DiscountPercent   float64      `json:"discount_percent" binding:"min=0,max=100"`
+	MaxBookingsMonth  int          `json:"max_bookings_month" binding:"min=0"`
+	IncludesRange     bool         `json:"includes_range"`
+	IncludesCart      bool         `json:"includes_cart"`
+	HouseholdBenefits bool         `json:"household_benefits"`                                     // benefits extend to the holder's household
+	QuotaScope        string       `json:"quota_scope" binding:"omitempty,oneof=person household"` // defaults to person
+}
+
+// GetPlans lists the plans open for sign-up
+func (h *MembershipHandler) GetPlans(c *gin.Context) {
+	var plans []models.MembershipPlan
+	if err := database.DB.Where("is_active = ?", true).
+		Order("price ASC, name ASC").
+		Find(&plans).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve membership plans"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"plans": plans,
+		"count": len(plans),
+	})
+}
+
+// CreatePlan adds a membership plan (admin only)
+func (h *MembershipHandler) CreatePlan(c *gin.Context) {
+	var req PlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	plan := models.MembershipPlan{Version: 1, IsActive: true}
+	req.apply(&plan)
+	if err := database.DB.Create(&plan).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create membership plan"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, plan)
+}
+
+// UpdatePlan edits a membership plan by publishing a new version of it (admin
+// only). The old version is closed to sign-ups; its subscribers keep its terms
+// and move to the new version when they renew.
+func (h *MembershipHandler) UpdatePlan(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid plan ID"})
+		return
+	}
+
+	var req PlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var plan models.MembershipPlan
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		current, err := lockLatestPlan(tx, id)
+		if err != nil {
+			return err
+		}
+
+		plan = models.MembershipPlan{
+			Version:           current.Version + 1,
+			PreviousVersionID: &current.ID,
+			IsActive:          true,
+		}
+		req.apply(&plan)
+		if err := tx.Create(&plan).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(current).Updates(map[string]interface{}{
+			"superseded_by_id": plan.ID,
+			"is_active":        false,
+		}).Error
+	})
+	if respondPlanError(c, err, "Failed to update membership plan") {
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
+
+// ArchivePlan closes a plan to new sign-ups (admin only). Current subscribers
+// keep it and renew on it.
+func (h *MembershipHandler) ArchivePlan(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid plan ID"})
+		return
+	}
+
+	var plan *models.MembershipPlan
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if plan, err = lockLatestPlan(tx, id); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		plan.IsActive = false
+		plan.ArchivedAt = &now
+		return tx.Model(plan).Updates(map[string]interface{}{
+			"is_active":   false,
+			"archived_at": now,
+		}).Error
+	})
+	if respondPlanError(c, err, "Failed to archive membership plan") {
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
+
+// LatestVersion follows a plan's version history to its latest version
+func LatestVersion(db *gorm.DB, planID uuid.UUID) (models.MembershipPlan, error) {
+	var plan models.MembershipPlan
+	if err := db.First(&plan, planID).Error; err != nil {
+		return plan, err
+	}
+	for plan.SupersededByID != nil {
+		next := *plan.SupersededByID
+		plan = models.MembershipPlan{}
+		if err := db.First(&plan, next).Error; err != nil {
+			return plan, err
+		}
+	}
+	return plan, nil
+}
+
+// lockLatestPlan loads a plan for update, refusing versions that can no longer
+// be changed
+func lockLatestPlan(tx *gorm.DB, id uuid.UUID) (*models.MembershipPlan, error) {
+	var plan models.MembershipPlan
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&plan, id).Error; err != nil {
+		return nil, err
+	}
+	if plan.SupersededByID != nil {
+		return nil, errPlanSuperseded
+	}
+	if plan.ArchivedAt != nil {
+		return nil, errPlanArchived
+	}
+	return &plan, nil
+}
+
+// respondPlanError writes the response for a failed plan change, reporting
+// whether it did
+func respondPlanError(c *gin.Context, err error, message string) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Membership plan not found"})
+	case errors.Is(err, errPlanSuperseded), errors.Is(err, errPlanArchived):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+	return true
+}
+
+// apply copies the request onto a plan
+func (req PlanRequest) apply(plan *models.MembershipPlan) {
+	plan.Name = req.Name
+	plan.Description = req.Description
+	plan.Price = req.Price
+	plan.BillingCycle = req.BillingCycle
+	plan.Features = models.StringArray(req.Features)
+	plan.BookingAdvantage = req.BookingAdvantage
+	plan.DiscountPercent = req.DiscountPercent
+	plan.MaxBookingsMonth = req.MaxBookingsMonth
+	plan.IncludesRange = req.IncludesRange
+	plan.IncludesCart = req.IncludesCart
+	plan.HouseholdBenefits = req.HouseholdBenefits
+	plan.QuotaScope = "person"
+	if req.QuotaScope != "" {
+		plan.QuotaScope = req.QuotaScope
+	}
+}
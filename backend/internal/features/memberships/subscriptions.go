@@ -0,0 +1,439 @@
+package memberships
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"golf-ezz-backend/internal/config"
+	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/features/passes"
+	"golf-ezz-backend/internal/features/payments"
+	"golf-ezz-backend/internal/middleware"
+	"golf-ezz-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MembershipHandler handles membership subscription requests
+type MembershipHandler struct {
+	config *config.Config
+}
+
+// NewMembershipHandler creates a new membership handler
+func NewMembershipHandler(cfg *config.Config) *MembershipHandler {
+	return &MembershipHandler{config: cfg}
+}
+
+// SubscribeRequest represents a request to subscribe to a membership plan
+type SubscribeRequest struct {
+	PlanID        string `json:"plan_id" binding:"required"`
+	PaymentMethod string `json:"payment_method" binding:"required,oneof=card wallet"`
+	Source        string `json:"source"` // reusable card token; unused for wallet
+}
+
+// ChangePlanRequest represents a request to move to another plan. Upgrades
+// take effect now and downgrades at renewal unless effective says otherwise.
+type ChangePlanRequest struct {
+	PlanID    string `json:"plan_id" binding:"required"`
+	Effective string `json:"effective" binding:"omitempty,oneof=now renewal"`
+}
+
+// PaymentMethodRequest represents a request to change how a subscription is paid
+type PaymentMethodRequest struct {
+	PaymentMethod string `json:"payment_method" binding:"required,oneof=card wallet"`
+	Source        string `json:"source"`
+}
+
+// GetMySubscription returns the authenticated user's current subscription
+func (h *MembershipHandler) GetMySubscription(c *gin.Context) {
+	userModel, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	sub, err := currentSubscription(database.DB, userModel.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No membership subscription"})
+		return
+	}
+
+	var plan models.MembershipPlan
+	database.DB.First(&plan, sub.PlanID)
+
+	response := gin.H{
+		"subscription": sub,
+		"plan":         plan,
+	}
+	if benefits, err := BenefitsFor(database.DB, userModel.ID); err == nil && benefits != nil {
+		response["benefits"] = benefits
+	}
+	// A scheduled plan change, or a plan edited since the member signed up,
+	// applies from the next renewal
+	if next, err := renewalPlan(database.DB, sub); err == nil && next.ID != sub.PlanID {
+		response["renewal_plan"] = next
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Subscribe signs the authenticated user up to a plan and charges the first period
+func (h *MembershipHandler) Subscribe(c *gin.Context) {
+	userModel, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	var req SubscribeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.PaymentMethod == "card" && req.Source == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "source is required for card payments"})
+		return
+	}
+
+	plan, ok := activePlan(c, req.PlanID)
+	if !ok {
+		return
+	}
+
+	if _, err := currentSubscription(database.DB, userModel.ID); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Already subscribed; change plan instead"})
+		return
+	}
+
+	// Abandon earlier sign-ups whose first charge never went through
+	database.DB.Model(&models.MembershipSubscription{}).
+		Where("user_id = ? AND status = ?", userModel.ID, "incomplete").
+		Update("status", "cancelled")
+
+	now := time.Now()
+	sub := models.MembershipSubscription{
+		UserID:             userModel.ID,
+		PlanID:             plan.ID,
+		Status:             "incomplete",
+		Price:              plan.Price,
+		Currency:           h.config.Payment.Currency,
+		BillingCycle:       billingCycle(plan),
+		PaymentMethod:      req.PaymentMethod,
+		Source:             req.Source,
+		CurrentPeriodStart: now,
+		CurrentPeriodEnd:   addCycle(now, billingCycle(plan)),
+	}
+	sub.NextBillingAt = sub.CurrentPeriodEnd
+
+	if err := database.DB.Create(&sub).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create subscription"})
+		return
+	}
+
+	var paymentID *uuid.UUID
+	if sub.Price > 0 {
+		payment, err := charge(c.Request.Context(), database.DB, h.config, &sub, sub.Price)
+		if err != nil {
+			reason := err.Error()
+			sub.LastFailure = &reason
+			database.DB.Save(&sub)
+			respondChargeError(c, err, payment)
+			return
+		}
+		paymentID = &payment.ID
+	}
+
+	if err := activate(database.DB, &sub, paymentID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to activate subscription"})
+		return
+	}
+	h.pushPassUpdates(c)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"subscription": sub,
+		"plan":         plan,
+	})
+}
+
+// ChangeMyPlan moves the authenticated user to another plan. A change that
+// takes effect now prorates the current period; one at renewal is scheduled
+// and the member keeps their current plan until then. Asking for the current
+// plan calls off a scheduled change.
+func (h *MembershipHandler) ChangeMyPlan(c *gin.Context) {
+	userModel, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	var req ChangePlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sub, err := currentSubscription(database.DB, userModel.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No membership subscription"})
+		return
+	}
+	if sub.Status != "active" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Settle the outstanding balance before changing plan"})
+		return
+	}
+
+	plan, ok := activePlan(c, req.PlanID)
+	if !ok {
+		return
+	}
+	if plan.ID == sub.PlanID {
+		if sub.ScheduledPlanID == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Already on this plan"})
+			return
+		}
+		sub.ScheduledPlanID = nil
+		if err := database.DB.Save(sub).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel plan change"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"subscription": sub,
+			"plan":         plan,
+		})
+		return
+	}
+
+	effective := req.Effective
+	if effective == "" {
+		effective = "now"
+		if monthlyPrice(plan.Price, billingCycle(plan)) < monthlyPrice(sub.Price, sub.BillingCycle) {
+			effective = "renewal"
+		}
+	}
+
+	if effective == "renewal" {
+		if sub.CancelAtPeriodEnd {
+			c.JSON(http.StatusConflict, gin.H{"error": "Subscription ends at the end of this period"})
+			return
+		}
+		sub.ScheduledPlanID = &plan.ID
+		if err := database.DB.Save(sub).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule plan change"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"subscription": sub,
+			"plan":         plan,
+			"effective":    effective,
+			"effective_at": sub.CurrentPeriodEnd,
+		})
+		return
+	}
+
+	prorated, payment, err := ChangePlan(c.Request.Context(), database.DB, h.config, sub, plan, time.Now())
+	if err != nil {
+		respondChargeError(c, err, payment)
+		return
+	}
+	h.pushPassUpdates(c)
+
+	c.JSON(http.StatusOK, gin.H{
+		"subscription": sub,
+		"plan":         plan,
+		"proration":    prorated,
+		"payment":      payment,
+		"effective":    effective,
+	})
+}
+
+// UpdateMyPaymentMethod changes how the subscription is paid. A subscription
+// in dunning or suspended is charged again straight away.
+func (h *MembershipHandler) UpdateMyPaymentMethod(c *gin.Context) {
+	userModel, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	var req PaymentMethodRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.PaymentMethod == "card" && req.Source == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "source is required for card payments"})
+		return
+	}
+
+	sub, err := currentSubscription(database.DB, userModel.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No membership subscription"})
+		return
+	}
+
+	sub.PaymentMethod = req.PaymentMethod
+	sub.Source = req.Source
+	if err := database.DB.Save(sub).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update payment method"})
+		return
+	}
+
+	if sub.Status == "past_due" || sub.Status == "suspended" {
+		err := WithBillingLock(database.DB, func() error {
+			// A billing run may have settled it since it was loaded
+			if err := database.DB.First(sub, sub.ID).Error; err != nil {
+				return err
+			}
+			if sub.Status != "past_due" && sub.Status != "suspended" {
+				return nil
+			}
+			return Renew(c.Request.Context(), database.DB, h.config, sub, time.Now())
+		})
+		if errors.Is(err, ErrBillingInProgress) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":        "Payment method updated; billing is running, so the outstanding charge will be retried shortly",
+				"subscription": sub,
+			})
+			return
+		}
+		h.pushPassUpdates(c)
+		if err != nil {
+			c.JSON(http.StatusPaymentRequired, gin.H{
+				"error":        "Payment method updated, but the outstanding charge failed",
+				"subscription": sub,
+			})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, sub)
+}
+
+// CancelMySubscription stops renewal; the membership runs to the end of the paid period
+func (h *MembershipHandler) CancelMySubscription(c *gin.Context) {
+	userModel, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	sub, err := currentSubscription(database.DB, userModel.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No membership subscription"})
+		return
+	}
+
+	// Nothing more is owed on a subscription that is not in good standing
+	if sub.Status != "active" {
+		if err := endSubscription(database.DB, sub, "cancelled", time.Now()); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel subscription"})
+			return
+		}
+		h.pushPassUpdates(c)
+		c.JSON(http.StatusOK, sub)
+		return
+	}
+
+	sub.CancelAtPeriodEnd = true
+	if err := database.DB.Save(sub).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel subscription"})
+		return
+	}
+
+	c.JSON(http.StatusOK, sub)
+}
+
+// GetSubscriptions lists subscriptions, optionally by status (admin only)
+func (h *MembershipHandler) GetSubscriptions(c *gin.Context) {
+	query := database.DB.Preload("User").Order("next_billing_at ASC")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var subs []models.MembershipSubscription
+	if err := query.Find(&subs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve subscriptions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"subscriptions": subs,
+		"count":         len(subs),
+	})
+}
+
+// RunBillingNow runs the billing cycle immediately (admin only)
+func (h *MembershipHandler) RunBillingNow(c *gin.Context) {
+	summary, err := RunBilling(c.Request.Context(), database.DB, h.config, time.Now())
+	if errors.Is(err, ErrBillingInProgress) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A billing run is already in progress"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Billing run failed"})
+		return
+	}
+	h.pushPassUpdates(c)
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// RunExpiryNow runs the membership expiry job immediately (admin only)
+func (h *MembershipHandler) RunExpiryNow(c *gin.Context) {
+	summary, err := RunExpiry(database.DB, h.config, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Expiry run failed"})
+		return
+	}
+	h.pushPassUpdates(c)
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// pushPassUpdates sends membership changes to the members' wallet passes.
+// The change is already saved, so a failure is only logged.
+func (h *MembershipHandler) pushPassUpdates(c *gin.Context) {
+	if _, err := passes.PushUpdates(c.Request.Context(), database.DB, h.config); err != nil {
+		log.Printf("Failed to push membership card updates: %v", err)
+	}
+}
+
+// currentSubscription returns the user's live subscription
+func currentSubscription(db *gorm.DB, userID uuid.UUID) (*models.MembershipSubscription, error) {
+	var sub models.MembershipSubscription
+	if err := db.Where("user_id = ? AND status IN ?", userID, liveStatuses).
+		Order("created_at DESC").
+		First(&sub).Error; err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// activePlan loads a plan that is open for sign-up, writing the error response if not
+func activePlan(c *gin.Context, planID string) (models.MembershipPlan, bool) {
+	var plan models.MembershipPlan
+
+	id, err := uuid.Parse(planID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid plan ID"})
+		return plan, false
+	}
+	if err := database.DB.Where("id = ? AND is_active = ?", id, true).First(&plan).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Membership plan not found"})
+		return plan, false
+	}
+	return plan, true
+}
+
+// respondChargeError writes the response for a failed subscription charge
+func respondChargeError(c *gin.Context, err error, payment *models.Payment) {
+	if errors.Is(err, payments.ErrDeclined) {
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": "Payment declined", "payment": payment})
+		return
+	}
+	c.JSON(http.StatusBadGateway, gin.H{"error": "Payment failed", "payment": payment})
+}
@@ -0,0 +1,328 @@
+package passes
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golf-ezz-backend/internal/config"
+	"golf-ezz-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrNotConfigured is returned when a wallet's credentials are not set
+var ErrNotConfigured = errors.New("wallet passes are not configured")
+
+// PKPassContentType is the media type of an Apple Wallet pass bundle
+const PKPassContentType = "application/vnd.apple.pkpass"
+
+// appleConfigured reports whether Apple Wallet passes can be signed
+func appleConfigured(cfg *config.Config) bool {
+	p := cfg.Passes
+	return p.AppleTeamID != "" && p.ApplePassTypeID != "" && p.AppleCertFile != "" &&
+		p.AppleKeyFile != "" && p.AppleWWDRFile != ""
+}
+
+// passField is a label and value shown on the pass
+type passField struct {
+	Key           string `json:"key"`
+	Label         string `json:"label"`
+	Value         string `json:"value"`
+	DateStyle     string `json:"dateStyle,omitempty"`
+	ChangeMessage string `json:"changeMessage,omitempty"`
+}
+
+type passBarcode struct {
+	Format          string `json:"format"`
+	Message         string `json:"message"`
+	MessageEncoding string `json:"messageEncoding"`
+	AltText         string `json:"altText,omitempty"`
+}
+
+type passStructure struct {
+	PrimaryFields   []passField `json:"primaryFields"`
+	SecondaryFields []passField `json:"secondaryFields"`
+	AuxiliaryFields []passField `json:"auxiliaryFields"`
+	BackFields      []passField `json:"backFields"`
+}
+
+// passJSON is the pass.json file of a pass bundle
+type passJSON struct {
+	FormatVersion       int           `json:"formatVersion"`
+	PassTypeIdentifier  string        `json:"passTypeIdentifier"`
+	SerialNumber        string        `json:"serialNumber"`
+	TeamIdentifier      string        `json:"teamIdentifier"`
+	OrganizationName    string        `json:"organizationName"`
+	Description         string        `json:"description"`
+	WebServiceURL       string        `json:"webServiceURL,omitempty"`
+	AuthenticationToken string        `json:"authenticationToken,omitempty"`
+	ForegroundColor     string        `json:"foregroundColor"`
+	BackgroundColor     string        `json:"backgroundColor"`
+	LabelColor          string        `json:"labelColor"`
+	ExpirationDate      string        `json:"expirationDate,omitempty"`
+	Voided              bool          `json:"voided,omitempty"`
+	Barcodes            []passBarcode `json:"barcodes"`
+	StoreCard           passStructure `json:"storeCard"`
+}
+
+// BuildPKPass returns a signed Apple Wallet pass bundle for a membership card
+func BuildPKPass(cfg *config.Config, card Card, pass *models.MembershipPass, now time.Time) ([]byte, error) {
+	if !appleConfigured(cfg) {
+		return nil, ErrNotConfigured
+	}
+	signer, err := loadAppleSigner(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	expiry := passField{Key: "expiry", Label: "EXPIRES", Value: "No expiry", ChangeMessage: "Your membership now runs to %@"}
+	if card.Expiry != nil {
+		expiry.Value = card.Expiry.Format(time.RFC3339)
+		expiry.DateStyle = "PKDateStyleMedium"
+	}
+	status := card.Status
+	if status != "" {
+		status = strings.ToUpper(status[:1]) + status[1:]
+	}
+	content := passJSON{
+		FormatVersion:      1,
+		PassTypeIdentifier: cfg.Passes.ApplePassTypeID,
+		SerialNumber:       pass.SerialNumber,
+		TeamIdentifier:     cfg.Passes.AppleTeamID,
+		OrganizationName:   cfg.Passes.OrganizationName,
+		Description:        cfg.Passes.OrganizationName + " membership card",
+		ForegroundColor:    "rgb(255, 255, 255)",
+		BackgroundColor:    "rgb(22, 101, 52)",
+		LabelColor:         "rgb(187, 247, 208)",
+		Voided:             !card.Valid(now),
+		Barcodes: []passBarcode{{
+			Format:          "PKBarcodeFormatQR",
+			Message:         card.Barcode,
+			MessageEncoding: "iso-8859-1",
+			AltText:         card.MembershipNumber,
+		}},
+		StoreCard: passStructure{
+			PrimaryFields: []passField{{Key: "plan", Label: "MEMBERSHIP", Value: card.Plan, ChangeMessage: "Your membership is now %@"}},
+			SecondaryFields: []passField{
+				{Key: "member", Label: "MEMBER", Value: card.Name},
+				{Key: "number", Label: "NUMBER", Value: card.MembershipNumber},
+			},
+			AuxiliaryFields: []passField{
+				expiry,
+				{Key: "status", Label: "STATUS", Value: status},
+			},
+			BackFields: []passField{
+				{Key: "terms", Label: "Check-in", Value: "Show this card at the pro shop when you arrive."},
+			},
+		},
+	}
+	if card.Expiry != nil {
+		content.ExpirationDate = card.Expiry.Format(time.RFC3339)
+	}
+	if cfg.Passes.AppleWebServiceURL != "" {
+		content.WebServiceURL = cfg.Passes.AppleWebServiceURL
+		content.AuthenticationToken = pass.AuthToken
+	}
+
+	files, err := passImages(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if files["pass.json"], err = json.Marshal(content); err != nil {
+		return nil, err
+	}
+
+	manifest := make(map[string]string, len(files))
+	for name, data := range files {
+		sum := sha1.Sum(data)
+		manifest[name] = hex.EncodeToString(sum[:])
+	}
+	if files["manifest.json"], err = json.Marshal(manifest); err != nil {
+		return nil, err
+	}
+	if files["signature"], err = signDetached(files["manifest.json"], signer.cert, signer.key, signer.chain, now); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, name := range names {
+		w, err := archive.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(files[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// appleSigner is the pass type certificate and key with Apple's intermediate
+type appleSigner struct {
+	pair  tls.Certificate
+	cert  *x509.Certificate
+	key   crypto.Signer
+	chain []*x509.Certificate
+}
+
+// loadAppleSigner reads the configured pass certificates
+func loadAppleSigner(cfg *config.Config) (*appleSigner, error) {
+	pair, err := tls.LoadX509KeyPair(cfg.Passes.AppleCertFile, cfg.Passes.AppleKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load pass certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("parse pass certificate: %w", err)
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("pass certificate key cannot sign")
+	}
+
+	data, err := os.ReadFile(cfg.Passes.AppleWWDRFile)
+	if err != nil {
+		return nil, fmt.Errorf("load WWDR certificate: %w", err)
+	}
+	var chain []*x509.Certificate
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		intermediate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse WWDR certificate: %w", err)
+		}
+		chain = append(chain, intermediate)
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no certificate in %s", cfg.Passes.AppleWWDRFile)
+	}
+
+	return &appleSigner{pair: pair, cert: cert, key: key, chain: chain}, nil
+}
+
+// passImages returns the images in the configured directory, or plain
+// generated icons when there are none. Wallet requires at least icon.png.
+func passImages(cfg *config.Config) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	if dir := cfg.Passes.AppleImagesDir; dir != "" {
+		paths, err := filepath.Glob(filepath.Join(dir, "*.png"))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			files[filepath.Base(path)] = data
+		}
+	}
+
+	if _, ok := files["icon.png"]; !ok {
+		for name, size := range map[string]int{"icon.png": 29, "icon@2x.png": 58} {
+			data, err := plainIcon(size)
+			if err != nil {
+				return nil, err
+			}
+			files[name] = data
+		}
+	}
+	return files, nil
+}
+
+// plainIcon draws a square in the pass background colour
+func plainIcon(size int) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	fill := color.RGBA{R: 22, G: 101, B: 52, A: 255}
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			img.Set(x, y, fill)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// pushApple asks every device holding a pass to fetch its new version.
+// Devices whose push token Apple no longer accepts are unregistered.
+func pushApple(ctx context.Context, db *gorm.DB, cfg *config.Config, pass *models.MembershipPass) error {
+	var registrations []models.PassRegistration
+	if err := db.Where("pass_id = ?", pass.ID).Find(&registrations).Error; err != nil {
+		return err
+	}
+	if len(registrations) == 0 {
+		return nil
+	}
+
+	signer, err := loadAppleSigner(cfg)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{Certificates: []tls.Certificate{signer.pair}},
+			ForceAttemptHTTP2: true,
+		},
+	}
+
+	for _, registration := range registrations {
+		url := strings.TrimRight(cfg.Passes.ApplePushURL, "/") + "/3/device/" + registration.PushToken
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader("{}"))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("apns-topic", cfg.Passes.ApplePassTypeID)
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		switch {
+		case resp.StatusCode == http.StatusGone:
+			if err := db.Unscoped().Delete(&registration).Error; err != nil {
+				return err
+			}
+		case resp.StatusCode != http.StatusOK:
+			return fmt.Errorf("APNs returned %s", resp.Status)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package passes
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golf-ezz-backend/internal/config"
+	"golf-ezz-backend/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// Google Wallet endpoints
+const (
+	googleSaveURL    = "https://pay.google.com/gp/v/save/"
+	googleTokenURL   = "https://oauth2.googleapis.com/token"
+	googleObjectsURL = "https://walletobjects.googleapis.com/walletobjects/v1/genericObject/"
+	googleScope      = "https://www.googleapis.com/auth/wallet_object.issuer"
+)
+
+// googleConfigured reports whether Google Wallet passes can be signed
+func googleConfigured(cfg *config.Config) bool {
+	return cfg.Passes.GoogleIssuerID != "" && cfg.Passes.GoogleKeyFile != ""
+}
+
+// serviceAccount is the part of a Google service account key we use
+type serviceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	key         *rsa.PrivateKey
+}
+
+func loadServiceAccount(cfg *config.Config) (*serviceAccount, error) {
+	data, err := os.ReadFile(cfg.Passes.GoogleKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load service account key: %w", err)
+	}
+	var account serviceAccount
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, fmt.Errorf("parse service account key: %w", err)
+	}
+	if account.key, err = jwt.ParseRSAPrivateKeyFromPEM([]byte(account.PrivateKey)); err != nil {
+		return nil, fmt.Errorf("parse service account key: %w", err)
+	}
+	return &account, nil
+}
+
+type localizedString struct {
+	DefaultValue translatedString `json:"defaultValue"`
+}
+
+type translatedString struct {
+	Language string `json:"language"`
+	Value    string `json:"value"`
+}
+
+type textModule struct {
+	ID     string `json:"id"`
+	Header string `json:"header"`
+	Body   string `json:"body"`
+}
+
+type googleBarcode struct {
+	Type          string `json:"type"`
+	Value         string `json:"value"`
+	AlternateText string `json:"alternateText"`
+}
+
+type timeInterval struct {
+	End struct {
+		Date string `json:"date"`
+	} `json:"end"`
+}
+
+// genericObject is a Google Wallet generic pass
+type genericObject struct {
+	ID                 string          `json:"id"`
+	ClassID            string          `json:"classId"`
+	State              string          `json:"state"`
+	CardTitle          localizedString `json:"cardTitle"`
+	Header             localizedString `json:"header"`
+	Subheader          localizedString `json:"subheader"`
+	HexBackgroundColor string          `json:"hexBackgroundColor"`
+	Barcode            googleBarcode   `json:"barcode"`
+	TextModulesData    []textModule    `json:"textModulesData"`
+	ValidTimeInterval  *timeInterval   `json:"validTimeInterval,omitempty"`
+}
+
+func localized(value string) localizedString {
+	return localizedString{DefaultValue: translatedString{Language: "en", Value: value}}
+}
+
+// googleObject builds the Google Wallet object for a membership card
+func googleObject(cfg *config.Config, card Card, pass *models.MembershipPass, now time.Time) genericObject {
+	state := "ACTIVE"
+	if !card.Valid(now) {
+		state = "EXPIRED"
+	}
+	expiry := "No expiry"
+
+	object := genericObject{
+		ID:                 cfg.Passes.GoogleIssuerID + "." + pass.SerialNumber,
+		ClassID:            googleClassID(cfg),
+		State:              state,
+		CardTitle:          localized(cfg.Passes.OrganizationName),
+		Header:             localized(card.Name),
+		Subheader:          localized(card.Plan),
+		HexBackgroundColor: "#166534",
+		Barcode: googleBarcode{
+			Type:          "QR_CODE",
+			Value:         card.Barcode,
+			AlternateText: card.MembershipNumber,
+		},
+	}
+	if card.Expiry != nil {
+		expiry = card.Expiry.Format("2 Jan 2006")
+		object.ValidTimeInterval = &timeInterval{}
+		object.ValidTimeInterval.End.Date = card.Expiry.Format(time.RFC3339)
+	}
+	object.TextModulesData = []textModule{
+		{ID: "number", Header: "Membership number", Body: card.MembershipNumber},
+		{ID: "expiry", Header: "Expires", Body: expiry},
+		{ID: "status", Header: "Status", Body: card.Status},
+	}
+	return object
+}
+
+func googleClassID(cfg *config.Config) string {
+	return cfg.Passes.GoogleIssuerID + "." + cfg.Passes.GoogleClassID
+}
+
+// GoogleSaveJWT returns the signed "Save to Google Wallet" JWT for a
+// membership card and the link that adds it to the member's wallet. The pass
+// class is created with the first save.
+func GoogleSaveJWT(cfg *config.Config, card Card, pass *models.MembershipPass, now time.Time) (string, string, error) {
+	if !googleConfigured(cfg) {
+		return "", "", ErrNotConfigured
+	}
+	account, err := loadServiceAccount(cfg)
+	if err != nil {
+		return "", "", err
+	}
+
+	claims := jwt.MapClaims{
+		"iss": account.ClientEmail,
+		"aud": "google",
+		"typ": "savetowallet",
+		"iat": now.Unix(),
+		"payload": map[string]interface{}{
+			"genericClasses": []map[string]string{{"id": googleClassID(cfg)}},
+			"genericObjects": []genericObject{googleObject(cfg, card, pass, now)},
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(account.key)
+	if err != nil {
+		return "", "", err
+	}
+	return token, googleSaveURL + token, nil
+}
+
+// updateGoogleObject brings a saved Google Wallet pass up to date. Passes the
+// member never saved do not exist at Google and are skipped.
+func updateGoogleObject(ctx context.Context, db *gorm.DB, cfg *config.Config, pass *models.MembershipPass) error {
+	card, err := CardFor(db, cfg, pass.UserID)
+	if errors.Is(err, ErrNoMembership) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	account, err := loadServiceAccount(cfg)
+	if err != nil {
+		return err
+	}
+	accessToken, err := googleAccessToken(ctx, account)
+	if err != nil {
+		return err
+	}
+
+	object := googleObject(cfg, card, pass, time.Now())
+	body, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, googleObjectsURL+url.PathEscape(object.ID), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := (&http.Client{Timeout: 10 * time.Second}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNotFound:
+		return nil
+	}
+	return fmt.Errorf("Google Wallet returned %s", resp.Status)
+}
+
+// googleAccessToken exchanges a signed service account assertion for an
+// access token to the Google Wallet API
+func googleAccessToken(ctx context.Context, account *serviceAccount) (string, error) {
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   account.ClientEmail,
+		"scope": googleScope,
+		"aud":   googleTokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(account.key)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, googleTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := (&http.Client{Timeout: 10 * time.Second}).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request returned %s", resp.Status)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
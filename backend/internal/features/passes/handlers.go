@@ -0,0 +1,377 @@
+package passes
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"golf-ezz-backend/internal/config"
+	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/features/courses"
+	"golf-ezz-backend/internal/middleware"
+	"golf-ezz-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PassHandler handles membership card requests
+type PassHandler struct {
+	config *config.Config
+}
+
+// NewPassHandler creates a new pass handler
+func NewPassHandler(cfg *config.Config) *PassHandler {
+	return &PassHandler{config: cfg}
+}
+
+// RegisterDeviceRequest is sent by an Apple device adding a pass
+type RegisterDeviceRequest struct {
+	PushToken string `json:"pushToken" binding:"required"`
+}
+
+// CheckInRequest represents a scanned membership card
+type CheckInRequest struct {
+	Barcode   string `json:"barcode" binding:"required"`
+	BookingID string `json:"booking_id"` // also checks in one of today's tee times
+}
+
+// GetMyMembershipCard returns the authenticated user's membership card with a
+// Google Wallet save link. With format=pkpass it returns the signed Apple
+// Wallet pass instead.
+func (h *PassHandler) GetMyMembershipCard(c *gin.Context) {
+	if !barcodesConfigured(h.config) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Membership cards are not configured"})
+		return
+	}
+
+	userModel, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	card, err := CardFor(database.DB, h.config, userModel.ID)
+	if errors.Is(err, ErrNoMembership) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "You do not have a membership card"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve membership"})
+		return
+	}
+
+	pass, err := PassFor(database.DB, userModel.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create membership card"})
+		return
+	}
+
+	now := time.Now()
+	if c.Query("format") == "pkpass" {
+		h.writePKPass(c, card, pass, now)
+		return
+	}
+
+	response := gin.H{
+		"card":          card,
+		"valid":         card.Valid(now),
+		"apple_wallet":  appleConfigured(h.config),
+		"google_wallet": nil,
+	}
+	if googleConfigured(h.config) {
+		token, saveURL, err := GoogleSaveJWT(h.config, card, pass, now)
+		if err != nil {
+			log.Printf("Failed to sign Google Wallet pass %s: %v", pass.SerialNumber, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create Google Wallet pass"})
+			return
+		}
+		response["google_wallet"] = gin.H{
+			"jwt":      token,
+			"save_url": saveURL,
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RegisterDevice records an Apple device that added a pass, so it is pushed
+// updates. Part of the Apple Wallet web service.
+func (h *PassHandler) RegisterDevice(c *gin.Context) {
+	pass, ok := h.authorizedPass(c)
+	if !ok {
+		return
+	}
+
+	var req RegisterDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	// Apple expects 201 for a new registration and 200 for a known one
+	var registration models.PassRegistration
+	err := database.DB.Where("pass_id = ? AND device_library_id = ?", pass.ID, c.Param("device_id")).
+		First(&registration).Error
+	if err == nil {
+		if err := database.DB.Model(&registration).Update("push_token", req.PushToken).Error; err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.Status(http.StatusOK)
+		return
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	registration = models.PassRegistration{
+		PassID:          pass.ID,
+		DeviceLibraryID: c.Param("device_id"),
+		PushToken:       req.PushToken,
+	}
+	if err := database.DB.Create(&registration).Error; err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusCreated)
+}
+
+// UnregisterDevice forgets a device that removed a pass. Part of the Apple
+// Wallet web service.
+func (h *PassHandler) UnregisterDevice(c *gin.Context) {
+	pass, ok := h.authorizedPass(c)
+	if !ok {
+		return
+	}
+
+	if err := database.DB.Unscoped().
+		Where("pass_id = ? AND device_library_id = ?", pass.ID, c.Param("device_id")).
+		Delete(&models.PassRegistration{}).Error; err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// GetUpdatedPasses lists the serial numbers of a device's passes that changed
+// since its last update tag. Part of the Apple Wallet web service.
+func (h *PassHandler) GetUpdatedPasses(c *gin.Context) {
+	if c.Param("pass_type_id") != h.config.Passes.ApplePassTypeID {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	query := database.DB.Model(&models.MembershipPass{}).
+		Joins("JOIN pass_registrations ON pass_registrations.pass_id = membership_passes.id").
+		Where("pass_registrations.device_library_id = ? AND pass_registrations.deleted_at IS NULL", c.Param("device_id"))
+	if since := c.Query("passesUpdatedSince"); since != "" {
+		if tag, err := time.Parse(time.RFC3339Nano, since); err == nil {
+			query = query.Where("membership_passes.changed_at > ?", tag)
+		}
+	}
+
+	var passes []models.MembershipPass
+	if err := query.Find(&passes).Error; err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	if len(passes) == 0 {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	serials := make([]string, len(passes))
+	latest := passes[0].ChangedAt
+	for i, pass := range passes {
+		serials[i] = pass.SerialNumber
+		if pass.ChangedAt.After(latest) {
+			latest = pass.ChangedAt
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"serialNumbers": serials,
+		"lastUpdated":   latest.UTC().Format(time.RFC3339Nano),
+	})
+}
+
+// GetLatestPass returns the current version of a pass to a device holding it.
+// Part of the Apple Wallet web service.
+func (h *PassHandler) GetLatestPass(c *gin.Context) {
+	if !barcodesConfigured(h.config) {
+		c.Status(http.StatusServiceUnavailable)
+		return
+	}
+
+	pass, ok := h.authorizedPass(c)
+	if !ok {
+		return
+	}
+
+	if since, err := http.ParseTime(c.GetHeader("If-Modified-Since")); err == nil &&
+		!pass.ChangedAt.Truncate(time.Second).After(since) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	card, err := CardFor(database.DB, h.config, pass.UserID)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	h.writePKPass(c, card, pass, time.Now())
+}
+
+// LogMessages records errors Apple devices report about passes. Part of the
+// Apple Wallet web service.
+func (h *PassHandler) LogMessages(c *gin.Context) {
+	var req struct {
+		Logs []string `json:"logs"`
+	}
+	if err := c.ShouldBindJSON(&req); err == nil {
+		for _, message := range req.Logs {
+			log.Printf("Apple Wallet: %s", message)
+		}
+	}
+	c.Status(http.StatusOK)
+}
+
+// CheckIn scans a member's card at the course (admin only). It reports
+// whether the membership is in force and the member's tee times today, and
+// checks in the given booking.
+func (h *PassHandler) CheckIn(c *gin.Context) {
+	if !barcodesConfigured(h.config) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Membership cards are not configured"})
+		return
+	}
+
+	var req CheckInRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	number, err := ParseBarcode(h.config, req.Barcode)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Membership card not recognised"})
+		return
+	}
+
+	var member models.User
+	if err := database.DB.Where("membership_id = ?", number).First(&member).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return
+	}
+	card, err := cardOf(h.config, member)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read membership"})
+		return
+	}
+
+	now := time.Now()
+	today := courses.DateOnly(now)
+
+	var checkedIn *models.TeeTimeBooking
+	if req.BookingID != "" {
+		bookingID, err := uuid.Parse(req.BookingID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid booking ID"})
+			return
+		}
+
+		var booking models.TeeTimeBooking
+		err = database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("id = ? AND user_id = ? AND date = ? AND status <> ?", bookingID, member.ID, today, "cancelled").
+				First(&booking).Error; err != nil {
+				return err
+			}
+			if booking.CheckedIn {
+				return nil
+			}
+			booking.CheckedIn = true
+			booking.CheckInTime = &now
+			return tx.Model(&booking).Updates(map[string]interface{}{
+				"checked_in":    true,
+				"check_in_time": now,
+			}).Error
+		})
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No booking today for this member"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check in booking"})
+			return
+		}
+		checkedIn = &booking
+	}
+
+	var bookings []models.TeeTimeBooking
+	if err := database.DB.Preload("Course").
+		Where("user_id = ? AND date = ? AND status <> ?", member.ID, today, "cancelled").
+		Order("time ASC").
+		Find(&bookings).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve bookings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"member": gin.H{
+			"id":    member.ID,
+			"name":  member.Name,
+			"email": member.Email,
+		},
+		"card":       card,
+		"valid":      card.Valid(now),
+		"bookings":   bookings,
+		"checked_in": checkedIn,
+	})
+}
+
+// writePKPass writes a signed Apple Wallet pass
+func (h *PassHandler) writePKPass(c *gin.Context, card Card, pass *models.MembershipPass, now time.Time) {
+	bundle, err := BuildPKPass(h.config, card, pass, now)
+	if errors.Is(err, ErrNotConfigured) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Apple Wallet passes are not available"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to build Apple Wallet pass %s: %v", pass.SerialNumber, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create Apple Wallet pass"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="membership-%s.pkpass"`, card.MembershipNumber))
+	c.Header("Last-Modified", pass.ChangedAt.UTC().Format(http.TimeFormat))
+	c.Data(http.StatusOK, PKPassContentType, bundle)
+}
+
+// authorizedPass loads the pass an Apple Wallet web service request is for,
+// checking the authentication token the device presents. It writes the
+// response and returns false when the request is refused.
+func (h *PassHandler) authorizedPass(c *gin.Context) (*models.MembershipPass, bool) {
+	if c.Param("pass_type_id") != h.config.Passes.ApplePassTypeID {
+		c.Status(http.StatusNotFound)
+		return nil, false
+	}
+
+	var pass models.MembershipPass
+	if err := database.DB.Where("serial_number = ?", c.Param("serial")).First(&pass).Error; err != nil {
+		c.Status(http.StatusUnauthorized)
+		return nil, false
+	}
+
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "ApplePass ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(pass.AuthToken)) != 1 {
+		c.Status(http.StatusUnauthorized)
+		return nil, false
+	}
+	return &pass, true
+}
@@ -0,0 +1,195 @@
+// Package passes provides digital membership cards for Apple and Google
+// Wallet, and the signed barcode on them that is scanned at check-in
+package passes
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"golf-ezz-backend/internal/config"
+	"golf-ezz-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrNoMembership is returned for users who have never held a membership and
+// so have no membership number to put on a card
+var ErrNoMembership = errors.New("no membership card")
+
+// ErrInvalidBarcode is returned for a barcode that was not issued by us
+var ErrInvalidBarcode = errors.New("invalid membership barcode")
+
+// ErrNoBarcodeSecret is returned when no barcode secret is set, so cards can
+// be neither issued nor checked
+var ErrNoBarcodeSecret = errors.New("membership barcode secret is not set")
+
+// Card is what a membership card shows
+type Card struct {
+	MembershipNumber string     `json:"membership_number"`
+	Name             string     `json:"name"`
+	Plan             string     `json:"plan"`
+	Status           string     `json:"status"`
+	Expiry           *time.Time `json:"expiry"`
+	Barcode          string     `json:"barcode"`
+}
+
+// Valid reports whether the card is for a membership in force
+func (card Card) Valid(now time.Time) bool {
+	return card.Status == "active" && (card.Expiry == nil || card.Expiry.After(now))
+}
+
+// CardFor builds the membership card of a user
+func CardFor(db *gorm.DB, cfg *config.Config, userID uuid.UUID) (Card, error) {
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return Card{}, err
+	}
+	return cardOf(cfg, user)
+}
+
+// cardOf builds the membership card of a loaded user
+func cardOf(cfg *config.Config, user models.User) (Card, error) {
+	if !barcodesConfigured(cfg) {
+		return Card{}, ErrNoBarcodeSecret
+	}
+	if user.MembershipID == nil {
+		return Card{}, ErrNoMembership
+	}
+
+	card := Card{
+		MembershipNumber: *user.MembershipID,
+		Name:             user.Name,
+		Status:           "expired",
+		Expiry:           user.MembershipExpiry,
+		Barcode:          Barcode(cfg, *user.MembershipID),
+	}
+	if user.MembershipType != nil {
+		card.Plan = *user.MembershipType
+	}
+	if user.MembershipStatus != nil {
+		card.Status = *user.MembershipStatus
+	}
+	return card, nil
+}
+
+// Barcode returns the barcode message for a membership number: the number
+// and a signature over it, e.g. M2026-00042.K3XQ7PZM2D4A
+func Barcode(cfg *config.Config, membershipNumber string) string {
+	return membershipNumber + "." + barcodeSignature(cfg, membershipNumber)
+}
+
+// ParseBarcode checks a scanned barcode and returns the membership number in it
+func ParseBarcode(cfg *config.Config, message string) (string, error) {
+	if !barcodesConfigured(cfg) {
+		return "", ErrNoBarcodeSecret
+	}
+	message = strings.TrimSpace(message)
+	i := strings.LastIndex(message, ".")
+	if i <= 0 {
+		return "", ErrInvalidBarcode
+	}
+	number, signature := message[:i], message[i+1:]
+	if !hmac.Equal([]byte(signature), []byte(barcodeSignature(cfg, number))) {
+		return "", ErrInvalidBarcode
+	}
+	return number, nil
+}
+
+// barcodesConfigured reports whether a barcode secret is set. Membership
+// cards and check-in are unavailable until it is.
+func barcodesConfigured(cfg *config.Config) bool {
+	return cfg.Passes.BarcodeSecret != ""
+}
+
+func barcodeSignature(cfg *config.Config, membershipNumber string) string {
+	mac := hmac.New(sha256.New, []byte(cfg.Passes.BarcodeSecret))
+	mac.Write([]byte(membershipNumber))
+	return base32.StdEncoding.EncodeToString(mac.Sum(nil))[:12]
+}
+
+// PassFor returns a user's pass record, creating it on first request
+func PassFor(db *gorm.DB, userID uuid.UUID) (*models.MembershipPass, error) {
+	token := make([]byte, 24)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.MembershipPass{
+		UserID:       userID,
+		SerialNumber: uuid.New().String(),
+		AuthToken:    hex.EncodeToString(token),
+		ChangedAt:    now,
+		PushedAt:     &now,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	var pass models.MembershipPass
+	if err := db.Where("user_id = ?", userID).First(&pass).Error; err != nil {
+		return nil, err
+	}
+	return &pass, nil
+}
+
+// Touch records that what a user's card shows has changed, e.g. their plan
+// or expiry date. Wallets are told on the next PushUpdates.
+func Touch(tx *gorm.DB, userIDs ...uuid.UUID) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	return tx.Model(&models.MembershipPass{}).
+		Where("user_id IN ?", userIDs).
+		Update("changed_at", time.Now()).Error
+}
+
+// PushUpdates tells the wallets holding changed passes to fetch the new
+// version. A pass that cannot be pushed is retried on the next call, and
+// nothing is pushed until barcodes are configured.
+func PushUpdates(ctx context.Context, db *gorm.DB, cfg *config.Config) (int, error) {
+	if !barcodesConfigured(cfg) {
+		return 0, nil
+	}
+
+	var changed []models.MembershipPass
+	if err := db.Where("pushed_at IS NULL OR pushed_at < changed_at").Find(&changed).Error; err != nil {
+		return 0, err
+	}
+
+	apple, google := appleConfigured(cfg), googleConfigured(cfg)
+	pushed := 0
+	for i := range changed {
+		pass := &changed[i]
+		var failed bool
+		if apple {
+			if err := pushApple(ctx, db, cfg, pass); err != nil {
+				log.Printf("Failed to push Apple Wallet update for pass %s: %v", pass.SerialNumber, err)
+				failed = true
+			}
+		}
+		if google {
+			if err := updateGoogleObject(ctx, db, cfg, pass); err != nil {
+				log.Printf("Failed to update Google Wallet pass %s: %v", pass.SerialNumber, err)
+				failed = true
+			}
+		}
+		if failed {
+			continue
+		}
+
+		if err := db.Model(pass).Update("pushed_at", pass.ChangedAt).Error; err != nil {
+			return pushed, err
+		}
+		pushed++
+	}
+	return pushed, nil
+}
@@ -0,0 +1,48 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+
+	"golf-ezz-backend/internal/money"
+
+	"github.com/google/uuid"
+)
+
+// CashProvider records cash taken over the counter. Nothing leaves the
+// building, so every step succeeds; the transaction ID only ties the payment
+// to its refunds.
+type CashProvider struct{}
+
+// NewCashProvider creates the provider for payment_method "cash"
+func NewCashProvider() *CashProvider {
+	return &CashProvider{}
+}
+
+// Name returns the provider's registry name
+func (p *CashProvider) Name() string {
+	return "cash"
+}
+
+// Authorize records the cash tendered
+func (p *CashProvider) Authorize(_ context.Context, req ChargeRequest) (Result, error) {
+	if req.Amount <= 0 {
+		return Result{}, fmt.Errorf("amount must be positive")
+	}
+	return Result{TransactionID: "cash_" + uuid.NewString(), Status: "authorized"}, nil
+}
+
+// Capture confirms the cash is in the drawer
+func (p *CashProvider) Capture(_ context.Context, transactionID string, _ money.Amount) (Result, error) {
+	return Result{TransactionID: transactionID, Status: "captured"}, nil
+}
+
+// Refund records cash handed back from the drawer
+func (p *CashProvider) Refund(_ context.Context, transactionID string, _ money.Amount) (Result, error) {
+	return Result{TransactionID: transactionID, Status: "refunded"}, nil
+}
+
+// Void cancels a cash payment that was never completed
+func (p *CashProvider) Void(_ context.Context, transactionID string) (Result, error) {
+	return Result{TransactionID: transactionID, Status: "voided"}, nil
+}
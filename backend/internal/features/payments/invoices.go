@@ -0,0 +1,578 @@
+package payments
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/features/taxes"
+	"golf-ezz-backend/internal/middleware"
+	"golf-ezz-backend/internal/models"
+	"golf-ezz-backend/internal/money"
+	"golf-ezz-backend/internal/pdf"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// VoidInvoiceRequest represents a request to void an invoice
+type VoidInvoiceRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// IssueInvoice issues the numbered receipt for a completed payment. A payment
+// that already has a live invoice keeps it. The payment is locked while its
+// invoice is looked up and issued, so concurrent callers (the charge, the
+// capture webhook and a receipt download) cannot issue two.
+func IssueInvoice(db *gorm.DB, payment *models.Payment) (*models.Invoice, error) {
+	var invoice *models.Invoice
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var locked models.Payment
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, payment.ID).Error; err != nil {
+			return err
+		}
+
+		var existing []models.Invoice
+		if err := tx.Where("payment_id = ? AND status = ?", payment.ID, "issued").Limit(1).Find(&existing).Error; err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			invoice = &existing[0]
+			return nil
+		}
+
+		invoice = &models.Invoice{
+			PaymentID: payment.ID,
+			UserID:    payment.UserID,
+			Status:    "issued",
+			IssuedAt:  time.Now(),
+			Revision:  1,
+		}
+		if err := buildInvoice(tx, payment, invoice); err != nil {
+			return err
+		}
+		return assignInvoiceNumber(tx, invoice)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
+
+// assignInvoiceNumber takes the next number in the course's sequence and
+// creates the invoice. The sequence row stays locked until the surrounding
+// transaction ends, so a rollback also returns the number.
+func assignInvoiceNumber(tx *gorm.DB, invoice *models.Invoice) error {
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.InvoiceSequence{CourseID: invoice.CourseID}).Error; err != nil {
+		return err
+	}
+
+	var sequence models.InvoiceSequence
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("course_id = ?", invoice.CourseID).
+		First(&sequence).Error; err != nil {
+		return err
+	}
+
+	sequence.LastNumber++
+	if err := tx.Model(&models.InvoiceSequence{}).
+		Where("course_id = ?", invoice.CourseID).
+		Update("last_number", sequence.LastNumber).Error; err != nil {
+		return err
+	}
+
+	invoice.Number = sequence.LastNumber
+	invoice.InvoiceNumber = fmt.Sprintf("%s-%06d", invoicePrefix(invoice.CourseName), sequence.LastNumber)
+	return tx.Create(invoice).Error
+}
+
+// invoicePrefix derives a short invoice prefix from the course name's initials
+func invoicePrefix(courseName string) string {
+	var prefix strings.Builder
+	for _, word := range strings.Fields(courseName) {
+		if r := word[0]; (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') {
+			prefix.WriteByte(r)
+		}
+	}
+	if prefix.Len() == 0 {
+		return "GEN"
+	}
+	return strings.ToUpper(prefix.String())
+}
+
+// buildInvoice fills in the invoice snapshot (customer, course and line
+// items) from the payment and the booking or sale it pays for
+func buildInvoice(db *gorm.DB, payment *models.Payment, invoice *models.Invoice) error {
+	var user models.User
+	if err := db.First(&user, payment.UserID).Error; err != nil {
+		return err
+	}
+
+	invoice.CustomerName = user.Name
+	invoice.CustomerEmail = user.Email
+	invoice.Currency = payment.Currency
+	invoice.PaymentMethod = payment.PaymentMethod
+	invoice.CourseID = uuid.Nil
+	invoice.CourseName = ""
+	invoice.CourseAddress = ""
+	invoice.Lines = models.InvoiceLines{}
+	invoice.TaxLines = models.InvoiceLines{}
+	invoice.Tax = 0
+	invoice.TaxInclusive = false
+
+	var course *models.Course
+
+	switch {
+	case payment.BookingID != nil:
+		var booking models.TeeTimeBooking
+		if err := db.Preload("Course").First(&booking, *payment.BookingID).Error; err != nil {
+			return err
+		}
+		course = &booking.Course
+
+		when := booking.Date.Format("Mon 02 Jan 2006") + " " + booking.Time
+		lines, ok := pricedLines(booking.PriceLines, booking.TotalAmount, payment.Amount, when)
+		bookingTax(invoice, booking.TaxLines, booking.TaxAmount, booking.TaxInclusive, booking.TotalAmount, payment.Amount, ok)
+		if ok {
+			invoice.Lines = lines
+			break
+		}
+
+		holes := booking.Holes
+		if holes == 0 {
+			holes = 18
+		}
+		players := booking.Players
+		if players < 1 {
+			players = 1
+		}
+		invoice.Lines = append(invoice.Lines, models.InvoiceLine{
+			Description: fmt.Sprintf("Green fee, %d holes, %s", holes, when),
+			Category:    "green_fee",
+			Quantity:    players,
+			UnitPrice:   payment.Amount.Div(players),
+			Amount:      payment.Amount,
+		})
+
+	case payment.RangeBookingID != nil:
+		var booking models.RangeBooking
+		if err := db.Preload("Course").First(&booking, *payment.RangeBookingID).Error; err != nil {
+			return err
+		}
+		course = &booking.Course
+
+		when := booking.Date.Format("Mon 02 Jan 2006") + " " + booking.StartTime
+		lines, ok := pricedLines(booking.PriceLines, booking.TotalAmount, payment.Amount, when)
+		bookingTax(invoice, booking.TaxLines, booking.TaxAmount, booking.TaxInclusive, booking.TotalAmount, payment.Amount, ok)
+		if ok {
+			invoice.Lines = lines
+			break
+		}
+
+		buckets := booking.BucketCount
+		if buckets < 1 {
+			buckets = 1
+		}
+		invoice.Lines = append(invoice.Lines, models.InvoiceLine{
+			Description: fmt.Sprintf("Range, %s bucket, %s", booking.BucketSize, when),
+			Category:    "range",
+			Quantity:    buckets,
+			UnitPrice:   payment.Amount.Div(buckets),
+			Amount:      payment.Amount,
+		})
+
+	case payment.SaleID != nil:
+		var sale models.Sale
+		if err := db.Preload("Course").Preload("Items").First(&sale, *payment.SaleID).Error; err != nil {
+			return err
+		}
+		course = sale.Course
+		if sale.UserID == nil {
+			invoice.CustomerName = "Walk-in customer"
+			invoice.CustomerEmail = ""
+		}
+
+		whole := payment.Amount == sale.TotalAmount
+		bookingTax(invoice, sale.TaxLines, sale.TaxAmount, sale.TaxInclusive, sale.TotalAmount, payment.Amount, whole)
+		if !whole {
+			invoice.Lines = append(invoice.Lines, models.InvoiceLine{
+				Description: "Pro shop sale, part payment",
+				Category:    "merchandise",
+				Quantity:    1,
+				UnitPrice:   payment.Amount,
+				Amount:      payment.Amount,
+			})
+			break
+		}
+		for _, item := range sale.Items {
+			invoice.Lines = append(invoice.Lines, models.InvoiceLine{
+				Description: item.Name,
+				Category:    "merchandise",
+				Quantity:    item.Quantity,
+				UnitPrice:   item.UnitPrice,
+				Amount:      item.Amount,
+			})
+		}
+
+	case payment.SubscriptionID != nil:
+		var subscription models.MembershipSubscription
+		if err := db.First(&subscription, *payment.SubscriptionID).Error; err != nil {
+			return err
+		}
+		var plan models.MembershipPlan
+		if err := db.First(&plan, subscription.PlanID).Error; err != nil {
+			return err
+		}
+
+		invoice.Lines = append(invoice.Lines, models.InvoiceLine{
+			Description: fmt.Sprintf("%s (%s)", plan.Name, subscription.BillingCycle),
+			Category:    "membership",
+			Quantity:    1,
+			UnitPrice:   payment.Amount,
+			Amount:      payment.Amount,
+		})
+
+	default:
+		invoice.Lines = append(invoice.Lines, models.InvoiceLine{
+			Description: "Payment",
+			Category:    "other",
+			Quantity:    1,
+			UnitPrice:   payment.Amount,
+			Amount:      payment.Amount,
+		})
+	}
+
+	if course != nil {
+		invoice.CourseID = course.ID
+		invoice.CourseName = course.Name
+		invoice.CourseAddress = course.Address
+	}
+
+	invoice.Subtotal = 0
+	for _, line := range invoice.Lines {
+		invoice.Subtotal += line.Amount
+	}
+	invoice.Total = invoice.Subtotal
+	if !invoice.TaxInclusive {
+		invoice.Total += invoice.Tax
+	}
+	return nil
+}
+
+// bookingTax copies a booking's tax onto the invoice for a payment of it. A
+// payment of the whole booking carries all of the tax; a split payment is
+// invoiced as one line and carries its share, already inside the amount paid.
+func bookingTax(invoice *models.Invoice, taxLines models.InvoiceLines, tax money.Amount, inclusive bool, total, paid money.Amount, whole bool) {
+	if tax == 0 {
+		return
+	}
+	if whole {
+		invoice.TaxLines = taxLines
+		invoice.Tax = tax
+		invoice.TaxInclusive = inclusive
+		return
+	}
+	invoice.TaxLines, invoice.Tax = taxes.Share(taxLines, paid, total)
+	invoice.TaxInclusive = true
+}
+
+// pricedLines returns a booking's price breakdown as invoice lines, with the
+// booking time added to the first line. Only a payment of the whole booking
+// gets the breakdown; split payments are invoiced as a single line.
+func pricedLines(priceLines models.InvoiceLines, total, paid money.Amount, when string) (models.InvoiceLines, bool) {
+	if len(priceLines) == 0 || total != paid {
+		return nil, false
+	}
+
+	lines := make(models.InvoiceLines, len(priceLines))
+	copy(lines, priceLines)
+	lines[0].Description += ", " + when
+	return lines, true
+}
+
+// renderInvoicePDF lays out an invoice as a one-page PDF receipt
+func renderInvoicePDF(invoice models.Invoice, payment models.Payment) []byte {
+	doc := pdf.New()
+	left, right := 56.0, pdf.PageWidth-56
+	y := pdf.PageHeight - 72
+
+	title := "RECEIPT"
+	if invoice.Status == "void" {
+		title = "RECEIPT (VOID)"
+	}
+	doc.BoldText(left, y, 20, title)
+	doc.RightText(right, y, 10, "Invoice "+invoice.InvoiceNumber)
+	y -= 16
+	doc.RightText(right, y, 10, "Issued "+invoice.IssuedAt.Format("02 Jan 2006"))
+	if invoice.Revision > 1 {
+		y -= 14
+		doc.RightText(right, y, 10, fmt.Sprintf("Revision %d", invoice.Revision))
+	}
+
+	y -= 30
+	courseName := invoice.CourseName
+	if courseName == "" {
+		courseName = "GolfEzz"
+	}
+	doc.BoldText(left, y, 12, courseName)
+	if invoice.CourseAddress != "" {
+		y -= 14
+		doc.Text(left, y, 10, invoice.CourseAddress)
+	}
+
+	y -= 28
+	doc.BoldText(left, y, 10, "Billed to")
+	y -= 14
+	doc.Text(left, y, 10, invoice.CustomerName)
+	y -= 14
+	doc.Text(left, y, 10, invoice.CustomerEmail)
+
+	y -= 30
+	doc.BoldText(left, y, 10, "Description")
+	doc.BoldText(360, y, 10, "Qty")
+	doc.BoldText(410, y, 10, "Unit")
+	doc.RightText(right, y, 10, "Amount")
+	y -= 6
+	doc.Line(left, y, right, y)
+
+	for _, line := range invoice.Lines {
+		y -= 16
+		doc.Text(left, y, 10, line.Description)
+		doc.Text(360, y, 10, fmt.Sprintf("%d", line.Quantity))
+		doc.Text(410, y, 10, line.UnitPrice.String())
+		doc.RightText(right, y, 10, line.Amount.String())
+	}
+
+	y -= 10
+	doc.Line(left, y, right, y)
+
+	type totalLine struct {
+		label  string
+		amount money.Amount
+	}
+	totals := []totalLine{{"Subtotal", invoice.Subtotal}}
+	if !invoice.TaxInclusive {
+		for _, line := range invoice.TaxLines {
+			totals = append(totals, totalLine{line.Description, line.Amount})
+		}
+		if len(invoice.TaxLines) == 0 {
+			totals = append(totals, totalLine{"Tax", invoice.Tax})
+		}
+	}
+	totals = append(totals, totalLine{"Total " + invoice.Currency, invoice.Total})
+	if invoice.TaxInclusive {
+		for _, line := range invoice.TaxLines {
+			totals = append(totals, totalLine{"Incl. " + line.Description, line.Amount})
+		}
+	}
+	if payment.RefundedAmount > 0 {
+		totals = append(totals, totalLine{"Refunded", -payment.RefundedAmount})
+	}
+	for _, total := range totals {
+		y -= 16
+		doc.Text(360, y, 10, total.label)
+		doc.RightText(right, y, 10, total.amount.String())
+	}
+
+	y -= 30
+	method := invoice.PaymentMethod
+	if payment.Provider != "" {
+		method += " via " + payment.Provider
+	}
+	doc.Text(left, y, 10, "Paid by "+method)
+	if payment.TransactionID != nil {
+		y -= 14
+		doc.Text(left, y, 10, "Transaction "+*payment.TransactionID)
+	}
+	if invoice.Status == "void" && invoice.VoidReason != nil {
+		y -= 14
+		doc.Text(left, y, 10, "Voided: "+*invoice.VoidReason)
+	}
+
+	return doc.Bytes()
+}
+
+// GetReceiptPDF returns the PDF receipt for one of the authenticated user's payments
+func (h *PaymentHandler) GetReceiptPDF(c *gin.Context) {
+	userModel, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment ID"})
+		return
+	}
+
+	var payment models.Payment
+	if err := database.DB.Where("id = ? AND user_id = ? AND status IN ?", id, userModel.ID, paidStatuses).
+		First(&payment).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Receipt not found"})
+		return
+	}
+
+	// Payments completed before receipts existed get theirs on first request
+	invoice, err := IssueInvoice(database.DB, &payment)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate receipt"})
+		return
+	}
+
+	writeInvoicePDF(c, *invoice, payment)
+}
+
+func writeInvoicePDF(c *gin.Context, invoice models.Invoice, payment models.Payment) {
+	c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="receipt-%s.pdf"`, invoice.InvoiceNumber))
+	c.Data(http.StatusOK, "application/pdf", renderInvoicePDF(invoice, payment))
+}
+
+// GetInvoices lists invoices, optionally filtered by course and status (admin only)
+func (h *PaymentHandler) GetInvoices(c *gin.Context) {
+	query := database.DB.Order("created_at DESC")
+
+	if courseID := c.Query("course_id"); courseID != "" {
+		id, err := uuid.Parse(courseID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
+			return
+		}
+		query = query.Where("course_id = ?", id)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var invoices []models.Invoice
+	if err := query.Find(&invoices).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve invoices"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"invoices": invoices,
+		"count":    len(invoices),
+	})
+}
+
+// GetInvoicePDF returns the PDF for any invoice (admin only)
+func (h *PaymentHandler) GetInvoicePDF(c *gin.Context) {
+	invoice, ok := loadInvoice(c)
+	if !ok {
+		return
+	}
+
+	var payment models.Payment
+	if err := database.DB.First(&payment, invoice.PaymentID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
+	}
+
+	writeInvoicePDF(c, invoice, payment)
+}
+
+// RegenerateInvoice refreshes an invoice from current records, keeping its
+// number. Regenerating a void invoice issues a replacement with a new number.
+// (admin only)
+func (h *PaymentHandler) RegenerateInvoice(c *gin.Context) {
+	invoice, ok := loadInvoice(c)
+	if !ok {
+		return
+	}
+
+	var payment models.Payment
+	if err := database.DB.First(&payment, invoice.PaymentID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
+	}
+
+	if invoice.Status == "void" {
+		replacement, err := IssueInvoice(database.DB, &payment)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue replacement invoice"})
+			return
+		}
+		database.DB.Model(&invoice).Update("replaced_by_id", replacement.ID)
+		c.JSON(http.StatusCreated, replacement)
+		return
+	}
+
+	courseID := invoice.CourseID
+	if err := buildInvoice(database.DB, &payment, &invoice); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to regenerate invoice"})
+		return
+	}
+	// The number belongs to the original course's sequence
+	invoice.CourseID = courseID
+
+	now := time.Now()
+	invoice.Revision++
+	invoice.RegeneratedAt = &now
+	if err := database.DB.Save(&invoice).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to regenerate invoice"})
+		return
+	}
+
+	c.JSON(http.StatusOK, invoice)
+}
+
+// VoidInvoice marks an invoice void. Its number is kept so the sequence stays
+// gap-free. (admin only)
+func (h *PaymentHandler) VoidInvoice(c *gin.Context) {
+	invoice, ok := loadInvoice(c)
+	if !ok {
+		return
+	}
+
+	var req VoidInvoiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if invoice.Status == "void" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Invoice is already void"})
+		return
+	}
+
+	now := time.Now()
+	invoice.Status = "void"
+	invoice.VoidedAt = &now
+	invoice.VoidReason = &req.Reason
+	if userID, ok := c.Get("user_id"); ok {
+		if adminID, err := uuid.Parse(fmt.Sprint(userID)); err == nil {
+			invoice.VoidedBy = &adminID
+		}
+	}
+
+	if err := database.DB.Save(&invoice).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to void invoice"})
+		return
+	}
+
+	c.JSON(http.StatusOK, invoice)
+}
+
+// loadInvoice loads the invoice named by the :id route parameter, writing an
+// error response if it cannot
+func loadInvoice(c *gin.Context) (models.Invoice, bool) {
+	var invoice models.Invoice
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return invoice, false
+	}
+
+	if err := database.DB.First(&invoice, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+		return invoice, false
+	}
+	return invoice, true
+}
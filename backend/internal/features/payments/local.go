@@ -0,0 +1,111 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"golf-ezz-backend/internal/money"
+
+	"github.com/google/uuid"
+)
+
+// Test sources recognised by the local provider. Any other source succeeds.
+const (
+	SourceDecline = "tok_decline" // declined at authorization
+)
+
+// LocalProvider is an in-memory provider for development and tests. It never
+// contacts a real processor and keeps transactions only for the process lifetime.
+type LocalProvider struct {
+	mu           sync.Mutex
+	transactions map[string]*localTransaction
+}
+
+type localTransaction struct {
+	authorized money.Amount
+	captured   money.Amount
+	refunded   money.Amount
+	voided     bool
+}
+
+// NewLocalProvider creates a local fake provider
+func NewLocalProvider() *LocalProvider {
+	return &LocalProvider{transactions: make(map[string]*localTransaction)}
+}
+
+// Name returns the provider's registry name
+func (p *LocalProvider) Name() string {
+	return "local"
+}
+
+// Authorize places a hold for the requested amount
+func (p *LocalProvider) Authorize(_ context.Context, req ChargeRequest) (Result, error) {
+	if req.Source == SourceDecline {
+		return Result{}, ErrDeclined
+	}
+	if req.Amount <= 0 {
+		return Result{}, fmt.Errorf("amount must be positive")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	id := "local_" + uuid.NewString()
+	p.transactions[id] = &localTransaction{authorized: req.Amount}
+	return Result{TransactionID: id, Status: "authorized"}, nil
+}
+
+// Capture settles a previously authorized amount
+func (p *LocalProvider) Capture(_ context.Context, transactionID string, amount money.Amount) (Result, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	tx, ok := p.transactions[transactionID]
+	if !ok {
+		return Result{}, ErrUnknownTransaction
+	}
+	if tx.voided {
+		return Result{}, fmt.Errorf("transaction %s was voided", transactionID)
+	}
+	if tx.captured+amount > tx.authorized {
+		return Result{}, fmt.Errorf("capture exceeds authorized amount")
+	}
+
+	tx.captured += amount
+	return Result{TransactionID: transactionID, Status: "captured"}, nil
+}
+
+// Refund returns all or part of a captured amount
+func (p *LocalProvider) Refund(_ context.Context, transactionID string, amount money.Amount) (Result, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	tx, ok := p.transactions[transactionID]
+	if !ok {
+		return Result{}, ErrUnknownTransaction
+	}
+	if tx.refunded+amount > tx.captured {
+		return Result{}, fmt.Errorf("refund exceeds captured amount")
+	}
+
+	tx.refunded += amount
+	return Result{TransactionID: transactionID, Status: "refunded"}, nil
+}
+
+// Void releases an authorization that has not been captured
+func (p *LocalProvider) Void(_ context.Context, transactionID string) (Result, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	tx, ok := p.transactions[transactionID]
+	if !ok {
+		return Result{}, ErrUnknownTransaction
+	}
+	if tx.captured > 0 {
+		return Result{}, fmt.Errorf("transaction %s is already captured", transactionID)
+	}
+
+	tx.voided = true
+	return Result{TransactionID: transactionID, Status: "voided"}, nil
+}
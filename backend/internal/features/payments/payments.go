@@ -0,0 +1,493 @@
+// Package payments provides payment processing through pluggable providers
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"golf-ezz-backend/internal/config"
+	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/features/households"
+	"golf-ezz-backend/internal/features/ledger"
+	"golf-ezz-backend/internal/middleware"
+	"golf-ezz-backend/internal/models"
+	"golf-ezz-backend/internal/money"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errBookingCancelled  = errors.New("booking is cancelled")
+	errBookingPaid       = errors.New("booking is already paid")
+	errPaymentInProgress = errors.New("a payment for this booking is in progress")
+	errNothingToPay      = errors.New("nothing to pay")
+	errExceedsBalance    = errors.New("amount exceeds the outstanding balance")
+)
+
+// PaymentHandler handles payment requests
+type PaymentHandler struct {
+	config *config.Config
+}
+
+// NewPaymentHandler creates a new payment handler
+func NewPaymentHandler(cfg *config.Config) *PaymentHandler {
+	return &PaymentHandler{config: cfg}
+}
+
+// PayBookingRequest represents a request to pay for a tee time or range booking
+type PayBookingRequest struct {
+	BookingID      string       `json:"booking_id"`
+	RangeBookingID string       `json:"range_booking_id"`
+	PaymentMethod  string       `json:"payment_method" binding:"required,oneof=card gift_card wallet points"`
+	Source         string       `json:"source"`                 // card token, or gift card code; unused for wallet and points
+	Amount         money.Amount `json:"amount" binding:"min=0"` // 0 pays the outstanding balance
+}
+
+// methodProviders maps stored-value and cash payment methods to their
+// providers. Card payments use the configured card provider.
+var methodProviders = map[string]string{
+	"gift_card": "gift_card",
+	"wallet":    "wallet",
+	"cash":      "cash",
+	"points":    "points",
+}
+
+// ProviderFor returns the provider that handles a payment method
+func ProviderFor(cfg *config.Config, method string) (Provider, error) {
+	name := cfg.Payment.Provider
+	if mapped, ok := methodProviders[method]; ok {
+		name = mapped
+	}
+	return GetProvider(name)
+}
+
+// Charge authorizes and captures a pending payment through the provider. On
+// success the payment, its ledger entry and the payment status of the booking
+// it pays for are recorded in a single transaction and a receipt is issued; on
+// failure the payment and booking are marked failed.
+func Charge(ctx context.Context, db *gorm.DB, provider Provider, payment *models.Payment, source string) error {
+	payment.Provider = provider.Name()
+
+	auth, err := provider.Authorize(ctx, ChargeRequest{
+		Amount:    payment.Amount,
+		Currency:  payment.Currency,
+		Source:    source,
+		Customer:  payment.UserID.String(),
+		Reference: payment.ID.String(),
+	})
+	if err != nil {
+		return markFailed(db, payment, err)
+	}
+
+	capture, err := provider.Capture(ctx, auth.TransactionID, payment.Amount)
+	if err != nil {
+		// Release the hold so the customer isn't left with a dangling authorization
+		provider.Void(ctx, auth.TransactionID)
+		payment.TransactionID = &auth.TransactionID
+		return markFailed(db, payment, err)
+	}
+
+	now := time.Now()
+	payment.Status = "completed"
+	payment.TransactionID = &auth.TransactionID
+	payment.ProcessedAt = &now
+	payment.Fee = capture.Fee
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(payment).Error; err != nil {
+			return err
+		}
+		if err := ledger.PostPayment(tx, payment); err != nil {
+			return err
+		}
+		return SettleBookingPaymentStatus(tx, payment)
+	}); err != nil {
+		return reverseCapture(ctx, db, provider, payment, err)
+	}
+
+	// The charge has settled, so a receipt problem must not fail the payment
+	if _, err := IssueInvoice(db, payment); err != nil {
+		log.Printf("Failed to issue invoice for payment %s: %v", payment.ID, err)
+	}
+	return nil
+}
+
+// reverseCapture handles money that was captured but could not be recorded.
+// The capture is refunded so the customer is not charged for a payment we
+// have no record of. If the refund fails too, the payment stays pending with
+// its transaction ID, where the provider's capture webhook or staff can settle
+// it, and ErrUnrecorded is returned.
+func reverseCapture(ctx context.Context, db *gorm.DB, provider Provider, payment *models.Payment, cause error) error {
+	log.Printf("Failed to record captured payment %s: %v", payment.ID, cause)
+
+	payment.Status = "pending"
+	payment.ProcessedAt = nil
+	if _, err := provider.Refund(ctx, *payment.TransactionID, payment.Amount); err != nil {
+		log.Printf("Failed to refund unrecorded payment %s (transaction %s): %v", payment.ID, *payment.TransactionID, err)
+		reason := "captured but not recorded: " + cause.Error()
+		payment.FailureReason = &reason
+		if err := db.Model(payment).Updates(map[string]interface{}{
+			"transaction_id": payment.TransactionID,
+			"failure_reason": reason,
+		}).Error; err != nil {
+			log.Printf("Failed to flag unrecorded payment %s: %v", payment.ID, err)
+		}
+		return ErrUnrecorded
+	}
+
+	payment.Fee = money.Zero
+	return markFailed(db, payment, fmt.Errorf("payment could not be recorded and was refunded: %w", cause))
+}
+
+// markFailed records a failed charge and returns the original error
+func markFailed(db *gorm.DB, payment *models.Payment, cause error) error {
+	reason := cause.Error()
+	payment.Status = "failed"
+	payment.FailureReason = &reason
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(payment).Error; err != nil {
+			return err
+		}
+		return settleBookingPaymentStatus(tx, payment, "failed")
+	}); err != nil {
+		return err
+	}
+	return cause
+}
+
+// paidStatuses are the payment statuses that count towards a booking's total
+var paidStatuses = []string{"completed", "partially_refunded", "refunded", "disputed"}
+
+// reservedStatuses also include payments still being charged
+var reservedStatuses = append([]string{"pending", "authorized"}, paidStatuses...)
+
+// OutstandingAmount returns how much of a booking's total is still unpaid
+func OutstandingAmount(db *gorm.DB, total money.Amount, column string, bookingID uuid.UUID) (money.Amount, error) {
+	return remainingAmount(db, total, column, bookingID, paidStatuses)
+}
+
+// UnreservedAmount returns how much of a booking's total is neither paid nor
+// being charged. Lock the booking first so that the answer still holds when
+// the new payment is created.
+func UnreservedAmount(db *gorm.DB, total money.Amount, column string, bookingID uuid.UUID) (money.Amount, error) {
+	return remainingAmount(db, total, column, bookingID, reservedStatuses)
+}
+
+func remainingAmount(db *gorm.DB, total money.Amount, column string, bookingID uuid.UUID, statuses []string) (money.Amount, error) {
+	var paid money.Amount
+	if err := db.Model(&models.Payment{}).
+		Where(column+" = ? AND status IN ?", bookingID, statuses).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&paid).Error; err != nil {
+		return money.Zero, err
+	}
+	return money.Max(total-paid, money.Zero), nil
+}
+
+// SettleBookingPaymentStatus marks the booking a payment is for as completed
+// once its payments cover the total, or partially_paid when they do not yet
+func SettleBookingPaymentStatus(tx *gorm.DB, payment *models.Payment) error {
+	return settleBookingPaymentStatus(tx, payment, "pending")
+}
+
+// settleBookingPaymentStatus derives the booking's payment status from all of
+// its payments, using unpaidStatus when none of them have taken money
+func settleBookingPaymentStatus(tx *gorm.DB, payment *models.Payment, unpaidStatus string) error {
+	var total money.Amount
+	var column string
+
+	switch {
+	case payment.BookingID != nil:
+		var booking models.TeeTimeBooking
+		if err := tx.First(&booking, *payment.BookingID).Error; err != nil {
+			return err
+		}
+		total, column = booking.TotalAmount, "booking_id"
+	case payment.RangeBookingID != nil:
+		var booking models.RangeBooking
+		if err := tx.First(&booking, *payment.RangeBookingID).Error; err != nil {
+			return err
+		}
+		total, column = booking.TotalAmount, "range_booking_id"
+	case payment.SaleID != nil:
+		var sale models.Sale
+		if err := tx.First(&sale, *payment.SaleID).Error; err != nil {
+			return err
+		}
+		total, column = sale.TotalAmount, "sale_id"
+	default:
+		return nil
+	}
+
+	bookingID := payment.BookingID
+	switch {
+	case payment.RangeBookingID != nil:
+		bookingID = payment.RangeBookingID
+	case payment.SaleID != nil:
+		bookingID = payment.SaleID
+	}
+	outstanding, err := OutstandingAmount(tx, total, column, *bookingID)
+	if err != nil {
+		return err
+	}
+
+	status := "completed"
+	switch {
+	case total > 0 && outstanding >= total:
+		status = unpaidStatus
+	case outstanding > 0:
+		status = "partially_paid"
+	}
+	return SetBookingPaymentStatus(tx, payment, status)
+}
+
+// SetBookingPaymentStatus updates the payment status of the booking or sale a
+// payment is for
+func SetBookingPaymentStatus(tx *gorm.DB, payment *models.Payment, status string) error {
+	if payment.SaleID != nil {
+		if err := tx.Model(&models.Sale{}).Where("id = ?", *payment.SaleID).
+			Update("payment_status", status).Error; err != nil {
+			return err
+		}
+	}
+	if payment.BookingID != nil {
+		if err := tx.Model(&models.TeeTimeBooking{}).Where("id = ?", *payment.BookingID).
+			Update("payment_status", status).Error; err != nil {
+			return err
+		}
+	}
+	if payment.RangeBookingID != nil {
+		if err := tx.Model(&models.RangeBooking{}).Where("id = ?", *payment.RangeBookingID).
+			Update("payment_status", status).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PayBooking charges the authenticated user for one of their bookings or, for
+// a household's primary member, one of the household's bookings
+func (h *PaymentHandler) PayBooking(c *gin.Context) {
+	userModel, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	var req PayBookingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if (req.BookingID == "") == (req.RangeBookingID == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide exactly one of booking_id or range_booking_id"})
+		return
+	}
+
+	payment := models.Payment{
+		UserID:        userModel.ID,
+		Currency:      h.config.Payment.Currency,
+		Status:        "pending",
+		PaymentMethod: req.PaymentMethod,
+	}
+
+	if req.BookingID != "" {
+		id, err := uuid.Parse(req.BookingID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid booking ID"})
+			return
+		}
+		payment.BookingID = &id
+	} else {
+		id, err := uuid.Parse(req.RangeBookingID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid range booking ID"})
+			return
+		}
+		payment.RangeBookingID = &id
+	}
+
+	if (req.PaymentMethod == "card" || req.PaymentMethod == "gift_card") && req.Source == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "source is required for this payment method"})
+		return
+	}
+
+	provider, err := ProviderFor(h.config, req.PaymentMethod)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Payment processing is not available"})
+		return
+	}
+	payment.Provider = provider.Name()
+
+	// A household's primary member pays for the whole household
+	payFor, err := households.AccountsPaidBy(database.DB, userModel.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check household"})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		total, err := lockPayableBooking(tx, &payment, payFor)
+		if err != nil {
+			return err
+		}
+
+		column, bookingID := "booking_id", payment.BookingID
+		if payment.RangeBookingID != nil {
+			column, bookingID = "range_booking_id", payment.RangeBookingID
+		}
+
+		// Payments still being charged hold their share of the balance, so
+		// a second request cannot take the same money
+		available, err := UnreservedAmount(tx, total, column, *bookingID)
+		if err != nil {
+			return err
+		}
+		if available <= 0 {
+			outstanding, err := OutstandingAmount(tx, total, column, *bookingID)
+			if err != nil {
+				return err
+			}
+			if outstanding > 0 {
+				return errPaymentInProgress
+			}
+			return errNothingToPay
+		}
+
+		// Split tenders pay part of the balance, e.g. a gift card then a card
+		payment.Amount = available
+		if req.Amount > 0 {
+			if req.Amount > available {
+				return errExceedsBalance
+			}
+			payment.Amount = req.Amount
+		}
+		return tx.Create(&payment).Error
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+		return
+	case errors.Is(err, errBookingCancelled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot pay for a cancelled booking"})
+		return
+	case errors.Is(err, errBookingPaid):
+		c.JSON(http.StatusConflict, gin.H{"error": "Booking is already paid"})
+		return
+	case errors.Is(err, errPaymentInProgress):
+		c.JSON(http.StatusConflict, gin.H{"error": "A payment for this booking is already in progress"})
+		return
+	case errors.Is(err, errNothingToPay):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to pay for this booking"})
+		return
+	case errors.Is(err, errExceedsBalance):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount exceeds the outstanding balance"})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment"})
+		return
+	}
+
+	if err := Charge(c.Request.Context(), database.DB, provider, &payment, req.Source); err != nil {
+		if errors.Is(err, ErrDeclined) {
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": "Payment declined", "payment": payment})
+			return
+		}
+		if errors.Is(err, ErrUnrecorded) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Payment was taken but could not be recorded; staff will confirm it", "payment": payment})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Payment failed", "payment": payment})
+		return
+	}
+
+	c.JSON(http.StatusCreated, payment)
+}
+
+// lockPayableBooking locks the booking a payment is for, so payments against
+// it are made one at a time, and returns its total. Bookings outside payFor
+// are not found.
+func lockPayableBooking(tx *gorm.DB, payment *models.Payment, payFor []uuid.UUID) (money.Amount, error) {
+	locked := tx.Clauses(clause.Locking{Strength: "UPDATE"})
+
+	var total money.Amount
+	var status, paymentStatus string
+	if payment.BookingID != nil {
+		var booking models.TeeTimeBooking
+		if err := locked.Where("id = ? AND user_id IN ?", *payment.BookingID, payFor).First(&booking).Error; err != nil {
+			return money.Zero, err
+		}
+		total, status, paymentStatus = booking.TotalAmount, booking.Status, booking.PaymentStatus
+	} else {
+		var booking models.RangeBooking
+		if err := locked.Where("id = ? AND user_id IN ?", *payment.RangeBookingID, payFor).First(&booking).Error; err != nil {
+			return money.Zero, err
+		}
+		total, status, paymentStatus = booking.TotalAmount, booking.Status, booking.PaymentStatus
+	}
+
+	if status == "cancelled" {
+		return money.Zero, errBookingCancelled
+	}
+	if paymentStatus == "completed" {
+		return money.Zero, errBookingPaid
+	}
+	return total, nil
+}
+
+// GetMyPayments returns all payments made by the authenticated user
+func (h *PaymentHandler) GetMyPayments(c *gin.Context) {
+	userModel, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	var payments []models.Payment
+	if err := database.DB.Where("user_id = ?", userModel.ID).
+		Order("created_at DESC").
+		Find(&payments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve payments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"payments": payments,
+		"count":    len(payments),
+	})
+}
+
+// GetPayment returns one of the authenticated user's payments
+func (h *PaymentHandler) GetPayment(c *gin.Context) {
+	userModel, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment ID"})
+		return
+	}
+
+	var payment models.Payment
+	if err := database.DB.Where("id = ? AND user_id = ?", id, userModel.ID).
+		Preload("Booking").Preload("RangeBooking").
+		First(&payment).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, payment)
+}
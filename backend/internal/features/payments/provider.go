@@ -0,0 +1,74 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"golf-ezz-backend/internal/money"
+)
+
+// ErrDeclined is returned by providers when the payment source is declined
+var ErrDeclined = errors.New("payment declined")
+
+// ErrUnrecorded is returned when a provider took the money but the payment
+// could not be recorded or refunded, so it needs checking by staff
+var ErrUnrecorded = errors.New("payment captured but not recorded")
+
+// ErrUnknownTransaction is returned when a provider has no record of a transaction
+var ErrUnknownTransaction = errors.New("unknown transaction")
+
+// ChargeRequest describes an amount to authorize against a payment source
+type ChargeRequest struct {
+	Amount    money.Amount
+	Currency  string
+	Source    string // card token or other provider-specific source reference
+	Customer  string // ID of the user being charged
+	Reference string // our payment ID, passed to the provider for reconciliation
+}
+
+// Result is the outcome of a provider operation
+type Result struct {
+	TransactionID string
+	Status        string       // authorized, captured, refunded, voided
+	Fee           money.Amount // processing fee on a capture, when the provider reports one
+}
+
+// Provider is implemented by every payment processor integration
+type Provider interface {
+	// Name returns the provider's registry name
+	Name() string
+	// Authorize places a hold for the requested amount
+	Authorize(ctx context.Context, req ChargeRequest) (Result, error)
+	// Capture settles a previously authorized amount
+	Capture(ctx context.Context, transactionID string, amount money.Amount) (Result, error)
+	// Refund returns all or part of a captured amount
+	Refund(ctx context.Context, transactionID string, amount money.Amount) (Result, error)
+	// Void releases an authorization that has not been captured
+	Void(ctx context.Context, transactionID string) (Result, error)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Provider)
+)
+
+// Register makes a provider available under its name
+func Register(provider Provider) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[provider.Name()] = provider
+}
+
+// GetProvider returns the provider registered under name
+func GetProvider(name string) (Provider, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	provider, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("payment provider %q is not registered", name)
+	}
+	return provider, nil
+}
@@ -0,0 +1,273 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/features/ledger"
+	"golf-ezz-backend/internal/models"
+	"golf-ezz-backend/internal/money"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Refund reason codes
+const (
+	ReasonCustomerRequest    = "customer_request"
+	ReasonCancellationPolicy = "cancellation_policy"
+	ReasonCourseCancelled    = "course_cancelled"
+	ReasonWeather            = "weather"
+	ReasonDuplicate          = "duplicate"
+	ReasonServiceIssue       = "service_issue"
+	ReasonOther              = "other"
+)
+
+// ErrNothingToRefund is returned when a payment has no refundable balance left
+var ErrNothingToRefund = errors.New("nothing left to refund on this payment")
+
+// ErrRefundUnrecorded is returned when the provider refunded the money but the
+// refund could not be recorded, so it must not be issued again
+var ErrRefundUnrecorded = errors.New("refund made at provider but not recorded")
+
+// RefundRequest represents an admin request to refund a payment
+type RefundRequest struct {
+	Amount     money.Amount `json:"amount" binding:"min=0"` // 0 refunds the remaining balance
+	ReasonCode string       `json:"reason_code" binding:"required,oneof=customer_request cancellation_policy course_cancelled weather duplicate service_issue other"`
+	Notes      string       `json:"notes"`
+}
+
+// RefundableAmount returns how much of a payment can still be refunded
+func RefundableAmount(payment models.Payment) money.Amount {
+	if payment.Status != "completed" && payment.Status != "partially_refunded" {
+		return money.Zero
+	}
+	return money.Max(payment.Amount-payment.RefundedAmount, money.Zero)
+}
+
+// IssueRefund returns amount of a completed payment through its provider and
+// records the refund. The payment is locked while the refund is reserved, and
+// pending refunds count against what is left, so concurrent refunds cannot
+// return more than was paid. The refund record and its ledger entry, the
+// payment's refunded total and the booking's payment status are then updated
+// in a single transaction. issuedBy is nil for refunds triggered
+// automatically, e.g. by the cancellation policy.
+func IssueRefund(ctx context.Context, db *gorm.DB, payment *models.Payment, amount money.Amount, reasonCode, notes string, issuedBy *uuid.UUID) (*models.Refund, error) {
+	refund := &models.Refund{
+		PaymentID:  payment.ID,
+		Currency:   payment.Currency,
+		ReasonCode: reasonCode,
+		Status:     "pending",
+		IssuedBy:   issuedBy,
+	}
+	if notes != "" {
+		refund.Notes = &notes
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(payment, payment.ID).Error; err != nil {
+			return err
+		}
+
+		var pending money.Amount
+		if err := tx.Model(&models.Refund{}).
+			Where("payment_id = ? AND status = ?", payment.ID, "pending").
+			Select("COALESCE(SUM(amount), 0)").
+			Scan(&pending).Error; err != nil {
+			return err
+		}
+
+		refundable := money.Max(RefundableAmount(*payment)-pending, money.Zero)
+		if refundable <= 0 {
+			return ErrNothingToRefund
+		}
+		if amount <= 0 {
+			amount = refundable
+		}
+		if amount > refundable {
+			return fmt.Errorf("refund of %s exceeds refundable amount %s", amount, refundable)
+		}
+		if payment.TransactionID == nil {
+			return fmt.Errorf("payment %s has no provider transaction", payment.ID)
+		}
+
+		refund.Amount = amount
+		return tx.Create(refund).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := GetProvider(payment.Provider)
+	if err != nil {
+		refund.Status = "failed"
+		db.Save(refund)
+		return refund, err
+	}
+
+	result, err := provider.Refund(ctx, *payment.TransactionID, amount)
+	if err != nil {
+		refund.Status = "failed"
+		db.Save(refund)
+		return refund, err
+	}
+
+	now := time.Now()
+	refund.TransactionID = &result.TransactionID
+	refund.ProcessedAt = &now
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		refund.Status = "completed"
+		if err := tx.Save(refund).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(payment).Update("refunded_amount", gorm.Expr("refunded_amount + ?", amount)).Error; err != nil {
+			return err
+		}
+		if err := tx.First(payment, payment.ID).Error; err != nil {
+			return err
+		}
+		status := "partially_refunded"
+		if payment.RefundedAmount >= payment.Amount {
+			status = "refunded"
+		}
+		if payment.Status != "disputed" {
+			payment.Status = status
+			if err := tx.Model(payment).Update("status", status).Error; err != nil {
+				return err
+			}
+		}
+		if err := ledger.PostRefund(tx, payment, refund); err != nil {
+			return err
+		}
+		return SetBookingPaymentStatus(tx, payment, payment.Status)
+	})
+	if err != nil {
+		// The money has gone back, so the refund must not look retryable.
+		// It stays pending with the provider's transaction, which keeps its
+		// amount reserved until staff record it.
+		refund.Status = "pending"
+		if saveErr := db.Model(refund).Updates(map[string]interface{}{
+			"transaction_id": refund.TransactionID,
+			"processed_at":   refund.ProcessedAt,
+		}).Error; saveErr != nil {
+			log.Printf("Failed to flag unrecorded refund %s: %v", refund.ID, saveErr)
+		}
+		log.Printf("Refund %s of payment %s was made at the provider but not recorded: %v", refund.ID, payment.ID, err)
+		return refund, fmt.Errorf("%w: %v", ErrRefundUnrecorded, err)
+	}
+	return refund, nil
+}
+
+// RefundBookingPayments refunds percent of every completed payment for a tee
+// time or range booking or a pro shop sale. It is used to apply cancellation
+// policy outcomes and sale voids.
+func RefundBookingPayments(ctx context.Context, db *gorm.DB, bookingID uuid.UUID, percent float64, reasonCode string, issuedBy *uuid.UUID) ([]models.Refund, error) {
+	var payments []models.Payment
+	if err := db.Where("(booking_id = ? OR range_booking_id = ? OR sale_id = ?) AND status IN ?",
+		bookingID, bookingID, bookingID, []string{"completed", "partially_refunded"}).
+		Find(&payments).Error; err != nil {
+		return nil, err
+	}
+
+	var refunds []models.Refund
+	for i := range payments {
+		amount := money.Min(payments[i].Amount.Percent(percent), RefundableAmount(payments[i]))
+		if amount <= 0 {
+			continue
+		}
+
+		refund, err := IssueRefund(ctx, db, &payments[i], amount, reasonCode, "", issuedBy)
+		if err != nil {
+			return refunds, err
+		}
+		refunds = append(refunds, *refund)
+	}
+	return refunds, nil
+}
+
+// RefundPayment refunds all or part of a payment (admin only)
+func (h *PaymentHandler) RefundPayment(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment ID"})
+		return
+	}
+
+	var req RefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var payment models.Payment
+	if err := database.DB.First(&payment, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
+	}
+
+	var issuedBy *uuid.UUID
+	if userID, ok := c.Get("user_id"); ok {
+		if adminID, err := uuid.Parse(fmt.Sprint(userID)); err == nil {
+			issuedBy = &adminID
+		}
+	}
+
+	refund, err := IssueRefund(c.Request.Context(), database.DB, &payment, req.Amount, req.ReasonCode, req.Notes, issuedBy)
+	if err != nil {
+		if errors.Is(err, ErrRefundUnrecorded) {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":  "Refund was made at the provider but could not be recorded; do not issue it again",
+				"refund": refund,
+			})
+			return
+		}
+		if refund != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Refund failed", "refund": refund})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"refund":  refund,
+		"payment": payment,
+	})
+}
+
+// GetPaymentRefunds lists the refunds issued against a payment (admin only)
+func (h *PaymentHandler) GetPaymentRefunds(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment ID"})
+		return
+	}
+
+	var refunds []models.Refund
+	if err := database.DB.Where("payment_id = ?", id).
+		Preload("Issuer").
+		Order("created_at ASC").
+		Find(&refunds).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve refunds"})
+		return
+	}
+
+	for i := range refunds {
+		if refunds[i].Issuer != nil {
+			refunds[i].Issuer.Password = ""
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"refunds": refunds,
+		"count":   len(refunds),
+	})
+}
@@ -0,0 +1,463 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/features/ledger"
+	"golf-ezz-backend/internal/models"
+	"golf-ezz-backend/internal/money"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SignatureHeader carries the webhook signature in the form "t=<unix>,v1=<hex>"
+const SignatureHeader = "X-Webhook-Signature"
+
+// maxWebhookBody caps the size of a webhook payload
+const maxWebhookBody = 1 << 20
+
+// Webhook event types
+const (
+	EventPaymentCaptured = "payment.captured"
+	EventPaymentFailed   = "payment.failed"
+	EventPaymentRefunded = "payment.refunded"
+	EventPaymentDisputed = "payment.disputed"
+)
+
+// Events that cannot be applied yet are replayed, but not forever
+const (
+	maxWebhookAttempts = 10
+	webhookReplayAge   = 72 * time.Hour
+	webhookReplayBatch = 100
+)
+
+var (
+	// errNotReady marks an event that cannot be applied yet and is kept for replay
+	errNotReady = errors.New("event cannot be applied yet")
+	// errIgnoredEvent marks an event type we do not act on
+	errIgnoredEvent = errors.New("event type is not handled")
+)
+
+// WebhookEvent is the normalized event body providers post to us
+type WebhookEvent struct {
+	ID      string           `json:"id"`
+	Type    string           `json:"type"`
+	Created int64            `json:"created"`
+	Data    WebhookEventData `json:"data"`
+}
+
+// WebhookEventData identifies the payment an event is about
+type WebhookEventData struct {
+	PaymentID      string       `json:"payment_id"`
+	TransactionID  string       `json:"transaction_id"`
+	Amount         money.Amount `json:"amount"`
+	AmountRefunded money.Amount `json:"amount_refunded"` // cumulative, for payment.refunded
+	Reason         string       `json:"reason"`
+	Fee            money.Amount `json:"fee"` // processing fee, for payment.captured
+}
+
+// SignPayload computes the webhook signature header value for a payload
+func SignPayload(secret string, timestamp int64, body []byte) string {
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, computeSignature(secret, timestamp, body))
+}
+
+func computeSignature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks a signature header against the payload, rejecting
+// timestamps further than tolerance from now
+func VerifySignature(header string, body []byte, secret string, tolerance time.Duration, now time.Time) error {
+	var timestamp int64
+	var signatures []string
+
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			ts, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid signature timestamp")
+			}
+			timestamp = ts
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	if timestamp == 0 || len(signatures) == 0 {
+		return fmt.Errorf("malformed signature header")
+	}
+
+	age := now.Sub(time.Unix(timestamp, 0))
+	if age > tolerance || age < -tolerance {
+		return fmt.Errorf("signature timestamp outside tolerance")
+	}
+
+	expected := computeSignature(secret, timestamp, body)
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("signature mismatch")
+}
+
+// HandleWebhook receives a signed event from a payment provider
+func (h *PaymentHandler) HandleWebhook(c *gin.Context) {
+	providerName := c.Param("provider")
+	if _, err := GetProvider(providerName); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown payment provider"})
+		return
+	}
+
+	if h.config.Payment.WebhookSecret == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Webhooks are not configured"})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBody))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	tolerance := time.Duration(h.config.Payment.WebhookTolerance) * time.Second
+	if err := VerifySignature(c.GetHeader(SignatureHeader), body, h.config.Payment.WebhookSecret, tolerance, time.Now()); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid signature"})
+		return
+	}
+
+	var event WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil || event.ID == "" || event.Type == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event payload"})
+		return
+	}
+
+	record := models.PaymentWebhookEvent{
+		Provider:   providerName,
+		EventID:    event.ID,
+		EventType:  event.Type,
+		OccurredAt: time.Unix(event.Created, 0),
+		Payload:    string(body),
+		Status:     "pending",
+	}
+
+	// Deduplicate on (provider, event ID): a redelivery is acknowledged as-is
+	result := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store event"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusOK, gin.H{"received": true, "duplicate": true})
+		return
+	}
+
+	processEvent(database.DB, &record)
+
+	// An applied event may unblock events that arrived before it
+	if record.Status == "processed" {
+		ReplayPendingEvents(database.DB, providerName)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"received": true, "status": record.Status})
+}
+
+// ReplayPendingEvents retries stored events that could not be applied yet,
+// oldest first. An empty provider replays events for every provider. Events
+// still pending after webhookReplayAge are given up on and marked failed.
+func ReplayPendingEvents(db *gorm.DB, provider string) (processed int, err error) {
+	cutoff := time.Now().Add(-webhookReplayAge)
+	expire := db.Model(&models.PaymentWebhookEvent{}).Where("status = ? AND created_at < ?", "pending", cutoff)
+	if provider != "" {
+		expire = expire.Where("provider = ?", provider)
+	}
+	if err := expire.Updates(map[string]interface{}{
+		"status":     "failed",
+		"last_error": "gave up waiting for the event to apply",
+	}).Error; err != nil {
+		return 0, err
+	}
+
+	query := db.Where("status = ? AND attempts < ?", "pending", maxWebhookAttempts)
+	if provider != "" {
+		query = query.Where("provider = ?", provider)
+	}
+
+	var events []models.PaymentWebhookEvent
+	if err := query.Order("occurred_at ASC").Limit(webhookReplayBatch).Find(&events).Error; err != nil {
+		return 0, err
+	}
+
+	for i := range events {
+		processEvent(db, &events[i])
+		if events[i].Status == "processed" {
+			processed++
+		}
+	}
+	return processed, nil
+}
+
+// processEvent applies a stored event and records the outcome on it
+func processEvent(db *gorm.DB, record *models.PaymentWebhookEvent) {
+	record.Attempts++
+
+	var event WebhookEvent
+	err := json.Unmarshal([]byte(record.Payload), &event)
+	if err == nil {
+		err = applyEvent(db, record, event)
+	}
+
+	switch {
+	case err == nil:
+		now := time.Now()
+		record.Status = "processed"
+		record.LastError = nil
+		record.ProcessedAt = &now
+	case errors.Is(err, errIgnoredEvent):
+		message := err.Error()
+		record.Status = "ignored"
+		record.LastError = &message
+	case errors.Is(err, errNotReady) && record.Attempts < maxWebhookAttempts:
+		message := err.Error()
+		record.Status = "pending"
+		record.LastError = &message
+	default:
+		message := err.Error()
+		record.Status = "failed"
+		record.LastError = &message
+		log.Printf("Payment webhook %s/%s failed: %v", record.Provider, record.EventID, err)
+	}
+
+	if err := db.Save(record).Error; err != nil {
+		log.Printf("Failed to save payment webhook %s/%s: %v", record.Provider, record.EventID, err)
+	}
+}
+
+// applyEvent transitions the payment an event refers to
+func applyEvent(db *gorm.DB, record *models.PaymentWebhookEvent, event WebhookEvent) error {
+	switch event.Type {
+	case EventPaymentCaptured, EventPaymentFailed, EventPaymentRefunded, EventPaymentDisputed:
+	default:
+		return fmt.Errorf("%w: %q", errIgnoredEvent, event.Type)
+	}
+
+	// The payment is locked so an event cannot race a refund or charge that
+	// is being recorded for it
+	return db.Transaction(func(tx *gorm.DB) error {
+		payment, err := findWebhookPayment(tx.Clauses(clause.Locking{Strength: "UPDATE"}), record.Provider, event.Data)
+		if err != nil {
+			return err
+		}
+		record.PaymentID = &payment.ID
+
+		switch event.Type {
+		case EventPaymentCaptured:
+			switch payment.Status {
+			case "pending", "authorized":
+			case "failed":
+				// A failed payment with a transaction had its capture voided
+				// or refunded by us, so the capture must not revive it
+				if payment.TransactionID != nil {
+					return fmt.Errorf("capture for payment %s whose transaction was reversed", payment.ID)
+				}
+			default:
+				return nil // already captured or later in its lifecycle
+			}
+			processedAt := record.OccurredAt
+			payment.Status = "completed"
+			payment.ProcessedAt = &processedAt
+			payment.FailureReason = nil
+			if payment.TransactionID == nil && event.Data.TransactionID != "" {
+				payment.TransactionID = &event.Data.TransactionID
+			}
+			if event.Data.Fee > 0 {
+				payment.Fee = event.Data.Fee
+			}
+
+		case EventPaymentFailed:
+			switch payment.Status {
+			case "pending", "authorized":
+			default:
+				return nil // a stale failure must not undo a capture
+			}
+			reason := event.Data.Reason
+			if reason == "" {
+				reason = "failed at provider"
+			}
+			payment.Status = "failed"
+			payment.FailureReason = &reason
+
+		case EventPaymentRefunded:
+			switch payment.Status {
+			case "completed", "partially_refunded", "refunded", "disputed":
+			default:
+				return fmt.Errorf("%w: refund for payment in status %q", errNotReady, payment.Status)
+			}
+			return applyProviderRefund(tx, payment, event)
+
+		case EventPaymentDisputed:
+			if payment.Status != "completed" && payment.Status != "partially_refunded" {
+				return fmt.Errorf("%w: dispute for payment in status %q", errNotReady, payment.Status)
+			}
+			payment.Status = "disputed"
+		}
+
+		if err := tx.Model(payment).Select("status", "processed_at", "failure_reason", "transaction_id", "fee").Updates(payment).Error; err != nil {
+			return err
+		}
+		if event.Type == EventPaymentCaptured {
+			if _, err := IssueInvoice(tx, payment); err != nil {
+				return err
+			}
+			if err := ledger.PostPayment(tx, payment); err != nil {
+				return err
+			}
+			return SettleBookingPaymentStatus(tx, payment)
+		}
+		return SetBookingPaymentStatus(tx, payment, payment.Status)
+	})
+}
+
+// applyProviderRefund records a refund made at the provider, e.g. from its
+// dashboard. Refund totals are cumulative, so only what we have no record of
+// is new; refunds still pending here are on their way to being recorded by
+// IssueRefund and count as known. The payment must be locked.
+func applyProviderRefund(tx *gorm.DB, payment *models.Payment, event WebhookEvent) error {
+	var pending money.Amount
+	if err := tx.Model(&models.Refund{}).
+		Where("payment_id = ? AND status = ?", payment.ID, "pending").
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&pending).Error; err != nil {
+		return err
+	}
+
+	delta := event.Data.AmountRefunded - payment.RefundedAmount - pending
+	if delta <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	notes := "Refunded at provider (event " + event.ID + ")"
+	refund := models.Refund{
+		PaymentID:     payment.ID,
+		Amount:        delta,
+		Currency:      payment.Currency,
+		ReasonCode:    ReasonOther,
+		Notes:         &notes,
+		Status:        "completed",
+		TransactionID: payment.TransactionID,
+		ProcessedAt:   &now,
+	}
+	if err := tx.Create(&refund).Error; err != nil {
+		return err
+	}
+	if err := ledger.PostRefund(tx, payment, &refund); err != nil {
+		return err
+	}
+	if err := tx.Model(payment).Update("refunded_amount", gorm.Expr("refunded_amount + ?", delta)).Error; err != nil {
+		return err
+	}
+	if err := tx.First(payment, payment.ID).Error; err != nil {
+		return err
+	}
+
+	if payment.Status != "disputed" {
+		status := "partially_refunded"
+		if payment.RefundedAmount >= payment.Amount {
+			status = "refunded"
+		}
+		payment.Status = status
+		if err := tx.Model(payment).Update("status", status).Error; err != nil {
+			return err
+		}
+	}
+	return SetBookingPaymentStatus(tx, payment, payment.Status)
+}
+
+// findWebhookPayment resolves the payment an event refers to
+func findWebhookPayment(db *gorm.DB, provider string, data WebhookEventData) (*models.Payment, error) {
+	var payment models.Payment
+	var err error
+
+	switch {
+	case data.PaymentID != "":
+		id, parseErr := uuid.Parse(data.PaymentID)
+		if parseErr != nil {
+			return nil, fmt.Errorf("invalid payment_id %q", data.PaymentID)
+		}
+		// A payment can only be changed by events for its own provider
+		err = db.Where("id = ? AND provider = ?", id, provider).First(&payment).Error
+	case data.TransactionID != "":
+		err = db.Where("provider = ? AND transaction_id = ?", provider, data.TransactionID).First(&payment).Error
+	default:
+		return nil, fmt.Errorf("event does not identify a payment")
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: payment not found", errNotReady)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// GetWebhookEvents lists stored webhook events, optionally by status (admin only)
+func (h *PaymentHandler) GetWebhookEvents(c *gin.Context) {
+	query := database.DB.Order("created_at DESC").Limit(200)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var events []models.PaymentWebhookEvent
+	if err := query.Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve webhook events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+		"count":  len(events),
+	})
+}
+
+// ReplayWebhookEvents retries pending webhook events (admin only)
+func (h *PaymentHandler) ReplayWebhookEvents(c *gin.Context) {
+	processed, err := ReplayPendingEvents(database.DB, c.Query("provider"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to replay webhook events"})
+		return
+	}
+
+	var pending int64
+	database.DB.Model(&models.PaymentWebhookEvent{}).Where("status = ?", "pending").Count(&pending)
+
+	c.JSON(http.StatusOK, gin.H{
+		"processed": processed,
+		"pending":   pending,
+	})
+}
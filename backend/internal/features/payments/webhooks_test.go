@@ -0,0 +1,347 @@
+package payments
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golf-ezz-backend/internal/config"
+	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/models"
+	"golf-ezz-backend/internal/money"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	testWebhookSecret    = "whsec_test"
+	placeholderPaymentID = "00000000-0000-0000-0000-000000000000"
+)
+
+// otherProvider stands in for a second provider sharing the webhook secret
+type otherProvider struct{ *LocalProvider }
+
+func (otherProvider) Name() string { return "other" }
+
+func init() {
+	gin.SetMode(gin.TestMode)
+	Register(NewLocalProvider())
+	Register(otherProvider{NewLocalProvider()})
+}
+
+// fixture reads a signed-webhook fixture, substituting paymentID
+func fixture(t *testing.T, name, paymentID string) []byte {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("..", "..", "..", "testdata", "webhooks", name))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	return []byte(strings.ReplaceAll(string(body), placeholderPaymentID, paymentID))
+}
+
+// postWebhook sends body to the webhook endpoint with the given signature header
+func postWebhook(provider string, body []byte, signature string) *httptest.ResponseRecorder {
+	cfg := &config.Config{Payment: config.PaymentConfig{WebhookSecret: testWebhookSecret, WebhookTolerance: 300}}
+	router := gin.New()
+	router.POST("/webhooks/payments/:provider", NewPaymentHandler(cfg).HandleWebhook)
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/payments/"+provider, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if signature != "" {
+		req.Header.Set(SignatureHeader, signature)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func sign(body []byte) string {
+	return SignPayload(testWebhookSecret, time.Now().Unix(), body)
+}
+
+func TestVerifySignature(t *testing.T) {
+	body := fixture(t, "payment_captured.json", uuid.NewString())
+	now := time.Now()
+	tolerance := 5 * time.Minute
+
+	tests := []struct {
+		name   string
+		header string
+		body   []byte
+		ok     bool
+	}{
+		{"valid", SignPayload(testWebhookSecret, now.Unix(), body), body, true},
+		{"one of several signatures valid", "t=" + strconv.FormatInt(now.Unix(), 10) + ",v1=deadbeef,v1=" + computeSignature(testWebhookSecret, now.Unix(), body), body, true},
+		{"wrong secret", SignPayload("whsec_other", now.Unix(), body), body, false},
+		{"tampered body", SignPayload(testWebhookSecret, now.Unix(), body), bytes.Replace(body, []byte("120.00"), []byte("1.00"), 1), false},
+		{"too old", SignPayload(testWebhookSecret, now.Add(-10*time.Minute).Unix(), body), body, false},
+		{"too far ahead", SignPayload(testWebhookSecret, now.Add(10*time.Minute).Unix(), body), body, false},
+		{"missing timestamp", "v1=" + computeSignature(testWebhookSecret, now.Unix(), body), body, false},
+		{"missing signature", "t=" + strconv.FormatInt(now.Unix(), 10), body, false},
+		{"empty", "", body, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifySignature(tt.header, tt.body, testWebhookSecret, tolerance, now)
+			if (err == nil) != tt.ok {
+				t.Errorf("VerifySignature() error = %v, want ok = %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestHandleWebhookRejectsBadSignatures(t *testing.T) {
+	body := fixture(t, "payment_captured.json", uuid.NewString())
+
+	tests := []struct {
+		name      string
+		provider  string
+		body      []byte
+		signature string
+		status    int
+	}{
+		{"unsigned", "local", body, "", http.StatusUnauthorized},
+		{"wrong secret", "local", body, SignPayload("whsec_other", time.Now().Unix(), body), http.StatusUnauthorized},
+		{"tampered", "local", bytes.Replace(body, []byte("120.00"), []byte("1.00"), 1), sign(body), http.StatusUnauthorized},
+		{"replayed late", "local", body, SignPayload(testWebhookSecret, time.Now().Add(-time.Hour).Unix(), body), http.StatusUnauthorized},
+		{"unknown provider", "nope", body, sign(body), http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := postWebhook(tt.provider, tt.body, tt.signature); w.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
+
+// useTestDB points database.DB at a transaction on TEST_DATABASE_DSN that is
+// rolled back when the test ends, skipping the test when none is configured
+func useTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	previous := database.DB
+	database.DB = db
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	tx := db.Begin()
+	database.DB = tx
+	t.Cleanup(func() {
+		tx.Rollback()
+		database.DB = previous
+	})
+	return tx
+}
+
+// pendingPayment creates a payment awaiting capture at the local provider
+func pendingPayment(t *testing.T, db *gorm.DB) models.Payment {
+	t.Helper()
+	user := models.User{
+		Email:    uuid.NewString() + "@example.com",
+		Name:     "Webhook Test",
+		Password: "x",
+		Role:     "member",
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	payment := models.Payment{
+		UserID:        user.ID,
+		Amount:        money.Cents(12000),
+		Currency:      "USD",
+		Status:        "pending",
+		PaymentMethod: "card",
+		Provider:      "local",
+	}
+	if err := db.Create(&payment).Error; err != nil {
+		t.Fatalf("create payment: %v", err)
+	}
+	return payment
+}
+
+// deliver signs and posts a fixture, returning the event status reported
+func deliver(t *testing.T, provider string, body []byte) gin.H {
+	t.Helper()
+	w := postWebhook(provider, body, sign(body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var response gin.H
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return response
+}
+
+func reload(t *testing.T, db *gorm.DB, payment models.Payment) models.Payment {
+	t.Helper()
+	var current models.Payment
+	if err := db.First(&current, payment.ID).Error; err != nil {
+		t.Fatalf("reload payment: %v", err)
+	}
+	return current
+}
+
+func TestHandleWebhookDuplicateDelivery(t *testing.T) {
+	db := useTestDB(t)
+	payment := pendingPayment(t, db)
+	body := fixture(t, "payment_captured.json", payment.ID.String())
+
+	if got := deliver(t, "local", body); got["status"] != "processed" {
+		t.Fatalf("first delivery = %v, want processed", got)
+	}
+	if got := deliver(t, "local", body); got["duplicate"] != true {
+		t.Fatalf("second delivery = %v, want duplicate", got)
+	}
+
+	var events int64
+	db.Model(&models.PaymentWebhookEvent{}).Where("provider = ? AND event_id = ?", "local", "evt_local_captured_001").Count(&events)
+	if events != 1 {
+		t.Errorf("stored %d events, want 1", events)
+	}
+	if got := reload(t, db, payment); got.Status != "completed" {
+		t.Errorf("payment status = %q, want completed", got.Status)
+	}
+}
+
+func TestHandleWebhookOutOfOrder(t *testing.T) {
+	db := useTestDB(t)
+	payment := pendingPayment(t, db)
+
+	// The refund arrives before the capture it depends on
+	if got := deliver(t, "local", fixture(t, "payment_refunded.json", payment.ID.String())); got["status"] != "pending" {
+		t.Fatalf("early refund = %v, want pending", got)
+	}
+	if got := deliver(t, "local", fixture(t, "payment_captured.json", payment.ID.String())); got["status"] != "processed" {
+		t.Fatalf("capture = %v, want processed", got)
+	}
+
+	got := reload(t, db, payment)
+	if got.Status != "partially_refunded" || got.RefundedAmount != money.Cents(6000) {
+		t.Errorf("payment = %s refunded %s, want partially_refunded refunded 60.00", got.Status, got.RefundedAmount)
+	}
+}
+
+func TestHandleWebhookOtherProviderCannotChangePayment(t *testing.T) {
+	db := useTestDB(t)
+	payment := pendingPayment(t, db)
+
+	deliver(t, "other", fixture(t, "payment_captured.json", payment.ID.String()))
+
+	if got := reload(t, db, payment); got.Status != "pending" {
+		t.Errorf("payment status = %q, want pending", got.Status)
+	}
+}
+
+func TestHandleWebhookIgnoresUnknownEvents(t *testing.T) {
+	db := useTestDB(t)
+	payment := pendingPayment(t, db)
+
+	body := []byte(`{"id":"evt_unknown_001","type":"customer.updated","created":1760000000,"data":{"payment_id":"` + payment.ID.String() + `"}}`)
+	if got := deliver(t, "local", body); got["status"] != "ignored" {
+		t.Fatalf("unknown event = %v, want ignored", got)
+	}
+
+	if processed, err := ReplayPendingEvents(db, "local"); err != nil || processed != 0 {
+		t.Errorf("ReplayPendingEvents() = %d, %v; want 0, nil", processed, err)
+	}
+}
+
+func TestReplayPendingEventsGivesUp(t *testing.T) {
+	db := useTestDB(t)
+
+	event := models.PaymentWebhookEvent{
+		Provider:   "local",
+		EventID:    "evt_orphan_001",
+		EventType:  EventPaymentCaptured,
+		OccurredAt: time.Now(),
+		Payload:    string(fixture(t, "payment_captured.json", uuid.NewString())),
+		Status:     "pending",
+		Attempts:   maxWebhookAttempts - 1,
+	}
+	if err := db.Create(&event).Error; err != nil {
+		t.Fatalf("create event: %v", err)
+	}
+
+	if _, err := ReplayPendingEvents(db, "local"); err != nil {
+		t.Fatalf("ReplayPendingEvents() error = %v", err)
+	}
+	db.First(&event, event.ID)
+	if event.Status != "failed" {
+		t.Errorf("event status = %q after the last attempt, want failed", event.Status)
+	}
+}
+
+func TestHandleWebhookCountsRefundsInFlight(t *testing.T) {
+	db := useTestDB(t)
+	payment := pendingPayment(t, db)
+	deliver(t, "local", fixture(t, "payment_captured.json", payment.ID.String()))
+
+	// IssueRefund has reserved 60.00 and is recording it
+	inFlight := models.Refund{
+		PaymentID:  payment.ID,
+		Amount:     money.Cents(6000),
+		Currency:   "USD",
+		ReasonCode: ReasonCustomerRequest,
+		Status:     "pending",
+	}
+	if err := db.Create(&inFlight).Error; err != nil {
+		t.Fatalf("create refund: %v", err)
+	}
+
+	deliver(t, "local", fixture(t, "payment_refunded.json", payment.ID.String()))
+
+	var refunds int64
+	db.Model(&models.Refund{}).Where("payment_id = ?", payment.ID).Count(&refunds)
+	if refunds != 1 {
+		t.Errorf("stored %d refunds, want only the one in flight", refunds)
+	}
+	if got := reload(t, db, payment); got.RefundedAmount != money.Zero {
+		t.Errorf("refunded amount = %s, want 0.00 until IssueRefund records it", got.RefundedAmount)
+	}
+}
+
+func TestHandleWebhookCaptureAfterReversal(t *testing.T) {
+	db := useTestDB(t)
+	payment := pendingPayment(t, db)
+
+	// Charge captured the payment, could not record it and refunded it
+	transactionID := "local_" + payment.ID.String()
+	if err := db.Model(&payment).Updates(map[string]interface{}{
+		"status":         "failed",
+		"transaction_id": transactionID,
+	}).Error; err != nil {
+		t.Fatalf("fail payment: %v", err)
+	}
+
+	if got := deliver(t, "local", fixture(t, "payment_captured.json", payment.ID.String())); got["status"] != "failed" {
+		t.Errorf("capture = %v, want failed", got)
+	}
+	if got := reload(t, db, payment); got.Status != "failed" {
+		t.Errorf("payment status = %q, want failed", got.Status)
+	}
+}
@@ -0,0 +1,187 @@
+// Package promotions provides promo codes that discount bookings
+package promotions
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golf-ezz-backend/internal/features/courses"
+	"golf-ezz-backend/internal/models"
+	"golf-ezz-backend/internal/money"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Booking kinds a coupon can apply to
+const (
+	KindTeeTime = "tee_time"
+	KindRange   = "range"
+)
+
+// ErrNotApplicable is returned when a promo code cannot be used for a booking
+var ErrNotApplicable = errors.New("promo code cannot be applied")
+
+// Usage describes the booking a coupon is being applied to
+type Usage struct {
+	Kind     string // tee_time or range
+	UserID   uuid.UUID
+	CourseID uuid.UUID
+	Date     time.Time
+	Time     string // HH:MM
+	Players  int
+}
+
+// NormalizeCode formats a user-entered promo code the way codes are stored
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Apply locks the coupon with the given code, checks that it may be used for
+// the booking and returns it with the discount it gives on subtotal. The lock
+// is held until tx ends, so usage limits hold under concurrent bookings as
+// long as the redemption is recorded in the same transaction.
+func Apply(tx *gorm.DB, code string, usage Usage, subtotal money.Amount) (*models.Coupon, money.Amount, error) {
+	var coupon models.Coupon
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("code = ?", NormalizeCode(code)).
+		First(&coupon).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, 0, fmt.Errorf("%w: unknown promo code", ErrNotApplicable)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := check(tx, &coupon, usage); err != nil {
+		return nil, 0, err
+	}
+	return &coupon, Discount(coupon, subtotal), nil
+}
+
+// Discount returns the amount a coupon takes off subtotal, never more than subtotal
+func Discount(coupon models.Coupon, subtotal money.Amount) money.Amount {
+	var discount money.Amount
+	switch coupon.DiscountType {
+	case "percentage":
+		discount = subtotal.Percent(coupon.DiscountPercent)
+	case "fixed":
+		discount = coupon.DiscountAmount
+	}
+	return money.Min(money.Max(discount, money.Zero), subtotal)
+}
+
+// check applies the coupon's restrictions and limits to a booking
+func check(tx *gorm.DB, coupon *models.Coupon, usage Usage) error {
+	if !coupon.IsActive {
+		return fmt.Errorf("%w: promo code is no longer active", ErrNotApplicable)
+	}
+	if coupon.UserID != nil && *coupon.UserID != usage.UserID {
+		return fmt.Errorf("%w: promo code belongs to another customer", ErrNotApplicable)
+	}
+	if coupon.AppliesTo != "" && coupon.AppliesTo != "any" && coupon.AppliesTo != usage.Kind {
+		return fmt.Errorf("%w: promo code is only valid for %s bookings", ErrNotApplicable, strings.ReplaceAll(coupon.AppliesTo, "_", " "))
+	}
+	if coupon.CourseID != nil && *coupon.CourseID != usage.CourseID {
+		return fmt.Errorf("%w: promo code is not valid at this course", ErrNotApplicable)
+	}
+
+	date := courses.DateOnly(usage.Date)
+	if coupon.ValidFrom != nil && date.Before(courses.DateOnly(*coupon.ValidFrom)) {
+		return fmt.Errorf("%w: promo code is not valid until %s", ErrNotApplicable, coupon.ValidFrom.Format("2006-01-02"))
+	}
+	if coupon.ValidUntil != nil && date.After(courses.DateOnly(*coupon.ValidUntil)) {
+		return fmt.Errorf("%w: promo code expired on %s", ErrNotApplicable, coupon.ValidUntil.Format("2006-01-02"))
+	}
+	if len(coupon.Weekdays) > 0 {
+		valid := false
+		for _, day := range coupon.Weekdays {
+			if time.Weekday(day) == date.Weekday() {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("%w: promo code is not valid on %s", ErrNotApplicable, date.Weekday())
+		}
+	}
+	if coupon.StartTime != nil || coupon.EndTime != nil {
+		minute, err := courses.ParseClock(usage.Time)
+		if err != nil {
+			return fmt.Errorf("%w: invalid booking time", ErrNotApplicable)
+		}
+		if coupon.StartTime != nil {
+			if start, err := courses.ParseClock(*coupon.StartTime); err == nil && minute < start {
+				return fmt.Errorf("%w: promo code is valid from %s", ErrNotApplicable, *coupon.StartTime)
+			}
+		}
+		if coupon.EndTime != nil {
+			if end, err := courses.ParseClock(*coupon.EndTime); err == nil && minute >= end {
+				return fmt.Errorf("%w: promo code is valid until %s", ErrNotApplicable, *coupon.EndTime)
+			}
+		}
+	}
+	if coupon.MinPlayers > 0 && usage.Players < coupon.MinPlayers {
+		return fmt.Errorf("%w: promo code requires at least %d players", ErrNotApplicable, coupon.MinPlayers)
+	}
+
+	redemptions := tx.Model(&models.CouponRedemption{}).Where("coupon_id = ? AND status = ?", coupon.ID, "applied")
+
+	if coupon.MaxRedemptions > 0 {
+		var used int64
+		if err := redemptions.Session(&gorm.Session{}).Count(&used).Error; err != nil {
+			return err
+		}
+		if used >= int64(coupon.MaxRedemptions) {
+			return fmt.Errorf("%w: promo code has been fully redeemed", ErrNotApplicable)
+		}
+	}
+	if coupon.MaxPerUser > 0 {
+		var used int64
+		if err := redemptions.Session(&gorm.Session{}).Where("user_id = ?", usage.UserID).Count(&used).Error; err != nil {
+			return err
+		}
+		if used >= int64(coupon.MaxPerUser) {
+			return fmt.Errorf("%w: promo code already used", ErrNotApplicable)
+		}
+	}
+	if coupon.FirstBookingOnly {
+		var teeTimes, rangeBookings int64
+		if err := tx.Model(&models.TeeTimeBooking{}).
+			Where("user_id = ? AND status <> ?", usage.UserID, "cancelled").
+			Count(&teeTimes).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.RangeBooking{}).
+			Where("user_id = ? AND status <> ?", usage.UserID, "cancelled").
+			Count(&rangeBookings).Error; err != nil {
+			return err
+		}
+		if teeTimes+rangeBookings > 0 {
+			return fmt.Errorf("%w: promo code is only valid on a first booking", ErrNotApplicable)
+		}
+	}
+	return nil
+}
+
+// Redeem records a coupon applied to a booking
+func Redeem(tx *gorm.DB, coupon *models.Coupon, redemption *models.CouponRedemption) error {
+	redemption.CouponID = coupon.ID
+	redemption.Status = "applied"
+	return tx.Create(redemption).Error
+}
+
+// ReleaseRedemptions returns the coupon usage of a cancelled booking so it no
+// longer counts towards the coupon's limits
+func ReleaseRedemptions(db *gorm.DB, bookingID uuid.UUID) error {
+	now := time.Now()
+	return db.Model(&models.CouponRedemption{}).
+		Where("(booking_id = ? OR range_booking_id = ?) AND status = ?", bookingID, bookingID, "applied").
+		Updates(map[string]interface{}{
+			"status":      "released",
+			"released_at": now,
+		}).Error
+}
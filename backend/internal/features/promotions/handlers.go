@@ -0,0 +1,308 @@
+package promotions
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/features/courses"
+	"golf-ezz-backend/internal/models"
+	"golf-ezz-backend/internal/money"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// CouponHandler handles promo code administration
+type CouponHandler struct{}
+
+// NewCouponHandler creates a new coupon handler
+func NewCouponHandler() *CouponHandler {
+	return &CouponHandler{}
+}
+
+// CouponRequest represents a request to create or update a coupon
+type CouponRequest struct {
+	Code             string       `json:"code" binding:"required"`
+	Description      string       `json:"description"`
+	DiscountType     string       `json:"discount_type" binding:"required,oneof=percentage fixed"`
+	DiscountPercent  float64      `json:"discount_percent" binding:"min=0,max=100"` // for percentage coupons
+	DiscountAmount   money.Amount `json:"discount_amount" binding:"min=0"`          // for fixed coupons
+	AppliesTo        string       `json:"applies_to" binding:"omitempty,oneof=any tee_time range"`
+	CourseID         string       `json:"course_id"`
+	ValidFrom        string       `json:"valid_from"`  // YYYY-MM-DD
+	ValidUntil       string       `json:"valid_until"` // YYYY-MM-DD
+	Weekdays         []int        `json:"weekdays" binding:"omitempty,dive,min=0,max=6"`
+	StartTime        *string      `json:"start_time"` // HH:MM
+	EndTime          *string      `json:"end_time"`   // HH:MM
+	MinPlayers       int          `json:"min_players" binding:"min=0,max=4"`
+	MaxRedemptions   int          `json:"max_redemptions" binding:"min=0"`
+	MaxPerUser       int          `json:"max_per_user" binding:"min=0"`
+	FirstBookingOnly bool         `json:"first_booking_only"`
+	IsActive         *bool        `json:"is_active"` // defaults to true
+}
+
+// CouponReport summarises the redemptions of one coupon
+type CouponReport struct {
+	CouponID       uuid.UUID    `json:"coupon_id"`
+	Code           string       `json:"code"`
+	Redemptions    int64        `json:"redemptions"`
+	Released       int64        `json:"released"`
+	UniqueUsers    int64        `json:"unique_users"`
+	GrossAmount    money.Amount `json:"gross_amount"`
+	DiscountAmount money.Amount `json:"discount_amount"`
+	NetAmount      money.Amount `json:"net_amount"`
+}
+
+// CreateCoupon creates a new promo code (admin only)
+func (h *CouponHandler) CreateCoupon(c *gin.Context) {
+	var req CouponRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var coupon models.Coupon
+	if err := req.apply(&coupon); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var taken int64
+	database.DB.Model(&models.Coupon{}).Where("code = ?", coupon.Code).Count(&taken)
+	if taken > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Promo code already exists"})
+		return
+	}
+
+	if userID, ok := c.Get("user_id"); ok {
+		if adminID, err := uuid.Parse(fmt.Sprint(userID)); err == nil {
+			coupon.CreatedBy = &adminID
+		}
+	}
+
+	if err := database.DB.Create(&coupon).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create promo code"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, coupon)
+}
+
+// GetCoupons lists promo codes (admin only)
+func (h *CouponHandler) GetCoupons(c *gin.Context) {
+	query := database.DB.Order("created_at DESC")
+	if active := c.Query("active"); active != "" {
+		query = query.Where("is_active = ?", active == "true")
+	}
+
+	var coupons []models.Coupon
+	if err := query.Find(&coupons).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve promo codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"coupons": coupons,
+		"count":   len(coupons),
+	})
+}
+
+// UpdateCoupon replaces a promo code's rules (admin only). Redemptions already
+// made are unaffected.
+func (h *CouponHandler) UpdateCoupon(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid coupon ID"})
+		return
+	}
+
+	var coupon models.Coupon
+	if err := database.DB.First(&coupon, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Promo code not found"})
+		return
+	}
+
+	var req CouponRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.apply(&coupon); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var taken int64
+	database.DB.Model(&models.Coupon{}).Where("code = ? AND id <> ?", coupon.Code, coupon.ID).Count(&taken)
+	if taken > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Promo code already exists"})
+		return
+	}
+
+	if err := database.DB.Save(&coupon).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update promo code"})
+		return
+	}
+
+	c.JSON(http.StatusOK, coupon)
+}
+
+// GetCouponReport reports redemption counts and revenue impact per promo code
+// (admin only). start_date and end_date optionally bound the redemption date.
+func (h *CouponHandler) GetCouponReport(c *gin.Context) {
+	redemptions := database.DB.Model(&models.CouponRedemption{})
+
+	if startDate := c.Query("start_date"); startDate != "" {
+		from, err := time.Parse("2006-01-02", startDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_date format. Use YYYY-MM-DD"})
+			return
+		}
+		redemptions = redemptions.Where("coupon_redemptions.created_at >= ?", from)
+	}
+	if endDate := c.Query("end_date"); endDate != "" {
+		to, err := time.Parse("2006-01-02", endDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date format. Use YYYY-MM-DD"})
+			return
+		}
+		redemptions = redemptions.Where("coupon_redemptions.created_at < ?", to.AddDate(0, 0, 1))
+	}
+	if couponID := c.Query("coupon_id"); couponID != "" {
+		id, err := uuid.Parse(couponID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid coupon ID"})
+			return
+		}
+		redemptions = redemptions.Where("coupon_redemptions.coupon_id = ?", id)
+	}
+
+	var rows []CouponReport
+	if err := redemptions.
+		Select(`coupons.id AS coupon_id, coupons.code AS code,
+			COUNT(*) FILTER (WHERE coupon_redemptions.status = 'applied') AS redemptions,
+			COUNT(*) FILTER (WHERE coupon_redemptions.status = 'released') AS released,
+			COUNT(DISTINCT coupon_redemptions.user_id) FILTER (WHERE coupon_redemptions.status = 'applied') AS unique_users,
+			COALESCE(SUM(coupon_redemptions.gross_amount) FILTER (WHERE coupon_redemptions.status = 'applied'), 0) AS gross_amount,
+			COALESCE(SUM(coupon_redemptions.discount_amount) FILTER (WHERE coupon_redemptions.status = 'applied'), 0) AS discount_amount`).
+		Joins("JOIN coupons ON coupons.id = coupon_redemptions.coupon_id").
+		Group("coupons.id, coupons.code").
+		Order("discount_amount DESC").
+		Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve promo code report"})
+		return
+	}
+
+	var totals CouponReport
+	for i := range rows {
+		rows[i].NetAmount = rows[i].GrossAmount - rows[i].DiscountAmount
+		totals.Redemptions += rows[i].Redemptions
+		totals.Released += rows[i].Released
+		totals.GrossAmount += rows[i].GrossAmount
+		totals.DiscountAmount += rows[i].DiscountAmount
+		totals.NetAmount += rows[i].NetAmount
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"coupons": rows,
+		"totals": gin.H{
+			"redemptions":     totals.Redemptions,
+			"released":        totals.Released,
+			"gross_amount":    totals.GrossAmount,
+			"discount_amount": totals.DiscountAmount,
+			"net_amount":      totals.NetAmount,
+		},
+		"generated_at": time.Now(),
+	})
+}
+
+// apply validates the request and copies it onto a coupon
+func (req CouponRequest) apply(coupon *models.Coupon) error {
+	coupon.Code = NormalizeCode(req.Code)
+	if coupon.Code == "" {
+		return fmt.Errorf("code must not be blank")
+	}
+	coupon.DiscountPercent, coupon.DiscountAmount = 0, money.Zero
+	switch req.DiscountType {
+	case "percentage":
+		if req.DiscountPercent <= 0 {
+			return fmt.Errorf("discount_percent is required for percentage coupons")
+		}
+		coupon.DiscountPercent = req.DiscountPercent
+	case "fixed":
+		if req.DiscountAmount <= 0 {
+			return fmt.Errorf("discount_amount is required for fixed coupons")
+		}
+		coupon.DiscountAmount = req.DiscountAmount
+	}
+
+	coupon.Description = req.Description
+	coupon.DiscountType = req.DiscountType
+	coupon.AppliesTo = req.AppliesTo
+	if coupon.AppliesTo == "" {
+		coupon.AppliesTo = "any"
+	}
+
+	coupon.CourseID = nil
+	if req.CourseID != "" {
+		id, err := uuid.Parse(req.CourseID)
+		if err != nil {
+			return fmt.Errorf("invalid course ID")
+		}
+		var count int64
+		database.DB.Model(&models.Course{}).Where("id = ?", id).Count(&count)
+		if count == 0 {
+			return fmt.Errorf("course not found")
+		}
+		coupon.CourseID = &id
+	}
+
+	coupon.ValidFrom, coupon.ValidUntil = nil, nil
+	if req.ValidFrom != "" {
+		from, err := time.Parse("2006-01-02", req.ValidFrom)
+		if err != nil {
+			return fmt.Errorf("invalid valid_from format, use YYYY-MM-DD")
+		}
+		coupon.ValidFrom = &from
+	}
+	if req.ValidUntil != "" {
+		until, err := time.Parse("2006-01-02", req.ValidUntil)
+		if err != nil {
+			return fmt.Errorf("invalid valid_until format, use YYYY-MM-DD")
+		}
+		coupon.ValidUntil = &until
+	}
+	if coupon.ValidFrom != nil && coupon.ValidUntil != nil && coupon.ValidUntil.Before(*coupon.ValidFrom) {
+		return fmt.Errorf("valid_until must not be before valid_from")
+	}
+
+	for _, clock := range []*string{req.StartTime, req.EndTime} {
+		if clock != nil {
+			if _, err := courses.ParseClock(*clock); err != nil {
+				return err
+			}
+		}
+	}
+	if req.StartTime != nil && req.EndTime != nil {
+		start, _ := courses.ParseClock(*req.StartTime)
+		end, _ := courses.ParseClock(*req.EndTime)
+		if end <= start {
+			return fmt.Errorf("end_time must be after start_time")
+		}
+	}
+
+	coupon.Weekdays = models.IntArray(req.Weekdays)
+	coupon.StartTime = req.StartTime
+	coupon.EndTime = req.EndTime
+	coupon.MinPlayers = req.MinPlayers
+	coupon.MaxRedemptions = req.MaxRedemptions
+	coupon.MaxPerUser = req.MaxPerUser
+	coupon.FirstBookingOnly = req.FirstBookingOnly
+	coupon.IsActive = true
+	if req.IsActive != nil {
+		coupon.IsActive = *req.IsActive
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+// Package proshop provides the pro shop point of sale: stock held as
+// inventory items, and sales rung up by staff and paid through the payment
+// subsystem
+package proshop
+
+import (
+	"net/http"
+
+	"golf-ezz-backend/internal/config"
+	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/models"
+	"golf-ezz-backend/internal/money"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ProShopHandler handles pro shop stock and sales
+type ProShopHandler struct {
+	config *config.Config
+}
+
+// NewProShopHandler creates a new pro shop handler
+func NewProShopHandler(cfg *config.Config) *ProShopHandler {
+	return &ProShopHandler{config: cfg}
+}
+
+// InventoryItemRequest represents a request to create or update a stock item
+type InventoryItemRequest struct {
+	CourseID    string       `json:"course_id" binding:"required"`
+	ItemType    string       `json:"item_type" binding:"required"`
+	Name        string       `json:"name" binding:"required"`
+	Description *string      `json:"description"`
+	Quantity    int          `json:"quantity" binding:"min=0"`
+	MinQuantity int          `json:"min_quantity" binding:"min=0"`
+	UnitPrice   money.Amount `json:"unit_price" binding:"min=0"`
+	IsActive    *bool        `json:"is_active"` // defaults to true
+}
+
+// GetInventory lists stock items (admin only). Filters: course_id, and
+// low_stock=true for items at or below their reorder level.
+func (h *ProShopHandler) GetInventory(c *gin.Context) {
+	query := database.DB.Order("name ASC")
+	if courseID := c.Query("course_id"); courseID != "" {
+		id, err := uuid.Parse(courseID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
+			return
+		}
+		query = query.Where("course_id = ?", id)
+	}
+	if c.Query("low_stock") == "true" {
+		query = query.Where("is_active = ? AND quantity <= min_quantity", true)
+	}
+
+	var items []models.InventoryItem
+	if err := query.Find(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve inventory"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": items,
+		"count": len(items),
+	})
+}
+
+// CreateInventoryItem adds a stock item (admin only)
+func (h *ProShopHandler) CreateInventoryItem(c *gin.Context) {
+	var req InventoryItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var item models.InventoryItem
+	if status, message := req.apply(&item); status != 0 {
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+
+	// The column default would turn an inactive item active on insert
+	active := item.IsActive
+	if err := database.DB.Create(&item).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create inventory item"})
+		return
+	}
+	if !active {
+		if err := database.DB.Model(&item).Update("is_active", false).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create inventory item"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusCreated, item)
+}
+
+// UpdateInventoryItem replaces a stock item's details and count (admin only).
+// Sales already made keep the price they were sold at.
+func (h *ProShopHandler) UpdateInventoryItem(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid inventory item ID"})
+		return
+	}
+
+	var item models.InventoryItem
+	if err := database.DB.First(&item, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Inventory item not found"})
+		return
+	}
+
+	var req InventoryItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if status, message := req.apply(&item); status != 0 {
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+
+	if err := database.DB.Save(&item).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update inventory item"})
+		return
+	}
+
+	c.JSON(http.StatusOK, item)
+}
+
+// apply copies the request onto an item, returning an HTTP status and message
+// when it cannot
+func (req InventoryItemRequest) apply(item *models.InventoryItem) (int, string) {
+	courseID, err := uuid.Parse(req.CourseID)
+	if err != nil {
+		return http.StatusBadRequest, "Invalid course ID"
+	}
+	var count int64
+	database.DB.Model(&models.Course{}).Where("id = ?", courseID).Count(&count)
+	if count == 0 {
+		return http.StatusNotFound, "Course not found"
+	}
+
+	item.CourseID = courseID
+	item.ItemType = req.ItemType
+	item.Name = req.Name
+	item.Description = req.Description
+	item.Quantity = req.Quantity
+	item.MinQuantity = req.MinQuantity
+	item.UnitPrice = req.UnitPrice
+	item.IsActive = true
+	if req.IsActive != nil {
+		item.IsActive = *req.IsActive
+	}
+	return 0, ""
+}
@@ -0,0 +1,780 @@
+package proshop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/features/ledger"
+	"golf-ezz-backend/internal/features/loyalty"
+	"golf-ezz-backend/internal/features/payments"
+	"golf-ezz-backend/internal/features/taxes"
+	"golf-ezz-backend/internal/models"
+	"golf-ezz-backend/internal/money"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrOutOfStock is returned when a sale asks for more than is on the shelf
+	ErrOutOfStock = errors.New("not enough stock")
+
+	// errSaleClosed is returned when a voided or fully returned sale is changed
+	errSaleClosed = errors.New("sale is closed")
+
+	// errBalanceTaken means the amount asked for is no longer available
+	errBalanceTaken = errors.New("sale balance is already paid or being paid")
+
+	// errNotVoidable is returned when a sale with returns is voided
+	errNotVoidable = errors.New("only a sale without returns can be voided")
+
+	// errSaleUnpaid is returned when items are returned against an unpaid sale
+	errSaleUnpaid = errors.New("sale is not paid")
+)
+
+// returnError explains why a return asks for items the sale cannot give back
+type returnError struct{ message string }
+
+func (e *returnError) Error() string { return e.message }
+
+// SaleRequest represents a request to ring up a sale
+type SaleRequest struct {
+	CourseID  string            `json:"course_id" binding:"required"`
+	UserID    string            `json:"user_id"`    // member buying, if any
+	BookingID string            `json:"booking_id"` // tee time the sale is for, if any
+	Items     []SaleItemRequest `json:"items" binding:"required,min=1,dive"`
+	Payment   *TenderRequest    `json:"payment"` // omit to take payment later
+}
+
+// SaleItemRequest is one line of a sale
+type SaleItemRequest struct {
+	InventoryItemID string `json:"inventory_item_id" binding:"required"`
+	Quantity        int    `json:"quantity" binding:"required,min=1"`
+}
+
+// TenderRequest represents a payment taken against a sale
+type TenderRequest struct {
+	PaymentMethod string       `json:"payment_method" binding:"required,oneof=card cash gift_card wallet points"`
+	Source        string       `json:"source"`                 // card token, or gift card code; unused for cash, wallet and points
+	Amount        money.Amount `json:"amount" binding:"min=0"` // 0 pays the outstanding balance
+}
+
+// VoidSaleRequest represents a request to void a sale
+type VoidSaleRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// ReturnRequest represents items brought back against a sale
+type ReturnRequest struct {
+	Items      []ReturnItemRequest `json:"items" binding:"required,min=1,dive"`
+	ReasonCode string              `json:"reason_code" binding:"omitempty,oneof=customer_request service_issue other"`
+	Notes      string              `json:"notes"`
+}
+
+// ReturnItemRequest is a quantity of one sale line being returned
+type ReturnItemRequest struct {
+	SaleItemID string `json:"sale_item_id" binding:"required"`
+	Quantity   int    `json:"quantity" binding:"required,min=1"`
+}
+
+// CreateSale rings up a sale (admin only). Stock is taken, the sale is priced
+// with the course's merchandise tax and posted to the ledger in a single
+// transaction; payment, when included, is taken afterwards.
+func (h *ProShopHandler) CreateSale(c *gin.Context) {
+	var req SaleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	staffID, ok := currentStaff(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	courseID, err := uuid.Parse(req.CourseID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
+		return
+	}
+	var course models.Course
+	if err := database.DB.First(&course, courseID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Course not found"})
+		return
+	}
+
+	sale := models.Sale{
+		CourseID:      course.ID,
+		StaffID:       staffID,
+		Status:        "completed",
+		PaymentStatus: "pending",
+	}
+
+	if req.BookingID != "" {
+		id, err := uuid.Parse(req.BookingID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid booking ID"})
+			return
+		}
+		var booking models.TeeTimeBooking
+		if err := database.DB.Where("id = ? AND course_id = ?", id, course.ID).First(&booking).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found at this course"})
+			return
+		}
+		sale.BookingID = &booking.ID
+		sale.UserID = &booking.UserID
+	}
+
+	if req.UserID != "" {
+		id, err := uuid.Parse(req.UserID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+		var user models.User
+		if err := database.DB.First(&user, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		sale.UserID = &user.ID
+	}
+
+	// Merge repeated items and lock them in a fixed order so concurrent
+	// sales of the same items cannot deadlock
+	quantities := make(map[uuid.UUID]int)
+	var itemIDs []uuid.UUID
+	for _, line := range req.Items {
+		id, err := uuid.Parse(line.InventoryItemID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid inventory item ID"})
+			return
+		}
+		if _, seen := quantities[id]; !seen {
+			itemIDs = append(itemIDs, id)
+		}
+		quantities[id] += line.Quantity
+	}
+	sort.Slice(itemIDs, func(i, j int) bool { return itemIDs[i].String() < itemIDs[j].String() })
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var lines models.InvoiceLines
+		for _, id := range itemIDs {
+			var item models.InventoryItem
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("id = ? AND course_id = ? AND is_active = ?", id, course.ID, true).
+				First(&item).Error; err != nil {
+				return err
+			}
+
+			quantity := quantities[id]
+			if item.Quantity < quantity {
+				return fmt.Errorf("%w: %d of %s left", ErrOutOfStock, item.Quantity, item.Name)
+			}
+			if err := tx.Model(&item).Update("quantity", gorm.Expr("quantity - ?", quantity)).Error; err != nil {
+				return err
+			}
+
+			amount := item.UnitPrice.Mul(quantity)
+			sale.Items = append(sale.Items, models.SaleItem{
+				InventoryItemID: item.ID,
+				Name:            item.Name,
+				Quantity:        quantity,
+				UnitPrice:       item.UnitPrice,
+				Amount:          amount,
+			})
+			lines = append(lines, models.InvoiceLine{
+				Description: item.Name,
+				Category:    "merchandise",
+				Quantity:    quantity,
+				UnitPrice:   item.UnitPrice,
+				Amount:      amount,
+			})
+		}
+
+		profile, err := taxes.ForCourse(tx, course.ID)
+		if err != nil {
+			return err
+		}
+		tax := taxes.Calculate(profile, lines)
+		sale.Subtotal = tax.Subtotal
+		sale.TaxLines = tax.Lines
+		sale.TaxAmount = tax.Tax
+		sale.TaxInclusive = tax.Inclusive
+		sale.TotalAmount = tax.Total
+		if sale.TotalAmount == 0 {
+			sale.PaymentStatus = "completed"
+		}
+
+		if err := tx.Create(&sale).Error; err != nil {
+			return err
+		}
+		return ledger.PostSale(tx, &sale)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Inventory item not found or not on sale at this course"})
+		return
+	}
+	if errors.Is(err, ErrOutOfStock) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create sale"})
+		return
+	}
+
+	if req.Payment == nil || sale.TotalAmount == 0 {
+		c.JSON(http.StatusCreated, sale)
+		return
+	}
+
+	payment, status, message := h.tender(c.Request.Context(), &sale, *req.Payment, staffID)
+	if message != "" {
+		c.JSON(status, gin.H{"error": message, "sale": sale, "payment": payment})
+		return
+	}
+
+	database.DB.Preload("Items").First(&sale, sale.ID)
+	c.JSON(http.StatusCreated, gin.H{
+		"sale":    sale,
+		"payment": payment,
+	})
+}
+
+// PaySale takes a payment against a sale's outstanding balance (admin only).
+// Split tenders pay part of the balance each.
+func (h *ProShopHandler) PaySale(c *gin.Context) {
+	sale, ok := loadSale(c)
+	if !ok {
+		return
+	}
+
+	var req TenderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	staffID, ok := currentStaff(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	if sale.Status == "voided" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot pay for a voided sale"})
+		return
+	}
+
+	payment, status, message := h.tender(c.Request.Context(), &sale, req, staffID)
+	if message != "" {
+		c.JSON(status, gin.H{"error": message, "payment": payment})
+		return
+	}
+
+	database.DB.Preload("Items").First(&sale, sale.ID)
+	c.JSON(http.StatusCreated, gin.H{
+		"sale":    sale,
+		"payment": payment,
+	})
+}
+
+// tender charges a payment against a sale, returning the HTTP status to
+// respond with and a message when it fails. Walk-in sales are paid in the name of the staff
+// member taking the money, since a payment always belongs to a user.
+func (h *ProShopHandler) tender(ctx context.Context, sale *models.Sale, req TenderRequest, staffID uuid.UUID) (*models.Payment, int, string) {
+	switch req.PaymentMethod {
+	case "card", "gift_card":
+		if req.Source == "" {
+			return nil, http.StatusBadRequest, "source is required for this payment method"
+		}
+	case "wallet", "points":
+		if sale.UserID == nil {
+			return nil, http.StatusBadRequest, "Wallet and points payments need a member on the sale"
+		}
+	}
+
+	payer := staffID
+	if sale.UserID != nil {
+		payer = *sale.UserID
+	}
+
+	provider, err := payments.ProviderFor(h.config, req.PaymentMethod)
+	if err != nil {
+		return nil, http.StatusServiceUnavailable, "Payment processing is not available"
+	}
+
+	payment := &models.Payment{
+		UserID:        payer,
+		SaleID:        &sale.ID,
+		Currency:      h.config.Payment.Currency,
+		Status:        "pending",
+		PaymentMethod: req.PaymentMethod,
+		Provider:      provider.Name(),
+	}
+
+	// The sale stays locked until the payment exists, so two tills cannot
+	// both take the same balance
+	var outstanding money.Amount
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var locked models.Sale
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, sale.ID).Error; err != nil {
+			return err
+		}
+		if locked.Status == "voided" {
+			return errSaleClosed
+		}
+		var err error
+		outstanding, err = payments.UnreservedAmount(tx, locked.TotalAmount, "sale_id", locked.ID)
+		if err != nil {
+			return err
+		}
+		if outstanding <= 0 || (req.Amount > 0 && req.Amount > outstanding) {
+			return errBalanceTaken
+		}
+
+		payment.Amount = outstanding
+		if req.Amount > 0 {
+			payment.Amount = req.Amount
+		}
+		return tx.Create(payment).Error
+	})
+	if errors.Is(err, errSaleClosed) {
+		return nil, http.StatusBadRequest, "Cannot pay for a voided sale"
+	}
+	if errors.Is(err, errBalanceTaken) {
+		if outstanding <= 0 {
+			return nil, http.StatusConflict, "Sale is already paid or a payment is in progress"
+		}
+		return nil, http.StatusBadRequest, "Amount exceeds the outstanding balance"
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, "Failed to create payment"
+	}
+
+	if err := payments.Charge(ctx, database.DB, provider, payment, req.Source); err != nil {
+		if errors.Is(err, payments.ErrDeclined) {
+			return payment, http.StatusPaymentRequired, "Payment declined"
+		}
+		if errors.Is(err, payments.ErrUnrecorded) {
+			return payment, http.StatusInternalServerError, "Payment was taken but could not be recorded; check it with the provider"
+		}
+		return payment, http.StatusBadGateway, "Payment failed"
+	}
+
+	// Members earn points once a sale is paid in full. The payment has
+	// settled, so a points problem must not fail it.
+	var paid models.Sale
+	if sale.UserID != nil && database.DB.First(&paid, sale.ID).Error == nil && paid.PaymentStatus == "completed" {
+		if err := database.DB.Transaction(func(tx *gorm.DB) error {
+			return loyalty.EarnForSale(tx, h.config, &paid)
+		}); err != nil {
+			log.Printf("Failed to credit points for sale %s: %v", sale.ID, err)
+		}
+	}
+	return payment, http.StatusCreated, ""
+}
+
+// GetSales lists sales, newest first (admin only). Filters: course_id,
+// user_id, booking_id, status and date (YYYY-MM-DD).
+func (h *ProShopHandler) GetSales(c *gin.Context) {
+	query := database.DB.Preload("Items").Order("created_at DESC").Limit(200)
+	for _, column := range []string{"course_id", "user_id", "booking_id"} {
+		value := c.Query(column)
+		if value == "" {
+			continue
+		}
+		id, err := uuid.Parse(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + column})
+			return
+		}
+		query = query.Where(column+" = ?", id)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if dateStr := c.Query("date"); dateStr != "" {
+		date, err := time.Parse("2006-01-02", dateStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD"})
+			return
+		}
+		query = query.Where("created_at >= ? AND created_at < ?", date, date.AddDate(0, 0, 1))
+	}
+
+	var sales []models.Sale
+	if err := query.Find(&sales).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve sales"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sales": sales,
+		"count": len(sales),
+	})
+}
+
+// GetSale returns a sale with its items and payments (admin only)
+func (h *ProShopHandler) GetSale(c *gin.Context) {
+	sale, ok := loadSale(c)
+	if !ok {
+		return
+	}
+
+	var salePayments []models.Payment
+	if err := database.DB.Where("sale_id = ?", sale.ID).Preload("Refunds").
+		Order("created_at ASC").Find(&salePayments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve payments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sale":     sale,
+		"payments": salePayments,
+	})
+}
+
+// VoidSale cancels a sale (admin only): every payment is refunded, all stock
+// is put back and anything still owed is written off. Sales with returns
+// cannot be voided; return the remaining items instead. The sale is marked
+// voided before any money moves, so a concurrent return or void is turned
+// away, and restored if the refunds fail.
+func (h *ProShopHandler) VoidSale(c *gin.Context) {
+	sale, ok := loadSale(c)
+	if !ok {
+		return
+	}
+
+	var req VoidSaleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	staffID, _ := currentStaff(c)
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockOpenSale(tx, &sale); err != nil {
+			return err
+		}
+		if sale.Status != "completed" {
+			return errNotVoidable
+		}
+
+		now := time.Now()
+		sale.Status = "voided"
+		sale.VoidedAt = &now
+		sale.VoidedBy = &staffID
+		sale.VoidReason = &req.Reason
+		return tx.Model(&sale).Updates(map[string]interface{}{
+			"status":      sale.Status,
+			"voided_at":   sale.VoidedAt,
+			"voided_by":   sale.VoidedBy,
+			"void_reason": sale.VoidReason,
+		}).Error
+	})
+	if errors.Is(err, errNotVoidable) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only a sale without returns can be voided"})
+		return
+	}
+	if errors.Is(err, errSaleClosed) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to void sale"})
+		return
+	}
+
+	refunds, err := payments.RefundBookingPayments(c.Request.Context(), database.DB, sale.ID, 100, payments.ReasonOther, &staffID)
+	if err != nil {
+		if undoErr := database.DB.Model(&sale).Updates(map[string]interface{}{
+			"status":      "completed",
+			"voided_at":   nil,
+			"voided_by":   nil,
+			"void_reason": nil,
+		}).Error; undoErr != nil {
+			log.Printf("Failed to reopen sale %s after its void refund failed: %v", sale.ID, undoErr)
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "The sale could not be refunded, so it was not voided", "refunds": refunds})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, item := range sale.Items {
+			if err := restock(tx, item.InventoryItemID, item.Quantity-item.ReturnedQuantity); err != nil {
+				return err
+			}
+		}
+		if err := loyalty.ReverseSale(tx, sale.ID, 1, "Sale voided"); err != nil {
+			return err
+		}
+
+		return ledger.PostCancellation(tx, &models.JournalEntry{
+			Description: "Sale voided: " + req.Reason,
+			CourseID:    &sale.CourseID,
+			UserID:      sale.UserID,
+			SaleID:      &sale.ID,
+			PostedBy:    &staffID,
+		})
+	})
+	if err != nil {
+		log.Printf("Sale %s was voided and refunded, but its stock, points or ledger were not updated: %v", sale.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Sale voided and refunded, but the stock could not be put back", "refunds": refunds})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sale":    sale,
+		"refunds": refunds,
+	})
+}
+
+// ReturnItems takes items back against a paid sale (admin only). The items go
+// back into stock and their price, with their share of the tax, is refunded
+// to the sale's payments, newest first. The returned quantities are reserved
+// on the locked sale before any money moves, so two returns of the same line
+// cannot both be refunded, and released again if the refund fails.
+func (h *ProShopHandler) ReturnItems(c *gin.Context) {
+	sale, ok := loadSale(c)
+	if !ok {
+		return
+	}
+
+	var req ReturnRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ReasonCode == "" {
+		req.ReasonCode = payments.ReasonCustomerRequest
+	}
+
+	returned := make(map[uuid.UUID]int)
+	for _, line := range req.Items {
+		id, err := uuid.Parse(line.SaleItemID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sale item ID"})
+			return
+		}
+		returned[id] += line.Quantity
+	}
+
+	// Work out what comes back and reserve it before any money moves
+	var value money.Amount
+	remaining := 0
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockOpenSale(tx, &sale); err != nil {
+			return err
+		}
+		if sale.Status == "returned" {
+			return errSaleClosed
+		}
+		if sale.PaymentStatus != "completed" && sale.PaymentStatus != "partially_refunded" {
+			return errSaleUnpaid
+		}
+
+		matched := 0
+		for i, item := range sale.Items {
+			quantity, ok := returned[item.ID]
+			if ok {
+				matched++
+			}
+			if quantity > item.Quantity-item.ReturnedQuantity {
+				return &returnError{fmt.Sprintf("Only %d of %s can be returned", item.Quantity-item.ReturnedQuantity, item.Name)}
+			}
+			value += item.UnitPrice.Mul(quantity)
+			remaining += item.Quantity - item.ReturnedQuantity - quantity
+			if quantity > 0 {
+				sale.Items[i].ReturnedQuantity += quantity
+				if err := tx.Model(&sale.Items[i]).Update("returned_quantity", sale.Items[i].ReturnedQuantity).Error; err != nil {
+					return err
+				}
+			}
+		}
+		if matched != len(returned) {
+			return &returnError{"Sale item not found on this sale"}
+		}
+
+		sale.Status = returnStatus(sale.Items)
+		return tx.Model(&sale).Update("status", sale.Status).Error
+	})
+	var notReturnable *returnError
+	switch {
+	case errors.Is(err, errSaleClosed):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing left to return on this sale"})
+		return
+	case errors.Is(err, errSaleUnpaid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only a paid sale can take returns; void an unpaid sale instead"})
+		return
+	case errors.As(err, &notReturnable):
+		c.JSON(http.StatusBadRequest, gin.H{"error": notReturnable.message})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record the return"})
+		return
+	}
+
+	// Tax follows the items back; the last return refunds whatever is left
+	// so rounding cannot strand a cent
+	amount := value
+	if sale.Subtotal > 0 {
+		amount = value.Scale(float64(sale.TotalAmount) / float64(sale.Subtotal))
+	}
+
+	var salePayments []models.Payment
+	if err := database.DB.Where("sale_id = ? AND status IN ?", sale.ID, []string{"completed", "partially_refunded"}).
+		Order("created_at DESC").Find(&salePayments).Error; err != nil {
+		releaseReturn(sale.ID, returned)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve payments"})
+		return
+	}
+	if remaining == 0 {
+		amount = 0
+		for _, payment := range salePayments {
+			amount += payments.RefundableAmount(payment)
+		}
+	}
+
+	staffID, _ := currentStaff(c)
+	var refunds []models.Refund
+	for i := range salePayments {
+		if amount <= 0 {
+			break
+		}
+		share := money.Min(amount, payments.RefundableAmount(salePayments[i]))
+		if share <= 0 {
+			continue
+		}
+		refund, err := payments.IssueRefund(c.Request.Context(), database.DB, &salePayments[i], share, req.ReasonCode, req.Notes, &staffID)
+		if err != nil {
+			releaseReturn(sale.ID, returned)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Refund failed; the items were not returned", "refunds": refunds})
+			return
+		}
+		refunds = append(refunds, *refund)
+		amount -= share
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, item := range sale.Items {
+			if err := restock(tx, item.InventoryItemID, returned[item.ID]); err != nil {
+				return err
+			}
+		}
+
+		// Points earned on the sale go back with the items
+		fraction := 1.0
+		if remaining > 0 && sale.Subtotal > 0 {
+			fraction = float64(value) / float64(sale.Subtotal)
+		}
+		return loyalty.ReverseSale(tx, sale.ID, fraction, "Items returned")
+	})
+	if err != nil {
+		log.Printf("Return on sale %s was refunded, but its stock or points were not updated: %v", sale.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Refund issued, but the items could not be put back in stock", "refunds": refunds})
+		return
+	}
+
+	database.DB.Preload("Items").First(&sale, sale.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"sale":    sale,
+		"refunds": refunds,
+	})
+}
+
+// releaseReturn gives back quantities reserved for a return that was not refunded
+func releaseReturn(saleID uuid.UUID, returned map[uuid.UUID]int) {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		sale := models.Sale{}
+		sale.ID = saleID
+		if err := lockOpenSale(tx, &sale); err != nil {
+			return err
+		}
+		for i, item := range sale.Items {
+			quantity := returned[item.ID]
+			if quantity == 0 {
+				continue
+			}
+			sale.Items[i].ReturnedQuantity -= quantity
+			if err := tx.Model(&sale.Items[i]).Update("returned_quantity", sale.Items[i].ReturnedQuantity).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&sale).Update("status", returnStatus(sale.Items)).Error
+	})
+	if err != nil {
+		log.Printf("Failed to release the return reserved on sale %s: %v", saleID, err)
+	}
+}
+
+// returnStatus is the status of an open sale given how much of it has come back
+func returnStatus(items []models.SaleItem) string {
+	returned, kept := 0, 0
+	for _, item := range items {
+		returned += item.ReturnedQuantity
+		kept += item.Quantity - item.ReturnedQuantity
+	}
+	switch {
+	case kept == 0 && returned > 0:
+		return "returned"
+	case returned > 0:
+		return "partially_returned"
+	}
+	return "completed"
+}
+
+// loadSale loads the sale named in the URL with its items, responding when it cannot
+func loadSale(c *gin.Context) (models.Sale, bool) {
+	var sale models.Sale
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sale ID"})
+		return sale, false
+	}
+	if err := database.DB.Preload("Items").First(&sale, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sale not found"})
+		return sale, false
+	}
+	return sale, true
+}
+
+// lockOpenSale reloads a sale and its items for update, failing once it is voided
+func lockOpenSale(tx *gorm.DB, sale *models.Sale) error {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(sale, sale.ID).Error; err != nil {
+		return err
+	}
+	if sale.Status == "voided" {
+		return errSaleClosed
+	}
+	sale.Items = nil
+	return tx.Where("sale_id = ?", sale.ID).Order("created_at ASC").Find(&sale.Items).Error
+}
+
+// restock puts quantity of an item back on the shelf
+func restock(tx *gorm.DB, itemID uuid.UUID, quantity int) error {
+	if quantity <= 0 {
+		return nil
+	}
+	return tx.Model(&models.InventoryItem{}).Where("id = ?", itemID).
+		Update("quantity", gorm.Expr("quantity + ?", quantity)).Error
+}
+
+// currentStaff returns the ID of the staff member making the request
+func currentStaff(c *gin.Context) (uuid.UUID, bool) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		return uuid.Nil, false
+	}
+	id, err := uuid.Parse(fmt.Sprint(userID))
+	return id, err == nil
+}
@@ -0,0 +1,326 @@
+package reconciliation
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/features/ledger"
+	"golf-ezz-backend/internal/models"
+	"golf-ezz-backend/internal/money"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// errDayLocked is returned when the counts of a locked day are changed
+	errDayLocked = errors.New("day is locked; post an adjustment instead")
+
+	// errNotCounted is returned when locking a day before its totals are counted
+	errNotCounted = errors.New("record the counted cash and card batch totals before locking the day")
+)
+
+// ReconciliationHandler handles the end-of-day close
+type ReconciliationHandler struct{}
+
+// NewReconciliationHandler creates a new reconciliation handler
+func NewReconciliationHandler() *ReconciliationHandler {
+	return &ReconciliationHandler{}
+}
+
+// CountRequest records what staff counted at the end of a day
+type CountRequest struct {
+	Date        string        `json:"date" binding:"required"` // YYYY-MM-DD
+	CountedCash *money.Amount `json:"counted_cash" binding:"omitempty,min=0"`
+	CountedCard *money.Amount `json:"counted_card" binding:"omitempty,min=0"`
+	Notes       *string       `json:"notes"`
+}
+
+// LockRequest represents a request to lock a day
+type LockRequest struct {
+	Date string `json:"date" binding:"required"` // YYYY-MM-DD
+}
+
+// AdjustmentRequest represents a correction to a locked day's takings
+type AdjustmentRequest struct {
+	Date   string       `json:"date" binding:"required"` // YYYY-MM-DD
+	Method string       `json:"method" binding:"required,oneof=cash card"`
+	Amount money.Amount `json:"amount" binding:"required"` // added to the expected total; negative for a shortfall
+	Reason string       `json:"reason" binding:"required"`
+}
+
+// GetDayClose returns a course's end-of-day report for a date (admin only),
+// defaulting to today: takings by method, refunds, gift card redemptions and
+// pro shop sales, the expected and counted totals and anything flagged.
+func (h *ReconciliationHandler) GetDayClose(c *gin.Context) {
+	courseID, ok := courseParam(c)
+	if !ok {
+		return
+	}
+
+	date := ledger.Day(time.Now())
+	if dateStr := c.Query("date"); dateStr != "" {
+		parsed, err := time.Parse("2006-01-02", dateStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD"})
+			return
+		}
+		date = parsed
+	}
+
+	dayClose := models.DayClose{CourseID: courseID, Date: date, Status: "open"}
+	err := database.DB.Where("course_id = ? AND date = ?", courseID, date).First(&dayClose).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve day close"})
+		return
+	}
+
+	respondDayClose(c, http.StatusOK, database.DB, &dayClose)
+}
+
+// RecordCounts records the counted cash and the card batch total for a day
+// (admin only). Counts can be corrected until the day is locked.
+func (h *ReconciliationHandler) RecordCounts(c *gin.Context) {
+	courseID, ok := courseParam(c)
+	if !ok {
+		return
+	}
+
+	var req CountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	date, err := time.Parse("2006-01-02", req.Date)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD"})
+		return
+	}
+
+	staffID := currentStaff(c)
+
+	var dayClose *models.DayClose
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if dayClose, err = lockDayClose(tx, courseID, date); err != nil {
+			return err
+		}
+		if dayClose.Status == "locked" {
+			return errDayLocked
+		}
+
+		if req.CountedCash != nil {
+			dayClose.CountedCash = req.CountedCash
+		}
+		if req.CountedCard != nil {
+			dayClose.CountedCard = req.CountedCard
+		}
+		if req.Notes != nil {
+			dayClose.Notes = req.Notes
+		}
+		dayClose.CountedBy = staffID
+		return tx.Model(dayClose).Updates(map[string]interface{}{
+			"counted_cash": dayClose.CountedCash,
+			"counted_card": dayClose.CountedCard,
+			"notes":        dayClose.Notes,
+			"counted_by":   dayClose.CountedBy,
+		}).Error
+	})
+	if errors.Is(err, errDayLocked) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record counts"})
+		return
+	}
+
+	respondDayClose(c, http.StatusOK, database.DB, dayClose)
+}
+
+// LockDay closes a day's books (admin only). The expected totals and the
+// variances against the counts are frozen; ledger postings dated into the day
+// afterwards land on the current day, and corrections need an adjustment.
+func (h *ReconciliationHandler) LockDay(c *gin.Context) {
+	courseID, ok := courseParam(c)
+	if !ok {
+		return
+	}
+
+	var req LockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	date, err := time.Parse("2006-01-02", req.Date)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD"})
+		return
+	}
+
+	staffID := currentStaff(c)
+
+	var dayClose *models.DayClose
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if dayClose, err = lockDayClose(tx, courseID, date); err != nil {
+			return err
+		}
+		if dayClose.Status == "locked" {
+			return errDayLocked
+		}
+		if dayClose.CountedCash == nil || dayClose.CountedCard == nil {
+			return errNotCounted
+		}
+
+		summary, err := Summarize(tx, courseID, date, dayClose)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		dayClose.Status = "locked"
+		dayClose.ExpectedCash = summary.ExpectedCash
+		dayClose.ExpectedCard = summary.ExpectedCard
+		dayClose.CashVariance = *dayClose.CountedCash - summary.ExpectedCash
+		dayClose.CardVariance = *dayClose.CountedCard - summary.ExpectedCard
+		dayClose.LockedAt = &now
+		dayClose.LockedBy = staffID
+		return tx.Save(dayClose).Error
+	})
+	switch {
+	case errors.Is(err, errDayLocked):
+		c.JSON(http.StatusConflict, gin.H{"error": "Day is already locked"})
+		return
+	case errors.Is(err, errNotCounted):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lock day"})
+		return
+	}
+
+	respondDayClose(c, http.StatusOK, database.DB, dayClose)
+}
+
+// PostAdjustment corrects a locked day's expected cash or card total with an
+// adjusting ledger entry against cash over/short (admin only)
+func (h *ReconciliationHandler) PostAdjustment(c *gin.Context) {
+	courseID, ok := courseParam(c)
+	if !ok {
+		return
+	}
+
+	var req AdjustmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	date, err := time.Parse("2006-01-02", req.Date)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD"})
+		return
+	}
+
+	var dayClose models.DayClose
+	if err := database.DB.Where("course_id = ? AND date = ?", courseID, date).First(&dayClose).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Day close not found"})
+		return
+	}
+	if dayClose.Status != "locked" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Day is still open; correct the counts instead"})
+		return
+	}
+
+	entry := &models.JournalEntry{
+		Description: fmt.Sprintf("%s adjustment for %s: %s", req.Method, req.Date, req.Reason),
+		CourseID:    &courseID,
+		DayCloseID:  &dayClose.ID,
+		PostedBy:    currentStaff(c),
+	}
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return ledger.PostAdjustment(tx, entry, ledger.FundsAccount(req.Method), req.Amount)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to post adjustment"})
+		return
+	}
+
+	summary, err := Summarize(database.DB, courseID, date, &dayClose)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to summarise day"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"entry":   entry,
+		"summary": summary,
+		"flags":   Flags(summary, &dayClose),
+	})
+}
+
+// respondDayClose writes a day close with its live summary and flags
+func respondDayClose(c *gin.Context, status int, db *gorm.DB, dayClose *models.DayClose) {
+	summary, err := Summarize(db, dayClose.CourseID, dayClose.Date, dayClose)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to summarise day"})
+		return
+	}
+
+	c.JSON(status, gin.H{
+		"day_close": dayClose,
+		"summary":   summary,
+		"flags":     Flags(summary, dayClose),
+	})
+}
+
+// lockDayClose loads a course's close for a date for update, creating it open
+// on first use
+func lockDayClose(tx *gorm.DB, courseID uuid.UUID, date time.Time) (*models.DayClose, error) {
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.DayClose{CourseID: courseID, Date: date, Status: "open"}).Error; err != nil {
+		return nil, err
+	}
+
+	var dayClose models.DayClose
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("course_id = ? AND date = ?", courseID, date).
+		First(&dayClose).Error; err != nil {
+		return nil, err
+	}
+	return &dayClose, nil
+}
+
+// courseParam parses and checks the course in the URL, responding when it cannot
+func courseParam(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
+		return uuid.Nil, false
+	}
+
+	var count int64
+	database.DB.Model(&models.Course{}).Where("id = ?", id).Count(&count)
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Course not found"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// currentStaff returns the ID of the staff member making the request
+func currentStaff(c *gin.Context) *uuid.UUID {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		return nil
+	}
+	id, err := uuid.Parse(fmt.Sprint(userID))
+	if err != nil {
+		return nil
+	}
+	return &id
+}
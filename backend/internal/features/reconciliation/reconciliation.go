@@ -0,0 +1,176 @@
+// Package reconciliation provides the end-of-day close: per course takings
+// from the ledger compared with the cash and card totals staff count
+package reconciliation
+
+import (
+	"time"
+
+	"golf-ezz-backend/internal/features/ledger"
+	"golf-ezz-backend/internal/models"
+	"golf-ezz-backend/internal/money"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MethodTotal is the money moved by one payment method
+type MethodTotal struct {
+	Method string       `json:"method"`
+	Count  int64        `json:"count"`
+	Amount money.Amount `json:"amount"`
+	Fees   money.Amount `json:"fees"`
+}
+
+// SalesTotal summarises the pro shop sales rung up on a day
+type SalesTotal struct {
+	Count    int64        `json:"count"`
+	Voided   int64        `json:"voided"`
+	Unpaid   int64        `json:"unpaid"` // neither paid in full nor voided
+	Subtotal money.Amount `json:"subtotal"`
+	Tax      money.Amount `json:"tax"`
+	Total    money.Amount `json:"total"`
+}
+
+// Summary is what a course took on one day, and what that means should be in
+// the cash drawer and the card batch
+type Summary struct {
+	CourseID            uuid.UUID     `json:"course_id"`
+	Date                string        `json:"date"`
+	Payments            []MethodTotal `json:"payments"`
+	Refunds             []MethodTotal `json:"refunds"`
+	GiftCardRedemptions MethodTotal   `json:"gift_card_redemptions"`
+	Sales               SalesTotal    `json:"sales"`
+	CashAdjustments     money.Amount  `json:"cash_adjustments"`
+	CardAdjustments     money.Amount  `json:"card_adjustments"`
+	ExpectedCash        money.Amount  `json:"expected_cash"`
+	ExpectedCard        money.Amount  `json:"expected_card"`
+	LatePostings        int64         `json:"late_postings"` // entries posted after the day was locked
+}
+
+// Summarize works out a course's takings for the day starting at date (UTC)
+// from the ledger. Payments and refunds count on the day they were posted;
+// adjustments count towards the closed day they correct.
+func Summarize(db *gorm.DB, courseID uuid.UUID, date time.Time, dayClose *models.DayClose) (*Summary, error) {
+	from, to := ledger.Day(date), ledger.Day(date).AddDate(0, 0, 1)
+	summary := &Summary{
+		CourseID: courseID,
+		Date:     from.Format("2006-01-02"),
+		Payments: []MethodTotal{},
+		Refunds:  []MethodTotal{},
+	}
+
+	if err := db.Table("journal_entries").
+		Select("payments.payment_method AS method, COUNT(*) AS count, "+
+			"COALESCE(SUM(payments.amount), 0) AS amount, COALESCE(SUM(payments.fee), 0) AS fees").
+		Joins("JOIN payments ON payments.id = journal_entries.payment_id").
+		Where("journal_entries.course_id = ? AND journal_entries.type = ? AND journal_entries.posted_at >= ? AND journal_entries.posted_at < ?",
+			courseID, ledger.EntryPayment, from, to).
+		Group("payments.payment_method").Order("payments.payment_method").
+		Scan(&summary.Payments).Error; err != nil {
+		return nil, err
+	}
+
+	if err := db.Table("journal_entries").
+		Select("payments.payment_method AS method, COUNT(*) AS count, COALESCE(SUM(refunds.amount), 0) AS amount").
+		Joins("JOIN refunds ON refunds.id = journal_entries.refund_id").
+		Joins("JOIN payments ON payments.id = refunds.payment_id").
+		Where("journal_entries.course_id = ? AND journal_entries.type = ? AND journal_entries.posted_at >= ? AND journal_entries.posted_at < ?",
+			courseID, ledger.EntryRefund, from, to).
+		Group("payments.payment_method").Order("payments.payment_method").
+		Scan(&summary.Refunds).Error; err != nil {
+		return nil, err
+	}
+
+	if err := db.Model(&models.Sale{}).
+		Select("COUNT(*) AS count, "+
+			"COUNT(*) FILTER (WHERE status = 'voided') AS voided, "+
+			"COUNT(*) FILTER (WHERE status <> 'voided' AND payment_status NOT IN ('completed', 'partially_refunded', 'refunded')) AS unpaid, "+
+			"COALESCE(SUM(subtotal) FILTER (WHERE status <> 'voided'), 0) AS subtotal, "+
+			"COALESCE(SUM(tax_amount) FILTER (WHERE status <> 'voided'), 0) AS tax, "+
+			"COALESCE(SUM(total_amount) FILTER (WHERE status <> 'voided'), 0) AS total").
+		Where("course_id = ? AND created_at >= ? AND created_at < ?", courseID, from, to).
+		Scan(&summary.Sales).Error; err != nil {
+		return nil, err
+	}
+
+	cash, card := ledger.FundsAccount("cash"), ledger.FundsAccount("card")
+	for _, total := range summary.Payments {
+		switch ledger.FundsAccount(total.Method) {
+		case cash:
+			summary.ExpectedCash += total.Amount
+		case card:
+			summary.ExpectedCard += total.Amount
+		}
+		if total.Method == "gift_card" {
+			summary.GiftCardRedemptions = total
+		}
+	}
+	for _, total := range summary.Refunds {
+		switch ledger.FundsAccount(total.Method) {
+		case cash:
+			summary.ExpectedCash -= total.Amount
+		case card:
+			summary.ExpectedCard -= total.Amount
+		}
+	}
+
+	if dayClose == nil || dayClose.ID == uuid.Nil {
+		return summary, nil
+	}
+
+	var adjustments []struct {
+		Account string
+		Amount  money.Amount
+	}
+	if err := db.Table("journal_lines").
+		Select("journal_lines.account, COALESCE(SUM(journal_lines.debit - journal_lines.credit), 0) AS amount").
+		Joins("JOIN journal_entries ON journal_entries.id = journal_lines.entry_id").
+		Where("journal_entries.day_close_id = ? AND journal_lines.account IN ?", dayClose.ID, []string{cash, card}).
+		Group("journal_lines.account").
+		Scan(&adjustments).Error; err != nil {
+		return nil, err
+	}
+	for _, adjustment := range adjustments {
+		if adjustment.Account == cash {
+			summary.CashAdjustments = adjustment.Amount
+		} else {
+			summary.CardAdjustments = adjustment.Amount
+		}
+	}
+	summary.ExpectedCash += summary.CashAdjustments
+	summary.ExpectedCard += summary.CardAdjustments
+
+	if dayClose.LockedAt != nil {
+		if err := db.Model(&models.JournalEntry{}).
+			Where("course_id = ? AND type <> ? AND posted_at >= ? AND posted_at < ? AND created_at > ?",
+				courseID, ledger.EntryAdjustment, from, to, *dayClose.LockedAt).
+			Count(&summary.LatePostings).Error; err != nil {
+			return nil, err
+		}
+	}
+	return summary, nil
+}
+
+// Flags lists what a manager should look at before or after closing the day
+func Flags(summary *Summary, dayClose *models.DayClose) []string {
+	flags := []string{}
+	switch {
+	case dayClose.CountedCash == nil:
+		flags = append(flags, "cash_not_counted")
+	case *dayClose.CountedCash != summary.ExpectedCash:
+		flags = append(flags, "cash_variance")
+	}
+	switch {
+	case dayClose.CountedCard == nil:
+		flags = append(flags, "card_batch_not_recorded")
+	case *dayClose.CountedCard != summary.ExpectedCard:
+		flags = append(flags, "card_variance")
+	}
+	if summary.Sales.Unpaid > 0 {
+		flags = append(flags, "unpaid_sales")
+	}
+	if summary.LatePostings > 0 {
+		flags = append(flags, "late_postings")
+	}
+	return flags
+}
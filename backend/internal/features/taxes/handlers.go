@@ -0,0 +1,296 @@
+package taxes
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/models"
+	"golf-ezz-backend/internal/money"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// TaxHandler handles tax profile administration and reporting
+type TaxHandler struct{}
+
+// NewTaxHandler creates a new tax handler
+func NewTaxHandler() *TaxHandler {
+	return &TaxHandler{}
+}
+
+// TaxProfileRequest represents a request to create or replace a tax profile
+type TaxProfileRequest struct {
+	Name         string           `json:"name" binding:"required"`
+	Jurisdiction string           `json:"jurisdiction"`
+	Inclusive    bool             `json:"inclusive"`
+	Rates        []TaxRateRequest `json:"rates" binding:"dive"`
+}
+
+// TaxRateRequest represents one rate of a tax profile
+type TaxRateRequest struct {
+	Category string  `json:"category" binding:"required,oneof=green_fee range cart rental merchandise membership"`
+	Name     string  `json:"name" binding:"required"`
+	Rate     float64 `json:"rate" binding:"gt=0,max=100"`
+}
+
+// CourseTaxProfileRequest assigns a tax profile to a course
+type CourseTaxProfileRequest struct {
+	TaxProfileID string `json:"tax_profile_id"` // empty to stop taxing the course
+}
+
+// SummaryRow is the tax collected under one rate at one course
+type SummaryRow struct {
+	CourseName string       `json:"course_name"`
+	Tax        string       `json:"tax"`
+	Invoices   int          `json:"invoices"`
+	Amount     money.Amount `json:"amount"`
+}
+
+// GetTaxProfiles lists tax profiles with their rates (admin only)
+func (h *TaxHandler) GetTaxProfiles(c *gin.Context) {
+	var profiles []models.TaxProfile
+	if err := database.DB.Preload("Rates").Order("name ASC").Find(&profiles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tax profiles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tax_profiles": profiles,
+		"count":        len(profiles),
+	})
+}
+
+// CreateTaxProfile creates a tax profile (admin only)
+func (h *TaxHandler) CreateTaxProfile(c *gin.Context) {
+	var req TaxProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	profile := models.TaxProfile{
+		Name:         req.Name,
+		Jurisdiction: req.Jurisdiction,
+		Inclusive:    req.Inclusive,
+		Rates:        req.rates(),
+	}
+	if err := database.DB.Create(&profile).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create tax profile"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, profile)
+}
+
+// UpdateTaxProfile replaces a tax profile's settings and rates (admin only).
+// Bookings already priced keep the tax they were quoted.
+func (h *TaxHandler) UpdateTaxProfile(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tax profile ID"})
+		return
+	}
+
+	var req TaxProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var profile models.TaxProfile
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&profile, id).Error; err != nil {
+			return err
+		}
+
+		profile.Name = req.Name
+		profile.Jurisdiction = req.Jurisdiction
+		profile.Inclusive = req.Inclusive
+		if err := tx.Model(&profile).Select("name", "jurisdiction", "inclusive").Updates(&profile).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("tax_profile_id = ?", profile.ID).Delete(&models.TaxRate{}).Error; err != nil {
+			return err
+		}
+		profile.Rates = req.rates()
+		for i := range profile.Rates {
+			profile.Rates[i].TaxProfileID = profile.ID
+		}
+		if len(profile.Rates) == 0 {
+			return nil
+		}
+		return tx.Create(&profile.Rates).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tax profile not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tax profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// SetCourseTaxProfile assigns a tax profile to a course (admin only)
+func (h *TaxHandler) SetCourseTaxProfile(c *gin.Context) {
+	courseID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
+		return
+	}
+
+	var req CourseTaxProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var course models.Course
+	if err := database.DB.First(&course, courseID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Course not found"})
+		return
+	}
+
+	var profileID *uuid.UUID
+	if req.TaxProfileID != "" {
+		id, err := uuid.Parse(req.TaxProfileID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tax profile ID"})
+			return
+		}
+		var count int64
+		database.DB.Model(&models.TaxProfile{}).Where("id = ?", id).Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tax profile not found"})
+			return
+		}
+		profileID = &id
+	}
+
+	if err := database.DB.Model(&course).Update("tax_profile_id", profileID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update course"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"course_id":      course.ID,
+		"tax_profile_id": profileID,
+	})
+}
+
+// GetTaxReport summarises the tax on receipts issued in a date range, per
+// course and rate (admin only). format=csv exports it as a spreadsheet.
+func (h *TaxHandler) GetTaxReport(c *gin.Context) {
+	startDateStr := c.Query("start_date")
+	endDateStr := c.Query("end_date")
+
+	if startDateStr == "" || endDateStr == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start_date and end_date parameters required"})
+		return
+	}
+
+	startDate, err := time.Parse("2006-01-02", startDateStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_date format. Use YYYY-MM-DD"})
+		return
+	}
+
+	endDate, err := time.Parse("2006-01-02", endDateStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date format. Use YYYY-MM-DD"})
+		return
+	}
+
+	rows, total, err := Summarize(database.DB, startDate, endDate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tax data"})
+		return
+	}
+
+	if c.Query("format") == "csv" {
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="tax-summary-%s-to-%s.csv"`, startDateStr, endDateStr))
+		c.Header("Content-Type", "text/csv")
+		c.Status(http.StatusOK)
+
+		w := csv.NewWriter(c.Writer)
+		w.Write([]string{"course", "tax", "invoices", "amount"})
+		for _, row := range rows {
+			w.Write([]string{row.CourseName, row.Tax, fmt.Sprint(row.Invoices), row.Amount.String()})
+		}
+		w.Write([]string{"Total", "", "", total.String()})
+		w.Flush()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"start_date":   startDateStr,
+		"end_date":     endDateStr,
+		"taxes":        rows,
+		"total_tax":    total,
+		"generated_at": time.Now(),
+	})
+}
+
+// Summarize totals the tax lines of the receipts issued between two dates,
+// inclusive, per course and rate. Voided receipts are left out; their
+// replacements carry the tax instead.
+func Summarize(db *gorm.DB, from, to time.Time) ([]SummaryRow, money.Amount, error) {
+	var invoices []models.Invoice
+	if err := db.Select("course_name", "tax_lines").
+		Where("status = ? AND issued_at >= ? AND issued_at < ? AND tax <> 0", "issued", from, to.AddDate(0, 0, 1)).
+		Find(&invoices).Error; err != nil {
+		return nil, 0, err
+	}
+
+	type key struct{ course, tax string }
+	sums := make(map[key]*SummaryRow)
+	var total money.Amount
+	for _, invoice := range invoices {
+		for _, line := range invoice.TaxLines {
+			k := key{invoice.CourseName, line.Description}
+			row, ok := sums[k]
+			if !ok {
+				row = &SummaryRow{CourseName: invoice.CourseName, Tax: line.Description}
+				sums[k] = row
+			}
+			row.Invoices++
+			row.Amount += line.Amount
+			total += line.Amount
+		}
+	}
+
+	rows := make([]SummaryRow, 0, len(sums))
+	for _, row := range sums {
+		rows = append(rows, *row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].CourseName != rows[j].CourseName {
+			return rows[i].CourseName < rows[j].CourseName
+		}
+		return rows[i].Tax < rows[j].Tax
+	})
+	return rows, total, nil
+}
+
+// rates converts the requested rates to models
+func (req TaxProfileRequest) rates() []models.TaxRate {
+	rates := make([]models.TaxRate, 0, len(req.Rates))
+	for _, rate := range req.Rates {
+		rates = append(rates, models.TaxRate{
+			Category: rate.Category,
+			Name:     rate.Name,
+			Rate:     rate.Rate,
+		})
+	}
+	return rates
+}
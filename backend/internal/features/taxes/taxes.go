@@ -0,0 +1,174 @@
+// Package taxes provides per-jurisdiction sales tax profiles and the tax
+// calculation used by quotes, bookings and receipts
+package taxes
+
+import (
+	"fmt"
+
+	"golf-ezz-backend/internal/models"
+	"golf-ezz-backend/internal/money"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Breakdown is the tax due on a set of priced lines
+type Breakdown struct {
+	Lines     models.InvoiceLines `json:"lines"`     // one line per tax rate
+	Inclusive bool                `json:"inclusive"` // the tax is already in Subtotal
+	Subtotal  money.Amount        `json:"subtotal"`  // sum of the priced lines
+	Tax       money.Amount        `json:"tax"`
+	Total     money.Amount        `json:"total"` // what the customer pays
+}
+
+// ForCourse loads the tax profile of a course, or nil when the course has none
+func ForCourse(db *gorm.DB, courseID uuid.UUID) (*models.TaxProfile, error) {
+	var course models.Course
+	if err := db.Select("id", "tax_profile_id").First(&course, courseID).Error; err != nil {
+		return nil, err
+	}
+	if course.TaxProfileID == nil {
+		return nil, nil
+	}
+
+	var profile models.TaxProfile
+	if err := db.Preload("Rates").First(&profile, *course.TaxProfileID).Error; err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// Calculate works out the tax on priced lines under a profile. Discount lines
+// (negative amounts) reduce the taxable amount of each category in proportion
+// to its share of the gross. A nil profile charges no tax.
+func Calculate(profile *models.TaxProfile, lines models.InvoiceLines) Breakdown {
+	breakdown := Breakdown{Lines: models.InvoiceLines{}}
+	for _, line := range lines {
+		breakdown.Subtotal += line.Amount
+	}
+	breakdown.Total = breakdown.Subtotal
+	if profile == nil || len(profile.Rates) == 0 {
+		return breakdown
+	}
+	breakdown.Inclusive = profile.Inclusive
+
+	// Sum per rate so a tax levied on several categories prints once
+	index := make(map[string]int)
+	for _, base := range taxableBases(lines) {
+		var rates []models.TaxRate
+		var combined float64
+		for _, rate := range profile.Rates {
+			if rate.Category == base.category && rate.Rate > 0 {
+				rates = append(rates, rate)
+				combined += rate.Rate
+			}
+		}
+		if len(rates) == 0 {
+			continue
+		}
+
+		// Inclusive prices hold base*combined/(100+combined) of tax, split
+		// between the rates with the last taking the rounding remainder
+		included := base.amount - base.amount.Scale(100/(100+combined))
+		allocated := money.Zero
+
+		for i, rate := range rates {
+			var amount money.Amount
+			switch {
+			case !profile.Inclusive:
+				amount = base.amount.Percent(rate.Rate)
+			case i == len(rates)-1:
+				amount = included - allocated
+			default:
+				amount = included.Scale(rate.Rate / combined)
+				allocated += amount
+			}
+
+			description := fmt.Sprintf("%s (%g%%)", rate.Name, rate.Rate)
+			at, ok := index[description]
+			if !ok {
+				at = len(breakdown.Lines)
+				index[description] = at
+				breakdown.Lines = append(breakdown.Lines, models.InvoiceLine{
+					Description: description,
+					Category:    "tax",
+					Quantity:    1,
+				})
+			}
+			breakdown.Lines[at].UnitPrice += amount
+			breakdown.Lines[at].Amount += amount
+			breakdown.Tax += amount
+		}
+	}
+
+	if !breakdown.Inclusive {
+		breakdown.Total += breakdown.Tax
+	}
+	return breakdown
+}
+
+type taxableBase struct {
+	category string
+	amount   money.Amount
+}
+
+// taxableBases returns the amount of each category after discounts, in the
+// order the categories first appear
+func taxableBases(lines models.InvoiceLines) []taxableBase {
+	var bases []taxableBase
+	var gross, discount money.Amount
+	for _, line := range lines {
+		if line.Amount < 0 {
+			discount -= line.Amount
+			continue
+		}
+		gross += line.Amount
+
+		found := false
+		for i := range bases {
+			if bases[i].category == line.Category {
+				bases[i].amount += line.Amount
+				found = true
+				break
+			}
+		}
+		if !found {
+			bases = append(bases, taxableBase{category: line.Category, amount: line.Amount})
+		}
+	}
+	if discount == 0 || gross == 0 {
+		return bases
+	}
+
+	discount = money.Min(discount, gross)
+	remaining := discount
+	for i := range bases {
+		share := remaining
+		if i < len(bases)-1 {
+			share = discount.Scale(float64(bases[i].amount) / float64(gross))
+		}
+		bases[i].amount -= share
+		remaining -= share
+	}
+	return bases
+}
+
+// Share returns the part of a tax breakdown that falls on a partial payment of
+// paid out of total, as tax lines and their sum
+func Share(lines models.InvoiceLines, paid, total money.Amount) (models.InvoiceLines, money.Amount) {
+	shared := models.InvoiceLines{}
+	var tax money.Amount
+	if total <= 0 {
+		return shared, tax
+	}
+
+	ratio := float64(paid) / float64(total)
+	for _, line := range lines {
+		amount := line.Amount.Scale(ratio)
+		line.UnitPrice = amount
+		line.Amount = amount
+		shared = append(shared, line)
+		tax += amount
+	}
+	return shared, tax
+}
@@ -4,13 +4,17 @@ package middleware
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"golf-ezz-backend/internal/config"
+	"golf-ezz-backend/internal/database"
+	"golf-ezz-backend/internal/models"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 // CORSMiddleware handles Cross-Origin Resource Sharing
@@ -30,7 +34,8 @@ func CORSMiddleware() gin.HandlerFunc {
 	})
 }
 
-// JWTMiddleware validates JWT tokens
+// JWTMiddleware validates JWT access tokens. The token's session must still
+// be signed in and its user active; the user is loaded into the context.
 func JWTMiddleware(cfg *config.Config) gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
@@ -60,22 +65,56 @@ func JWTMiddleware(cfg *config.Config) gin.HandlerFunc {
 			return
 		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			// Check token expiration
-			if exp, ok := claims["exp"].(float64); ok {
-				if time.Now().Unix() > int64(exp) {
-					c.JSON(http.StatusUnauthorized, gin.H{"error": "Token expired"})
-					c.Abort()
-					return
-				}
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.Abort()
+			return
+		}
+
+		// Check token expiration
+		if exp, ok := claims["exp"].(float64); ok {
+			if time.Now().Unix() > int64(exp) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token expired"})
+				c.Abort()
+				return
 			}
+		}
+
+		// The session must not have been signed out
+		sessionID, err := uuid.Parse(fmt.Sprint(claims["sid"]))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.Abort()
+			return
+		}
+		var session models.Session
+		if err := database.DB.Where("id = ? AND revoked_at IS NULL AND expires_at > ?", sessionID, time.Now()).
+			First(&session).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has ended"})
+			c.Abort()
+			return
+		}
 
-			// Set user information in context
-			c.Set("user_id", claims["user_id"])
-			c.Set("user_email", claims["email"])
-			c.Set("user_role", claims["role"])
+		var user models.User
+		if err := database.DB.First(&user, session.UserID).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			c.Abort()
+			return
+		}
+		if user.Status != "active" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account is not active"})
+			c.Abort()
+			return
 		}
 
+		// Set user information in context
+		c.Set("user", user)
+		c.Set("user_id", user.ID.String())
+		c.Set("user_email", user.Email)
+		c.Set("user_role", user.Role)
+		c.Set("session_id", session.ID)
+
 		c.Next()
 	})
 }
@@ -93,6 +132,63 @@ func AdminMiddleware() gin.HandlerFunc {
 	})
 }
 
+// VerifiedEmailMiddleware turns away users who have not verified their email
+// address while the require_email_verification system setting is on. It runs
+// after JWTMiddleware.
+func VerifiedEmailMiddleware() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		user, ok := CurrentUser(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			c.Abort()
+			return
+		}
+		if !user.EmailVerified && settingEnabled("require_email_verification") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Please verify your email address first"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	})
+}
+
+// CurrentUser returns the signed-in user. It uses the user JWTMiddleware
+// loaded when there is one, and otherwise loads it by the user_id claim.
+func CurrentUser(c *gin.Context) (models.User, bool) {
+	if user, exists := c.Get("user"); exists {
+		if userModel, ok := user.(models.User); ok {
+			return userModel, true
+		}
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		return models.User{}, false
+	}
+	id, err := uuid.Parse(fmt.Sprint(userID))
+	if err != nil {
+		return models.User{}, false
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, id).Error; err != nil {
+		return models.User{}, false
+	}
+	c.Set("user", user)
+	return user, true
+}
+
+// settingEnabled reports whether a boolean system setting is on. A setting
+// that has not been created is off.
+func settingEnabled(key string) bool {
+	var settings []models.SystemSettings
+	if err := database.DB.Where("key = ?", key).Limit(1).Find(&settings).Error; err != nil || len(settings) == 0 {
+		return false
+	}
+	enabled, _ := strconv.ParseBool(settings[0].Value)
+	return enabled
+}
+
 // LoggerMiddleware provides custom logging
 func LoggerMiddleware() gin.HandlerFunc {
 	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
@@ -5,9 +5,12 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
+	"strconv"
 	"strings"
 	"time"
 
+	"golf-ezz-backend/internal/money"
+
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
@@ -61,6 +64,52 @@ func (s StringArray) Value() (driver.Value, error) {
 	return "{" + strings.Join([]string(s), ",") + "}", nil
 }
 
+// IntArray is a custom type for PostgreSQL integer arrays
+type IntArray []int
+
+// Scan implements the Scanner interface for database deserialization
+func (a *IntArray) Scan(value interface{}) error {
+	if value == nil {
+		*a = IntArray{}
+		return nil
+	}
+
+	switch v := value.(type) {
+	case string:
+		// Handle PostgreSQL array format: {1,2,3}
+		v = strings.Trim(v, "{}")
+		if v == "" {
+			*a = IntArray{}
+			return nil
+		}
+
+		items := strings.Split(v, ",")
+		result := make([]int, len(items))
+		for i, item := range items {
+			n, err := strconv.Atoi(strings.TrimSpace(item))
+			if err != nil {
+				return err
+			}
+			result[i] = n
+		}
+		*a = IntArray(result)
+		return nil
+	case []byte:
+		return a.Scan(string(v))
+	default:
+		return errors.New("cannot scan non-string value into IntArray")
+	}
+}
+
+// Value implements the Valuer interface for database serialization
+func (a IntArray) Value() (driver.Value, error) {
+	items := make([]string, len(a))
+	for i, n := range a {
+		items[i] = strconv.Itoa(n)
+	}
+	return "{" + strings.Join(items, ",") + "}", nil
+}
+
 // Base contains common columns for all tables
 type Base struct {
 	ID        uuid.UUID      `json:"id" gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
@@ -72,21 +121,23 @@ type Base struct {
 // User represents a user in the system (both members and admins)
 type User struct {
 	Base
-	Email           string     `json:"email" gorm:"uniqueIndex;not null"`
-	Name            string     `json:"name" gorm:"not null"`
-	Password        string     `json:"-" gorm:"not null"` // Password field, hidden from JSON
-	Image           *string    `json:"image"`
-	Role            string     `json:"role" gorm:"not null;check:role IN ('member','admin','super_admin')"`
-	Status          string     `json:"status" gorm:"default:'active';check:status IN ('active','inactive','suspended')"`
-	EmailVerified   bool       `json:"email_verified" gorm:"default:false"`
-	EmailVerifiedAt *time.Time `json:"email_verified_at"`
-	Phone           *string    `json:"phone"`
-	Address         *string    `json:"address"`
-	DateOfBirth     *time.Time `json:"date_of_birth"`
+	Email              string     `json:"email" gorm:"uniqueIndex;not null"`
+	Name               string     `json:"name" gorm:"not null"`
+	Password           string     `json:"-" gorm:"not null"` // Password field, hidden from JSON
+	Image              *string    `json:"image"`
+	Role               string     `json:"role" gorm:"not null;check:role IN ('member','admin','super_admin')"`
+	Status             string     `json:"status" gorm:"default:'active';check:status IN ('active','inactive','suspended')"`
+	EmailVerified      bool       `json:"email_verified" gorm:"default:false"`
+	EmailVerifiedAt    *time.Time `json:"email_verified_at"`
+	VerificationSentAt *time.Time `json:"-"` // last verification email, for throttling resends
+	Phone              *string    `json:"phone"`
+	Address            *string    `json:"address"`
+	DateOfBirth        *time.Time `json:"date_of_birth"`
 
 	// Member-specific fields
-	MembershipID     *string         `json:"membership_id" gorm:"uniqueIndex"`
-	MembershipType   *string         `json:"membership_type"` // basic, premium, vip
+	MembershipID     *string         `json:"membership_id" gorm:"uniqueIndex"`    // membership number, assigned on first enrollment
+	MembershipPlanID *uuid.UUID      `json:"membership_plan_id" gorm:"type:uuid"` // plan version held; benefits come from it
+	MembershipType   *string         `json:"membership_type"`                     // name of the plan held, for display
 	MembershipExpiry *time.Time      `json:"membership_expiry"`
 	MembershipStatus *string         `json:"membership_status"` // active, expired, suspended
 	Handicap         *float64        `json:"handicap"`
@@ -102,10 +153,14 @@ type User struct {
 
 	// Authentication & Security
 	GoogleID            *string    `json:"google_id" gorm:"uniqueIndex"`
-	PasswordResetToken  *string    `json:"-"`
+	PasswordResetToken  *string    `json:"-" gorm:"index"` // SHA-256 of the emailed token
 	PasswordResetExpiry *time.Time `json:"-"`
 	TwoFactorEnabled    bool       `json:"two_factor_enabled" gorm:"default:false"`
-	TwoFactorSecret     *string    `json:"-"`
+	TwoFactorSecret     *string    `json:"-"`                                        // base32 TOTP secret; set before enrollment is confirmed
+	TwoFactorRequired   bool       `json:"two_factor_required" gorm:"default:false"` // set by an admin; the user must enroll to sign in
+	TwoFactorLastStep   int64      `json:"-"`                                        // TOTP time step last used, so a code works once
+	TwoFactorFailures   int        `json:"-"`                                        // wrong codes in a row
+	TwoFactorLockedAt   *time.Time `json:"-"`                                        // codes are refused for a while after too many failures
 
 	// Relationships
 	Bookings       []TeeTimeBooking `json:"bookings" gorm:"foreignKey:UserID"`
@@ -161,6 +216,29 @@ type NotificationSettings struct {
 	Push  bool `json:"push"`
 }
 
+// Session is a signed-in device. Access tokens name their session, so
+// revoking it signs the device out; the refresh token rotates on every use.
+type Session struct {
+	Base
+	UserID            uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	RefreshTokenHash  string     `json:"-" gorm:"not null;uniqueIndex"`
+	PreviousTokenHash *string    `json:"-" gorm:"index"` // the token rotated out; presenting it again revokes the session
+	ExpiresAt         time.Time  `json:"expires_at" gorm:"not null"`
+	LastUsedAt        time.Time  `json:"last_used_at"`
+	RevokedAt         *time.Time `json:"revoked_at"`
+	IPAddress         string     `json:"ip_address"`
+	UserAgent         string     `json:"user_agent"`
+}
+
+// RecoveryCode is a one-time code that stands in for a TOTP code when the
+// user's authenticator is unavailable. Only its hash is stored.
+type RecoveryCode struct {
+	Base
+	UserID   uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	CodeHash string     `json:"-" gorm:"not null"`
+	UsedAt   *time.Time `json:"used_at"`
+}
+
 // Course represents a golf course
 type Course struct {
 	Base
@@ -180,24 +258,30 @@ type Course struct {
 	HoleDetails []HoleDetail `json:"hole_details" gorm:"type:jsonb"`
 
 	// Pricing Management
-	GreenFeeWeekday float64 `json:"green_fee_weekday"`
-	GreenFeeWeekend float64 `json:"green_fee_weekend"`
-	GreenFeeHoliday float64 `json:"green_fee_holiday"`
-	CartFee         float64 `json:"cart_fee"`
-	ClubRentalFee   float64 `json:"club_rental_fee"`
-	RangeBallPrice  float64 `json:"range_ball_price"`
-	MemberDiscount  float64 `json:"member_discount"` // percentage
+	GreenFeeWeekday money.Amount `json:"green_fee_weekday"`
+	GreenFeeWeekend money.Amount `json:"green_fee_weekend"`
+	GreenFeeHoliday money.Amount `json:"green_fee_holiday"`
+	NineHoleWeekday money.Amount `json:"nine_hole_weekday"` // 0 = half the 18-hole fee
+	NineHoleWeekend money.Amount `json:"nine_hole_weekend"` // 0 = half the 18-hole fee
+	CartFee         money.Amount `json:"cart_fee"`
+	ClubRentalFee   money.Amount `json:"club_rental_fee"`
+	RangeBallPrice  money.Amount `json:"range_ball_price"`
+	MemberDiscount  float64      `json:"member_discount"` // percentage
+	TaxProfileID    *uuid.UUID   `json:"tax_profile_id" gorm:"type:uuid"`
+	TaxProfile      *TaxProfile  `json:"tax_profile,omitempty" gorm:"foreignKey:TaxProfileID"`
 
 	// Course Settings
 	IsActive           bool   `json:"is_active" gorm:"default:true"`
 	BookingAdvanceDays int    `json:"booking_advance_days" gorm:"default:14"`
 	MaxPlayersPerSlot  int    `json:"max_players_per_slot" gorm:"default:4"`
-	SlotDuration       int    `json:"slot_duration" gorm:"default:15"` // minutes
+	SlotDuration       int    `json:"slot_duration" gorm:"default:15"`       // minutes
+	NineHoleDuration   int    `json:"nine_hole_duration" gorm:"default:135"` // minutes to reach the turn
 	OpenTime           string `json:"open_time" gorm:"default:'06:00'"`
 	CloseTime          string `json:"close_time" gorm:"default:'19:00'"`
 
 	// Relationships
 	Conditions     []CourseCondition `json:"conditions" gorm:"foreignKey:CourseID"`
+	Closures       []CourseClosure   `json:"closures" gorm:"foreignKey:CourseID"`
 	Bookings       []TeeTimeBooking  `json:"bookings" gorm:"foreignKey:CourseID"`
 	RangeBookings  []RangeBooking    `json:"range_bookings" gorm:"foreignKey:CourseID"`
 	Reviews        []Review          `json:"reviews" gorm:"foreignKey:CourseID"`
@@ -240,39 +324,94 @@ type CourseCondition struct {
 	LastUpdated      time.Time `json:"last_updated"`
 }
 
+// CourseClosure represents a scheduled closure or maintenance blackout.
+// A closure without a time range covers the whole day, and a closure without
+// holes covers the whole course. Closures limited to a set of holes are
+// partial: the course stays bookable, optionally at a reduced price.
+type CourseClosure struct {
+	Base
+	CourseID        uuid.UUID  `json:"course_id" gorm:"type:uuid;not null;index"`
+	Course          Course     `json:"course" gorm:"foreignKey:CourseID"`
+	StartDate       time.Time  `json:"start_date" gorm:"not null"`
+	EndDate         time.Time  `json:"end_date" gorm:"not null"`
+	StartTime       *string    `json:"start_time"` // HH:MM, nil for full day
+	EndTime         *string    `json:"end_time"`   // HH:MM, nil for full day
+	Holes           IntArray   `json:"holes" gorm:"type:integer[]"`
+	ClosureType     string     `json:"closure_type" gorm:"default:'maintenance'"` // maintenance, aeration, event, weather, repair
+	Reason          string     `json:"reason" gorm:"not null"`
+	PriceAdjustment float64    `json:"price_adjustment" gorm:"default:0"` // percentage off for partial closures
+	CreatedBy       *uuid.UUID `json:"created_by" gorm:"type:uuid"`
+}
+
+// TaxProfile is the sales tax setup of a jurisdiction, shared by the courses
+// in it. Inclusive profiles treat prices as already containing the tax;
+// exclusive ones add it on top.
+type TaxProfile struct {
+	Base
+	Name         string    `json:"name" gorm:"not null"`
+	Jurisdiction string    `json:"jurisdiction"`
+	Inclusive    bool      `json:"inclusive" gorm:"not null"`
+	Rates        []TaxRate `json:"rates" gorm:"foreignKey:TaxProfileID"`
+}
+
+// TaxRate is one tax a profile levies on an item category, e.g. state sales
+// tax on merchandise. A category may carry several rates.
+type TaxRate struct {
+	Base
+	TaxProfileID uuid.UUID `json:"tax_profile_id" gorm:"type:uuid;not null;index"`
+	Category     string    `json:"category" gorm:"not null"` // green_fee, range, cart, rental, merchandise, membership
+	Name         string    `json:"name" gorm:"not null"`     // as printed on receipts
+	Rate         float64   `json:"rate" gorm:"not null"`     // percentage
+}
+
 // TeeTimeBooking represents a tee time booking
 type TeeTimeBooking struct {
 	Base
-	CourseID        uuid.UUID  `json:"course_id" gorm:"type:uuid;not null"`
-	Course          Course     `json:"course" gorm:"foreignKey:CourseID"`
-	UserID          uuid.UUID  `json:"user_id" gorm:"type:uuid;not null"`
-	User            User       `json:"user" gorm:"foreignKey:UserID"`
-	Date            time.Time  `json:"date" gorm:"not null"`
-	Time            string     `json:"time" gorm:"not null"`
-	Players         int        `json:"players" gorm:"not null"`
-	Status          string     `json:"status" gorm:"default:'pending'"`
-	TotalAmount     float64    `json:"total_amount"`
-	PaymentStatus   string     `json:"payment_status" gorm:"default:'pending'"`
-	SpecialRequests *string    `json:"special_requests"`
-	CheckedIn       bool       `json:"checked_in" gorm:"default:false"`
-	CheckInTime     *time.Time `json:"check_in_time"`
+	CourseID        uuid.UUID    `json:"course_id" gorm:"type:uuid;not null"`
+	Course          Course       `json:"course" gorm:"foreignKey:CourseID"`
+	UserID          uuid.UUID    `json:"user_id" gorm:"type:uuid;not null"`
+	User            User         `json:"user" gorm:"foreignKey:UserID"`
+	Date            time.Time    `json:"date" gorm:"not null"`
+	Time            string       `json:"time" gorm:"not null"`
+	Players         int          `json:"players" gorm:"not null"`
+	Holes           int          `json:"holes" gorm:"default:18"`       // 9 or 18
+	StartingTee     int          `json:"starting_tee" gorm:"default:1"` // 1 or 10
+	Status          string       `json:"status" gorm:"default:'pending'"`
+	TotalAmount     money.Amount `json:"total_amount"`
+	PriceLines      InvoiceLines `json:"price_lines" gorm:"type:jsonb"` // priced items, discounts as negative lines
+	PromoCode       *string      `json:"promo_code"`
+	DiscountAmount  money.Amount `json:"discount_amount" gorm:"default:0"`
+	TaxLines        InvoiceLines `json:"tax_lines" gorm:"type:jsonb"` // one line per tax rate
+	TaxAmount       money.Amount `json:"tax_amount" gorm:"default:0"`
+	TaxInclusive    bool         `json:"tax_inclusive" gorm:"default:false"` // TaxAmount is already in PriceLines
+	PaymentStatus   string       `json:"payment_status" gorm:"default:'pending'"`
+	SpecialRequests *string      `json:"special_requests"`
+	CheckedIn       bool         `json:"checked_in" gorm:"default:false"`
+	CheckInTime     *time.Time   `json:"check_in_time"`
 }
 
 // RangeBooking represents a driving range booking
 type RangeBooking struct {
 	Base
-	UserID      uuid.UUID `json:"user_id" gorm:"type:uuid;not null"`
-	User        User      `json:"user" gorm:"foreignKey:UserID"`
-	CourseID    uuid.UUID `json:"course_id" gorm:"type:uuid;not null"`
-	Course      Course    `json:"course" gorm:"foreignKey:CourseID"`
-	Date        time.Time `json:"date" gorm:"not null"`
-	StartTime   string    `json:"start_time" gorm:"not null"`
-	Duration    int       `json:"duration"`    // in minutes
-	BucketSize  string    `json:"bucket_size"` // small, medium, large
-	BucketCount int       `json:"bucket_count"`
-	TotalAmount float64   `json:"total_amount"`
-	Status      string    `json:"status" gorm:"default:'active'"`
-	UsedBuckets int       `json:"used_buckets" gorm:"default:0"`
+	UserID         uuid.UUID    `json:"user_id" gorm:"type:uuid;not null"`
+	User           User         `json:"user" gorm:"foreignKey:UserID"`
+	CourseID       uuid.UUID    `json:"course_id" gorm:"type:uuid;not null"`
+	Course         Course       `json:"course" gorm:"foreignKey:CourseID"`
+	Date           time.Time    `json:"date" gorm:"not null"`
+	StartTime      string       `json:"start_time" gorm:"not null"`
+	Duration       int          `json:"duration"`    // in minutes
+	BucketSize     string       `json:"bucket_size"` // small, medium, large
+	BucketCount    int          `json:"bucket_count"`
+	TotalAmount    money.Amount `json:"total_amount"`
+	PriceLines     InvoiceLines `json:"price_lines" gorm:"type:jsonb"` // priced items, discounts as negative lines
+	PromoCode      *string      `json:"promo_code"`
+	DiscountAmount money.Amount `json:"discount_amount" gorm:"default:0"`
+	TaxLines       InvoiceLines `json:"tax_lines" gorm:"type:jsonb"` // one line per tax rate
+	TaxAmount      money.Amount `json:"tax_amount" gorm:"default:0"`
+	TaxInclusive   bool         `json:"tax_inclusive" gorm:"default:false"` // TaxAmount is already in PriceLines
+	PaymentStatus  string       `json:"payment_status" gorm:"default:'pending'"`
+	Status         string       `json:"status" gorm:"default:'active'"`
+	UsedBuckets    int          `json:"used_buckets" gorm:"default:0"`
 }
 
 // Payment represents a payment transaction
@@ -284,12 +423,352 @@ type Payment struct {
 	Booking        *TeeTimeBooking `json:"booking" gorm:"foreignKey:BookingID"`
 	RangeBookingID *uuid.UUID      `json:"range_booking_id" gorm:"type:uuid"`
 	RangeBooking   *RangeBooking   `json:"range_booking" gorm:"foreignKey:RangeBookingID"`
-	Amount         float64         `json:"amount" gorm:"not null"`
+	SubscriptionID *uuid.UUID      `json:"subscription_id" gorm:"type:uuid;index"`
+	SaleID         *uuid.UUID      `json:"sale_id" gorm:"type:uuid;index"`
+	Amount         money.Amount    `json:"amount" gorm:"not null"`
 	Currency       string          `json:"currency" gorm:"default:'USD'"`
-	Status         string          `json:"status" gorm:"default:'pending'"`
+	Status         string          `json:"status" gorm:"default:'pending'"` // pending, authorized, completed, failed, voided, partially_refunded, refunded, disputed
 	PaymentMethod  string          `json:"payment_method"`
+	Provider       string          `json:"provider"`
 	TransactionID  *string         `json:"transaction_id"`
+	FailureReason  *string         `json:"failure_reason"`
 	ProcessedAt    *time.Time      `json:"processed_at"`
+	RefundedAmount money.Amount    `json:"refunded_amount" gorm:"default:0"`
+	Fee            money.Amount    `json:"fee" gorm:"default:0"` // kept by the provider
+	Refunds        []Refund        `json:"refunds" gorm:"foreignKey:PaymentID"`
+}
+
+// Refund represents money returned against a completed payment
+type Refund struct {
+	Base
+	PaymentID     uuid.UUID    `json:"payment_id" gorm:"type:uuid;not null;index"`
+	Payment       *Payment     `json:"payment,omitempty" gorm:"foreignKey:PaymentID"`
+	Amount        money.Amount `json:"amount" gorm:"not null"`
+	Currency      string       `json:"currency" gorm:"default:'USD'"`
+	ReasonCode    string       `json:"reason_code" gorm:"not null"` // customer_request, cancellation_policy, course_cancelled, weather, duplicate, service_issue, other
+	Notes         *string      `json:"notes"`
+	Status        string       `json:"status" gorm:"default:'pending'"` // pending, completed, failed
+	TransactionID *string      `json:"transaction_id"`
+	IssuedBy      *uuid.UUID   `json:"issued_by" gorm:"type:uuid"` // nil for automatic refunds
+	Issuer        *User        `json:"issuer,omitempty" gorm:"foreignKey:IssuedBy"`
+	ProcessedAt   *time.Time   `json:"processed_at"`
+}
+
+// Invoice is the numbered receipt issued for a completed payment. Numbers are
+// gap-free per course: voided invoices keep their number, and a replacement
+// takes the next one. Course and customer details are snapshotted at issue.
+type Invoice struct {
+	Base
+	CourseID      uuid.UUID    `json:"course_id" gorm:"type:uuid;not null;uniqueIndex:idx_invoice_course_number"` // uuid.Nil when not tied to a course
+	Number        int          `json:"number" gorm:"not null;uniqueIndex:idx_invoice_course_number"`
+	InvoiceNumber string       `json:"invoice_number" gorm:"not null"`
+	PaymentID     uuid.UUID    `json:"payment_id" gorm:"type:uuid;not null;index"`
+	Payment       *Payment     `json:"payment,omitempty" gorm:"foreignKey:PaymentID"`
+	UserID        uuid.UUID    `json:"user_id" gorm:"type:uuid;not null"`
+	Status        string       `json:"status" gorm:"default:'issued'"` // issued, void
+	CourseName    string       `json:"course_name"`
+	CourseAddress string       `json:"course_address"`
+	CustomerName  string       `json:"customer_name"`
+	CustomerEmail string       `json:"customer_email"`
+	Lines         InvoiceLines `json:"lines" gorm:"type:jsonb"`
+	Subtotal      money.Amount `json:"subtotal"`
+	TaxLines      InvoiceLines `json:"tax_lines" gorm:"type:jsonb"`
+	Tax           money.Amount `json:"tax"`
+	TaxInclusive  bool         `json:"tax_inclusive" gorm:"default:false"` // Tax is already in Subtotal
+	Total         money.Amount `json:"total"`
+	Currency      string       `json:"currency" gorm:"default:'USD'"`
+	PaymentMethod string       `json:"payment_method"`
+	IssuedAt      time.Time    `json:"issued_at"`
+	Revision      int          `json:"revision" gorm:"default:1"`
+	RegeneratedAt *time.Time   `json:"regenerated_at"`
+	VoidedAt      *time.Time   `json:"voided_at"`
+	VoidedBy      *uuid.UUID   `json:"voided_by" gorm:"type:uuid"`
+	VoidReason    *string      `json:"void_reason"`
+	ReplacedByID  *uuid.UUID   `json:"replaced_by_id" gorm:"type:uuid"`
+}
+
+// InvoiceLine is a single line item on an invoice
+type InvoiceLine struct {
+	Description string       `json:"description"`
+	Category    string       `json:"category"` // green_fee, range, cart, rental, merchandise, discount, membership, tax
+	Quantity    int          `json:"quantity"`
+	UnitPrice   money.Amount `json:"unit_price"`
+	Amount      money.Amount `json:"amount"`
+}
+
+// InvoiceLines stores invoice line items in JSONB format
+type InvoiceLines []InvoiceLine
+
+// Scan implements the Scanner interface for database deserialization
+func (l *InvoiceLines) Scan(value interface{}) error {
+	if value == nil {
+		*l = InvoiceLines{}
+		return nil
+	}
+
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return errors.New("cannot scan non-string/[]byte value into InvoiceLines")
+	}
+
+	if len(bytes) == 0 {
+		*l = InvoiceLines{}
+		return nil
+	}
+
+	return json.Unmarshal(bytes, l)
+}
+
+// Value implements the Valuer interface for database serialization
+func (l InvoiceLines) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	return json.Marshal(l)
+}
+
+// InvoiceSequence holds the last invoice number issued for a course. The row
+// is locked while an invoice is issued so numbers are never skipped or reused.
+type InvoiceSequence struct {
+	CourseID   uuid.UUID `json:"course_id" gorm:"type:uuid;primaryKey"`
+	LastNumber int       `json:"last_number" gorm:"not null;default:0"`
+}
+
+// PaymentWebhookEvent stores every event received from a payment provider.
+// Events that cannot be applied yet (unknown type, unknown payment or arriving
+// out of order) stay pending so they can be replayed later.
+type PaymentWebhookEvent struct {
+	Base
+	Provider    string     `json:"provider" gorm:"not null;uniqueIndex:idx_webhook_provider_event"`
+	EventID     string     `json:"event_id" gorm:"not null;uniqueIndex:idx_webhook_provider_event"`
+	EventType   string     `json:"event_type" gorm:"not null"`
+	OccurredAt  time.Time  `json:"occurred_at"`
+	Payload     string     `json:"payload" gorm:"type:jsonb"`
+	Status      string     `json:"status" gorm:"default:'pending';index"` // pending, processed, ignored, failed
+	Attempts    int        `json:"attempts" gorm:"default:0"`
+	LastError   *string    `json:"last_error"`
+	PaymentID   *uuid.UUID `json:"payment_id" gorm:"type:uuid"`
+	ProcessedAt *time.Time `json:"processed_at"`
+}
+
+// GiftCard represents a stored-value card sold at the pro shop. Its balance
+// only changes through StoredValueTransaction entries.
+type GiftCard struct {
+	Base
+	Code           string       `json:"code" gorm:"uniqueIndex;not null"`
+	InitialBalance money.Amount `json:"initial_balance" gorm:"not null"`
+	Balance        money.Amount `json:"balance" gorm:"not null;default:0"`
+	Currency       string       `json:"currency" gorm:"default:'USD'"`
+	Status         string       `json:"status" gorm:"default:'active';index"` // active, depleted, expired, void
+	ExpiresAt      *time.Time   `json:"expires_at"`
+	PurchaserID    *uuid.UUID   `json:"purchaser_id" gorm:"type:uuid"`
+	RecipientName  *string      `json:"recipient_name"`
+	Notes          *string      `json:"notes"`
+	IssuedBy       *uuid.UUID   `json:"issued_by" gorm:"type:uuid"`
+}
+
+// Wallet is a member's stored-value balance
+type Wallet struct {
+	Base
+	UserID   uuid.UUID    `json:"user_id" gorm:"type:uuid;uniqueIndex;not null"`
+	User     *User        `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Balance  money.Amount `json:"balance" gorm:"not null;default:0"`
+	Currency string       `json:"currency" gorm:"default:'USD'"`
+}
+
+// StoredValueTransaction is one entry in the ledger of a gift card or wallet.
+// Amount is signed: credits are positive and debits negative.
+type StoredValueTransaction struct {
+	Base
+	GiftCardID   *uuid.UUID   `json:"gift_card_id" gorm:"type:uuid;index"`
+	WalletID     *uuid.UUID   `json:"wallet_id" gorm:"type:uuid;index"`
+	Type         string       `json:"type" gorm:"not null"` // issue, redeem, void, refund, transfer, adjustment, expire
+	Amount       money.Amount `json:"amount" gorm:"not null"`
+	BalanceAfter money.Amount `json:"balance_after" gorm:"not null"`
+	PaymentID    *uuid.UUID   `json:"payment_id" gorm:"type:uuid;index"`
+	RelatedID    *uuid.UUID   `json:"related_id" gorm:"type:uuid"` // the entry a void or refund reverses, or the other side of a transfer
+	Reason       *string      `json:"reason"`
+	PerformedBy  *uuid.UUID   `json:"performed_by" gorm:"type:uuid"` // admin for issuance and adjustments
+}
+
+// Coupon is a promo code that discounts tee time or range bookings. Zero
+// values for the limits mean "no restriction".
+type Coupon struct {
+	Base
+	Code             string       `json:"code" gorm:"uniqueIndex;not null"`
+	Description      string       `json:"description"`
+	DiscountType     string       `json:"discount_type" gorm:"not null"`     // percentage, fixed
+	DiscountPercent  float64      `json:"discount_percent" gorm:"default:0"` // percentage coupons
+	DiscountAmount   money.Amount `json:"discount_amount" gorm:"default:0"`  // fixed coupons
+	AppliesTo        string       `json:"applies_to" gorm:"default:'any'"`   // any, tee_time, range
+	CourseID         *uuid.UUID   `json:"course_id" gorm:"type:uuid"`
+	Course           *Course      `json:"course,omitempty" gorm:"foreignKey:CourseID"`
+	ValidFrom        *time.Time   `json:"valid_from"`
+	ValidUntil       *time.Time   `json:"valid_until"`
+	Weekdays         IntArray     `json:"weekdays" gorm:"type:integer[]"` // 0 = Sunday
+	StartTime        *string      `json:"start_time"`                     // HH:MM
+	EndTime          *string      `json:"end_time"`                       // HH:MM
+	MinPlayers       int          `json:"min_players" gorm:"default:0"`
+	MaxRedemptions   int          `json:"max_redemptions" gorm:"default:0"`
+	MaxPerUser       int          `json:"max_per_user" gorm:"default:0"`
+	FirstBookingOnly bool         `json:"first_booking_only" gorm:"default:false"`
+	UserID           *uuid.UUID   `json:"user_id" gorm:"type:uuid;index"` // only this customer may use it, e.g. a loyalty reward
+	IsActive         bool         `json:"is_active" gorm:"not null"`
+	CreatedBy        *uuid.UUID   `json:"created_by" gorm:"type:uuid"`
+}
+
+// CouponRedemption records a coupon applied to a booking
+type CouponRedemption struct {
+	Base
+	CouponID       uuid.UUID    `json:"coupon_id" gorm:"type:uuid;not null;index"`
+	Coupon         *Coupon      `json:"coupon,omitempty" gorm:"foreignKey:CouponID"`
+	UserID         uuid.UUID    `json:"user_id" gorm:"type:uuid;not null;index"`
+	BookingID      *uuid.UUID   `json:"booking_id" gorm:"type:uuid;index"`
+	RangeBookingID *uuid.UUID   `json:"range_booking_id" gorm:"type:uuid;index"`
+	GrossAmount    money.Amount `json:"gross_amount"` // booking price before the discount
+	DiscountAmount money.Amount `json:"discount_amount"`
+	Status         string       `json:"status" gorm:"default:'applied'"` // applied, released
+	ReleasedAt     *time.Time   `json:"released_at"`
+}
+
+// JournalEntry is one posting to the double-entry ledger. The debits of its
+// lines always equal the credits. Entries are append-only; a mistake is
+// corrected by posting a reversing entry.
+type JournalEntry struct {
+	Base
+	Type                     string        `json:"type" gorm:"not null;index"` // charge, cancellation, payment, refund, stored_value, adjustment, reversal
+	Description              string        `json:"description"`
+	PostedAt                 time.Time     `json:"posted_at" gorm:"not null;index"`
+	CourseID                 *uuid.UUID    `json:"course_id" gorm:"type:uuid;index"`
+	UserID                   *uuid.UUID    `json:"user_id" gorm:"type:uuid"`
+	BookingID                *uuid.UUID    `json:"booking_id" gorm:"type:uuid;index"`
+	RangeBookingID           *uuid.UUID    `json:"range_booking_id" gorm:"type:uuid;index"`
+	PaymentID                *uuid.UUID    `json:"payment_id" gorm:"type:uuid;index"`
+	RefundID                 *uuid.UUID    `json:"refund_id" gorm:"type:uuid;index"`
+	StoredValueTransactionID *uuid.UUID    `json:"stored_value_transaction_id" gorm:"type:uuid;index"`
+	SaleID                   *uuid.UUID    `json:"sale_id" gorm:"type:uuid;index"`
+	DayCloseID               *uuid.UUID    `json:"day_close_id" gorm:"type:uuid;index"` // the closed day an adjustment corrects
+	ReversalOfID             *uuid.UUID    `json:"reversal_of_id" gorm:"type:uuid"`
+	PostedBy                 *uuid.UUID    `json:"posted_by" gorm:"type:uuid"`
+	Lines                    []JournalLine `json:"lines" gorm:"foreignKey:EntryID"`
+}
+
+// JournalLine debits or credits one ledger account. The entry's course and
+// posting time are copied on so reports need not join the entry.
+type JournalLine struct {
+	Base
+	EntryID  uuid.UUID    `json:"entry_id" gorm:"type:uuid;not null;index"`
+	Account  string       `json:"account" gorm:"not null;index"`
+	CourseID *uuid.UUID   `json:"course_id" gorm:"type:uuid;index"`
+	PostedAt time.Time    `json:"posted_at" gorm:"not null;index"`
+	Debit    money.Amount `json:"debit" gorm:"not null;default:0"`
+	Credit   money.Amount `json:"credit" gorm:"not null;default:0"`
+}
+
+// errAppendOnly is returned when posted ledger records are changed
+var errAppendOnly = errors.New("ledger is append-only; post a reversing entry instead")
+
+// BeforeUpdate keeps posted entries immutable
+func (JournalEntry) BeforeUpdate(*gorm.DB) error { return errAppendOnly }
+
+// BeforeDelete keeps posted entries immutable
+func (JournalEntry) BeforeDelete(*gorm.DB) error { return errAppendOnly }
+
+// BeforeUpdate keeps posted lines immutable
+func (JournalLine) BeforeUpdate(*gorm.DB) error { return errAppendOnly }
+
+// BeforeDelete keeps posted lines immutable
+func (JournalLine) BeforeDelete(*gorm.DB) error { return errAppendOnly }
+
+// DayClose is a course's end-of-day reconciliation: the cash and card totals
+// the ledger expects against what staff counted. Locking the day freezes the
+// expected totals and variances; later corrections are posted as adjustments.
+type DayClose struct {
+	Base
+	CourseID     uuid.UUID     `json:"course_id" gorm:"type:uuid;not null;uniqueIndex:idx_day_close_course_date"`
+	Date         time.Time     `json:"date" gorm:"not null;uniqueIndex:idx_day_close_course_date"`
+	Status       string        `json:"status" gorm:"default:'open'"` // open, locked
+	CountedCash  *money.Amount `json:"counted_cash"`
+	CountedCard  *money.Amount `json:"counted_card"`  // card terminal batch total
+	ExpectedCash money.Amount  `json:"expected_cash"` // frozen when the day is locked
+	ExpectedCard money.Amount  `json:"expected_card"`
+	CashVariance money.Amount  `json:"cash_variance"` // counted minus expected
+	CardVariance money.Amount  `json:"card_variance"`
+	Notes        *string       `json:"notes"`
+	CountedBy    *uuid.UUID    `json:"counted_by" gorm:"type:uuid"`
+	LockedAt     *time.Time    `json:"locked_at"`
+	LockedBy     *uuid.UUID    `json:"locked_by" gorm:"type:uuid"`
+}
+
+// LoyaltyRule sets how many points an activity earns. Activities are
+// completed tee times, completed range sessions and pro shop purchases.
+type LoyaltyRule struct {
+	Base
+	Activity      string  `json:"activity" gorm:"uniqueIndex;not null"` // tee_time, range, purchase
+	PointsPerUnit float64 `json:"points_per_unit"`                      // per whole currency unit paid
+	BonusPoints   int     `json:"bonus_points" gorm:"default:0"`        // flat points per activity
+	IsActive      bool    `json:"is_active" gorm:"default:true"`
+}
+
+// LoyaltyTier is a level a member reaches by the points they earned recently.
+// Points earned are multiplied by the member's tier multiplier.
+type LoyaltyTier struct {
+	Base
+	Name       string  `json:"name" gorm:"uniqueIndex;not null"`
+	MinPoints  int     `json:"min_points" gorm:"not null;default:0"`
+	Multiplier float64 `json:"multiplier" gorm:"not null;default:1"`
+}
+
+// LoyaltyReward is something points can be exchanged for. Redeeming one
+// issues the member a single-use promo code worth Value off a booking, e.g. a
+// free bucket of range balls.
+type LoyaltyReward struct {
+	Base
+	Name        string       `json:"name" gorm:"not null"`
+	Description string       `json:"description"`
+	Points      int          `json:"points" gorm:"not null"`
+	Value       money.Amount `json:"value" gorm:"not null"`
+	AppliesTo   string       `json:"applies_to" gorm:"default:'any'"` // any, tee_time, range
+	ValidDays   int          `json:"valid_days" gorm:"default:90"`    // how long the issued code lasts
+	IsActive    bool         `json:"is_active" gorm:"default:true"`
+}
+
+// PointsAccount holds a member's loyalty points. Balance always equals the
+// sum of PointsTransaction entries.
+type PointsAccount struct {
+	Base
+	UserID  uuid.UUID `json:"user_id" gorm:"type:uuid;uniqueIndex;not null"`
+	User    *User     `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Balance int       `json:"balance" gorm:"not null;default:0"`
+	Tier    *string   `json:"tier"`
+}
+
+// PointsTransaction is one entry in a member's points ledger. Points is
+// signed: earnings are positive and spending negative. Entries that add
+// points are spent oldest first; Remaining is what is left of them to spend
+// or expire.
+type PointsTransaction struct {
+	Base
+	AccountID      uuid.UUID  `json:"account_id" gorm:"type:uuid;not null;index"`
+	Type           string     `json:"type" gorm:"not null"` // earn, redeem, refund, reward, reverse, adjustment, expire
+	Points         int        `json:"points" gorm:"not null"`
+	BalanceAfter   int        `json:"balance_after" gorm:"not null"`
+	Remaining      int        `json:"-" gorm:"not null;default:0"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	BookingID      *uuid.UUID `json:"booking_id" gorm:"type:uuid;index"`
+	RangeBookingID *uuid.UUID `json:"range_booking_id" gorm:"type:uuid;index"`
+	SaleID         *uuid.UUID `json:"sale_id" gorm:"type:uuid;index"`
+	PaymentID      *uuid.UUID `json:"payment_id" gorm:"type:uuid;index"`
+	RewardID       *uuid.UUID `json:"reward_id" gorm:"type:uuid"`
+	CouponID       *uuid.UUID `json:"coupon_id" gorm:"type:uuid"`
+	RelatedID      *uuid.UUID `json:"related_id" gorm:"type:uuid"` // the redemption a refund returns
+	Description    string     `json:"description"`
+	PerformedBy    *uuid.UUID `json:"performed_by" gorm:"type:uuid"` // admin for adjustments
 }
 
 // Review represents a course review
@@ -320,72 +799,109 @@ type Notification struct {
 // InventoryItem represents range inventory
 type InventoryItem struct {
 	Base
-	CourseID    uuid.UUID `json:"course_id" gorm:"type:uuid;not null"`
-	Course      Course    `json:"course" gorm:"foreignKey:CourseID"`
-	ItemType    string    `json:"item_type" gorm:"not null"` // golf_balls, clubs, etc.
-	Name        string    `json:"name" gorm:"not null"`
-	Description *string   `json:"description"`
-	Quantity    int       `json:"quantity" gorm:"not null"`
-	MinQuantity int       `json:"min_quantity" gorm:"default:0"`
-	UnitPrice   float64   `json:"unit_price"`
-	IsActive    bool      `json:"is_active" gorm:"default:true"`
+	CourseID    uuid.UUID    `json:"course_id" gorm:"type:uuid;not null"`
+	Course      Course       `json:"course" gorm:"foreignKey:CourseID"`
+	ItemType    string       `json:"item_type" gorm:"not null"` // golf_balls, clubs, etc.
+	Name        string       `json:"name" gorm:"not null"`
+	Description *string      `json:"description"`
+	Quantity    int          `json:"quantity" gorm:"not null"`
+	MinQuantity int          `json:"min_quantity" gorm:"default:0"`
+	UnitPrice   money.Amount `json:"unit_price"`
+	IsActive    bool         `json:"is_active" gorm:"default:true"`
+}
+
+// Sale is a pro shop sale rung up by staff. It may be for a member, and may be
+// attached to the tee time booking it was bought for; walk-in sales have no
+// member. Stock is taken when the sale is made.
+type Sale struct {
+	Base
+	CourseID      uuid.UUID       `json:"course_id" gorm:"type:uuid;not null;index"`
+	Course        *Course         `json:"course,omitempty" gorm:"foreignKey:CourseID"`
+	UserID        *uuid.UUID      `json:"user_id" gorm:"type:uuid;index"`
+	User          *User           `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	BookingID     *uuid.UUID      `json:"booking_id" gorm:"type:uuid;index"`
+	Booking       *TeeTimeBooking `json:"booking,omitempty" gorm:"foreignKey:BookingID"`
+	StaffID       uuid.UUID       `json:"staff_id" gorm:"type:uuid;not null"`
+	Status        string          `json:"status" gorm:"default:'completed'"` // completed, partially_returned, returned, voided
+	Items         []SaleItem      `json:"items" gorm:"foreignKey:SaleID"`
+	Subtotal      money.Amount    `json:"subtotal"`
+	TaxLines      InvoiceLines    `json:"tax_lines" gorm:"type:jsonb"` // one line per tax rate
+	TaxAmount     money.Amount    `json:"tax_amount" gorm:"default:0"`
+	TaxInclusive  bool            `json:"tax_inclusive" gorm:"default:false"` // TaxAmount is already in Subtotal
+	TotalAmount   money.Amount    `json:"total_amount"`
+	PaymentStatus string          `json:"payment_status" gorm:"default:'pending'"`
+	VoidedAt      *time.Time      `json:"voided_at"`
+	VoidedBy      *uuid.UUID      `json:"voided_by" gorm:"type:uuid"`
+	VoidReason    *string         `json:"void_reason"`
+}
+
+// SaleItem is one line of a pro shop sale, priced when it was sold
+type SaleItem struct {
+	Base
+	SaleID           uuid.UUID    `json:"sale_id" gorm:"type:uuid;not null;index"`
+	InventoryItemID  uuid.UUID    `json:"inventory_item_id" gorm:"type:uuid;not null;index"`
+	Name             string       `json:"name" gorm:"not null"`
+	Quantity         int          `json:"quantity" gorm:"not null"`
+	ReturnedQuantity int          `json:"returned_quantity" gorm:"default:0"`
+	UnitPrice        money.Amount `json:"unit_price"`
+	Amount           money.Amount `json:"amount"`
 }
 
 // Analytics represents course analytics data
 type Analytics struct {
 	Base
-	CourseID        uuid.UUID   `json:"course_id" gorm:"type:uuid;not null"`
-	Course          Course      `json:"course" gorm:"foreignKey:CourseID"`
-	Date            time.Time   `json:"date" gorm:"not null"`
-	BookingsCount   int         `json:"bookings_count"`
-	Revenue         float64     `json:"revenue"`
-	UtilizationRate float64     `json:"utilization_rate"`
-	AverageRating   float64     `json:"average_rating"`
-	MemberGrowth    int         `json:"member_growth"`
-	PopularTimes    StringArray `json:"popular_times" gorm:"type:text[]"`
+	CourseID        uuid.UUID    `json:"course_id" gorm:"type:uuid;not null"`
+	Course          Course       `json:"course" gorm:"foreignKey:CourseID"`
+	Date            time.Time    `json:"date" gorm:"not null"`
+	BookingsCount   int          `json:"bookings_count"`
+	Revenue         money.Amount `json:"revenue"`
+	UtilizationRate float64      `json:"utilization_rate"`
+	AverageRating   float64      `json:"average_rating"`
+	MemberGrowth    int          `json:"member_growth"`
+	PopularTimes    StringArray  `json:"popular_times" gorm:"type:text[]"`
 }
 
 // TeeTimeSlot represents available tee time slots for a course
 type TeeTimeSlot struct {
 	Base
-	CourseID       uuid.UUID `json:"course_id" gorm:"type:uuid;not null"`
-	Course         Course    `json:"course" gorm:"foreignKey:CourseID"`
-	Date           time.Time `json:"date" gorm:"not null"`
-	StartTime      string    `json:"start_time" gorm:"not null"`
-	EndTime        string    `json:"end_time" gorm:"not null"`
-	MaxPlayers     int       `json:"max_players" gorm:"default:4"`
-	AvailableSlots int       `json:"available_slots" gorm:"default:1"`
-	Price          float64   `json:"price"`
-	IsAvailable    bool      `json:"is_available" gorm:"default:true"`
-	SlotType       string    `json:"slot_type" gorm:"default:'regular'"` // regular, premium, tournament
+	CourseID       uuid.UUID    `json:"course_id" gorm:"type:uuid;not null"`
+	Course         Course       `json:"course" gorm:"foreignKey:CourseID"`
+	Date           time.Time    `json:"date" gorm:"not null"`
+	StartTime      string       `json:"start_time" gorm:"not null"`
+	EndTime        string       `json:"end_time" gorm:"not null"`
+	MaxPlayers     int          `json:"max_players" gorm:"default:4"`
+	AvailableSlots int          `json:"available_slots" gorm:"default:1"`
+	Price          money.Amount `json:"price"`
+	IsAvailable    bool         `json:"is_available" gorm:"default:true"`
+	SlotType       string       `json:"slot_type" gorm:"default:'regular'"` // regular, premium, tournament
 }
 
 // CoursePricing represents dynamic pricing for courses
 type CoursePricing struct {
 	Base
-	CourseID      uuid.UUID  `json:"course_id" gorm:"type:uuid;not null"`
-	Course        Course     `json:"course" gorm:"foreignKey:CourseID"`
-	PricingType   string     `json:"pricing_type" gorm:"not null"` // weekday, weekend, holiday, peak, off_peak
-	StartDate     *time.Time `json:"start_date"`
-	EndDate       *time.Time `json:"end_date"`
-	TimeSlotStart string     `json:"time_slot_start"`
-	TimeSlotEnd   string     `json:"time_slot_end"`
-	BasePrice     float64    `json:"base_price"`
-	MemberPrice   float64    `json:"member_price"`
-	IsActive      bool       `json:"is_active" gorm:"default:true"`
+	CourseID      uuid.UUID    `json:"course_id" gorm:"type:uuid;not null"`
+	Course        Course       `json:"course" gorm:"foreignKey:CourseID"`
+	PricingType   string       `json:"pricing_type" gorm:"not null"` // weekday, weekend, holiday, peak, off_peak
+	StartDate     *time.Time   `json:"start_date"`
+	EndDate       *time.Time   `json:"end_date"`
+	TimeSlotStart string       `json:"time_slot_start"`
+	TimeSlotEnd   string       `json:"time_slot_end"`
+	BasePrice     money.Amount `json:"base_price"`
+	MemberPrice   money.Amount `json:"member_price"`
+	IsActive      bool         `json:"is_active" gorm:"default:true"`
 }
 
 // RangePricing represents driving range pricing
 type RangePricing struct {
 	Base
-	CourseID    uuid.UUID `json:"course_id" gorm:"type:uuid;not null"`
-	Course      Course    `json:"course" gorm:"foreignKey:CourseID"`
-	BucketSize  string    `json:"bucket_size" gorm:"not null"` // small, medium, large, jumbo
-	BallCount   int       `json:"ball_count"`
-	Price       float64   `json:"price"`
-	MemberPrice float64   `json:"member_price"`
-	Duration    int       `json:"duration"` // minutes allowed per bucket
-	IsActive    bool      `json:"is_active" gorm:"default:true"`
+	CourseID    uuid.UUID    `json:"course_id" gorm:"type:uuid;not null"`
+	Course      Course       `json:"course" gorm:"foreignKey:CourseID"`
+	BucketSize  string       `json:"bucket_size" gorm:"not null"` // small, medium, large, jumbo
+	BallCount   int          `json:"ball_count"`
+	Price       money.Amount `json:"price"`
+	MemberPrice money.Amount `json:"member_price"`
+	Duration    int          `json:"duration"` // minutes allowed per bucket
+	IsActive    bool         `json:"is_active" gorm:"default:true"`
 }
 
 // AdminActivity represents admin activity logs
@@ -415,18 +931,105 @@ type SystemSettings struct {
 	Admin       *User      `json:"admin" gorm:"foreignKey:UpdatedBy"`
 }
 
-// MembershipPlan represents membership plans available
+// MembershipPlan represents membership plans available. Plans are versioned:
+// editing a plan creates a new version and closes the old one to sign-ups, so
+// subscribers keep the terms they signed up for until they next renew.
 type MembershipPlan struct {
 	Base
-	Name             string      `json:"name" gorm:"not null"`
-	Description      string      `json:"description"`
-	Price            float64     `json:"price"`
-	BillingCycle     string      `json:"billing_cycle" gorm:"default:'monthly'"` // monthly, yearly
-	Features         StringArray `json:"features" gorm:"type:text[]"`
-	BookingAdvantage int         `json:"booking_advantage"` // days in advance
-	DiscountPercent  float64     `json:"discount_percent"`
-	MaxBookingsMonth int         `json:"max_bookings_month" gorm:"default:0"` // 0 = unlimited
-	IncludesRange    bool        `json:"includes_range" gorm:"default:false"`
-	IncludesCart     bool        `json:"includes_cart" gorm:"default:false"`
-	IsActive         bool        `json:"is_active" gorm:"default:true"`
+	Version           int          `json:"version" gorm:"not null;default:1"`
+	PreviousVersionID *uuid.UUID   `json:"previous_version_id" gorm:"type:uuid"`
+	SupersededByID    *uuid.UUID   `json:"superseded_by_id" gorm:"type:uuid;index"` // set on every version but the latest
+	Name              string       `json:"name" gorm:"not null"`
+	Description       string       `json:"description"`
+	Price             money.Amount `json:"price"`
+	BillingCycle      string       `json:"billing_cycle" gorm:"default:'monthly'"` // monthly, yearly
+	Features          StringArray  `json:"features" gorm:"type:text[]"`
+	BookingAdvantage  int          `json:"booking_advantage"` // days in advance
+	DiscountPercent   float64      `json:"discount_percent"`
+	MaxBookingsMonth  int          `json:"max_bookings_month" gorm:"default:0"` // 0 = unlimited
+	IncludesRange     bool         `json:"includes_range" gorm:"default:false"`
+	IncludesCart      bool         `json:"includes_cart" gorm:"default:false"`
+	HouseholdBenefits bool         `json:"household_benefits" gorm:"default:false"` // benefits extend to the holder's household
+	QuotaScope        string       `json:"quota_scope" gorm:"default:'person'"`     // person, household: who shares MaxBookingsMonth
+	IsActive          bool         `json:"is_active" gorm:"default:true"`           // open for sign-up
+	ArchivedAt        *time.Time   `json:"archived_at"`
+}
+
+// Household groups family members who share one membership. Each member keeps
+// their own login, handicap and bookings; the primary member holds the
+// membership and pays for the household.
+type Household struct {
+	Base
+	Name          string            `json:"name" gorm:"not null"`
+	PrimaryUserID uuid.UUID         `json:"primary_user_id" gorm:"type:uuid;not null;uniqueIndex"`
+	Members       []HouseholdMember `json:"members,omitempty" gorm:"foreignKey:HouseholdID"`
+}
+
+// HouseholdMember places a user in a household. The booking permissions let
+// the primary member decide what each dependent may book.
+type HouseholdMember struct {
+	Base
+	HouseholdID     uuid.UUID `json:"household_id" gorm:"type:uuid;not null;index"`
+	UserID          uuid.UUID `json:"user_id" gorm:"type:uuid;not null;uniqueIndex"` // a user belongs to one household
+	User            *User     `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Relationship    string    `json:"relationship" gorm:"not null"` // primary, partner, dependent, junior
+	CanBookTeeTimes bool      `json:"can_book_tee_times" gorm:"default:true"`
+	CanBookRange    bool      `json:"can_book_range" gorm:"default:true"`
+}
+
+// MembershipSubscription bills a member for a MembershipPlan on its billing
+// cycle. PlanID is the plan version the member holds. Price and BillingCycle
+// are copied from it when the member signs up or changes plan; a newer version
+// of the plan only takes effect when the subscription renews.
+type MembershipSubscription struct {
+	Base
+	UserID             uuid.UUID    `json:"user_id" gorm:"type:uuid;not null;index"`
+	User               *User        `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	PlanID             uuid.UUID    `json:"plan_id" gorm:"type:uuid;not null"`
+	Status             string       `json:"status" gorm:"default:'incomplete';index"` // incomplete, active, past_due, suspended, cancelled, expired
+	Price              money.Amount `json:"price" gorm:"not null"`
+	Currency           string       `json:"currency" gorm:"default:'USD'"`
+	BillingCycle       string       `json:"billing_cycle" gorm:"not null"`  // monthly, yearly
+	PaymentMethod      string       `json:"payment_method" gorm:"not null"` // card, wallet
+	Source             string       `json:"-"`                              // reusable card token
+	CurrentPeriodStart time.Time    `json:"current_period_start"`
+	CurrentPeriodEnd   time.Time    `json:"current_period_end"`
+	NextBillingAt      time.Time    `json:"next_billing_at" gorm:"index"`
+	CreditBalance      money.Amount `json:"credit_balance" gorm:"default:0"` // proration credit taken off the next charges
+	FailedAttempts     int          `json:"failed_attempts" gorm:"default:0"`
+	NextRetryAt        *time.Time   `json:"next_retry_at"`
+	LastFailure        *string      `json:"last_failure"`
+	LastPaymentID      *uuid.UUID   `json:"last_payment_id" gorm:"type:uuid"`
+	CancelAtPeriodEnd  bool         `json:"cancel_at_period_end" gorm:"default:false"`
+	ScheduledPlanID    *uuid.UUID   `json:"scheduled_plan_id" gorm:"type:uuid"` // plan change taking effect at the next renewal
+	CancelledAt        *time.Time   `json:"cancelled_at"`
+	SuspendedAt        *time.Time   `json:"suspended_at"`
+}
+
+// MembershipSequence holds the last membership number issued in a year. The
+// row is locked while a number is issued so numbers are never reused.
+type MembershipSequence struct {
+	Year       int `json:"year" gorm:"primaryKey;autoIncrement:false"`
+	LastNumber int `json:"last_number" gorm:"not null;default:0"`
+}
+
+// MembershipPass is a member's digital membership card in Apple or Google
+// Wallet. ChangedAt moves whenever what the card shows changes, so wallets
+// holding it can be told to fetch the new version.
+type MembershipPass struct {
+	Base
+	UserID       uuid.UUID  `json:"user_id" gorm:"type:uuid;uniqueIndex;not null"`
+	SerialNumber string     `json:"serial_number" gorm:"uniqueIndex;not null"`
+	AuthToken    string     `json:"-" gorm:"not null"` // presented by Apple devices fetching updates
+	ChangedAt    time.Time  `json:"changed_at" gorm:"not null"`
+	PushedAt     *time.Time `json:"pushed_at"` // the change wallets were last told about
+}
+
+// PassRegistration is an Apple device that holds a membership pass and wants
+// push notifications when it changes
+type PassRegistration struct {
+	Base
+	PassID          uuid.UUID `json:"pass_id" gorm:"type:uuid;not null;uniqueIndex:idx_pass_device"`
+	DeviceLibraryID string    `json:"device_library_id" gorm:"not null;uniqueIndex:idx_pass_device;index"`
+	PushToken       string    `json:"push_token" gorm:"not null"`
 }
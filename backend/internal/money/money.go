@@ -0,0 +1,223 @@
+// Package money represents monetary amounts exactly. Amounts are integers of
+// minor units (cents); every conversion from a fractional value rounds here,
+// half away from zero, so the rest of the code never rounds on its own.
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Amount is a monetary amount in minor units. It is stored as DECIMAL(10,2)
+// and encoded in JSON as a decimal number, e.g. 12.50.
+type Amount int64
+
+// Zero is the zero amount
+const Zero Amount = 0
+
+// Cents returns the amount of the given number of minor units
+func Cents(cents int64) Amount {
+	return Amount(cents)
+}
+
+// FromFloat converts a decimal value in major units, rounding to the nearest
+// minor unit. Use it only at the edges, e.g. for configuration or ratios.
+func FromFloat(value float64) Amount {
+	return round(value * 100)
+}
+
+// Parse reads a decimal string such as "12.5", "12.50" or "-3"
+func Parse(value string) (Amount, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return Zero, fmt.Errorf("empty amount")
+	}
+
+	negative := strings.HasPrefix(value, "-")
+	digits := value
+	if negative || strings.HasPrefix(value, "+") {
+		digits = value[1:]
+	}
+
+	// Only one sign is allowed, so the parts must be bare digits
+	whole, fraction, _ := strings.Cut(digits, ".")
+	if whole == "" && fraction == "" {
+		return Zero, fmt.Errorf("invalid amount %q", value)
+	}
+	if !allDigits(whole) || !allDigits(fraction) {
+		return Zero, fmt.Errorf("invalid amount %q", value)
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units > (math.MaxInt64-100)/100 {
+		return Zero, fmt.Errorf("amount %q is out of range", value)
+	}
+
+	// Beyond two places, round using the remaining digits
+	cents := units * 100
+	if len(fraction) > 0 {
+		padded := (fraction + "00")[:2]
+		minor, _ := strconv.ParseInt(padded, 10, 64)
+		cents += minor
+		if len(fraction) > 2 && fraction[2] >= '5' {
+			cents++
+		}
+	}
+
+	if negative {
+		cents = -cents
+	}
+	return Amount(cents), nil
+}
+
+// allDigits reports whether s holds only the digits 0-9
+func allDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// round converts a fractional number of minor units to an Amount, half away from zero
+func round(cents float64) Amount {
+	return Amount(math.Round(cents))
+}
+
+// Float64 returns the amount in major units. Use it only for display or
+// ratios, never to compute further amounts.
+func (a Amount) Float64() float64 {
+	return float64(a) / 100
+}
+
+// String formats the amount with two decimal places, e.g. "12.50"
+func (a Amount) String() string {
+	sign := ""
+	cents := int64(a)
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// Mul returns the amount multiplied by a whole quantity
+func (a Amount) Mul(quantity int) Amount {
+	return a * Amount(quantity)
+}
+
+// Div splits the amount into n parts, rounding each to the minor unit
+func (a Amount) Div(n int) Amount {
+	if n == 0 {
+		return Zero
+	}
+	return round(float64(a) / float64(n))
+}
+
+// Percent returns percent of the amount, e.g. Percent(20) is a fifth
+func (a Amount) Percent(percent float64) Amount {
+	return round(float64(a) * percent / 100)
+}
+
+// Scale returns the amount multiplied by a ratio, e.g. the unused part of a period
+func (a Amount) Scale(ratio float64) Amount {
+	return round(float64(a) * ratio)
+}
+
+// Neg returns the negated amount
+func (a Amount) Neg() Amount {
+	return -a
+}
+
+// Min returns the smaller of two amounts
+func Min(a, b Amount) Amount {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Max returns the larger of two amounts
+func Max(a, b Amount) Amount {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// GormDataType matches the DECIMAL(10,2) columns of the SQL migrations
+func (Amount) GormDataType() string {
+	return "decimal(10,2)"
+}
+
+// Value implements driver.Valuer
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+// Scan implements sql.Scanner
+func (a *Amount) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*a = Zero
+		return nil
+	case []byte:
+		return a.scanString(string(v))
+	case string:
+		return a.scanString(v)
+	case int64:
+		*a = Amount(v * 100)
+		return nil
+	case float64:
+		*a = FromFloat(v)
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into money.Amount", value)
+}
+
+func (a *Amount) scanString(value string) error {
+	parsed, err := Parse(value)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// MarshalJSON encodes the amount as a decimal number
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON accepts a decimal number or a string holding one
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		text = string(data)
+	}
+	if text == "null" {
+		*a = Zero
+		return nil
+	}
+	return a.scanString(text)
+}
+
+// currencies are the supported ISO 4217 codes. Amounts are stored with two
+// decimal places, so only currencies with two minor digits are listed.
+var currencies = map[string]bool{
+	"AUD": true, "CAD": true, "CHF": true, "DKK": true, "EUR": true,
+	"GBP": true, "HKD": true, "MXN": true, "NOK": true, "NZD": true,
+	"SEK": true, "SGD": true, "USD": true, "ZAR": true,
+}
+
+// ValidCurrency reports whether code is a supported ISO 4217 currency
+func ValidCurrency(code string) bool {
+	return currencies[code]
+}
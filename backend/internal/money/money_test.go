@@ -0,0 +1,91 @@
+package money
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Amount
+		ok    bool
+	}{
+		{"12.5", 1250, true},
+		{"12.50", 1250, true},
+		{"-3", -300, true},
+		{"+3", 300, true},
+		{".5", 50, true},
+		{"5.", 500, true},
+		{" 7.25 ", 725, true},
+		{"1.005", 101, true},
+		{"1.004", 100, true},
+		{"-1.005", -101, true},
+		{"92233720368547757", 9223372036854775700, true},
+		{"", 0, false},
+		{".", 0, false},
+		{"-", 0, false},
+		{"--5", 0, false},
+		{"+-5", 0, false},
+		{"-+5", 0, false},
+		{"5-", 0, false},
+		{"1.2.3", 0, false},
+		{"1e3", 0, false},
+		{"12,50", 0, false},
+		{"abc", 0, false},
+		{"92233720368547758", 0, false},
+		{"99999999999999999999", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := Parse(tt.value)
+			if (err == nil) != tt.ok {
+				t.Fatalf("Parse(%q) error = %v, want ok = %v", tt.value, err, tt.ok)
+			}
+			if tt.ok && got != tt.want {
+				t.Errorf("Parse(%q) = %d, want %d", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		amount Amount
+		want   string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{1250, "12.50"},
+		{-5, "-0.05"},
+		{-1250, "-12.50"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.amount.String(); got != tt.want {
+			t.Errorf("Amount(%d).String() = %q, want %q", tt.amount, got, tt.want)
+		}
+		if parsed, err := Parse(tt.want); err != nil || parsed != tt.amount {
+			t.Errorf("Parse(%q) = %d, %v; want %d", tt.want, parsed, err, tt.amount)
+		}
+	}
+}
+
+func TestRounding(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Amount
+		want Amount
+	}{
+		{"scale half up", Cents(1001).Scale(0.5), 501},
+		{"scale half away from zero", Cents(-1001).Scale(0.5), -501},
+		{"percent", Cents(1999).Percent(15), 300},
+		{"div", Cents(1000).Div(3), 333},
+		{"div by zero", Cents(1000).Div(0), 0},
+		{"from float", FromFloat(0.1 + 0.2), 30},
+	}
+
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %d, want %d", tt.name, tt.got, tt.want)
+		}
+	}
+}
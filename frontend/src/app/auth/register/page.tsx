@@ -22,7 +22,6 @@ export default function RegisterPage() {
   const [role, setRole] = useState<'member' | 'admin'>('member');
   const [phone, setPhone] = useState('');
   const [address, setAddress] = useState('');
-  const [membershipType, setMembershipType] = useState('');
   const [error, setError] = useState('');
   const [success, setSuccess] = useState('');
   const [isLoading, setIsLoading] = useState(false);
@@ -54,8 +53,7 @@ export default function RegisterPage() {
         password, 
         role,
         phone: phone || undefined,
-        address: address || undefined,
-        membership_type: role === 'member' && membershipType ? membershipType : undefined
+        address: address || undefined
       });
       
       // Show success message briefly before redirect
@@ -197,22 +195,6 @@ export default function RegisterPage() {
                   placeholder="Your phone number"
                 />
               </div>
-              
-              {role === 'member' && (
-                <div className="space-y-2">
-                  <Label htmlFor="membershipType">Membership Type</Label>
-                  <Select value={membershipType} onValueChange={setMembershipType}>
-                    <SelectTrigger>
-                      <SelectValue placeholder="Select membership" />
-                    </SelectTrigger>
-                    <SelectContent>
-                      <SelectItem value="basic">Basic Member</SelectItem>
-                      <SelectItem value="premium">Premium Member</SelectItem>
-                      <SelectItem value="vip">VIP Member</SelectItem>
-                    </SelectContent>
-                  </Select>
-                </div>
-              )}
             </div>
             
             {role === 'member' && (
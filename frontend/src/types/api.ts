@@ -224,7 +224,6 @@ export interface RegisterRequest {
   phone?: string;
   address?: string;
   date_of_birth?: string;
-  membership_type?: string;
 }
 
 export interface LoginResponse {